@@ -0,0 +1,232 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/anaryk/odoo-helpdesk-bridge/internal/attach"
+	"github.com/anaryk/odoo-helpdesk-bridge/internal/config"
+	"github.com/anaryk/odoo-helpdesk-bridge/internal/imap"
+	"github.com/anaryk/odoo-helpdesk-bridge/internal/odoo"
+	"github.com/anaryk/odoo-helpdesk-bridge/internal/s3"
+	"github.com/anaryk/odoo-helpdesk-bridge/internal/scan"
+)
+
+// attachments applies the limits of app.attachments when a mail's files are put on a
+// task: what fits goes to Odoo, oversized files to the object store when one is set.
+// With a scanner configured nothing infected is stored at all.
+type attachments struct {
+	policy  *attach.Policy
+	offload *s3.Client
+	prefix  string
+
+	scanner        scan.Scanner
+	allowUnscanned bool
+
+	original *config.Original
+}
+
+// newAttachments reads app.attachments of a route
+func newAttachments(rc *config.Config) (*attachments, error) {
+	a := &attachments{policy: attach.NewPolicy(rc.App.Attachments), original: rc.App.Attachments.Original}
+	if o := rc.App.Attachments.Offload; o != nil {
+		c, err := s3.New(s3.Config{
+			Endpoint:   o.Endpoint,
+			Region:     o.Region,
+			Bucket:     o.Bucket,
+			AccessKey:  o.AccessKey,
+			SecretKey:  o.SecretKey,
+			PublicURL:  o.PublicURL,
+			LinkExpiry: time.Duration(o.LinkExpiryHours) * time.Hour,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("attachment offload: %w", err)
+		}
+		a.offload, a.prefix = c, o.Prefix
+	}
+	if sc := rc.App.Attachments.Scan; sc != nil {
+		c, err := scan.NewClamd(sc.Clamd, time.Duration(sc.TimeoutSeconds)*time.Second)
+		if err != nil {
+			return nil, fmt.Errorf("attachment scan: %w", err)
+		}
+		a.scanner, a.allowUnscanned = c, sc.AllowUnscanned
+	}
+	return a, nil
+}
+
+// upload stores the mail's attachments on the task and returns the Odoo URLs of
+// inline images by Content-ID, and the infected files as "name (signature)".
+// Files that were not uploaded are listed in a note.
+func (a *attachments) upload(ctx context.Context, oc *odoo.Client, taskID int64, em imap.Email) (map[string]string, []string) {
+	var split attach.Split
+	if a == nil {
+		split.Keep = em.Attachments
+	} else {
+		split = a.policy.Split(em.Attachments)
+	}
+
+	var lines, infected []string
+	if a != nil && a.scanner != nil {
+		var inf, unscanned []string
+		split.Keep, inf, unscanned = a.scan(ctx, taskID, split.Keep)
+		infected, lines = append(infected, inf...), append(lines, unscanned...)
+		split.Oversized, inf, unscanned = a.scan(ctx, taskID, split.Oversized)
+		infected, lines = append(infected, inf...), append(lines, unscanned...)
+	}
+	if len(infected) > 0 {
+		note := "Karanténa příloh: antivirus našel malware, soubory nebyly uloženy:\n" + strings.Join(infected, "\n")
+		if err := oc.MessagePostNote(ctx, taskID, note); err != nil {
+			log.Error().Err(err).Int64("task_id", taskID).Msg("odoo infected attachments note")
+		}
+	}
+
+	urls := uploadAttachments(ctx, oc, taskID, split.Keep)
+	for _, att := range split.Oversized {
+		lines = append(lines, a.offloadLine(ctx, taskID, att))
+	}
+	for _, att := range split.Denied {
+		log.Info().Str("filename", att.Filename).Str("content_type", att.ContentType).Int64("task_id", taskID).Msg("attachment type not allowed")
+		lines = append(lines, fmt.Sprintf("%s (%s) – nepovolený typ souboru", att.Filename, att.ContentType))
+	}
+	for _, att := range em.Skipped {
+		lines = append(lines, fmt.Sprintf("%s (%s) – nestaženo, zůstává v poštovní schránce", att.Filename, formatSize(att.Size)))
+	}
+	if len(lines) > 0 {
+		note := "Přílohy, které nebyly nahrány do Odoo:\n" + strings.Join(lines, "\n")
+		if err := oc.MessagePostNote(ctx, taskID, note); err != nil {
+			log.Error().Err(err).Int64("task_id", taskID).Msg("odoo attachments note")
+		}
+	}
+	return urls, infected
+}
+
+// scan returns the clean files, the infected ones as "name (signature)" and note lines
+// for files the scanner failed on, which are held back unless allow_unscanned is set
+func (a *attachments) scan(ctx context.Context, taskID int64, atts []imap.Attachment) (clean []imap.Attachment, infected, unscanned []string) {
+	for _, att := range atts {
+		res, err := a.scanner.Scan(ctx, att.Filename, bytes.NewReader(att.Data))
+		switch {
+		case err != nil && a.allowUnscanned:
+			log.Warn().Err(err).Str("filename", att.Filename).Int64("task_id", taskID).Msg("attachment scan failed, storing unscanned")
+			clean = append(clean, att)
+		case err != nil:
+			log.Error().Err(err).Str("filename", att.Filename).Int64("task_id", taskID).Msg("attachment scan failed, holding back")
+			unscanned = append(unscanned, fmt.Sprintf("%s (%s) – nepodařilo se zkontrolovat antivirem", att.Filename, formatSize(int64(len(att.Data)))))
+		case res.Infected:
+			log.Warn().Str("filename", att.Filename).Str("signature", res.Signature).Int64("task_id", taskID).Msg("infected attachment held back")
+			infected = append(infected, fmt.Sprintf("%s (%s)", att.Filename, res.Signature))
+		default:
+			clean = append(clean, att)
+		}
+	}
+	return clean, infected, unscanned
+}
+
+// storeOriginal uploads the raw source of the mail to the task and returns its
+// attachment ID for the chatter message; none when app.attachments.original is off,
+// the source is too large or the scanner held it back
+func (a *attachments) storeOriginal(ctx context.Context, oc *odoo.Client, taskID int64, em imap.Email) []int64 {
+	if a == nil || a.original == nil || len(em.Raw) == 0 {
+		return nil
+	}
+	name := "email-" + receivedAt(em).Format("20060102-150405") + ".eml"
+	// The source carries every attachment of the mail, infected ones must not get in this way
+	if a.scanner != nil {
+		if clean, _, _ := a.scan(ctx, taskID, []imap.Attachment{{Filename: name, Data: em.Raw}}); len(clean) == 0 {
+			return nil
+		}
+	}
+
+	contentType, data := "message/rfc822", em.Raw
+	if a.original.Compress {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		if _, err := zw.Write(em.Raw); err != nil || zw.Close() != nil {
+			log.Error().Err(err).Int64("task_id", taskID).Msg("compress original mail")
+			return nil
+		}
+		name, contentType, data = name+".gz", "application/gzip", buf.Bytes()
+	}
+	if limit := int64(a.original.MaxSizeMB) << 20; limit > 0 && int64(len(data)) > limit {
+		log.Info().Str("filename", name).Int("size", len(data)).Int64("task_id", taskID).Msg("original mail over size limit not stored")
+		return nil
+	}
+
+	att, err := oc.UploadAttachment(ctx, taskID, name, contentType, data)
+	if err != nil {
+		log.Error().Err(err).Str("filename", name).Int64("task_id", taskID).Msg("original mail upload failed")
+		return nil
+	}
+	return []int64{att.ID}
+}
+
+// offloadLine stores an oversized file in the object store and describes the result
+func (a *attachments) offloadLine(ctx context.Context, taskID int64, att imap.Attachment) string {
+	size := int64(len(att.Data))
+	if a.offload == nil {
+		log.Info().Str("filename", att.Filename).Int64("size", size).Int64("task_id", taskID).Msg("attachment over size limit dropped")
+		return fmt.Sprintf("%s (%s) – překračuje limit velikosti", att.Filename, formatSize(size))
+	}
+	key := offloadKey(a.prefix, taskID, att)
+	if err := a.offload.Put(ctx, key, att.ContentType, att.Data); err != nil {
+		log.Error().Err(err).Str("filename", att.Filename).Int64("task_id", taskID).Msg("attachment offload failed")
+		return fmt.Sprintf("%s (%s) – překračuje limit velikosti, uložení mimo Odoo selhalo", att.Filename, formatSize(size))
+	}
+	log.Info().Str("filename", att.Filename).Str("key", key).Int64("task_id", taskID).Msg("attachment offloaded")
+	line := fmt.Sprintf("%s (%s): %s", att.Filename, formatSize(size), a.offload.URL(key))
+	if exp := a.offload.LinkExpiry(); exp > 0 {
+		line += fmt.Sprintf(" (odkaz platí do %s)", time.Now().Add(exp).Format("2.1.2006 15:04"))
+	}
+	return line
+}
+
+// offloadKey names the object of an oversized file. The sender picks the filename, so
+// it is cut to a plain basename; the content hash in front of it keeps two files of
+// the same name apart.
+func offloadKey(prefix string, taskID int64, att imap.Attachment) string {
+	sum := sha256.Sum256(att.Data)
+	return fmt.Sprintf("%stask-%d/%x/%s", prefix, taskID, sum[:8], safeFilename(att.Filename))
+}
+
+// safeFilename keeps the last path element of a filename and replaces anything but
+// letters, digits, dots, dashes and underscores
+func safeFilename(name string) string {
+	name = path.Base(strings.ReplaceAll(name, `\`, "/"))
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '.' || r == '-' || r == '_' {
+			return r
+		}
+		return '_'
+	}, name)
+	name = strings.TrimLeft(name, ".")
+	if r := []rune(name); len(r) > maxFilenameRunes {
+		name = string(r[len(r)-maxFilenameRunes:])
+	}
+	if name == "" {
+		return "attachment"
+	}
+	return name
+}
+
+// maxFilenameRunes keeps the end of long filenames, where the extension is
+const maxFilenameRunes = 100
+
+// formatSize prints a file size for the chatter
+func formatSize(n int64) string {
+	switch {
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%d kB", n>>10)
+	}
+	return fmt.Sprintf("%d B", n)
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/anaryk/odoo-helpdesk-bridge/internal/config"
+	"github.com/anaryk/odoo-helpdesk-bridge/internal/flood"
+	"github.com/anaryk/odoo-helpdesk-bridge/internal/imap"
+	"github.com/anaryk/odoo-helpdesk-bridge/internal/ingest"
+	"github.com/anaryk/odoo-helpdesk-bridge/internal/rules"
+	"github.com/anaryk/odoo-helpdesk-bridge/internal/sla"
+	"github.com/anaryk/odoo-helpdesk-bridge/internal/slack"
+	"github.com/anaryk/odoo-helpdesk-bridge/internal/state"
+	"github.com/anaryk/odoo-helpdesk-bridge/internal/templ"
+)
+
+// ingestBatch is how many messages processIncoming gets per round
+const ingestBatch = 50
+
+// runIngest implements "helpdesk-bridge ingest [flags] <path>...". Mail stored in .eml
+// files, mbox archives or Maildir folders goes through processIncoming as if it had
+// arrived in the route's mailbox.
+func runIngest(args []string) error {
+	fs := flag.NewFlagSet("ingest", flag.ContinueOnError)
+	cfgPath := fs.String("config", "config.yaml", "configuration file")
+	routeName := fs.String("route", "", "inbound route the mail belongs to, the first route when empty")
+	noMail := fs.Bool("no-mail", false, "log confirmation mails instead of sending them")
+	noSlack := fs.Bool("no-slack", false, "do not post to Slack")
+	backdate := fs.Bool("backdate-sla", false, "start SLA clocks at the Date header of the mail instead of now")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s ingest [flags] <file.eml|mbox|maildir>...\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return errors.New("no files to ingest")
+	}
+
+	cfg, err := loadConfig(*cfgPath)
+	if err != nil {
+		return fmt.Errorf("load config: %w", err)
+	}
+	rc, err := ingestRoute(cfg, *routeName)
+	if err != nil {
+		return err
+	}
+	reader, err := ingest.Open(fs.Args()...)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = reader.Close() }()
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	st, err := state.New(cfg.App.StatePath)
+	if err != nil {
+		return fmt.Errorf("state: %w", err)
+	}
+	defer func() {
+		if err := st.Close(); err != nil {
+			log.Error().Err(err).Msg("failed to close state store")
+		}
+	}()
+	oc, err := newOdooClient(ctx, cfg)
+	if err != nil {
+		return fmt.Errorf("odoo: %w", err)
+	}
+	m := newMailer(cfg, *noMail)
+	sl := newSlack(rc)
+	if *noSlack {
+		sl = slack.NewWithConfig(slack.Config{})
+	}
+	tm, err := templ.New(rc.TemplatesDirOrDefault())
+	if err != nil {
+		return err
+	}
+	tm.SignTags(rc.App.ReplyAuth.TokenSecret)
+	re, err := rules.New(rc.App.Rules, rc.App.RulesDryRun)
+	if err != nil {
+		return err
+	}
+	files, err := newAttachments(rc)
+	if err != nil {
+		return err
+	}
+	parser, err := imap.NewParser(imapConfig(rc))
+	if err != nil {
+		return err
+	}
+
+	slaHandler := sla.New(rc, oc, sl, st)
+	guard := flood.New(rc, st)
+	box := &fileMailbox{reader: reader, parser: parser, backdate: *backdate}
+	log.Info().Str("route", rc.RouteName).Int("files", reader.Files()).Bool("no_mail", *noMail).Bool("no_slack", *noSlack).Bool("backdate_sla", *backdate).Msg("ingesting mail")
+	for !box.done && ctx.Err() == nil {
+		if err := processIncoming(ctx, rc, box, oc, sl, st, tm, m, slaHandler, re, files, guard); err != nil {
+			return err
+		}
+	}
+	log.Info().Int("messages", box.read).Int("unreadable", box.failed).Msg("ingest finished")
+	return ctx.Err()
+}
+
+// ingestRoute picks the route ingested mail belongs to
+func ingestRoute(cfg *config.Config, name string) (*config.Config, error) {
+	routes := cfg.RouteConfigs()
+	if name == "" {
+		return routes[0], nil
+	}
+	for _, rc := range routes {
+		if rc.RouteName == name {
+			return rc, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown route %q", name)
+}
+
+// fileMailbox feeds messages read from files to processIncoming in batches.
+// Nothing can be flagged or moved, the state store alone remembers what was done.
+type fileMailbox struct {
+	reader   *ingest.Reader
+	parser   *imap.Parser
+	backdate bool
+
+	done         bool
+	read, failed int
+}
+
+// FetchUnseen returns the next batch of messages, empty once all are read
+func (b *fileMailbox) FetchUnseen(_ context.Context) ([]imap.Email, error) {
+	var out []imap.Email
+	for len(out) < ingestBatch {
+		msg, err := b.reader.Next()
+		if errors.Is(err, io.EOF) {
+			b.done = true
+			break
+		}
+		if err != nil {
+			b.done = true
+			return out, err
+		}
+		b.read++
+		em, err := b.parser.Parse(ingestID(msg.Raw), msg.Raw)
+		if err != nil {
+			b.failed++
+			log.Warn().Err(err).Str("source", msg.Source).Msg("skipping unreadable message")
+			continue
+		}
+		if b.backdate && !em.Date.IsZero() {
+			em.Received = em.Date
+		}
+		log.Debug().Str("source", msg.Source).Str("id", em.ID).Str("subject", em.Subject).Msg("read message for ingest")
+		out = append(out, em)
+	}
+	return out, nil
+}
+
+// MarkSeen has nothing to flag. Without Move, quarantined mail is not marked
+// processed and can be ingested again.
+func (b *fileMailbox) MarkSeen(_ context.Context, _ uint32) error { return nil }
+
+// ingestID identifies a message by its content, so ingesting the same file twice
+// does not open a second ticket
+func ingestID(raw []byte) string {
+	sum := sha256.Sum256(raw)
+	return "ingest/" + hex.EncodeToString(sum[:16])
+}
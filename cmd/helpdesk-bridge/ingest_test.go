@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/anaryk/odoo-helpdesk-bridge/internal/config"
+	"github.com/anaryk/odoo-helpdesk-bridge/internal/imap"
+	"github.com/anaryk/odoo-helpdesk-bridge/internal/ingest"
+	"github.com/anaryk/odoo-helpdesk-bridge/internal/pop3"
+)
+
+func TestFileMailbox(t *testing.T) {
+	var mbox strings.Builder
+	for i := 1; i <= ingestBatch+1; i++ {
+		fmt.Fprintf(&mbox, "From customer@example.com Mon Jul  1 10:00:00 2024\n"+
+			"From: customer%d@example.com\n"+
+			"Subject: Ticket %d\n"+
+			"Date: Mon, 01 Jul 2024 10:00:00 +0200\n"+
+			"\n"+
+			"Body %d\n\n", i, i, i)
+	}
+	mbox.WriteString("From broken Mon Jul  1 10:00:00 2024\nSubject: no sender\n\nbody\n")
+	path := filepath.Join(t.TempDir(), "archive.mbox")
+	if err := os.WriteFile(path, []byte(mbox.String()), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	reader, err := ingest.Open(path)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer func() { _ = reader.Close() }()
+	parser, err := imap.NewParser(imap.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	box := &fileMailbox{reader: reader, parser: parser, backdate: true}
+
+	ctx := context.Background()
+	first, err := box.FetchUnseen(ctx)
+	if err != nil || len(first) != ingestBatch || box.done {
+		t.Fatalf("first batch = %d messages, done %v, err %v", len(first), box.done, err)
+	}
+	second, err := box.FetchUnseen(ctx)
+	if err != nil || len(second) != 1 || !box.done {
+		t.Fatalf("second batch = %d messages, done %v, err %v", len(second), box.done, err)
+	}
+	if box.read != ingestBatch+2 || box.failed != 1 {
+		t.Errorf("read %d, failed %d", box.read, box.failed)
+	}
+
+	em := first[0]
+	if em.FromEmail != "customer1@example.com" || em.Subject != "Ticket 1" || !strings.HasPrefix(em.ID, "ingest/") {
+		t.Errorf("first message = %q %q %q", em.ID, em.FromEmail, em.Subject)
+	}
+	if want := time.Date(2024, 7, 1, 8, 0, 0, 0, time.UTC); !em.Received.Equal(want) {
+		t.Errorf("Received = %v, want the Date header %v", em.Received, want)
+	}
+	if first[0].ID == first[1].ID {
+		t.Error("different messages must get different IDs")
+	}
+	if moveMail(ctx, box, 0, "Quarantine") == nil {
+		t.Error("moving ingested mail must fail so quarantined mail is not marked processed")
+	}
+}
+
+func TestMailSourceMover(t *testing.T) {
+	// Only an IMAP folder can take quarantined mail elsewhere
+	for src, want := range map[MailSource]bool{&imap.Client{}: true, &pop3.Client{}: false, &fileMailbox{}: false} {
+		if _, ok := src.(Mover); ok != want {
+			t.Errorf("%T is a Mover: %v, want %v", src, ok, want)
+		}
+	}
+}
+
+func TestIngestRoute(t *testing.T) {
+	cfg := &config.Config{Routes: []config.Route{{Name: "sales"}, {Name: "support"}}}
+	if rc, err := ingestRoute(cfg, ""); err != nil || rc.RouteName != "sales" {
+		t.Errorf("default route = %v, %v", rc, err)
+	}
+	if rc, err := ingestRoute(cfg, "support"); err != nil || rc.RouteName != "support" {
+		t.Errorf("named route = %v, %v", rc, err)
+	}
+	if _, err := ingestRoute(cfg, "billing"); err == nil {
+		t.Error("expected error for unknown route")
+	}
+}
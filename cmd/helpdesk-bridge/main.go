@@ -3,9 +3,11 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"os/signal"
+	"slices"
 	"strings"
 	"syscall"
 	"time"
@@ -15,13 +17,17 @@ import (
 	"github.com/rs/zerolog/log"
 
 	"github.com/anaryk/odoo-helpdesk-bridge/internal/config"
+	"github.com/anaryk/odoo-helpdesk-bridge/internal/flood"
 	"github.com/anaryk/odoo-helpdesk-bridge/internal/imap"
 	"github.com/anaryk/odoo-helpdesk-bridge/internal/mailer"
+	"github.com/anaryk/odoo-helpdesk-bridge/internal/oauth"
 	"github.com/anaryk/odoo-helpdesk-bridge/internal/odoo"
+	"github.com/anaryk/odoo-helpdesk-bridge/internal/rules"
 	"github.com/anaryk/odoo-helpdesk-bridge/internal/sla"
 	"github.com/anaryk/odoo-helpdesk-bridge/internal/slack"
 	"github.com/anaryk/odoo-helpdesk-bridge/internal/state"
 	"github.com/anaryk/odoo-helpdesk-bridge/internal/templ"
+	"github.com/anaryk/odoo-helpdesk-bridge/internal/ticket"
 )
 
 const (
@@ -33,6 +39,9 @@ const (
 
 	// Default operator name for unassigned tickets
 	defaultOperatorName = "Nepřiřazeno"
+
+	// Maximum number of Message-IDs carried in the References header of outgoing mail
+	maxReferences = 20
 )
 
 func main() {
@@ -40,23 +49,22 @@ func main() {
 	zerolog.TimeFieldFormat = zerolog.TimeFormatUnix
 	log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stderr})
 
+	if len(os.Args) > 1 && os.Args[1] == "ingest" {
+		if err := runIngest(os.Args[2:]); err != nil {
+			log.Fatal().Err(err).Msg("ingest")
+		}
+		return
+	}
+
 	cfgPath := "config.yaml"
 	if len(os.Args) > 1 {
 		cfgPath = os.Args[1]
 	}
-	cfg, err := config.Load(cfgPath)
+	cfg, err := loadConfig(cfgPath)
 	if err != nil {
 		log.Fatal().Err(err).Msg("load config")
 	}
 
-	// Configure log level based on debug flag
-	if cfg.App.Debug {
-		zerolog.SetGlobalLevel(zerolog.DebugLevel)
-		log.Debug().Msg("debug logging enabled")
-	} else {
-		zerolog.SetGlobalLevel(zerolog.InfoLevel)
-	}
-
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
@@ -72,74 +80,40 @@ func main() {
 		}
 	}()
 
-	// templates
-	tm, err := templ.New(cfg.TemplatesDirOrDefault())
-	if err != nil {
-		log.Error().Err(err).Msg("failed to initialize templates")
-		return
-	}
-
 	// mailer
-	m := mailer.NewSMTP(mailer.SMTPConfig{
-		Host:      cfg.SMTP.Host,
-		Port:      cfg.SMTP.Port,
-		Username:  cfg.SMTP.Username,
-		Password:  cfg.SMTP.Password,
-		FromName:  cfg.SMTP.FromName,
-		FromEmail: cfg.SMTP.FromEmail,
-		Timeout:   time.Duration(cfg.SMTP.TimeoutSeconds) * time.Second,
-	})
-
-	// slack
-	sl := slack.NewWithConfig(slack.Config{
-		WebhookURL: cfg.Slack.WebhookURL,
-		BotToken:   cfg.Slack.BotToken,
-		ChannelID:  cfg.Slack.ChannelID,
-	})
+	m := newMailer(cfg, false)
 
 	// odoo client
-	oc, err := odoo.NewClient(ctx, odoo.Config{
-		URL:     cfg.Odoo.URL,
-		DB:      cfg.Odoo.DB,
-		User:    cfg.Odoo.Username,
-		Pass:    cfg.Odoo.Password,
-		Timeout: time.Duration(cfg.Odoo.TimeoutSeconds) * time.Second,
-	})
+	oc, err := newOdooClient(ctx, cfg)
 	if err != nil {
 		log.Fatal().Err(err).Msg("odoo") //nolint:gocritic // Log.Fatal is intentionally used for startup failure
 	}
 
-	// imap
-	im, err := imap.New(imap.Config{
-		Host:             cfg.IMAP.Host,
-		Port:             cfg.IMAP.Port,
-		Username:         cfg.IMAP.Username,
-		Password:         cfg.IMAP.Password,
-		Folder:           cfg.IMAP.Folder,
-		SearchTo:         cfg.IMAP.SearchTo,
-		ProcessedKeyword: cfg.IMAP.CustomProcessedFlag,
-	})
-	if err != nil {
-		log.Fatal().Err(err).Msg("imap")
-	}
+	// inbound routes, each with its own mailbox, project, templates and Slack channel
+	var routes []*route
 	defer func() {
-		if err := im.Close(); err != nil {
-			log.Error().Err(err).Msg("failed to close IMAP connection")
+		for _, r := range routes {
+			r.close()
 		}
 	}()
-
-	// sla handler
-	slaHandler := sla.New(cfg, oc, sl, st)
+	for _, rc := range cfg.RouteConfigs() {
+		r, err := newRoute(rc, oc, st, m)
+		if err != nil {
+			log.Error().Err(err).Str("route", rc.RouteName).Msg("failed to initialize route")
+			return
+		}
+		routes = append(routes, r)
+	}
 
 	// prvotní běh
-	if err := processIncoming(ctx, cfg, im, oc, sl, st, tm, m, slaHandler); err != nil {
-		log.Error().Err(err).Msg("initial incoming")
+	for _, r := range routes {
+		r.runIncoming(ctx, "initial incoming")
+		r.runOdoo(ctx)
 	}
-	if err := processOdooEvents(ctx, cfg, oc, st, tm, m, sl); err != nil {
-		log.Error().Err(err).Msg("odoo events")
-	}
-	if err := slaHandler.CheckSLAViolations(ctx); err != nil {
-		log.Error().Err(err).Msg("initial SLA check")
+
+	// IMAP IDLE push mode
+	for _, r := range routes {
+		r.startIdle(ctx)
 	}
 
 	// Create gocron scheduler
@@ -148,23 +122,16 @@ func main() {
 		log.Fatal().Err(err).Msg("scheduler")
 	}
 
-	// Schedule periodic jobs
-	_, err = scheduler.NewJob(
-		gocron.DurationJob(time.Duration(cfg.App.PollSeconds)*time.Second),
-		gocron.NewTask(func() {
-			if err := processIncoming(ctx, cfg, im, oc, sl, st, tm, m, slaHandler); err != nil {
-				log.Error().Err(err).Msg("incoming")
-			}
-			if err := processOdooEvents(ctx, cfg, oc, st, tm, m, sl); err != nil {
-				log.Error().Err(err).Msg("odoo")
-			}
-			if err := slaHandler.CheckSLAViolations(ctx); err != nil {
-				log.Error().Err(err).Msg("SLA check")
-			}
-		}),
-	)
-	if err != nil {
-		log.Fatal().Err(err).Msg("schedule job")
+	// Schedule periodic jobs, one per route so a slow mailbox does not hold up the others
+	for _, r := range routes {
+		_, err = scheduler.NewJob(
+			gocron.DurationJob(time.Duration(cfg.App.PollSeconds)*time.Second),
+			gocron.NewTask(func() { r.poll(ctx) }),
+			gocron.WithName("route "+r.cfg.RouteName),
+		)
+		if err != nil {
+			log.Fatal().Err(err).Str("route", r.cfg.RouteName).Msg("schedule job")
+		}
 	}
 
 	// Start scheduler
@@ -175,7 +142,10 @@ func main() {
 		}
 	}()
 
-	log.Info().Int("poll_seconds", cfg.App.PollSeconds).Msg("helpdesk bridge started")
+	for _, r := range routes {
+		log.Info().Str("route", r.cfg.RouteName).Int("project_id", r.cfg.Odoo.ProjectID).Str("imap_user", r.cfg.IMAP.Username).Str("folder", r.cfg.IMAP.Folder).Str("ticket_prefix", r.cfg.App.TicketPrefix).Bool("imap_idle", r.cfg.IMAP.Idle).Msg("inbound route ready")
+	}
+	log.Info().Int("poll_seconds", cfg.App.PollSeconds).Int("routes", len(routes)).Msg("helpdesk bridge started")
 
 	// Graceful shutdown
 	sig := make(chan os.Signal, 1)
@@ -186,17 +156,90 @@ func main() {
 	cancel()
 }
 
+// loadConfig reads the configuration and sets the log level from its debug flag
+func loadConfig(path string) (*config.Config, error) {
+	cfg, err := config.Load(path)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.App.Debug {
+		zerolog.SetGlobalLevel(zerolog.DebugLevel)
+		log.Debug().Msg("debug logging enabled")
+	} else {
+		zerolog.SetGlobalLevel(zerolog.InfoLevel)
+	}
+	return cfg, nil
+}
+
+// newMailer creates the SMTP client, with suppress it only logs what it would send
+func newMailer(cfg *config.Config, suppress bool) *mailer.SMTPClient {
+	return mailer.NewSMTP(mailer.SMTPConfig{
+		Host:      cfg.SMTP.Host,
+		Port:      cfg.SMTP.Port,
+		Username:  cfg.SMTP.Username,
+		Password:  cfg.SMTP.Password,
+		FromName:  cfg.SMTP.FromName,
+		FromEmail: cfg.SMTP.FromEmail,
+		Timeout:   time.Duration(cfg.SMTP.TimeoutSeconds) * time.Second,
+
+		OAuth:          newTokenSource(cfg.SMTP.OAuth2),
+		OAuthMechanism: oauthMechanism(cfg.SMTP.OAuth2),
+
+		Suppress: suppress,
+	})
+}
+
+// newOdooClient logs in to Odoo
+func newOdooClient(ctx context.Context, cfg *config.Config) (*odoo.Client, error) {
+	return odoo.NewClient(ctx, odoo.Config{
+		URL:      cfg.Odoo.URL,
+		DB:       cfg.Odoo.DB,
+		User:     cfg.Odoo.Username,
+		Pass:     cfg.Odoo.Password,
+		Timeout:  time.Duration(cfg.Odoo.TimeoutSeconds) * time.Second,
+		Protocol: cfg.Odoo.Protocol,
+	})
+}
+
+// MailSource is where processIncoming takes mail from: the IMAP folder or POP3
+// mailbox of a route, or files given to the ingest command. MarkSeen acknowledges a
+// handled message so it is not fetched again.
+type MailSource interface {
+	FetchUnseen(ctx context.Context) ([]imap.Email, error)
+	MarkSeen(ctx context.Context, uid uint32) error
+}
+
+// Mover is a MailSource with folders, quarantined mail can be moved out of the way
+type Mover interface {
+	Move(ctx context.Context, uid uint32, folder string) error
+}
+
+// errNoFolders is returned for a quarantine move on a source that is not a Mover
+var errNoFolders = errors.New("mail source has no folders")
+
+// moveMail moves the message to the folder when the source has folders
+func moveMail(ctx context.Context, im MailSource, uid uint32, folder string) error {
+	mv, ok := im.(Mover)
+	if !ok {
+		return errNoFolders
+	}
+	return mv.Move(ctx, uid, folder)
+}
+
 //nolint:gocyclo // This is the main processing function and complexity is acceptable
 func processIncoming(
 	ctx context.Context,
 	cfg *config.Config,
-	im *imap.Client,
+	im MailSource,
 	oc *odoo.Client,
 	sl *slack.Client,
 	st *state.Store,
 	tm *templ.Engine,
 	m *mailer.SMTPClient,
 	slaHandler *sla.Handler,
+	re *rules.Engine,
+	files *attachments,
+	guard *flood.Guard,
 ) error {
 	msgs, err := im.FetchUnseen(ctx)
 	if err != nil {
@@ -210,6 +253,8 @@ func processIncoming(
 
 		if ok, _ := st.IsProcessedEmail(em.ID); ok {
 			log.Debug().Str("id", em.ID).Msg("email already processed, skipping")
+			// Flag it again so the UID cursor can move past it
+			_ = im.MarkSeen(ctx, em.UID)
 			continue
 		}
 
@@ -221,19 +266,103 @@ func processIncoming(
 			continue
 		}
 
-		taskID, hasTicket := imap.ExtractTicketID(em.Subject, cfg.App.TicketPrefix)
+		// Auto-replies, bounces and our own mail never open tickets, otherwise they loop
+		if em.Class != imap.ClassNormal {
+			handleAutoMail(ctx, cfg, oc, st, em)
+			_ = st.MarkProcessedEmail(em.ID)
+			_ = im.MarkSeen(ctx, em.UID)
+			continue
+		}
+
+		// Spam and mail failing sender authentication stays out of the normal flow
+		quarantined := quarantineReason(cfg, em)
+		if quarantined != "" {
+			log.Warn().Str("id", em.ID).Str("from", em.FromEmail).Str("subject", em.Subject).Str("reason", quarantined).Str("action", cfg.App.Quarantine.Action).Msg("quarantining email")
+			if cfg.App.Quarantine.Action == config.QuarantineFolder {
+				if err := moveMail(ctx, im, em.UID, cfg.App.Quarantine.Folder); err != nil {
+					// Left in the inbox, the next poll tries again
+					log.Error().Err(err).Str("id", em.ID).Str("folder", cfg.App.Quarantine.Folder).Msg("move to quarantine folder")
+					continue
+				}
+				_ = st.MarkProcessedEmail(em.ID)
+				continue
+			}
+		}
+
+		// A person wrote from this address, so it delivers again
+		if quarantined == "" && st.IsEmailBouncing(em.FromEmail) {
+			log.Info().Str("email", em.FromEmail).Msg("address no longer bouncing")
+			_ = st.ClearEmailBouncing(em.FromEmail)
+		}
+
+		taskID, hasTicket := findTaskByThread(cfg, st, em)
 		if hasTicket {
+			log.Debug().Int("task_id", taskID).Str("in_reply_to", em.InReplyTo).Msg("matched reply to existing ticket by message headers")
+		} else if taskID, hasTicket = subjectTicket(cfg, em.Subject); hasTicket {
 			log.Debug().Int("task_id", taskID).Str("subject", em.Subject).Msg("found existing ticket ID in subject")
+		}
 
-			// odpověď zákazníka -> zkontrolovat zda je task uzavřený a znovu ho otevřít
-			taskIDInt64 := int64(taskID)
+		forwarded := forwardedOrigin(cfg, em)
+		// The same mail sent again joins the ticket it repeats while that is open
+		if !hasTicket && forwarded == nil {
+			if id, ok := guard.Duplicate(em.FromEmail, em.Subject, receivedAt(em)); ok && taskOpen(ctx, cfg, oc, id) {
+				log.Info().Int64("task_id", id).Str("from", em.FromEmail).Str("subject", em.Subject).Msg("duplicate mail added to open task")
+				taskID, hasTicket = int(id), true
+			}
+		}
+		if hasTicket && quarantined != "" {
+			// A suspicious reply must not reach the conversation, the agents see it as a note
+			note := fmt.Sprintf("Odpověď v karanténě (%s) od %s: %s\n\n%s", quarantined, em.FromEmail, em.Subject, em.Stripped)
+			if err := oc.MessagePostNote(ctx, int64(taskID), note); err != nil {
+				log.Error().Err(err).Int("task_id", taskID).Msg("odoo quarantine note")
+			}
+			_ = st.MarkProcessedEmail(em.ID)
+			_ = im.MarkSeen(ctx, em.UID)
+			continue
+		}
 
+		// Only people who belong to the ticket may write into it
+		if hasTicket && cfg.App.ReplyAuth.Policy != "" && !replyAuthorized(ctx, cfg, oc, st, int64(taskID), em.FromEmail) {
+			log.Warn().Int("task_id", taskID).Str("from", em.FromEmail).Str("subject", em.Subject).Str("policy", cfg.App.ReplyAuth.Policy).Msg("reply from sender outside the ticket")
+			switch cfg.App.ReplyAuth.Policy {
+			case config.ReplyAuthQuarantine:
+				if err := moveMail(ctx, im, em.UID, cfg.App.Quarantine.Folder); err != nil {
+					log.Error().Err(err).Str("id", em.ID).Str("folder", cfg.App.Quarantine.Folder).Msg("move to quarantine folder")
+					continue
+				}
+				_ = st.MarkProcessedEmail(em.ID)
+				continue
+			case config.ReplyAuthNote:
+				note := fmt.Sprintf("Odpověď od odesílatele mimo požadavek (%s): %s\n\n%s", em.FromEmail, em.Subject, em.Stripped)
+				if err := oc.MessagePostNote(ctx, int64(taskID), note); err != nil {
+					log.Error().Err(err).Int("task_id", taskID).Msg("odoo unauthorized reply note")
+				}
+				_ = st.MarkProcessedEmail(em.ID)
+				_ = im.MarkSeen(ctx, em.UID)
+				continue
+			default:
+				hasTicket = false
+			}
+		}
+		// odpověď zákazníka -> zkontrolovat zda je task uzavřený a znovu ho otevřít
+		var wasReopened bool
+		var reopenErr error
+		if hasTicket {
 			// Check if task is closed and reopen if necessary
 			log.Debug().Int("task_id", taskID).Msg("checking if task needs to be reopened")
-			wasReopened, err := oc.ReopenTask(ctx, taskIDInt64, cfg.Odoo.Stages.New)
+			wasReopened, reopenErr = oc.ReopenTask(ctx, int64(taskID), cfg.Odoo.Stages.New)
+			if errors.Is(reopenErr, odoo.ErrMissing) {
+				// The task was deleted in Odoo, the reply opens a new ticket instead
+				log.Warn().Int("task_id", taskID).Str("from", em.FromEmail).Msg("ticket no longer exists in odoo, opening a new one")
+				hasTicket = false
+			}
+		}
+		if hasTicket {
+			taskIDInt64 := int64(taskID)
+
 			//nolint:gocritic // if-else chain is clearer than switch for this error handling pattern
-			if err != nil {
-				log.Error().Err(err).Int("task_id", taskID).Msg("failed to reopen task")
+			if reopenErr != nil {
+				log.Error().Err(reopenErr).Int("task_id", taskID).Msg("failed to reopen task")
 				// Continue processing even if reopen fails
 			} else if wasReopened {
 				log.Info().Int("task_id", taskID).Msg("task was reopened from closed state")
@@ -252,6 +381,7 @@ func processIncoming(
 
 				// Update Slack message and notify in thread about task reopening
 				if slackInfo, err := st.GetSlackMessage(taskIDInt64); err == nil && slackInfo != nil {
+					sl := slackFor(sl, slackInfo)
 					slackMsg := &slack.Message{
 						Timestamp: slackInfo.Timestamp,
 						Channel:   slackInfo.Channel,
@@ -280,7 +410,7 @@ func processIncoming(
 			}
 
 			// přidat komentář
-			body := imap.CleanBody(em.Body)
+			body := em.Stripped
 			if body == "" {
 				body = "(empty message)"
 			}
@@ -294,25 +424,32 @@ func processIncoming(
 				log.Debug().Int64("partner_id", partnerID).Str("email", em.FromEmail).Msg("found or created partner")
 			}
 
-			if err := oc.MessagePostCustomer(ctx, taskIDInt64, partnerID, body); err != nil {
-				log.Error().Err(err).Int("task_id", taskID).Msg("odoo message_post")
-			} else {
-				log.Debug().Int("task_id", taskID).Msg("customer reply posted successfully")
-			}
+			// Attachments go first so the HTML body can point at inline images
+			cidURLs, infected := files.upload(ctx, oc, taskIDInt64, em)
+			warnInfected(sl, st, taskIDInt64, infected)
+			original := files.storeOriginal(ctx, oc, taskIDInt64, em)
 
-			// Upload attachments for customer reply if any
-			if len(em.Attachments) > 0 {
-				log.Debug().Int("count", len(em.Attachments)).Int("task_id", taskID).Msg("processing reply attachments")
-				for _, att := range em.Attachments {
-					log.Debug().Str("filename", att.Filename).Str("content_type", att.ContentType).Int("size", len(att.Data)).Msg("uploading attachment")
-					_, err := oc.UploadAttachment(ctx, int64(taskID), att.Filename, att.ContentType, att.Data)
-					if err != nil {
-						log.Error().Err(err).Str("filename", att.Filename).Int("task_id", taskID).Msg("reply attachment upload failed")
-					} else {
-						log.Debug().Str("filename", att.Filename).Int("task_id", taskID).Msg("reply attachment uploaded successfully")
-					}
+			postedHTML := false
+			if html := htmlBody(cfg, em); html != "" {
+				if err := oc.MessagePostCustomerHTML(ctx, taskIDInt64, partnerID, imap.ReplaceCIDs(html, cidURLs), original...); err != nil {
+					log.Warn().Err(err).Int("task_id", taskID).Msg("odoo message_post html, falling back to plain text")
+				} else {
+					postedHTML = true
+					log.Debug().Int("task_id", taskID).Msg("customer reply posted as html")
 				}
 			}
+			if !postedHTML {
+				if err := oc.MessagePostCustomer(ctx, taskIDInt64, partnerID, body, original...); err != nil {
+					log.Error().Err(err).Int("task_id", taskID).Msg("odoo message_post")
+				} else {
+					log.Debug().Int("task_id", taskID).Msg("customer reply posted successfully")
+				}
+			}
+
+			if err := st.StoreMessageID(taskIDInt64, em.MessageID); err != nil {
+				log.Error().Err(err).Int("task_id", taskID).Msg("store message id")
+			}
+			addParticipants(ctx, oc, st, taskIDInt64, mailParticipants(cfg, em))
 
 			_ = st.MarkProcessedEmail(em.ID)
 			_ = im.MarkSeen(ctx, em.UID)
@@ -320,8 +457,24 @@ func processIncoming(
 		}
 
 		// nový ticket
+		// Mail an operator forwarded belongs to the original sender, the operator goes to the chatter
+		var forwardedBy *imap.Email
+		if fw := forwarded; fw != nil {
+			log.Info().Str("operator", em.FromEmail).Str("customer", fw.FromEmail).Bool("attached", fw.Attached).Msg("forwarded mail, using original sender as customer")
+			operator := em
+			forwardedBy = &operator
+			em = forwardedTicket(em, fw)
+		}
 		log.Debug().Str("from", em.FromEmail).Str("subject", em.Subject).Msg("creating new ticket")
 
+		// A sender over its limit opens no more tickets, the mail goes to its latest one
+		if v := guard.Check(em.FromEmail, receivedAt(em)); v.Throttled && v.TaskID != 0 {
+			addThrottled(ctx, cfg, oc, sl, files, em, v, guard.Window())
+			_ = st.MarkProcessedEmail(em.ID)
+			_ = im.MarkSeen(ctx, em.UID)
+			continue
+		}
+
 		title := em.Subject
 		if title == "" {
 			title = "Nový požadavek"
@@ -329,12 +482,12 @@ func processIncoming(
 
 		// Debug original body content
 		log.Debug().Int("original_body_length", len(em.Body)).Str("original_body_preview", truncateString(em.Body, previewLength)).Msg("original email body")
-		desc := imap.CleanBody(em.Body)
+		desc := em.Stripped
 		log.Debug().Int("cleaned_body_length", len(desc)).Str("cleaned_body_preview", truncateString(desc, previewLength)).Msg("cleaned email body")
 
 		if desc == "" && len(em.Body) > 0 {
-			log.Debug().Msg("CleanBody returned empty string, using original body")
-			desc = em.Body // Use original body if CleanBody returns empty
+			log.Debug().Msg("stripped body is empty, using original body")
+			desc = em.Body // Use original body if stripping left nothing
 		}
 
 		log.Debug().Int("final_desc_length", len(desc)).Str("final_desc_preview", truncateString(desc, previewLength)).Msg("final description for task creation")
@@ -346,12 +499,45 @@ func processIncoming(
 			log.Debug().Int64("partner_id", partnerID).Str("email", em.FromEmail).Msg("found or created partner for new ticket")
 		}
 
+		// Routing rules may send the ticket elsewhere and change how it is handled
+		var decision rules.Decision
+		if quarantined == "" {
+			decision = re.Decide(em)
+		}
+		projectID, stageID := int64(cfg.Odoo.ProjectID), cfg.Odoo.Stages.New
+		if decision.ProjectID != 0 {
+			projectID = decision.ProjectID
+		}
+		if decision.StageID != 0 {
+			stageID = decision.StageID
+		}
+		if quarantined != "" {
+			stageID = cfg.App.Quarantine.StageID
+		}
+		var tagIDs []int64
+		if len(decision.Tags) > 0 {
+			ids, err := oc.FindOrCreateTags(ctx, decision.Tags)
+			if err != nil {
+				log.Error().Err(err).Strs("tags", decision.Tags).Msg("odoo tags")
+			}
+			tagIDs = ids
+		}
+
+		// The HTML body replaces the plain text description, Slack and the confirmation keep plain text
+		taskDesc := desc
+		html := htmlBody(cfg, em)
+		if html != "" {
+			taskDesc = html
+		}
+
 		taskID64, err := oc.CreateTask(ctx, odoo.CreateTaskInput{
-			ProjectID:         int64(cfg.Odoo.ProjectID),
+			ProjectID:         projectID,
 			Name:              title,
-			Description:       desc,
+			Description:       taskDesc,
 			CustomerPartnerID: partnerID,
-			StageID:           cfg.Odoo.Stages.New, // Start in "Nové" stage
+			StageID:           stageID, // Start in "Nové" stage unless a rule says otherwise
+			TagIDs:            tagIDs,
+			Priority:          decision.Priority,
 		})
 		if err != nil {
 			log.Error().Err(err).Str("title", title).Msg("odoo create task")
@@ -362,24 +548,64 @@ func processIncoming(
 
 		log.Debug().Int("task_id", newTaskID).Str("url", taskURL).Msg("new task created successfully")
 
-		// Upload attachments if any
-		if len(em.Attachments) > 0 {
-			log.Info().Int("count", len(em.Attachments)).Int64("task_id", taskID64).Msg("uploading attachments")
-			for _, att := range em.Attachments {
-				_, err := oc.UploadAttachment(ctx, taskID64, att.Filename, att.ContentType, att.Data)
-				if err != nil {
-					log.Error().Err(err).Str("filename", att.Filename).Int64("task_id", taskID64).Msg("attachment upload failed")
-				} else {
-					log.Info().Str("filename", att.Filename).Int64("task_id", taskID64).Msg("attachment uploaded")
-				}
+		if err := st.StoreMessageID(taskID64, em.MessageID); err != nil {
+			log.Error().Err(err).Int("task_id", newTaskID).Msg("store message id")
+		}
+		guard.Record(em.FromEmail, em.Subject, taskID64, receivedAt(em))
+		if quarantined == "" {
+			addParticipants(ctx, oc, st, taskID64, mailParticipants(cfg, em))
+		}
+		if forwardedBy != nil {
+			if err := oc.MessagePostNote(ctx, taskID64, forwardNote(*forwardedBy)); err != nil {
+				log.Error().Err(err).Int64("task_id", taskID64).Msg("odoo forward note")
+			}
+		}
+
+		// Upload attachments, then point inline images of the description at them
+		cidURLs, infected := files.upload(ctx, oc, taskID64, em)
+		if html != "" && len(imap.CIDs(html)) > 0 {
+			if err := oc.SetTaskDescription(ctx, taskID64, imap.ReplaceCIDs(html, cidURLs)); err != nil {
+				log.Error().Err(err).Int64("task_id", taskID64).Msg("odoo update description")
+			}
+		}
+		if original := files.storeOriginal(ctx, oc, taskID64, em); len(original) > 0 {
+			if err := oc.MessagePostNote(ctx, taskID64, "Původní e-mail", original...); err != nil {
+				log.Error().Err(err).Int64("task_id", taskID64).Msg("odoo original mail note")
 			}
 		}
 
-		// Automatic assignment to operator with least tasks
+		// Quarantined tickets stay quiet: no assignment, no @channel, no SLA and no confirmation
+		if quarantined != "" {
+			if err := oc.MessagePostNote(ctx, taskID64, "Karanténa: "+quarantined); err != nil {
+				log.Error().Err(err).Int64("task_id", taskID64).Msg("odoo quarantine note")
+			}
+			qmsg, err := sl.NotifyQuarantinedTask(newTaskID, title, taskURL, quarantined)
+			if err != nil {
+				log.Error().Err(err).Int("task_id", newTaskID).Msg("slack notify quarantine")
+			}
+			if err := sl.NotifyInfectedAttachments(qmsg, newTaskID, infected); err != nil {
+				log.Error().Err(err).Int("task_id", newTaskID).Msg("slack notify infected attachments")
+			}
+			_ = st.MarkProcessedEmail(em.ID)
+			_ = im.MarkSeen(ctx, em.UID)
+			continue
+		}
+
+		// Automatic assignment to operator with least tasks, a rule may name the assignee or team
+		operators := cfg.App.Operators
+		if decision.Assignee != "" {
+			operators = []string{decision.Assignee}
+		} else if len(decision.Team) > 0 {
+			operators = decision.Team
+		}
+		assignedStage := cfg.Odoo.Stages.Assigned
+		if decision.StageID != 0 {
+			assignedStage = 0 // keep the stage the rule chose
+		}
 		assignedOperator := ""
-		if len(cfg.App.Operators) > 0 {
+		if len(operators) > 0 {
 			var err error
-			assignedOperator, err = assignTaskToOperator(ctx, oc, taskID64, cfg)
+			assignedOperator, err = assignLeastLoaded(ctx, oc, taskID64, projectID, operators, assignedStage)
 			if err != nil {
 				log.Error().Err(err).Int64("task_id", taskID64).Msg("auto assignment failed")
 				assignedOperator = defaultOperatorName // Fallback message
@@ -391,35 +617,52 @@ func processIncoming(
 		}
 
 		// Slack
-		slackMsg, err := sl.NotifyNewTask(newTaskID, title, taskURL, desc, assignedOperator)
+		tsl := sl
+		if decision.SlackChannel != "" {
+			tsl = sl.WithChannel(decision.SlackChannel)
+		}
+		slackMsg, err := tsl.NotifyNewTask(newTaskID, title, taskURL, desc, assignedOperator)
 		if err != nil {
 			log.Error().Err(err).Int("task_id", newTaskID).Msg("slack notify")
 		} else if slackMsg != nil {
 			// Store Slack message info for threading
 			_ = st.StoreSlackMessage(taskID64, state.SlackMessageInfo{
-				Timestamp: slackMsg.Timestamp,
-				Channel:   slackMsg.Channel,
+				Timestamp:   slackMsg.Timestamp,
+				Channel:     slackMsg.Channel,
+				RuleChannel: decision.SlackChannel,
 			})
 
 			// Notify about task assignment in thread if operator was assigned
 			if assignedOperator != "" && assignedOperator != defaultOperatorName && assignedOperator != "Žádný operátor k dispozici" {
-				if err := sl.NotifyTaskAssigned(slackMsg, newTaskID, assignedOperator); err != nil {
+				if err := tsl.NotifyTaskAssigned(slackMsg, newTaskID, assignedOperator); err != nil {
 					log.Error().Err(err).Int("task_id", newTaskID).Msg("slack notify task assigned")
 				}
 			}
+			if err := tsl.NotifyInfectedAttachments(slackMsg, newTaskID, infected); err != nil {
+				log.Error().Err(err).Int("task_id", newTaskID).Msg("slack notify infected attachments")
+			}
 		}
 
-		// Initialize SLA tracking
-		_ = slaHandler.InitializeTask(taskID64)
+		// Initialize SLA tracking, ingested mail may start the clocks when it was sent
+		if em.Received.IsZero() {
+			_ = slaHandler.InitializeTask(taskID64)
+		} else {
+			_ = slaHandler.InitializeTaskAt(taskID64, em.Received)
+		}
 
 		// potvrzení zákazníkovi (skip for no-reply emails like AI bots)
-		if isNoReplyEmail(em.FromEmail, cfg.App.NoReplyEmails) {
+		if decision.NoConfirmation {
+			log.Info().Str("email", em.FromEmail).Int("task_id", newTaskID).Str("rule", decision.Rule).Msg("confirmation email suppressed by routing rule")
+		} else if isNoReplyEmail(em.FromEmail, cfg.App.NoReplyEmails) {
 			log.Info().Str("email", em.FromEmail).Int("task_id", newTaskID).Msg("skipping confirmation email for no-reply address")
 		} else {
 			subj, body, err := tm.RenderNewTicket(cfg.App.TicketPrefix, newTaskID, em.FromName, desc, cfg.App.SLA.StartTimeHours, cfg.App.SLA.ResolutionTimeHours)
 			if err == nil {
-				if err := m.Send(em.FromEmail, subj, body); err != nil {
+				thread := taskThread(st, m, cfg.App.TicketPrefix, cfg.App.ReplyAuth.TokenSecret, taskID64, "new", 0)
+				if err := m.Send(em.FromEmail, subj, body, thread); err != nil {
 					log.Error().Err(err).Str("email", em.FromEmail).Msg("send confirm")
+				} else {
+					recordSentMessageID(st, taskID64, thread)
 				}
 			} else {
 				log.Error().Err(err).Int("task_id", newTaskID).Msg("tmpl")
@@ -442,7 +685,7 @@ func processOdooPublicMessages(
 	m *mailer.SMTPClient,
 ) error {
 	log.Debug().Msg("processOdooPublicMessages: starting")
-	lastTS := st.GetLastOdooMessageTime()
+	lastTS := st.GetLastOdooMessageTimeForProject(int64(cfg.Odoo.ProjectID))
 	msgs, err := oc.ListTaskMessagesSince(ctx, int64(cfg.Odoo.ProjectID), lastTS)
 	if err != nil {
 		log.Error().Err(err).Msg("processOdooPublicMessages: ListTaskMessagesSince failed")
@@ -479,6 +722,11 @@ func processOdooPublicMessages(
 			_ = st.MarkOdooMessageSent(mm.ID) // Mark as sent to prevent reprocessing
 			continue
 		}
+		if st.IsEmailBouncing(task.CustomerEmail) {
+			log.Warn().Int64("msg_id", mm.ID).Int64("task_id", task.ID).Str("email", task.CustomerEmail).Msg("processOdooPublicMessages: skipping reply to bouncing address")
+			_ = st.MarkOdooMessageSent(mm.ID)
+			continue
+		}
 
 		subj, body, err := tm.RenderAgentReply(cfg.App.TicketPrefix, int(task.ID), task.Name, task.CustomerName, mm.BodyWithoutPrefix)
 		if err != nil {
@@ -494,27 +742,35 @@ func processOdooPublicMessages(
 
 		log.Info().Int64("msg_id", mm.ID).Int64("task_id", mm.TaskID).Str("customer_email", task.CustomerEmail).Int("attachments", len(attachments)).Msg("processOdooPublicMessages: sending agent reply email")
 
+		thread := taskThread(st, m, cfg.App.TicketPrefix, cfg.App.ReplyAuth.TokenSecret, task.ID, "reply", mm.ID)
+		thread.Cc = replyCc(cfg, st, task.ID, task.CustomerEmail)
+		if len(thread.Cc) > 0 {
+			log.Debug().Int64("task_id", task.ID).Strs("cc", thread.Cc).Msg("processOdooPublicMessages: keeping participants in copy")
+		}
+
 		// Send email with attachments if any
 		if len(attachments) > 0 {
 			log.Debug().Int64("msg_id", mm.ID).Str("subject", subj).Msg("processOdooPublicMessages: sending email with attachments")
-			if err := sendEmailWithAttachments(ctx, m, oc, task.CustomerEmail, subj, body, attachments); err != nil {
+			if err := sendEmailWithAttachments(ctx, m, oc, task.CustomerEmail, subj, body, attachments, thread); err != nil {
 				log.Error().Err(err).Str("email", task.CustomerEmail).Msg("send agent reply with attachments")
 			} else {
 				log.Info().Int64("msg_id", mm.ID).Str("email", task.CustomerEmail).Msg("processOdooPublicMessages: email with attachments sent successfully")
 				_ = st.MarkOdooMessageSent(mm.ID)
+				recordSentMessageID(st, task.ID, thread)
 			}
 		} else {
 			log.Debug().Int64("msg_id", mm.ID).Str("subject", subj).Msg("processOdooPublicMessages: sending plain email")
-			if err := m.Send(task.CustomerEmail, subj, body); err != nil {
+			if err := m.Send(task.CustomerEmail, subj, body, thread); err != nil {
 				log.Error().Err(err).Str("email", task.CustomerEmail).Msg("send agent")
 			} else {
 				log.Info().Int64("msg_id", mm.ID).Str("email", task.CustomerEmail).Msg("processOdooPublicMessages: email sent successfully")
 				_ = st.MarkOdooMessageSent(mm.ID)
+				recordSentMessageID(st, task.ID, thread)
 			}
 		}
 	}
 	if maxSeen.After(lastTS) {
-		_ = st.SetLastOdooMessageTime(maxSeen)
+		_ = st.SetLastOdooMessageTimeForProject(int64(cfg.Odoo.ProjectID), maxSeen)
 	}
 	return nil
 }
@@ -576,6 +832,8 @@ func processCompletedTasks(
 		// Skip sending email to no-reply addresses (like AI bots)
 		if isNoReplyEmail(t.CustomerEmail, cfg.App.NoReplyEmails) {
 			log.Info().Int64("task_id", t.ID).Str("email", t.CustomerEmail).Msg("processCompletedTasks: skipping completion email for no-reply address")
+		} else if st.IsEmailBouncing(t.CustomerEmail) {
+			log.Warn().Int64("task_id", t.ID).Str("email", t.CustomerEmail).Msg("processCompletedTasks: skipping completion email for bouncing address")
 		} else {
 			log.Info().Int64("task_id", t.ID).Str("customer_email", t.CustomerEmail).Msg("processCompletedTasks: sending completion email")
 
@@ -586,10 +844,14 @@ func processCompletedTasks(
 			} else {
 				log.Debug().Int64("task_id", t.ID).Str("subject", subj).Msg("processCompletedTasks: sending email")
 
-				if err := m.Send(t.CustomerEmail, subj, body); err != nil {
+				// A task can be closed again after reopening, number each closure by the thread length
+				ids, _ := st.GetTaskMessageIDs(t.ID)
+				thread := taskThread(st, m, cfg.App.TicketPrefix, cfg.App.ReplyAuth.TokenSecret, t.ID, "closed", int64(len(ids)))
+				if err := m.Send(t.CustomerEmail, subj, body, thread); err != nil {
 					log.Error().Err(err).Str("email", t.CustomerEmail).Msg("send close")
 				} else {
 					log.Info().Int64("task_id", t.ID).Str("email", t.CustomerEmail).Msg("processCompletedTasks: email sent successfully")
+					recordSentMessageID(st, t.ID, thread)
 				}
 			}
 		}
@@ -602,6 +864,7 @@ func processCompletedTasks(
 
 		// Update Slack message and notify in thread about task completion
 		if parentMsg, err := st.GetSlackMessage(t.ID); err == nil && parentMsg != nil {
+			sl := slackFor(sl, parentMsg)
 			slackMsg := &slack.Message{
 				Timestamp: parentMsg.Timestamp,
 				Channel:   parentMsg.Channel,
@@ -677,6 +940,7 @@ func processReopenedTasks(
 
 		// Update Slack message and notify in thread about task reopening
 		if parentMsg, err := st.GetSlackMessage(t.ID); err == nil && parentMsg != nil {
+			sl := slackFor(sl, parentMsg)
 			slackMsg := &slack.Message{
 				Timestamp: parentMsg.Timestamp,
 				Channel:   parentMsg.Channel,
@@ -798,10 +1062,16 @@ func matchEmailPattern(email string, patterns []string) bool {
 
 // assignTaskToOperator assigns task to operator with fewest assigned tasks (round-robin)
 func assignTaskToOperator(ctx context.Context, oc *odoo.Client, taskID int64, cfg *config.Config) (string, error) {
-	log.Debug().Int64("task_id", taskID).Strs("operators", cfg.App.Operators).Msg("starting operator assignment")
+	return assignLeastLoaded(ctx, oc, taskID, int64(cfg.Odoo.ProjectID), cfg.App.Operators, cfg.Odoo.Stages.Assigned)
+}
+
+// assignLeastLoaded assigns the task to whoever of operators has the fewest tasks in the
+// project and moves it to assignedStage, the stage is left alone when that is 0
+func assignLeastLoaded(ctx context.Context, oc *odoo.Client, taskID, projectID int64, operators []string, assignedStage int64) (string, error) {
+	log.Debug().Int64("task_id", taskID).Strs("operators", operators).Msg("starting operator assignment")
 
 	// Get task counts for all operators
-	counts, err := oc.GetTaskCounts(ctx, int64(cfg.Odoo.ProjectID), cfg.App.Operators)
+	counts, err := oc.GetTaskCounts(ctx, projectID, operators)
 	if err != nil {
 		log.Error().Err(err).Int64("task_id", taskID).Msg("failed to get task counts")
 		return "", err
@@ -810,7 +1080,7 @@ func assignTaskToOperator(ctx context.Context, oc *odoo.Client, taskID int64, cf
 	// Find operator with minimum tasks
 	minCount := -1
 	selectedOperator := ""
-	for _, operator := range cfg.App.Operators {
+	for _, operator := range operators {
 		count := counts[operator]
 		log.Debug().Str("operator", operator).Int("count", count).Msg("operator task count")
 		if minCount == -1 || count < minCount {
@@ -832,9 +1102,10 @@ func assignTaskToOperator(ctx context.Context, oc *odoo.Client, taskID int64, cf
 	}
 
 	// Move task to "Přiřazeno" stage
-	err = oc.SetTaskStage(ctx, taskID, cfg.Odoo.Stages.Assigned)
-	if err != nil {
-		return "", err
+	if assignedStage != 0 {
+		if err := oc.SetTaskStage(ctx, taskID, assignedStage); err != nil {
+			return "", err
+		}
 	}
 
 	return selectedOperator, nil
@@ -847,9 +1118,10 @@ func sendEmailWithAttachments(
 	oc *odoo.Client,
 	to, subject, body string,
 	odooAttachments []odoo.Attachment,
+	thread *mailer.Thread,
 ) error {
 	if len(odooAttachments) == 0 {
-		return m.Send(to, subject, body)
+		return m.Send(to, subject, body, thread)
 	}
 
 	var attachments []mailer.Attachment
@@ -868,7 +1140,466 @@ func sendEmailWithAttachments(
 		})
 	}
 
-	return m.SendWithAttachments(to, subject, body, attachments)
+	return m.SendWithAttachments(to, subject, body, attachments, thread)
+}
+
+// newTokenSource returns the OAuth2 token source of a mailbox, nil when it logs in with a password
+func newTokenSource(o *config.OAuth2) *oauth.TokenSource {
+	if o == nil {
+		return nil
+	}
+	return oauth.NewTokenSource(oauth.Config{
+		TokenURL:     o.TokenURL,
+		ClientID:     o.ClientID,
+		ClientSecret: o.ClientSecret,
+		RefreshToken: o.RefreshToken,
+		Scopes:       o.Scopes,
+	})
+}
+
+// oauthMechanism returns the configured SASL mechanism name
+func oauthMechanism(o *config.OAuth2) string {
+	if o == nil {
+		return ""
+	}
+	return strings.ToUpper(strings.TrimSpace(o.Mechanism))
+}
+
+// uploadAttachments stores the mail attachments on the task and returns the
+// Odoo URLs of the inline ones keyed by Content-ID
+func uploadAttachments(ctx context.Context, oc *odoo.Client, taskID int64, atts []imap.Attachment) map[string]string {
+	urls := make(map[string]string)
+	if len(atts) == 0 {
+		return urls
+	}
+	log.Info().Int("count", len(atts)).Int64("task_id", taskID).Msg("uploading attachments")
+	for _, att := range atts {
+		log.Debug().Str("filename", att.Filename).Str("content_type", att.ContentType).Int("size", len(att.Data)).Msg("uploading attachment")
+		a, err := oc.UploadAttachment(ctx, taskID, att.Filename, att.ContentType, att.Data)
+		if err != nil {
+			log.Error().Err(err).Str("filename", att.Filename).Int64("task_id", taskID).Msg("attachment upload failed")
+			continue
+		}
+		log.Info().Str("filename", att.Filename).Int64("task_id", taskID).Msg("attachment uploaded")
+		if att.ContentID != "" && a != nil {
+			urls[att.ContentID] = fmt.Sprintf("/web/content/%d", a.ID)
+		}
+	}
+	return urls
+}
+
+// htmlBody returns the sanitized HTML of the mail when the route keeps HTML bodies
+func htmlBody(cfg *config.Config, em imap.Email) string {
+	if !cfg.App.KeepHTML {
+		return ""
+	}
+	return em.HTMLBody
+}
+
+// quarantineReason explains why the mail goes to quarantine, empty when it does not
+func quarantineReason(cfg *config.Config, em imap.Email) string {
+	q := cfg.App.Quarantine
+	if q.Action == "" {
+		return ""
+	}
+	if em.Spam.Flagged {
+		return "flagged as spam"
+	}
+	if q.SpamScore > 0 && em.Spam.Scored && em.Spam.Score >= q.SpamScore {
+		return fmt.Sprintf("spam score %.1f", em.Spam.Score)
+	}
+	for _, check := range q.AuthFail {
+		var result string
+		switch strings.ToLower(check) {
+		case "spf":
+			result = em.Auth.SPF
+		case "dkim":
+			result = em.Auth.DKIM
+		case "dmarc":
+			result = em.Auth.DMARC
+		}
+		if result == "fail" {
+			return strings.ToLower(check) + "=fail"
+		}
+	}
+	return ""
+}
+
+// forwardedOrigin returns the original mail an operator forwarded into the helpdesk, either
+// attached as message/rfc822 or quoted in a forward block. Mail from anyone else is kept
+// as it is, a customer attaching an old mail stays the customer. The From header is easy
+// to forge, so the operator's mail must pass sender authentication unless
+// app.trust_operator_forwards is set; otherwise anyone could open tickets in a
+// customer's name.
+func forwardedOrigin(cfg *config.Config, em imap.Email) *imap.Forwarded {
+	fw := em.Forwarded
+	if fw == nil || fw.FromEmail == "" || strings.EqualFold(fw.FromEmail, em.FromEmail) {
+		return nil
+	}
+	if !matchEmailPattern(em.FromEmail, cfg.App.Operators) {
+		return nil
+	}
+	if !cfg.App.TrustOperatorForwards && !senderAuthenticated(em) {
+		log.Warn().Str("operator", em.FromEmail).Str("customer", fw.FromEmail).Str("spf", em.Auth.SPF).Str("dkim", em.Auth.DKIM).Str("dmarc", em.Auth.DMARC).
+			Msg("forward from an operator address without passing sender authentication, keeping the sender")
+		return nil
+	}
+	return fw
+}
+
+// senderAuthenticated reports whether the receiving server vouched for the From
+// address: a DMARC pass, or a valid DKIM signature of the From domain. SPF alone only
+// covers the envelope sender, and anyone can sign with a domain of their own.
+func senderAuthenticated(em imap.Email) bool {
+	if em.Auth.DMARC == "pass" {
+		return true
+	}
+	_, from, _ := strings.Cut(strings.ToLower(em.FromEmail), "@")
+	for _, d := range em.Auth.DKIMDomains {
+		if from != "" && (from == d || strings.HasSuffix(from, "."+d)) {
+			return true
+		}
+	}
+	return false
+}
+
+// forwardedTicket turns the forward into the mail the customer originally sent
+func forwardedTicket(em imap.Email, fw *imap.Forwarded) imap.Email {
+	em.FromEmail = fw.FromEmail
+	em.FromName = fw.FromName
+	if em.FromName == "" {
+		em.FromName = fw.FromEmail
+	}
+	if fw.Subject != "" {
+		em.Subject = fw.Subject
+	} else {
+		em.Subject = imap.StripForwardPrefix(em.Subject)
+	}
+	em.Body = fw.Body
+	em.Stripped = fw.Body
+	// The HTML part is the operator's mail, not the customer's
+	em.HTMLBody = ""
+	em.ReplyTo = ""
+	return em
+}
+
+// forwardNote is the chatter note recording who forwarded the mail
+func forwardNote(operator imap.Email) string {
+	note := fmt.Sprintf("Přeposláno operátorem %s <%s>", operator.FromName, operator.FromEmail)
+	if fw := operator.Forwarded; fw != nil && fw.Note != "" {
+		note += "\n\n" + fw.Note
+	}
+	return note
+}
+
+// mailParticipants returns the To, Cc and Reply-To addresses of the mail that should follow
+// the ticket: not the sender, not our own mailbox, not excluded and optionally not internal
+func mailParticipants(cfg *config.Config, em imap.Email) []string {
+	own := []string{cfg.SMTP.FromEmail, cfg.IMAP.Username, cfg.IMAP.SearchTo, em.FromEmail}
+	internal := cfg.InternalDomains()
+
+	var out []string
+	candidates := append(append(append([]string{}, em.To...), em.Cc...), em.ReplyTo)
+	for _, addr := range candidates {
+		addr = strings.ToLower(strings.TrimSpace(addr))
+		if addr == "" || !strings.Contains(addr, "@") || slices.Contains(out, addr) {
+			continue
+		}
+		if slices.ContainsFunc(own, func(o string) bool { return strings.EqualFold(o, addr) }) {
+			continue
+		}
+		if isExcludedEmail(addr, cfg.App.ExcludedEmails) {
+			continue
+		}
+		if cfg.App.Participants.ExcludeInternal {
+			_, domain, _ := strings.Cut(addr, "@")
+			if slices.Contains(internal, domain) {
+				continue
+			}
+		}
+		out = append(out, addr)
+	}
+	return out
+}
+
+// addParticipants makes the addresses followers of the task and remembers them for agent replies
+func addParticipants(ctx context.Context, oc *odoo.Client, st *state.Store, taskID int64, emails []string) {
+	if len(emails) == 0 {
+		return
+	}
+	for _, addr := range emails {
+		partnerID, err := oc.FindOrCreatePartnerByEmail(ctx, addr, "")
+		if err != nil {
+			log.Error().Err(err).Str("email", addr).Msg("odoo partner for participant")
+			continue
+		}
+		if err := oc.AddFollower(ctx, taskID, partnerID); err != nil {
+			log.Error().Err(err).Str("email", addr).Int64("task_id", taskID).Msg("odoo add follower")
+		}
+	}
+	if err := st.AddTaskParticipants(taskID, emails...); err != nil {
+		log.Error().Err(err).Int64("task_id", taskID).Msg("store task participants")
+	}
+	log.Info().Strs("participants", emails).Int64("task_id", taskID).Msg("participants added to task")
+}
+
+// replyCc returns the tracked participants to keep in copy of a mail to the customer
+func replyCc(cfg *config.Config, st *state.Store, taskID int64, customer string) []string {
+	participants, err := st.GetTaskParticipants(taskID)
+	if err != nil {
+		log.Error().Err(err).Int64("task_id", taskID).Msg("load task participants")
+		return nil
+	}
+	var cc []string
+	for _, addr := range participants {
+		if strings.EqualFold(addr, customer) || isNoReplyEmail(addr, cfg.App.NoReplyEmails) || st.IsEmailBouncing(addr) {
+			continue
+		}
+		cc = append(cc, addr)
+	}
+	return cc
+}
+
+// subjectTicket returns the ticket tagged in the subject. With a token secret only
+// tags carrying their valid token count.
+func subjectTicket(cfg *config.Config, subject string) (int, bool) {
+	ref, ok := ticket.Parse(subject, cfg.App.TicketPrefix)
+	if !ok {
+		return 0, false
+	}
+	if !ref.Valid(cfg.App.ReplyAuth.TokenSecret) {
+		log.Warn().Int("task_id", ref.ID).Str("subject", subject).Msg("ticket tag without a valid token, ignoring it")
+		return 0, false
+	}
+	return ref.ID, true
+}
+
+// replyAuthorized reports whether the sender may write into the task: its customer, a
+// follower, a tracked participant, an operator or someone from an allowed domain
+func replyAuthorized(ctx context.Context, cfg *config.Config, oc *odoo.Client, st *state.Store, taskID int64, sender string) bool {
+	sender = strings.ToLower(strings.TrimSpace(sender))
+	if _, domain, ok := strings.Cut(sender, "@"); ok {
+		for _, d := range cfg.App.ReplyAuth.AllowDomains {
+			if strings.EqualFold(strings.TrimPrefix(strings.TrimSpace(d), "@"), domain) {
+				return true
+			}
+		}
+	}
+	if matchEmailPattern(sender, cfg.App.Operators) {
+		return true
+	}
+	if participants, err := st.GetTaskParticipants(taskID); err == nil && slices.Contains(participants, sender) {
+		return true
+	}
+	task, err := oc.GetTask(ctx, taskID)
+	if err != nil {
+		log.Warn().Err(err).Int64("task_id", taskID).Msg("odoo get task")
+		return false
+	}
+	if strings.EqualFold(task.CustomerEmail, sender) {
+		return true
+	}
+	followers, err := oc.TaskFollowerEmails(ctx, taskID)
+	if err != nil {
+		log.Warn().Err(err).Int64("task_id", taskID).Msg("odoo task followers")
+		return false
+	}
+	return slices.Contains(followers, sender)
+}
+
+// addThrottled puts mail of a sender over its ticket limit on the sender's latest task
+// as a note; the first such mail also alerts Slack
+func addThrottled(ctx context.Context, cfg *config.Config, oc *odoo.Client, sl *slack.Client, files *attachments, em imap.Email, v flood.Verdict, window time.Duration) {
+	log.Warn().Str("from", em.FromEmail).Str("key", v.Key).Int("count", v.Count).Int64("task_id", v.TaskID).Msg("ticket limit reached, adding mail as note")
+	note := fmt.Sprintf("Omezeno, příliš mnoho nových požadavků od %s. Zpráva od %s: %s\n\n%s", v.Key, em.FromEmail, em.Subject, em.Stripped)
+	if err := oc.MessagePostNote(ctx, v.TaskID, note, files.storeOriginal(ctx, oc, v.TaskID, em)...); err != nil {
+		log.Error().Err(err).Int64("task_id", v.TaskID).Msg("odoo throttled note")
+	}
+	files.upload(ctx, oc, v.TaskID, em)
+	if v.Alert {
+		if _, err := sl.NotifyFlood(v.Key, v.Count, window, int(v.TaskID), oc.TaskURL(cfg.Odoo.BaseURL, v.TaskID)); err != nil {
+			log.Error().Err(err).Str("key", v.Key).Msg("slack notify flood")
+		}
+	}
+}
+
+// taskOpen reports whether the task exists and is not in a done stage
+func taskOpen(ctx context.Context, cfg *config.Config, oc *odoo.Client, taskID int64) bool {
+	task, err := oc.GetTask(ctx, taskID)
+	if err != nil {
+		log.Warn().Err(err).Int64("task_id", taskID).Msg("odoo get task")
+		return false
+	}
+	return !oc.IsTaskDone(task, cfg.App.DoneStageIDs)
+}
+
+// receivedAt is when the mail reached the helpdesk; ingested mail keeps its original time
+func receivedAt(em imap.Email) time.Time {
+	if em.Received.IsZero() {
+		return time.Now()
+	}
+	return em.Received
+}
+
+// warnInfected posts the attachments held back by the virus scanner to the task's Slack thread
+func warnInfected(sl *slack.Client, st *state.Store, taskID int64, infected []string) {
+	if len(infected) == 0 {
+		return
+	}
+	info, err := st.GetSlackMessage(taskID)
+	if err != nil || info == nil {
+		return
+	}
+	msg := &slack.Message{Timestamp: info.Timestamp, Channel: info.Channel}
+	if err := slackFor(sl, info).NotifyInfectedAttachments(msg, int(taskID), infected); err != nil {
+		log.Error().Err(err).Int64("task_id", taskID).Msg("slack notify infected attachments")
+	}
+}
+
+// slackFor returns the Slack client posting to the channel the task's message is in
+func slackFor(sl *slack.Client, info *state.SlackMessageInfo) *slack.Client {
+	if info.RuleChannel != "" {
+		return sl.WithChannel(info.RuleChannel)
+	}
+	return sl
+}
+
+// taskThread builds the threading headers for an outgoing mail so it joins the task's
+// conversation; with a secret its Message-ID carries the ticket token
+func taskThread(st *state.Store, m *mailer.SMTPClient, prefix, secret string, taskID int64, kind string, ref int64) *mailer.Thread {
+	var token string
+	if secret != "" {
+		token = ticket.Token(secret, prefix, int(taskID))
+	}
+	thread := &mailer.Thread{MessageID: m.MessageID(prefix, taskID, kind, ref, token)}
+
+	recorded, err := st.GetTaskMessageIDs(taskID)
+	if err != nil {
+		log.Error().Err(err).Int64("task_id", taskID).Msg("load task message ids")
+		return thread
+	}
+	// A resend must not reference itself
+	var ids []string
+	for _, id := range recorded {
+		if id != thread.MessageID {
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 {
+		return thread
+	}
+
+	thread.InReplyTo = ids[len(ids)-1]
+	// Keep the thread root and the most recent messages
+	if len(ids) > maxReferences {
+		ids = append([]string{ids[0]}, ids[len(ids)-maxReferences+1:]...)
+	}
+	thread.References = ids
+	return thread
+}
+
+// recordSentMessageID remembers the Message-ID of a sent mail so replies to it find the task
+func recordSentMessageID(st *state.Store, taskID int64, thread *mailer.Thread) {
+	if err := st.StoreMessageID(taskID, thread.MessageID); err != nil {
+		log.Error().Err(err).Int64("task_id", taskID).Msg("store message id")
+	}
+}
+
+// handleAutoMail applies the configured action to an auto-reply, bounce or our own mail coming back
+func handleAutoMail(ctx context.Context, cfg *config.Config, oc *odoo.Client, st *state.Store, em imap.Email) {
+	action := autoMailAction(cfg, em.Class)
+
+	taskID, hasTicket := findTaskByThread(cfg, st, em)
+	if !hasTicket {
+		taskID, hasTicket = subjectTicket(cfg, em.Subject)
+	}
+
+	log.Info().Str("class", string(em.Class)).Str("action", action).Str("from", em.FromEmail).
+		Str("subject", em.Subject).Int("task_id", taskID).Msg("automatic email detected")
+
+	switch action {
+	case config.AutoMailNote:
+		if !hasTicket {
+			log.Info().Str("class", string(em.Class)).Str("from", em.FromEmail).Msg("automatic email does not belong to any ticket, dropping")
+			return
+		}
+		note := fmt.Sprintf("%s od %s: %s\n\n%s", autoMailLabel(em.Class), em.FromEmail, em.Subject, em.Stripped)
+		if err := oc.MessagePostNote(ctx, int64(taskID), note); err != nil {
+			log.Error().Err(err).Int("task_id", taskID).Msg("odoo internal note")
+		}
+
+	case config.AutoMailBounce:
+		// Only a delivery failure marks an address, an out-of-office reply comes from a
+		// mailbox that works
+		if em.Class != imap.ClassBounce {
+			log.Warn().Str("class", string(em.Class)).Str("from", em.FromEmail).Msg("bounce action is only for delivery failures, ignoring")
+			return
+		}
+		addr := em.BouncedRecipient
+		switch {
+		case addr != "":
+		case hasTicket:
+			if task, err := oc.GetTask(ctx, int64(taskID)); err == nil {
+				addr = task.CustomerEmail
+			} else {
+				log.Error().Err(err).Int("task_id", taskID).Msg("get task for bounce")
+			}
+		}
+		if addr == "" {
+			log.Warn().Str("class", string(em.Class)).Str("subject", em.Subject).Msg("could not determine bouncing address")
+			return
+		}
+		if err := st.MarkEmailBouncing(addr); err != nil {
+			log.Error().Err(err).Str("email", addr).Msg("mark email bouncing")
+			return
+		}
+		log.Warn().Str("email", addr).Int("task_id", taskID).Msg("customer address marked as bouncing, no further emails will be sent")
+	}
+}
+
+// autoMailAction returns the configured action for a class of automatic mail
+func autoMailAction(cfg *config.Config, class imap.MessageClass) string {
+	switch class {
+	case imap.ClassAutoReply:
+		return cfg.App.AutoMail.AutoReply
+	case imap.ClassBounce:
+		return cfg.App.AutoMail.Bounce
+	default:
+		return cfg.App.AutoMail.Loop
+	}
+}
+
+func autoMailLabel(class imap.MessageClass) string {
+	switch class {
+	case imap.ClassAutoReply:
+		return "Automatická odpověď"
+	case imap.ClassBounce:
+		return "Nedoručitelná zpráva"
+	default:
+		return "Vlastní odeslaný e-mail"
+	}
+}
+
+// findTaskByThread looks up the task of any message this email replies to. Message-IDs
+// the bridge generated can be guessed, with a token secret they only count when signed.
+func findTaskByThread(cfg *config.Config, st *state.Store, em imap.Email) (int, bool) {
+	secret := cfg.App.ReplyAuth.TokenSecret
+	for _, id := range em.ThreadIDs() {
+		taskID, ok, err := st.GetTaskByMessageID(id)
+		if err != nil {
+			log.Error().Err(err).Str("message_id", id).Msg("lookup task by message id")
+			continue
+		}
+		if !ok {
+			continue
+		}
+		if ref, own := ticket.ParseMessageID(id, cfg.App.TicketPrefix); own && secret != "" && (!ref.Valid(secret) || int64(ref.ID) != taskID) {
+			log.Warn().Int64("task_id", taskID).Str("message_id", id).Str("from", em.FromEmail).Msg("reference to a generated Message-ID without a valid token, ignoring it")
+			continue
+		}
+		return int(taskID), true
+	}
+	return 0, false
 }
 
 // truncateString truncates a string to maxLength characters, adding "..." if truncated
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/anaryk/odoo-helpdesk-bridge/internal/config"
+	"github.com/anaryk/odoo-helpdesk-bridge/internal/flood"
+	"github.com/anaryk/odoo-helpdesk-bridge/internal/imap"
+	"github.com/anaryk/odoo-helpdesk-bridge/internal/mailer"
+	"github.com/anaryk/odoo-helpdesk-bridge/internal/odoo"
+	"github.com/anaryk/odoo-helpdesk-bridge/internal/pop3"
+	"github.com/anaryk/odoo-helpdesk-bridge/internal/rules"
+	"github.com/anaryk/odoo-helpdesk-bridge/internal/sla"
+	"github.com/anaryk/odoo-helpdesk-bridge/internal/slack"
+	"github.com/anaryk/odoo-helpdesk-bridge/internal/state"
+	"github.com/anaryk/odoo-helpdesk-bridge/internal/templ"
+)
+
+// route bundles everything one inbound route needs: its mailbox, templates,
+// Slack channel and SLA handler. Odoo, SMTP and state are shared.
+type route struct {
+	cfg     *config.Config
+	imapCfg imap.Config
+	src     source
+	sl      *slack.Client
+	tm      *templ.Engine
+	sla     *sla.Handler
+	rules   *rules.Engine
+	files   *attachments
+	flood   *flood.Guard
+	watcher *imap.Watcher
+
+	oc *odoo.Client
+	st *state.Store
+	m  *mailer.SMTPClient
+
+	// processIncoming can be triggered by both the poll job and IMAP IDLE
+	incomingMu sync.Mutex
+}
+
+// source is the mailbox of a route, IMAP or POP3
+type source interface {
+	MailSource
+	Close() error
+}
+
+// newRoute connects the mailbox of a resolved route configuration
+func newRoute(rc *config.Config, oc *odoo.Client, st *state.Store, m *mailer.SMTPClient) (*route, error) {
+	tm, err := templ.New(rc.TemplatesDirOrDefault())
+	if err != nil {
+		return nil, err
+	}
+	tm.SignTags(rc.App.ReplyAuth.TokenSecret)
+
+	sl := newSlack(rc)
+
+	imapCfg := imapConfig(rc)
+	src, err := newSource(rc, imapCfg, st)
+	if err != nil {
+		return nil, err
+	}
+	re, err := rules.New(rc.App.Rules, rc.App.RulesDryRun)
+	if err != nil {
+		return nil, err
+	}
+	files, err := newAttachments(rc)
+	if err != nil {
+		return nil, err
+	}
+
+	return &route{
+		cfg:     rc,
+		imapCfg: imapCfg,
+		src:     src,
+		sl:      sl,
+		tm:      tm,
+		sla:     sla.New(rc, oc, sl, st),
+		rules:   re,
+		files:   files,
+		flood:   flood.New(rc, st),
+		oc:      oc,
+		st:      st,
+		m:       m,
+	}, nil
+}
+
+// newSource connects the route's POP3 mailbox when one is configured, its IMAP folder otherwise
+func newSource(rc *config.Config, imapCfg imap.Config, st *state.Store) (source, error) {
+	if rc.POP3 == nil {
+		return imap.New(imapCfg, st)
+	}
+	parser, err := imap.NewParser(imapCfg)
+	if err != nil {
+		return nil, err
+	}
+	return pop3.New(pop3.Config{
+		Host:     rc.POP3.Host,
+		Port:     rc.POP3.Port,
+		Username: rc.POP3.Username,
+		Password: rc.POP3.Password,
+		StartTLS: rc.POP3.StartTLS,
+		Delete:   rc.POP3.Delete,
+		Timeout:  time.Duration(rc.POP3.TimeoutSeconds) * time.Second,
+	}, parser, st)
+}
+
+// newSlack creates the Slack client of a route
+func newSlack(rc *config.Config) *slack.Client {
+	return slack.NewWithConfig(slack.Config{
+		WebhookURL: rc.Slack.WebhookURL,
+		BotToken:   rc.Slack.BotToken,
+		ChannelID:  rc.Slack.ChannelID,
+	})
+}
+
+// imapConfig is the mailbox configuration of a route
+func imapConfig(rc *config.Config) imap.Config {
+	return imap.Config{
+		Host:             rc.IMAP.Host,
+		Port:             rc.IMAP.Port,
+		Username:         rc.IMAP.Username,
+		Password:         rc.IMAP.Password,
+		Folder:           rc.IMAP.Folder,
+		SearchTo:         rc.IMAP.SearchTo,
+		ProcessedKeyword: rc.IMAP.CustomProcessedFlag,
+		OwnAddresses:     []string{rc.SMTP.FromEmail},
+		AuthServID:       rc.App.Quarantine.AuthServID,
+		Strip: imap.StripConfig{
+			Languages:      rc.App.Strip.Languages,
+			Patterns:       rc.App.Strip.Patterns,
+			KeepSignatures: rc.App.Strip.KeepSignatures,
+			Debug:          rc.App.Strip.Debug,
+		},
+		OAuth:           newTokenSource(rc.IMAP.OAuth2),
+		OAuthMechanism:  oauthMechanism(rc.IMAP.OAuth2),
+		SkipPartsLarger: int64(rc.App.Attachments.SkipDownloadMB) << 20,
+	}
+}
+
+// close logs out of the route's mailbox
+func (r *route) close() {
+	if err := r.src.Close(); err != nil {
+		log.Error().Err(err).Str("route", r.cfg.RouteName).Msg("failed to close mailbox connection")
+	}
+}
+
+// runIncoming turns new mail of this route into tickets and replies
+func (r *route) runIncoming(ctx context.Context, what string) {
+	r.incomingMu.Lock()
+	defer r.incomingMu.Unlock()
+	if err := processIncoming(ctx, r.cfg, r.src, r.oc, r.sl, r.st, r.tm, r.m, r.sla, r.rules, r.files, r.flood); err != nil {
+		log.Error().Err(err).Str("route", r.cfg.RouteName).Msg(what)
+	}
+}
+
+// runOdoo handles Odoo side events and SLA checks of the route's project
+func (r *route) runOdoo(ctx context.Context) {
+	if err := processOdooEvents(ctx, r.cfg, r.oc, r.st, r.tm, r.m, r.sl); err != nil {
+		log.Error().Err(err).Str("route", r.cfg.RouteName).Msg("odoo events")
+	}
+	if err := r.sla.CheckSLAViolations(ctx); err != nil {
+		log.Error().Err(err).Str("route", r.cfg.RouteName).Msg("SLA check")
+	}
+}
+
+// poll is the periodic job of the route
+func (r *route) poll(ctx context.Context) {
+	// With IDLE running the mailbox pushes new mail, polling is only the fallback
+	if r.watcher == nil || !r.watcher.Active() {
+		r.runIncoming(ctx, "incoming")
+	}
+	r.runOdoo(ctx)
+}
+
+// startIdle switches the route to IMAP IDLE push mode when configured
+func (r *route) startIdle(ctx context.Context) {
+	if !r.cfg.IMAP.Idle || r.cfg.POP3 != nil {
+		return
+	}
+	r.watcher = imap.NewWatcher(r.imapCfg)
+	go func() {
+		if err := r.watcher.Run(ctx); errors.Is(err, imap.ErrIdleUnsupported) {
+			log.Warn().Str("route", r.cfg.RouteName).Str("host", r.cfg.IMAP.Host).Msg("IMAP server does not support IDLE, falling back to polling")
+		}
+	}()
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-r.watcher.C():
+				r.runIncoming(ctx, "idle incoming")
+			}
+		}
+	}()
+}
@@ -1,7 +1,21 @@
 package main
 
 import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
 	"testing"
+
+	"github.com/anaryk/odoo-helpdesk-bridge/internal/config"
+	"github.com/anaryk/odoo-helpdesk-bridge/internal/imap"
+	"github.com/anaryk/odoo-helpdesk-bridge/internal/mailer"
+	"github.com/anaryk/odoo-helpdesk-bridge/internal/scan"
+	"github.com/anaryk/odoo-helpdesk-bridge/internal/slack"
+	"github.com/anaryk/odoo-helpdesk-bridge/internal/state"
+	"github.com/anaryk/odoo-helpdesk-bridge/internal/ticket"
 )
 
 func TestIsExcludedEmail(t *testing.T) {
@@ -136,3 +150,511 @@ func TestSelectOperatorFromCounts_MissingCounts(t *testing.T) {
 		t.Errorf("selectOperatorFromCounts() with missing counts = %s, want %s", selected, expected)
 	}
 }
+
+func TestFindTaskByThread(t *testing.T) {
+	store, err := state.New(t.TempDir() + "/test.db")
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	defer func() { _ = store.Close() }()
+
+	_ = store.StoreMessageID(42, "original@customer.example.com")
+
+	tests := []struct {
+		name     string
+		email    imap.Email
+		expectID int
+		expectOK bool
+	}{
+		{
+			name:     "In-Reply-To known",
+			email:    imap.Email{InReplyTo: "original@customer.example.com"},
+			expectID: 42,
+			expectOK: true,
+		},
+		{
+			name: "Only an older reference known",
+			email: imap.Email{
+				InReplyTo:  "unknown@elsewhere.example.com",
+				References: []string{"original@customer.example.com", "unknown@elsewhere.example.com"},
+			},
+			expectID: 42,
+			expectOK: true,
+		},
+		{
+			name:     "Nothing known",
+			email:    imap.Email{InReplyTo: "unknown@elsewhere.example.com"},
+			expectOK: false,
+		},
+		{
+			name:     "Own Message-ID is not a reference",
+			email:    imap.Email{MessageID: "original@customer.example.com"},
+			expectOK: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id, ok := findTaskByThread(&config.Config{}, store, tt.email)
+			if ok != tt.expectOK || id != tt.expectID {
+				t.Errorf("findTaskByThread() = (%d, %v), want (%d, %v)", id, ok, tt.expectID, tt.expectOK)
+			}
+		})
+	}
+}
+
+func TestFindTaskByThread_ForgedMessageID(t *testing.T) {
+	store, err := state.New(t.TempDir() + "/test.db")
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	defer func() { _ = store.Close() }()
+
+	cfg := &config.Config{App: config.App{TicketPrefix: "ML", ReplyAuth: config.ReplyAuth{TokenSecret: "s3cret"}}}
+	m := mailer.NewSMTP(mailer.SMTPConfig{FromEmail: "support@example.com"})
+	signed := taskThread(store, m, "ML", "s3cret", 42, "new", 0).MessageID
+	_ = store.StoreMessageID(42, signed)
+	// Stored before the secret was set, and guessable by anyone
+	_ = store.StoreMessageID(42, "ml-42.new.0@example.com")
+	// A token of another ticket pasted into an ID of task 42
+	other := "ml-42-" + ticket.Token("s3cret", "ML", 43) + ".reply.1@example.com"
+	_ = store.StoreMessageID(42, other)
+
+	if id, ok := findTaskByThread(cfg, store, imap.Email{InReplyTo: signed}); !ok || id != 42 {
+		t.Errorf("signed Message-ID = (%d, %v), want (42, true)", id, ok)
+	}
+	for _, forged := range []string{"ml-42.new.0@example.com", other} {
+		if id, ok := findTaskByThread(cfg, store, imap.Email{InReplyTo: forged}); ok {
+			t.Errorf("forged In-Reply-To %s matched task %d", forged, id)
+		}
+	}
+	// Without a secret the old IDs still thread
+	if id, ok := findTaskByThread(&config.Config{App: config.App{TicketPrefix: "ML"}}, store, imap.Email{InReplyTo: "ml-42.new.0@example.com"}); !ok || id != 42 {
+		t.Errorf("unsigned Message-ID without a secret = (%d, %v), want (42, true)", id, ok)
+	}
+}
+
+func TestTaskThread(t *testing.T) {
+	store, err := state.New(t.TempDir() + "/test.db")
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	defer func() { _ = store.Close() }()
+
+	m := mailer.NewSMTP(mailer.SMTPConfig{FromEmail: "support@example.com"})
+
+	// Nothing recorded yet: only a Message-ID
+	thread := taskThread(store, m, "ML", "", 7, "new", 0)
+	if thread.MessageID != "ml-7.new.0@example.com" {
+		t.Errorf("Unexpected Message-ID %s", thread.MessageID)
+	}
+	if thread.InReplyTo != "" || len(thread.References) != 0 {
+		t.Errorf("Expected no threading headers, got %+v", thread)
+	}
+
+	_ = store.StoreMessageID(7, "orig@customer.example.com")
+	recordSentMessageID(store, 7, thread)
+
+	reply := taskThread(store, m, "ML", "", 7, "reply", 55)
+	if reply.InReplyTo != "ml-7.new.0@example.com" {
+		t.Errorf("Expected In-Reply-To the confirmation, got %s", reply.InReplyTo)
+	}
+	if len(reply.References) != 2 || reply.References[0] != "orig@customer.example.com" {
+		t.Errorf("Expected References [orig, confirmation], got %v", reply.References)
+	}
+
+	// Resending the confirmation does not reference itself
+	resend := taskThread(store, m, "ML", "", 7, "new", 0)
+	if resend.InReplyTo != "orig@customer.example.com" || len(resend.References) != 1 {
+		t.Errorf("Resend should only reference the original, got %+v", resend)
+	}
+
+	// Long threads keep the root and the most recent IDs
+	for i := 0; i < maxReferences*2; i++ {
+		_ = store.StoreMessageID(7, fmt.Sprintf("msg-%d@example.com", i))
+	}
+	long := taskThread(store, m, "ML", "", 7, "closed", 99)
+	if len(long.References) != maxReferences {
+		t.Fatalf("Expected %d references, got %d", maxReferences, len(long.References))
+	}
+	if long.References[0] != "orig@customer.example.com" {
+		t.Errorf("Thread root should be kept, got %s", long.References[0])
+	}
+	if last := fmt.Sprintf("msg-%d@example.com", maxReferences*2-1); long.References[maxReferences-1] != last || long.InReplyTo != last {
+		t.Errorf("Most recent ID should be last and In-Reply-To, got %v / %s", long.References[maxReferences-1], long.InReplyTo)
+	}
+}
+
+func TestAutoMailAction(t *testing.T) {
+	cfg := &config.Config{App: config.App{AutoMail: config.AutoMail{
+		AutoReply: config.AutoMailNote,
+		Bounce:    config.AutoMailBounce,
+		Loop:      config.AutoMailDrop,
+	}}}
+
+	tests := []struct {
+		class    imap.MessageClass
+		expected string
+	}{
+		{imap.ClassAutoReply, config.AutoMailNote},
+		{imap.ClassBounce, config.AutoMailBounce},
+		{imap.ClassLoop, config.AutoMailDrop},
+	}
+	for _, tt := range tests {
+		if got := autoMailAction(cfg, tt.class); got != tt.expected {
+			t.Errorf("autoMailAction(%q) = %q, want %q", tt.class, got, tt.expected)
+		}
+	}
+}
+
+func TestHandleAutoMail_BounceMarksRecipient(t *testing.T) {
+	store, err := state.New(t.TempDir() + "/test.db")
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	defer func() { _ = store.Close() }()
+
+	cfg := &config.Config{App: config.App{TicketPrefix: "ML", AutoMail: config.AutoMail{Bounce: config.AutoMailBounce}}}
+	em := imap.Email{
+		Class:            imap.ClassBounce,
+		FromEmail:        "mailer-daemon@mx.example.org",
+		Subject:          "Undelivered Mail Returned to Sender",
+		BouncedRecipient: "gone@customer.example.com",
+	}
+
+	// The recipient is known from the DSN, Odoo is not needed
+	handleAutoMail(context.Background(), cfg, nil, store, em)
+
+	if !store.IsEmailBouncing("gone@customer.example.com") {
+		t.Error("Bounced recipient should be marked as bouncing")
+	}
+	if store.IsEmailBouncing(em.FromEmail) {
+		t.Error("The mailer daemon itself must not be marked")
+	}
+}
+
+func TestHandleAutoMail_AutoReplyNotBouncing(t *testing.T) {
+	store, err := state.New(t.TempDir() + "/test.db")
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	defer func() { _ = store.Close() }()
+
+	// Even with the bounce action an out-of-office reply leaves the address alone
+	cfg := &config.Config{App: config.App{TicketPrefix: "ML", AutoMail: config.AutoMail{AutoReply: config.AutoMailBounce}}}
+	em := imap.Email{
+		Class:     imap.ClassAutoReply,
+		FromEmail: "away@customer.example.com",
+		Subject:   "Out of office: [ML-#7] Potvrzení přijetí požadavku",
+	}
+	handleAutoMail(context.Background(), cfg, nil, store, em)
+
+	if store.IsEmailBouncing(em.FromEmail) {
+		t.Error("An auto-reply must not mark its sender as bouncing")
+	}
+}
+
+func TestHTMLBody(t *testing.T) {
+	em := imap.Email{Body: "plain", HTMLBody: "<p>rich</p>"}
+
+	if got := htmlBody(&config.Config{}, em); got != "" {
+		t.Errorf("HTML body should be ignored unless keep_html is set, got %q", got)
+	}
+	cfg := &config.Config{App: config.App{KeepHTML: true}}
+	if got := htmlBody(cfg, em); got != "<p>rich</p>" {
+		t.Errorf("htmlBody() = %q", got)
+	}
+	if got := htmlBody(cfg, imap.Email{Body: "plain"}); got != "" {
+		t.Errorf("plain text mail has no HTML body, got %q", got)
+	}
+}
+
+func TestMailParticipants(t *testing.T) {
+	cfg := &config.Config{
+		App:  config.App{ExcludedEmails: []string{"*@noreply.example.net"}},
+		IMAP: config.IMAPCfg{Username: "helpdesk@example.com"},
+		SMTP: config.SMTPCfg{FromEmail: "support@example.com"},
+	}
+	em := imap.Email{
+		FromEmail: "customer@client.example.org",
+		To:        []string{"support@example.com", "helpdesk@example.com"},
+		Cc:        []string{"Colleague@client.example.org", "agent@example.com", "bot@noreply.example.net", "colleague@client.example.org"},
+		ReplyTo:   "tickets@client.example.org",
+	}
+
+	got := strings.Join(mailParticipants(cfg, em), ",")
+	if got != "colleague@client.example.org,agent@example.com,tickets@client.example.org" {
+		t.Errorf("mailParticipants() = %s", got)
+	}
+
+	// Internal colleagues are left out on request, the domain defaults to the sender address
+	cfg.App.Participants.ExcludeInternal = true
+	got = strings.Join(mailParticipants(cfg, em), ",")
+	if got != "colleague@client.example.org,tickets@client.example.org" {
+		t.Errorf("mailParticipants() with exclude_internal = %s", got)
+	}
+}
+
+func TestReplyCc(t *testing.T) {
+	store, err := state.New(t.TempDir() + "/test.db")
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	defer func() { _ = store.Close() }()
+
+	_ = store.AddTaskParticipants(42, "customer@client.example.org", "colleague@client.example.org", "bot@ai.example.net", "gone@client.example.org")
+	_ = store.MarkEmailBouncing("gone@client.example.org")
+	cfg := &config.Config{App: config.App{NoReplyEmails: []string{"*@ai.example.net"}}}
+
+	got := replyCc(cfg, store, 42, "Customer@client.example.org")
+	if strings.Join(got, ",") != "colleague@client.example.org" {
+		t.Errorf("replyCc() = %v, want only the colleague", got)
+	}
+	if cc := replyCc(cfg, store, 7, "customer@client.example.org"); len(cc) != 0 {
+		t.Errorf("Task without participants should have no Cc, got %v", cc)
+	}
+}
+
+func TestForwardedOrigin(t *testing.T) {
+	cfg := &config.Config{App: config.App{Operators: []string{"operator@example.com"}}}
+	fw := &imap.Forwarded{FromName: "Jan Novák", FromEmail: "jan@customer.example.com", Subject: "VPN", Body: "VPN does not connect.", Note: "FYI"}
+	em := imap.Email{
+		FromName:  "Operator",
+		FromEmail: "Operator@example.com",
+		Subject:   "Fwd: VPN",
+		Body:      "FYI\n---------- Forwarded message ---------\n...",
+		HTMLBody:  "<p>FYI</p>",
+		Forwarded: fw,
+		Auth:      imap.AuthResults{SPF: "pass", DKIM: "pass", DMARC: "pass"},
+	}
+
+	if got := forwardedOrigin(cfg, em); got != fw {
+		t.Fatalf("forwardedOrigin() = %v, want the forwarded mail", got)
+	}
+	customer := em
+	customer.FromEmail = "someone@customer.example.com"
+	if got := forwardedOrigin(cfg, customer); got != nil {
+		t.Errorf("Forward from a non-operator must keep the sender, got %+v", got)
+	}
+
+	// Anyone can put an operator into From, the server has to vouch for it
+	for _, auth := range []imap.AuthResults{
+		{},
+		{SPF: "pass", DMARC: "fail"},
+		{DKIM: "fail", DMARC: "none"},
+		// SPF covers the envelope sender only, the From header may say anything
+		{SPF: "pass"},
+		// A valid signature, but of the attacker's own domain
+		{DKIM: "pass", DKIMDomains: []string{"attacker.example"}},
+		{DKIM: "pass", DKIMDomains: []string{"example.com.attacker.example"}},
+	} {
+		spoofed := em
+		spoofed.Auth = auth
+		if got := forwardedOrigin(cfg, spoofed); got != nil {
+			t.Errorf("Forward with %+v must keep the sender, got %+v", auth, got)
+		}
+		trusted := &config.Config{App: config.App{Operators: cfg.App.Operators, TrustOperatorForwards: true}}
+		if got := forwardedOrigin(trusted, spoofed); got != fw {
+			t.Errorf("trust_operator_forwards with %+v = %v, want the forwarded mail", auth, got)
+		}
+	}
+	for from, domain := range map[string]string{"Operator@example.com": "example.com", "operator@helpdesk.example.com": "example.com"} {
+		signed := imap.Email{FromEmail: from, Forwarded: fw, Auth: imap.AuthResults{DKIM: "pass", DKIMDomains: []string{"esp.example.net", domain}}}
+		op := &config.Config{App: config.App{Operators: []string{"operator@example.com", "operator@helpdesk.example.com"}}}
+		if got := forwardedOrigin(op, signed); got != fw {
+			t.Errorf("DKIM pass of %s for %s without DMARC = %v, want the forwarded mail", domain, from, got)
+		}
+	}
+
+	ticket := forwardedTicket(em, fw)
+	if ticket.FromEmail != "jan@customer.example.com" || ticket.FromName != "Jan Novák" {
+		t.Errorf("customer = %q <%s>", ticket.FromName, ticket.FromEmail)
+	}
+	if ticket.Subject != "VPN" || ticket.Stripped != "VPN does not connect." || ticket.HTMLBody != "" {
+		t.Errorf("unexpected ticket mail %+v", ticket)
+	}
+	fw.Subject = ""
+	if got := forwardedTicket(em, fw).Subject; got != "VPN" {
+		t.Errorf("Subject without forward header = %q, want prefix stripped", got)
+	}
+
+	if note := forwardNote(em); note != "Přeposláno operátorem Operator <Operator@example.com>\n\nFYI" {
+		t.Errorf("forwardNote() = %q", note)
+	}
+}
+
+func TestSlackFor(t *testing.T) {
+	sl := slack.NewWithConfig(slack.Config{BotToken: "xoxb", ChannelID: "C0ROUTE"})
+
+	if got := slackFor(sl, &state.SlackMessageInfo{Timestamp: "1.2", Channel: "C0ROUTE"}); got != sl {
+		t.Error("Task in the route's channel should use the route's client")
+	}
+	if got := slackFor(sl, &state.SlackMessageInfo{Timestamp: "1.2", RuleChannel: "C0BILLING"}); got == sl {
+		t.Error("Task posted by a routing rule should use a client for the rule's channel")
+	}
+}
+
+func TestQuarantineReason(t *testing.T) {
+	cfg := &config.Config{}
+	spam := imap.Email{Spam: imap.SpamVerdict{Flagged: true}}
+	if got := quarantineReason(cfg, spam); got != "" {
+		t.Errorf("Quarantine is off without an action, got %q", got)
+	}
+
+	cfg.App.Quarantine = config.Quarantine{Action: config.QuarantineStage, StageID: 9, SpamScore: 6, AuthFail: []string{"dmarc"}}
+	tests := []struct {
+		name string
+		em   imap.Email
+		want string
+	}{
+		{"flagged", spam, "flagged as spam"},
+		{"score above", imap.Email{Spam: imap.SpamVerdict{Score: 7.25, Scored: true}}, "spam score 7.2"},
+		{"score below", imap.Email{Spam: imap.SpamVerdict{Score: 5.9, Scored: true}}, ""},
+		{"dmarc fail", imap.Email{Auth: imap.AuthResults{SPF: "pass", DMARC: "fail"}}, "dmarc=fail"},
+		{"spf fail not checked", imap.Email{Auth: imap.AuthResults{SPF: "fail", DMARC: "pass"}}, ""},
+		{"clean", imap.Email{Auth: imap.AuthResults{SPF: "pass", DKIM: "pass", DMARC: "pass"}}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := quarantineReason(cfg, tt.em); got != tt.want {
+				t.Errorf("quarantineReason() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewAttachments(t *testing.T) {
+	cfg := &config.Config{}
+	a, err := newAttachments(cfg)
+	if err != nil || a.offload != nil {
+		t.Fatalf("newAttachments() = %+v, %v", a, err)
+	}
+
+	cfg.App.Attachments.Offload = &config.Offload{Endpoint: "http://minio:9000", Bucket: "helpdesk", AccessKey: "a", SecretKey: "s", Prefix: "mail/"}
+	if a, err = newAttachments(cfg); err != nil || a.offload == nil || a.prefix != "mail/" {
+		t.Fatalf("newAttachments() with offload = %+v, %v", a, err)
+	}
+
+	cfg.App.Attachments.Offload.Endpoint = "minio:9000"
+	if _, err := newAttachments(cfg); err == nil {
+		t.Error("expected error for endpoint without scheme")
+	}
+}
+
+func TestOffloadKey(t *testing.T) {
+	for name, want := range map[string]string{
+		"report.pdf":                      "report.pdf",
+		"../../other-task/x.pdf":          "x.pdf",
+		`C:\Users\jan\smlouva.pdf`:        "smlouva.pdf",
+		"faktura ř 1?.pdf":                "faktura_ř_1_.pdf",
+		"..":                              "attachment",
+		".htaccess":                       "htaccess",
+		strings.Repeat("a", 200) + ".zip": strings.Repeat("a", 96) + ".zip",
+	} {
+		if got := safeFilename(name); got != want {
+			t.Errorf("safeFilename(%q) = %q, want %q", name, got, want)
+		}
+	}
+
+	first := offloadKey("mail/", 7, imap.Attachment{Filename: "../scan.pdf", Data: []byte("first")})
+	second := offloadKey("mail/", 7, imap.Attachment{Filename: "scan.pdf", Data: []byte("second")})
+	if !strings.HasPrefix(first, "mail/task-7/") || !strings.HasSuffix(first, "/scan.pdf") || strings.Contains(first, "..") {
+		t.Errorf("offloadKey() = %q", first)
+	}
+	if first == second {
+		t.Errorf("files of the same name share the key %q", first)
+	}
+	if again := offloadKey("mail/", 7, imap.Attachment{Filename: "scan.pdf", Data: []byte("first")}); again != first {
+		t.Errorf("same file got keys %q and %q", first, again)
+	}
+}
+
+func TestFormatSize(t *testing.T) {
+	for n, want := range map[int64]string{512: "512 B", 2048: "2 kB", 42 << 20: "42.0 MB", 1<<20 + 1<<19: "1.5 MB"} {
+		if got := formatSize(n); got != want {
+			t.Errorf("formatSize(%d) = %q, want %q", n, got, want)
+		}
+	}
+}
+
+// fakeScanner flags files containing "virus" and fails on files containing "broken"
+type fakeScanner struct{}
+
+func (fakeScanner) Scan(_ context.Context, _ string, r io.Reader) (scan.Result, error) {
+	data, _ := io.ReadAll(r)
+	switch {
+	case strings.Contains(string(data), "broken"):
+		return scan.Result{}, errors.New("clamd: connection refused")
+	case strings.Contains(string(data), "virus"):
+		return scan.Result{Infected: true, Signature: "Eicar-Test-Signature"}, nil
+	}
+	return scan.Result{}, nil
+}
+
+func TestAttachmentsScan(t *testing.T) {
+	atts := []imap.Attachment{
+		{Filename: "invoice.pdf", Data: []byte("pdf")},
+		{Filename: "setup.exe", Data: []byte("virus")},
+		{Filename: "odd.bin", Data: []byte("broken")},
+	}
+	a := &attachments{scanner: fakeScanner{}}
+	clean, infected, unscanned := a.scan(context.Background(), 7, atts)
+	if len(clean) != 1 || clean[0].Filename != "invoice.pdf" {
+		t.Errorf("clean = %+v", clean)
+	}
+	if len(infected) != 1 || infected[0] != "setup.exe (Eicar-Test-Signature)" {
+		t.Errorf("infected = %v", infected)
+	}
+	if len(unscanned) != 1 || !strings.HasPrefix(unscanned[0], "odd.bin (6 B)") {
+		t.Errorf("unscanned = %v", unscanned)
+	}
+
+	a.allowUnscanned = true
+	clean, _, unscanned = a.scan(context.Background(), 7, atts)
+	if len(clean) != 2 || len(unscanned) != 0 {
+		t.Errorf("allow_unscanned: clean = %d, unscanned = %v", len(clean), unscanned)
+	}
+}
+
+func TestStoreOriginalHeldBack(t *testing.T) {
+	em := imap.Email{Raw: []byte("Subject: hi\r\n\r\nvirus")}
+	ctx := context.Background()
+
+	// Nothing reaches Odoo, a nil client would fail the test otherwise
+	var a *attachments
+	if ids := a.storeOriginal(ctx, nil, 7, em); ids != nil {
+		t.Errorf("without attachments = %v", ids)
+	}
+	a = &attachments{scanner: fakeScanner{}, original: &config.Original{}}
+	if ids := a.storeOriginal(ctx, nil, 7, em); ids != nil {
+		t.Errorf("infected source = %v", ids)
+	}
+	a = &attachments{original: &config.Original{Compress: true, MaxSizeMB: 1}}
+	em.Raw = []byte(strings.Repeat("x", 3<<20))
+	if _, err := rand.Read(em.Raw[:2<<20]); err != nil {
+		t.Fatal(err)
+	}
+	if ids := a.storeOriginal(ctx, nil, 7, em); ids != nil {
+		t.Errorf("source over the limit after compression = %v", ids)
+	}
+}
+
+func TestSubjectTicket(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.App.TicketPrefix = "TICKET"
+	if id, ok := subjectTicket(cfg, "Re: [TICKET-#12] Printer"); !ok || id != 12 {
+		t.Errorf("unsigned tag = %d, %v", id, ok)
+	}
+
+	cfg.App.ReplyAuth.TokenSecret = "s3cret"
+	if _, ok := subjectTicket(cfg, "Re: [TICKET-#12] Printer"); ok {
+		t.Error("unsigned tag must be ignored with a token secret")
+	}
+	if _, ok := subjectTicket(cfg, "Re: [TICKET-#12-00000000] Printer"); ok {
+		t.Error("wrong token must be ignored")
+	}
+	signed := "Re: [" + ticket.Tag("s3cret", "TICKET", 12) + "] Printer"
+	if id, ok := subjectTicket(cfg, signed); !ok || id != 12 {
+		t.Errorf("signed tag %q = %d, %v", signed, id, ok)
+	}
+}
@@ -0,0 +1,89 @@
+// Package attach decides which mail attachments are uploaded to Odoo, which are too
+// large for it and which types are not accepted at all.
+package attach
+
+import (
+	"path"
+	"strings"
+
+	"github.com/anaryk/odoo-helpdesk-bridge/internal/config"
+	"github.com/anaryk/odoo-helpdesk-bridge/internal/imap"
+)
+
+const mb = 1 << 20
+
+// Policy applies the limits of app.attachments
+type Policy struct {
+	maxSize  int64
+	maxTotal int64
+	allow    []string
+	deny     []string
+}
+
+// Split is a mail's attachments sorted by what happens to them
+type Split struct {
+	Keep      []imap.Attachment // uploaded to Odoo
+	Oversized []imap.Attachment // over the per-file or per-message limit
+	Denied    []imap.Attachment // type not allowed
+}
+
+// NewPolicy reads the limits, a zero limit is unlimited
+func NewPolicy(cfg config.Attachments) *Policy {
+	p := &Policy{maxSize: int64(cfg.MaxSizeMB) * mb, maxTotal: int64(cfg.MaxTotalMB) * mb}
+	for _, t := range cfg.AllowTypes {
+		p.allow = append(p.allow, strings.ToLower(strings.TrimSpace(t)))
+	}
+	for _, t := range cfg.DenyTypes {
+		p.deny = append(p.deny, strings.ToLower(strings.TrimSpace(t)))
+	}
+	return p
+}
+
+// Split sorts the attachments. Files are kept in order until the message limit is
+// reached, anything after that is oversized. A nil policy keeps everything.
+func (p *Policy) Split(atts []imap.Attachment) Split {
+	var s Split
+	if p == nil {
+		s.Keep = atts
+		return s
+	}
+	var total int64
+	for _, att := range atts {
+		size := int64(len(att.Data))
+		switch {
+		case len(p.deny) > 0 && MatchType(att, p.deny),
+			len(p.allow) > 0 && !MatchType(att, p.allow):
+			s.Denied = append(s.Denied, att)
+		case p.maxSize > 0 && size > p.maxSize,
+			p.maxTotal > 0 && total+size > p.maxTotal:
+			s.Oversized = append(s.Oversized, att)
+		default:
+			total += size
+			s.Keep = append(s.Keep, att)
+		}
+	}
+	return s
+}
+
+// MatchType reports whether the attachment has one of the types. A type is a MIME
+// type ("application/pdf"), a MIME family ("image/*") or an extension (".pdf"),
+// all lowercased.
+func MatchType(att imap.Attachment, types []string) bool {
+	ct := strings.ToLower(att.ContentType)
+	ext := strings.ToLower(path.Ext(att.Filename))
+	for _, t := range types {
+		switch {
+		case strings.HasPrefix(t, "."):
+			if ext == t {
+				return true
+			}
+		case strings.HasSuffix(t, "/*"):
+			if strings.HasPrefix(ct, strings.TrimSuffix(t, "*")) {
+				return true
+			}
+		case ct == t:
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,64 @@
+package attach
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/anaryk/odoo-helpdesk-bridge/internal/config"
+	"github.com/anaryk/odoo-helpdesk-bridge/internal/imap"
+)
+
+func file(name, ct string, size int) imap.Attachment {
+	return imap.Attachment{Filename: name, ContentType: ct, Data: []byte(strings.Repeat("x", size))}
+}
+
+func names(atts []imap.Attachment) string {
+	var out []string
+	for _, a := range atts {
+		out = append(out, a.Filename)
+	}
+	return strings.Join(out, ",")
+}
+
+func TestPolicy_Split(t *testing.T) {
+	p := NewPolicy(config.Attachments{
+		MaxSizeMB:  2,
+		MaxTotalMB: 3,
+		DenyTypes:  []string{".EXE", "video/*"},
+	})
+	s := p.Split([]imap.Attachment{
+		file("invoice.pdf", "application/pdf", mb),
+		file("setup.exe", "application/octet-stream", 10),
+		file("clip.mp4", "video/mp4", 10),
+		file("scan.png", "image/png", 3*mb), // over the per-file limit
+		file("photo.jpg", "image/jpeg", 2*mb-200),
+		file("notes.txt", "text/plain", mb), // over the per-message limit
+		file("logo.gif", "image/gif", 100),
+	})
+	if got := names(s.Keep); got != "invoice.pdf,photo.jpg,logo.gif" {
+		t.Errorf("Keep = %s", got)
+	}
+	if got := names(s.Oversized); got != "scan.png,notes.txt" {
+		t.Errorf("Oversized = %s", got)
+	}
+	if got := names(s.Denied); got != "setup.exe,clip.mp4" {
+		t.Errorf("Denied = %s", got)
+	}
+}
+
+func TestPolicy_AllowList(t *testing.T) {
+	p := NewPolicy(config.Attachments{AllowTypes: []string{"application/pdf", "image/*"}})
+	s := p.Split([]imap.Attachment{
+		file("a.pdf", "application/pdf", 1),
+		file("b.png", "image/png", 1),
+		file("c.zip", "application/zip", 1),
+	})
+	if names(s.Keep) != "a.pdf,b.png" || names(s.Denied) != "c.zip" {
+		t.Errorf("Keep = %s, Denied = %s", names(s.Keep), names(s.Denied))
+	}
+
+	var none *Policy
+	if s := none.Split([]imap.Attachment{file("c.zip", "application/zip", 1)}); len(s.Keep) != 1 {
+		t.Error("nil policy must keep everything")
+	}
+}
@@ -4,6 +4,9 @@ package config
 import (
 	"fmt"
 	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
 	"strings"
 	"time"
 
@@ -12,15 +15,30 @@ import (
 
 // App holds application-specific configuration settings.
 type App struct {
-	PollSeconds    int      `yaml:"poll_seconds"`
-	StatePath      string   `yaml:"state_path"`
-	TicketPrefix   string   `yaml:"ticket_prefix"`
-	DoneStageIDs   []int64  `yaml:"done_stage_ids"`
-	ExcludedEmails []string `yaml:"excluded_emails"`
-	NoReplyEmails  []string `yaml:"no_reply_emails"` // Emails that create tickets but don't receive any responses
-	Operators      []string `yaml:"operators"`
-	SLA            SLA      `yaml:"sla"`
-	Debug          bool     `yaml:"debug"`
+	PollSeconds    int          `yaml:"poll_seconds"`
+	StatePath      string       `yaml:"state_path"`
+	TicketPrefix   string       `yaml:"ticket_prefix"`
+	DoneStageIDs   []int64      `yaml:"done_stage_ids"`
+	ExcludedEmails []string     `yaml:"excluded_emails"`
+	NoReplyEmails  []string     `yaml:"no_reply_emails"` // Emails that create tickets but don't receive any responses
+	Operators      []string     `yaml:"operators"`
+	SLA            SLA          `yaml:"sla"`
+	AutoMail       AutoMail     `yaml:"auto_mail"`
+	KeepHTML       bool         `yaml:"keep_html"` // store sanitized HTML bodies with inline images instead of plain text
+	Strip          Strip        `yaml:"strip"`
+	Participants   Participants `yaml:"participants"`
+	Quarantine     Quarantine   `yaml:"quarantine"`
+	Attachments    Attachments  `yaml:"attachments"`
+	Flood          Flood        `yaml:"flood"`
+	ReplyAuth      ReplyAuth    `yaml:"reply_auth"`
+	Rules          []Rule       `yaml:"rules"`         // routing of new tickets, the first matching rule wins
+	RulesDryRun    bool         `yaml:"rules_dry_run"` // only log which rule would fire
+	TemplatesDir   string       `yaml:"templates_dir"`
+	Debug          bool         `yaml:"debug"`
+
+	// Take forwards from app.operators without an SPF, DKIM or DMARC pass, e.g. when
+	// operators submit on the same server and no Authentication-Results is added
+	TrustOperatorForwards bool `yaml:"trust_operator_forwards"`
 }
 
 // SLA holds Service Level Agreement configuration settings.
@@ -29,6 +47,153 @@ type SLA struct {
 	ResolutionTimeHours int `yaml:"resolution_time_hours"` // Hours to resolve task
 }
 
+// Actions for automatically generated mail
+const (
+	AutoMailDrop   = "drop"   // mark as processed without touching Odoo
+	AutoMailNote   = "note"   // attach to the matching ticket as an internal note
+	AutoMailBounce = "bounce" // mark the customer address as bouncing, no more mail is sent to it
+)
+
+// AutoMail selects what happens to auto-replies, bounces and our own mail coming back.
+type AutoMail struct {
+	AutoReply string `yaml:"auto_reply"` // default "note"
+	Bounce    string `yaml:"bounce"`     // default "bounce"
+	Loop      string `yaml:"loop"`       // default "drop"
+}
+
+// Quarantine actions
+const (
+	QuarantineFolder = "folder" // move the mail to an IMAP folder, no ticket is created
+	QuarantineStage  = "stage"  // create the ticket in a low-priority stage, quietly
+)
+
+// Quarantine keeps spam and mail failing sender authentication out of the normal ticket flow.
+// Mail the spam filter flagged is always quarantined once an action is set.
+type Quarantine struct {
+	Action    string   `yaml:"action"`     // folder or stage, quarantine is off when empty
+	Folder    string   `yaml:"folder"`     // default "Quarantine"
+	StageID   int64    `yaml:"stage_id"`   // required for the stage action
+	SpamScore float64  `yaml:"spam_score"` // quarantine at or above this X-Spam-Score, 0 disables
+	AuthFail  []string `yaml:"auth_fail"`  // spf, dkim, dmarc: quarantine when any listed check failed
+
+	// AuthServID is the authserv-id our receiving server writes into Authentication-Results,
+	// e.g. mx.example.com. Only its headers are read, without it no mail is authenticated.
+	AuthServID string `yaml:"authserv_id"`
+}
+
+// Policies for replies from senders who do not belong to the ticket
+const (
+	ReplyAuthNewTicket  = "new_ticket" // open a new ticket from the mail
+	ReplyAuthNote       = "note"       // add it to the ticket as an internal note only
+	ReplyAuthQuarantine = "quarantine" // move it to the quarantine folder
+)
+
+// ReplyAuth decides who may write into an existing ticket by mail: its customer,
+// followers, tracked participants, operators and senders from allowed domains.
+type ReplyAuth struct {
+	Policy       string   `yaml:"policy"`        // new_ticket, note or quarantine; replies are not checked when empty
+	AllowDomains []string `yaml:"allow_domains"` // senders from these domains may always reply
+	TokenSecret  string   `yaml:"token_secret"`  // signs the ticket tag in subjects, tags without a valid token are ignored
+}
+
+// Attachments limits what is uploaded to Odoo. Files over a limit go to the object
+// store when offload is configured, otherwise they are only listed in the chatter.
+type Attachments struct {
+	MaxSizeMB      int       `yaml:"max_size_mb"`      // per file, 0 is unlimited
+	MaxTotalMB     int       `yaml:"max_total_mb"`     // per message, 0 is unlimited
+	AllowTypes     []string  `yaml:"allow_types"`      // MIME types (image/*) or extensions (.pdf) to keep, all when empty
+	DenyTypes      []string  `yaml:"deny_types"`       // MIME types or extensions that are never kept
+	SkipDownloadMB int       `yaml:"skip_download_mb"` // parts above this stay on the IMAP server, 0 downloads everything
+	Offload        *Offload  `yaml:"offload"`
+	Scan           *Scan     `yaml:"scan"`
+	Original       *Original `yaml:"original"`
+}
+
+// Original keeps the raw source of every customer mail on its task as an .eml file,
+// so headers and recipients can be checked later
+type Original struct {
+	Compress  bool `yaml:"compress"`    // store it gzipped as .eml.gz
+	MaxSizeMB int  `yaml:"max_size_mb"` // larger sources are not stored, 0 is unlimited
+}
+
+// Scan checks attachments with a clamd daemon before they are stored
+type Scan struct {
+	Clamd          string `yaml:"clamd"`           // tcp://host:3310 or unix:///run/clamav/clamd.ctl
+	TimeoutSeconds int    `yaml:"timeout_seconds"` // per file, default 60
+	AllowUnscanned bool   `yaml:"allow_unscanned"` // store files clamd could not check instead of holding them back
+}
+
+// Flood limits how many tickets a single sender or domain opens and folds repeated
+// mails into the ticket they repeat
+type Flood struct {
+	SenderLimit   int      `yaml:"sender_limit"`   // new tickets per sender within the window, 0 is unlimited
+	DomainLimit   int      `yaml:"domain_limit"`   // new tickets per sender domain within the window, 0 is unlimited
+	WindowMinutes int      `yaml:"window_minutes"` // default 10
+	IgnoreDomains []string `yaml:"ignore_domains"` // shared domains like gmail.com the domain limit does not apply to
+
+	// Mail from the same sender with the same subject within this time becomes a
+	// comment on the open task instead of a new one, 0 turns it off
+	DuplicateWindowMinutes int `yaml:"duplicate_window_minutes"`
+}
+
+// Offload stores oversized attachments in an S3 compatible bucket and links them in the chatter
+type Offload struct {
+	Endpoint        string `yaml:"endpoint"` // e.g. http://minio:9000
+	Region          string `yaml:"region"`   // default us-east-1
+	Bucket          string `yaml:"bucket"`
+	AccessKey       string `yaml:"access_key"`
+	SecretKey       string `yaml:"secret_key"`
+	Prefix          string `yaml:"prefix"`            // prepended to object keys
+	PublicURL       string `yaml:"public_url"`        // base URL of a public bucket, links are presigned otherwise
+	LinkExpiryHours int    `yaml:"link_expiry_hours"` // presigned link validity, at most and by default 168
+}
+
+// Strip configures how quoted history and signatures are cut from incoming mail.
+type Strip struct {
+	Languages      []string `yaml:"languages"`       // en, cs, sk, de; all when empty
+	Patterns       []string `yaml:"patterns"`        // extra regexes, the body is cut at the first matching line
+	KeepSignatures bool     `yaml:"keep_signatures"` // keep "-- " signatures and "Sent from my ..." lines
+	Debug          bool     `yaml:"debug"`           // log which rule cut each body
+}
+
+// Participants controls which To/Cc addresses of incoming mail are added to the ticket
+// as followers and kept in copy of agent replies.
+type Participants struct {
+	ExcludeInternal bool     `yaml:"exclude_internal"` // skip addresses from internal domains
+	InternalDomains []string `yaml:"internal_domains"` // default is the domain of smtp.from_email
+}
+
+// Rule routes a new ticket whose mail meets every condition in Match.
+type Rule struct {
+	Name  string      `yaml:"name"`
+	Match RuleMatch   `yaml:"match"`
+	Set   RuleActions `yaml:"set"`
+}
+
+// RuleMatch lists the conditions of a rule, empty ones are ignored.
+type RuleMatch struct {
+	From            []string          `yaml:"from"`             // sender patterns as in excluded_emails, e.g. "*@example.com"
+	Subject         string            `yaml:"subject"`          // regex
+	Body            string            `yaml:"body"`             // regex on the stripped body
+	AttachmentTypes []string          `yaml:"attachment_types"` // "application/pdf", "image/*" or ".pdf", any attachment may match
+	Headers         map[string]string `yaml:"headers"`          // header name -> regex
+}
+
+// RuleActions is what a matching rule changes, empty fields keep the route's defaults.
+type RuleActions struct {
+	ProjectID      int64    `yaml:"project_id"` // must be the project of one of the routes
+	StageID        int64    `yaml:"stage_id"`
+	Tags           []string `yaml:"tags"`            // created in Odoo when missing
+	Priority       string   `yaml:"priority"`        // "0" normal, "1" high
+	Assignee       string   `yaml:"assignee"`        // Odoo login, replaces the operator round-robin
+	Team           []string `yaml:"team"`            // least loaded of these logins is assigned
+	SlackChannel   string   `yaml:"slack_channel"`   // channel ID, needs a bot token
+	NoConfirmation bool     `yaml:"no_confirmation"` // do not send the new ticket confirmation
+}
+
+// stripLanguages are the rule sets known to the stripping engine
+var stripLanguages = []string{"en", "cs", "sk", "de"}
+
 // Odoo holds Odoo ERP system configuration settings.
 type Odoo struct {
 	URL            string     `yaml:"url"`
@@ -38,6 +203,7 @@ type Odoo struct {
 	ProjectID      int        `yaml:"project_id"`
 	BaseURL        string     `yaml:"base_url"`
 	TimeoutSeconds int        `yaml:"timeout_seconds"`
+	Protocol       string     `yaml:"protocol"` // jsonrpc (default) or xmlrpc
 	Stages         OdooStages `yaml:"stages"`
 }
 
@@ -58,35 +224,103 @@ type SlackCfg struct {
 
 // IMAPCfg holds IMAP email server configuration settings.
 type IMAPCfg struct {
-	Host                string `yaml:"host"`
-	Port                int    `yaml:"port"`
-	Username            string `yaml:"username"`
-	Password            string `yaml:"password"`
-	Folder              string `yaml:"folder"`
-	SearchTo            string `yaml:"search_to"`
-	CustomProcessedFlag string `yaml:"custom_processed_flag"`
+	Host                string  `yaml:"host"`
+	Port                int     `yaml:"port"`
+	Username            string  `yaml:"username"`
+	Password            string  `yaml:"password"`
+	Folder              string  `yaml:"folder"`
+	SearchTo            string  `yaml:"search_to"`
+	CustomProcessedFlag string  `yaml:"custom_processed_flag"`
+	Idle                bool    `yaml:"idle"`   // Use IMAP IDLE push instead of polling the mailbox when the server supports it
+	OAuth2              *OAuth2 `yaml:"oauth2"` // Log in with an OAuth2 access token instead of the password
 }
 
-// SMTPCfg holds SMTP email server configuration settings.
-type SMTPCfg struct {
+// POP3Cfg holds the settings of a POP3 mailbox, read instead of IMAP when set.
+type POP3Cfg struct {
 	Host           string `yaml:"host"`
-	Port           int    `yaml:"port"`
+	Port           int    `yaml:"port"` // default 995, 110 with starttls
 	Username       string `yaml:"username"`
 	Password       string `yaml:"password"`
-	FromName       string `yaml:"from_name"`
-	FromEmail      string `yaml:"from_email"`
+	StartTLS       bool   `yaml:"starttls"` // Connect in plain text and upgrade with STLS
+	Delete         bool   `yaml:"delete"`   // Remove processed mail from the server
 	TimeoutSeconds int    `yaml:"timeout_seconds"`
 }
 
+// SMTPCfg holds SMTP email server configuration settings.
+type SMTPCfg struct {
+	Host           string  `yaml:"host"`
+	Port           int     `yaml:"port"`
+	Username       string  `yaml:"username"`
+	Password       string  `yaml:"password"`
+	FromName       string  `yaml:"from_name"`
+	FromEmail      string  `yaml:"from_email"`
+	TimeoutSeconds int     `yaml:"timeout_seconds"`
+	OAuth2         *OAuth2 `yaml:"oauth2"` // Log in with an OAuth2 access token instead of the password
+}
+
+// OAuth2 configures XOAUTH2/OAUTHBEARER login for a mailbox. With a refresh token the
+// refresh_token grant is used, otherwise client_credentials.
+type OAuth2 struct {
+	TokenURL     string   `yaml:"token_url"`
+	ClientID     string   `yaml:"client_id"`
+	ClientSecret string   `yaml:"client_secret"`
+	RefreshToken string   `yaml:"refresh_token"`
+	Scopes       []string `yaml:"scopes"`
+	Mechanism    string   `yaml:"mechanism"` // xoauth2 (default) or oauthbearer
+}
+
+// validate reports missing OAuth2 settings under the given key
+func (o *OAuth2) validate(key string) []string {
+	if o == nil {
+		return nil
+	}
+	var errors []string
+	if o.TokenURL == "" {
+		errors = append(errors, key+".token_url is required")
+	}
+	if o.ClientID == "" {
+		errors = append(errors, key+".client_id is required")
+	}
+	switch strings.ToLower(strings.TrimSpace(o.Mechanism)) {
+	case "", "xoauth2", "oauthbearer":
+	default:
+		errors = append(errors, key+".mechanism must be xoauth2 or oauthbearer")
+	}
+	return errors
+}
+
+// Route pairs an inbound mailbox with the Odoo project, stages and Slack channel its tickets go to.
+// Fields left empty inherit the top-level settings.
+type Route struct {
+	Name         string     `yaml:"name"`
+	IMAP         IMAPCfg    `yaml:"imap"`
+	POP3         *POP3Cfg   `yaml:"pop3"` // Replaces the IMAP mailbox of the route
+	ProjectID    int        `yaml:"project_id"`
+	Stages       OdooStages `yaml:"stages"`
+	DoneStageIDs []int64    `yaml:"done_stage_ids"`
+	TicketPrefix string     `yaml:"ticket_prefix"`
+	Operators    []string   `yaml:"operators"`
+	TemplatesDir string     `yaml:"templates_dir"`
+	Slack        SlackCfg   `yaml:"slack"`
+}
+
 // Config holds the complete application configuration.
 type Config struct {
-	App   App      `yaml:"app"`
-	Odoo  Odoo     `yaml:"odoo"`
-	Slack SlackCfg `yaml:"slack"`
-	IMAP  IMAPCfg  `yaml:"imap"`
-	SMTP  SMTPCfg  `yaml:"smtp"`
+	App    App      `yaml:"app"`
+	Odoo   Odoo     `yaml:"odoo"`
+	Slack  SlackCfg `yaml:"slack"`
+	IMAP   IMAPCfg  `yaml:"imap"`
+	POP3   *POP3Cfg `yaml:"pop3"` // Read mail over POP3 instead of IMAP
+	SMTP   SMTPCfg  `yaml:"smtp"`
+	Routes []Route  `yaml:"routes"`
+
+	// RouteName identifies the inbound route a resolved configuration belongs to
+	RouteName string `yaml:"-"`
 }
 
+// defaultRouteName names the implicit route built from the top-level settings
+const defaultRouteName = "default"
+
 // Load reads and parses configuration from a YAML file.
 func Load(path string) (*Config, error) {
 	// Validate path to prevent directory traversal
@@ -120,6 +354,24 @@ func Load(path string) (*Config, error) {
 		c.App.TicketPrefix = "TICKET"
 	}
 
+	// Automatic mail never opens tickets
+	if c.App.AutoMail.AutoReply == "" {
+		c.App.AutoMail.AutoReply = AutoMailNote
+	}
+	if c.App.AutoMail.Bounce == "" {
+		c.App.AutoMail.Bounce = AutoMailBounce
+	}
+	if c.App.AutoMail.Loop == "" {
+		c.App.AutoMail.Loop = AutoMailDrop
+	}
+
+	if c.App.Quarantine.Folder == "" {
+		c.App.Quarantine.Folder = "Quarantine"
+	}
+	if c.App.Flood.WindowMinutes == 0 {
+		c.App.Flood.WindowMinutes = 10
+	}
+
 	// Set SLA defaults
 	if c.App.SLA.StartTimeHours == 0 {
 		c.App.SLA.StartTimeHours = 4
@@ -136,6 +388,121 @@ func Load(path string) (*Config, error) {
 	return &c, nil
 }
 
+// RouteConfigs returns one resolved configuration per inbound route, with the route's
+// settings laid over the top-level ones. Without routes the top-level settings form a
+// single route named "default".
+func (c *Config) RouteConfigs() []*Config {
+	if len(c.Routes) == 0 {
+		rc := *c
+		rc.RouteName = defaultRouteName
+		return []*Config{&rc}
+	}
+
+	out := make([]*Config, 0, len(c.Routes))
+	for i, r := range c.Routes {
+		rc := *c
+		rc.Routes = nil
+		rc.RouteName = r.Name
+		if rc.RouteName == "" {
+			rc.RouteName = fmt.Sprintf("route%d", i+1)
+		}
+
+		rc.IMAP = overlayIMAP(c.IMAP, r.IMAP)
+		// A route naming its own IMAP server does not inherit a top-level POP3 mailbox
+		if r.POP3 != nil {
+			rc.POP3 = r.POP3
+		} else if r.IMAP.Host != "" {
+			rc.POP3 = nil
+		}
+		rc.Slack = overlaySlack(c.Slack, r.Slack)
+		rc.Odoo.Stages = overlayStages(c.Odoo.Stages, r.Stages)
+		if r.ProjectID != 0 {
+			rc.Odoo.ProjectID = r.ProjectID
+		}
+		if r.DoneStageIDs != nil {
+			rc.App.DoneStageIDs = r.DoneStageIDs
+		}
+		if r.TicketPrefix != "" {
+			rc.App.TicketPrefix = r.TicketPrefix
+		}
+		if r.Operators != nil {
+			rc.App.Operators = r.Operators
+		}
+		if r.TemplatesDir != "" {
+			rc.App.TemplatesDir = r.TemplatesDir
+		}
+		out = append(out, &rc)
+	}
+	return out
+}
+
+func overlayIMAP(base, r IMAPCfg) IMAPCfg {
+	// The top-level login is never sent to another server, a route with its own host
+	// brings its own credentials
+	if r.Host != "" && !strings.EqualFold(r.Host, base.Host) {
+		base.Username, base.Password, base.OAuth2 = "", "", nil
+	}
+	if r.Host != "" {
+		base.Host = r.Host
+	}
+	if r.Port != 0 {
+		base.Port = r.Port
+	}
+	if r.Username != "" {
+		base.Username = r.Username
+	}
+	if r.Password != "" {
+		base.Password = r.Password
+	}
+	// The token wins over a password at login, so a route's own password drops the
+	// top-level OAuth2 settings
+	if r.OAuth2 != nil {
+		base.OAuth2 = r.OAuth2
+	} else if r.Password != "" {
+		base.OAuth2 = nil
+	}
+	if r.Folder != "" {
+		base.Folder = r.Folder
+	}
+	if r.SearchTo != "" {
+		base.SearchTo = r.SearchTo
+	}
+	if r.CustomProcessedFlag != "" {
+		base.CustomProcessedFlag = r.CustomProcessedFlag
+	}
+	base.Idle = base.Idle || r.Idle
+	return base
+}
+
+func overlaySlack(base, r SlackCfg) SlackCfg {
+	if r.WebhookURL != "" {
+		base.WebhookURL = r.WebhookURL
+	}
+	if r.BotToken != "" {
+		base.BotToken = r.BotToken
+	}
+	if r.ChannelID != "" {
+		base.ChannelID = r.ChannelID
+	}
+	return base
+}
+
+func overlayStages(base, r OdooStages) OdooStages {
+	if r.New != 0 {
+		base.New = r.New
+	}
+	if r.Assigned != 0 {
+		base.Assigned = r.Assigned
+	}
+	if r.InProgress != 0 {
+		base.InProgress = r.InProgress
+	}
+	if r.Done != 0 {
+		base.Done = r.Done
+	}
+	return base
+}
+
 // Validate checks that all required configuration fields are set.
 func (c *Config) Validate() error {
 	var errors []string
@@ -153,25 +520,116 @@ func (c *Config) Validate() error {
 	if c.Odoo.Password == "" {
 		errors = append(errors, "odoo.password is required")
 	}
-	if c.Odoo.ProjectID == 0 {
-		errors = append(errors, "odoo.project_id is required")
+	switch c.Odoo.Protocol {
+	case "", "jsonrpc", "xmlrpc":
+	default:
+		errors = append(errors, "odoo.protocol must be jsonrpc or xmlrpc")
 	}
 
-	// Stage IDs validation (critical for SLA)
-	if c.Odoo.Stages.New == 0 {
-		errors = append(errors, "odoo.stages.new is required for SLA tracking")
+	// Per-route settings, each route may take them from the top level
+	seen := make(map[string]bool)
+	for _, rc := range c.RouteConfigs() {
+		prefix := ""
+		if len(c.Routes) > 0 {
+			prefix = "routes[" + rc.RouteName + "]: "
+			if seen[rc.RouteName] {
+				errors = append(errors, prefix+"duplicate route name")
+			}
+			seen[rc.RouteName] = true
+		}
+
+		if rc.Odoo.ProjectID == 0 {
+			errors = append(errors, prefix+"odoo.project_id is required")
+		}
+
+		// Stage IDs validation (critical for SLA)
+		if rc.Odoo.Stages.New == 0 {
+			errors = append(errors, prefix+"odoo.stages.new is required for SLA tracking")
+		}
+		for _, e := range rc.validateTemplates() {
+			errors = append(errors, prefix+e)
+		}
+
+		if rc.POP3 != nil {
+			for _, e := range rc.validatePOP3() {
+				errors = append(errors, prefix+e)
+			}
+			continue
+		}
+
+		// IMAP validation
+		if rc.IMAP.Host == "" {
+			errors = append(errors, prefix+"imap.host is required")
+		}
+		if rc.IMAP.Username == "" {
+			errors = append(errors, prefix+"imap.username is required")
+		}
+		if rc.IMAP.Password == "" && rc.IMAP.OAuth2 == nil {
+			errors = append(errors, prefix+"imap.password is required")
+		}
+		for _, e := range rc.IMAP.OAuth2.validate("imap.oauth2") {
+			errors = append(errors, prefix+e)
+		}
 	}
 
-	// IMAP validation
-	if c.IMAP.Host == "" {
-		errors = append(errors, "imap.host is required")
+	// Automatic mail actions, only a delivery failure may mark an address as bouncing
+	switch c.App.AutoMail.Bounce {
+	case "", AutoMailDrop, AutoMailNote, AutoMailBounce:
+	default:
+		errors = append(errors, "app.auto_mail.bounce must be one of drop, note, bounce")
+	}
+	for _, am := range []struct{ key, action string }{
+		{"app.auto_mail.auto_reply", c.App.AutoMail.AutoReply},
+		{"app.auto_mail.loop", c.App.AutoMail.Loop},
+	} {
+		switch am.action {
+		case "", AutoMailDrop, AutoMailNote:
+		default:
+			errors = append(errors, am.key+" must be drop or note")
+		}
+	}
+
+	// Quote stripping rules
+	for _, lang := range c.App.Strip.Languages {
+		if !slices.Contains(stripLanguages, strings.ToLower(strings.TrimSpace(lang))) {
+			errors = append(errors, "app.strip.languages: unknown language "+lang)
+		}
+	}
+	for i, p := range c.App.Strip.Patterns {
+		if _, err := regexp.Compile(p); err != nil {
+			errors = append(errors, fmt.Sprintf("app.strip.patterns[%d]: %v", i, err))
+		}
+	}
+
+	// Quarantine policy
+	switch c.App.Quarantine.Action {
+	case "", QuarantineFolder:
+	case QuarantineStage:
+		if c.App.Quarantine.StageID == 0 {
+			errors = append(errors, "app.quarantine.stage_id is required for the stage action")
+		}
+	default:
+		errors = append(errors, "app.quarantine.action must be folder or stage")
+	}
+	for _, m := range c.App.Quarantine.AuthFail {
+		if !slices.Contains([]string{"spf", "dkim", "dmarc"}, strings.ToLower(m)) {
+			errors = append(errors, "app.quarantine.auth_fail: unknown check "+m)
+		}
+	}
+	if len(c.App.Quarantine.AuthFail) > 0 && c.App.Quarantine.AuthServID == "" {
+		errors = append(errors, "app.quarantine.authserv_id is required for auth_fail")
 	}
-	if c.IMAP.Username == "" {
-		errors = append(errors, "imap.username is required")
+
+	errors = append(errors, c.App.Attachments.validate()...)
+	switch c.App.ReplyAuth.Policy {
+	case "", ReplyAuthNewTicket, ReplyAuthNote, ReplyAuthQuarantine:
+	default:
+		errors = append(errors, "app.reply_auth.policy must be new_ticket, note or quarantine")
 	}
-	if c.IMAP.Password == "" {
-		errors = append(errors, "imap.password is required")
+	if f := c.App.Flood; f.SenderLimit < 0 || f.DomainLimit < 0 || f.WindowMinutes < 0 || f.DuplicateWindowMinutes < 0 {
+		errors = append(errors, "app.flood: limits and windows must not be negative")
 	}
+	errors = append(errors, c.validateRules()...)
 
 	// SMTP validation
 	if c.SMTP.Host == "" {
@@ -180,6 +638,7 @@ func (c *Config) Validate() error {
 	if c.SMTP.FromEmail == "" {
 		errors = append(errors, "smtp.from_email is required")
 	}
+	errors = append(errors, c.SMTP.OAuth2.validate("smtp.oauth2")...)
 
 	if len(errors) > 0 {
 		return fmt.Errorf("missing required fields: %s", strings.Join(errors, ", "))
@@ -188,10 +647,152 @@ func (c *Config) Validate() error {
 	return nil
 }
 
-// TemplatesDirOrDefault returns the default templates directory path.
-func (c *Config) TemplatesDirOrDefault() string { return "./templates" }
+// validate checks the attachment limits, the offload bucket and the scanner
+func (a Attachments) validate() []string {
+	var errs []string
+	if a.MaxSizeMB < 0 || a.MaxTotalMB < 0 || a.SkipDownloadMB < 0 {
+		errs = append(errs, "app.attachments: sizes must not be negative")
+	}
+	if o := a.Offload; o != nil {
+		if o.Endpoint == "" || o.Bucket == "" || o.AccessKey == "" || o.SecretKey == "" {
+			errs = append(errs, "app.attachments.offload: endpoint, bucket, access_key and secret_key are required")
+		}
+		if o.LinkExpiryHours < 0 || o.LinkExpiryHours > 168 {
+			errs = append(errs, "app.attachments.offload.link_expiry_hours must be between 1 and 168")
+		}
+	}
+	if sc := a.Scan; sc != nil {
+		if sc.Clamd == "" {
+			errs = append(errs, "app.attachments.scan.clamd is required")
+		}
+		if sc.TimeoutSeconds < 0 {
+			errs = append(errs, "app.attachments.scan.timeout_seconds must not be negative")
+		}
+	}
+	if o := a.Original; o != nil && o.MaxSizeMB < 0 {
+		errs = append(errs, "app.attachments.original.max_size_mb must not be negative")
+	}
+	return errs
+}
+
+// subjectTemplates are the templates whose subject a reply carries back
+var (
+	subjectTemplates = []string{"new_ticket_subject.tmpl", "agent_reply_subject.tmpl", "ticket_closed_subject.tmpl"}
+	tagAction        = regexp.MustCompile(`{{[^}]*\.Tag\b`)
+)
+
+// validateTemplates checks that with a token secret every subject template prints
+// .Tag; a tag built from .TicketPrefix and .TaskID has no token and replies to it are
+// ignored. Missing templates are left for the template engine to report.
+func (c *Config) validateTemplates() []string {
+	if c.App.ReplyAuth.TokenSecret == "" {
+		return nil
+	}
+	var errs []string
+	for _, name := range subjectTemplates {
+		b, err := os.ReadFile(filepath.Join(c.TemplatesDirOrDefault(), name)) // #nosec G304 - fixed template names
+		if err != nil {
+			continue
+		}
+		if !tagAction.Match(b) {
+			errs = append(errs, "templates: "+name+" must print {{ .Tag }} when app.reply_auth.token_secret is set")
+		}
+	}
+	return errs
+}
+
+// validatePOP3 checks a route reading a POP3 mailbox, which has no folders to move
+// quarantined mail to
+func (c *Config) validatePOP3() []string {
+	var errors []string
+	if c.POP3.Host == "" {
+		errors = append(errors, "pop3.host is required")
+	}
+	if c.POP3.Username == "" {
+		errors = append(errors, "pop3.username is required")
+	}
+	if c.POP3.Password == "" {
+		errors = append(errors, "pop3.password is required")
+	}
+	if c.POP3.Port < 0 || c.POP3.TimeoutSeconds < 0 {
+		errors = append(errors, "pop3: port and timeout_seconds must not be negative")
+	}
+	if c.App.Quarantine.Action == QuarantineFolder {
+		errors = append(errors, "app.quarantine.action folder needs an IMAP mailbox, use stage with pop3")
+	}
+	if c.App.ReplyAuth.Policy == ReplyAuthQuarantine {
+		errors = append(errors, "app.reply_auth.policy quarantine needs an IMAP mailbox, use note or new_ticket with pop3")
+	}
+	return errors
+}
+
+// validateRules checks the routing rules: regexes compile, every rule has a condition
+// and tickets only go to projects a route watches, otherwise agent replies would never be mailed
+func (c *Config) validateRules() []string {
+	projects := make(map[int64]bool)
+	for _, rc := range c.RouteConfigs() {
+		projects[int64(rc.Odoo.ProjectID)] = true
+	}
+
+	var errors []string
+	for i, r := range c.App.Rules {
+		key := fmt.Sprintf("app.rules[%d]", i)
+		if r.Name != "" {
+			key = "app.rules[" + r.Name + "]"
+		}
+		m := r.Match
+		if len(m.From) == 0 && m.Subject == "" && m.Body == "" && len(m.AttachmentTypes) == 0 && len(m.Headers) == 0 {
+			errors = append(errors, key+".match needs at least one condition")
+		}
+		if _, err := regexp.Compile(m.Subject); err != nil {
+			errors = append(errors, fmt.Sprintf("%s.match.subject: %v", key, err))
+		}
+		if _, err := regexp.Compile(m.Body); err != nil {
+			errors = append(errors, fmt.Sprintf("%s.match.body: %v", key, err))
+		}
+		for name, p := range m.Headers {
+			if _, err := regexp.Compile(p); err != nil {
+				errors = append(errors, fmt.Sprintf("%s.match.headers.%s: %v", key, name, err))
+			}
+		}
+		if r.Set.ProjectID != 0 && !projects[r.Set.ProjectID] {
+			errors = append(errors, fmt.Sprintf("%s.set.project_id %d is not the project of any route", key, r.Set.ProjectID))
+		}
+		switch r.Set.Priority {
+		case "", "0", "1":
+		default:
+			errors = append(errors, key+".set.priority must be 0 or 1")
+		}
+	}
+	return errors
+}
+
+// TemplatesDirOrDefault returns the configured templates directory, or ./templates.
+func (c *Config) TemplatesDirOrDefault() string {
+	if c.App.TemplatesDir != "" {
+		return c.App.TemplatesDir
+	}
+	return "./templates"
+}
 
 // OdooTimeout returns the configured Odoo API timeout as a time.Duration.
 func (c *Config) OdooTimeout() time.Duration {
 	return time.Duration(c.Odoo.TimeoutSeconds) * time.Second
 }
+
+// InternalDomains returns the lowercased domains treated as internal for participants,
+// falling back to the domain of smtp.from_email.
+func (c *Config) InternalDomains() []string {
+	var domains []string
+	for _, d := range c.App.Participants.InternalDomains {
+		if d = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(d), "@")); d != "" {
+			domains = append(domains, d)
+		}
+	}
+	if len(domains) == 0 {
+		if _, d, ok := strings.Cut(c.SMTP.FromEmail, "@"); ok && d != "" {
+			domains = append(domains, strings.ToLower(d))
+		}
+	}
+	return domains
+}
@@ -3,6 +3,7 @@ package config
 import (
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 )
@@ -56,6 +57,7 @@ imap:
   folder: "INBOX"
   search_to: "test@test.com"
   custom_processed_flag: "X-TEST"
+  idle: true
 
 smtp:
   host: "smtp.test.com"
@@ -158,6 +160,9 @@ smtp:
 	if cfg.IMAP.Port != 993 {
 		t.Errorf("Expected IMAP Port 993, got %d", cfg.IMAP.Port)
 	}
+	if !cfg.IMAP.Idle {
+		t.Errorf("Expected IMAP Idle true, got %v", cfg.IMAP.Idle)
+	}
 
 	// Test SMTP config
 	if cfg.SMTP.FromName != "Test Support" {
@@ -235,6 +240,21 @@ func TestConfig_OdooTimeout(t *testing.T) {
 	}
 }
 
+func TestConfig_OdooProtocol(t *testing.T) {
+	cfg := &Config{
+		Odoo: Odoo{URL: "https://odoo.example.com", DB: "db", Username: "admin", Password: "pw", ProjectID: 1, Stages: OdooStages{New: 100}, Protocol: "xmlrpc"},
+		IMAP: IMAPCfg{Host: "imap.example.com", Username: "user@example.com", Password: "pw"},
+		SMTP: SMTPCfg{Host: "smtp.example.com", FromEmail: "support@example.com"},
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Valid xmlrpc config rejected: %v", err)
+	}
+	cfg.Odoo.Protocol = "soap"
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "odoo.protocol must be jsonrpc or xmlrpc") {
+		t.Errorf("Expected protocol error, got %v", err)
+	}
+}
+
 func TestConfig_TemplatesDirOrDefault(t *testing.T) {
 	cfg := &Config{}
 
@@ -338,3 +358,585 @@ smtp:
 		t.Errorf("Expected Debug false, got %v", cfg.App.Debug)
 	}
 }
+
+func TestConfig_Routes(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "routes_config.yaml")
+
+	content := `
+app:
+  ticket_prefix: "SUP"
+  operators: ["alice@example.com"]
+odoo:
+  url: "https://odoo.example.com"
+  db: "odoo_db"
+  username: "admin"
+  password: "password"
+  stages:
+    new: 100
+    assigned: 101
+slack:
+  bot_token: "xoxb-shared"
+  channel_id: "CSUPPORT"
+imap:
+  host: "imap.example.com"
+  password: "shared-password"
+smtp:
+  host: "smtp.example.com"
+  from_email: "support@example.com"
+routes:
+  - name: support
+    project_id: 1
+    imap:
+      username: "support@example.com"
+  - name: billing
+    project_id: 2
+    ticket_prefix: "BIL"
+    operators: ["bob@example.com"]
+    templates_dir: "./templates/billing"
+    stages:
+      new: 200
+    imap:
+      username: "billing@example.com"
+      folder: "Billing"
+      idle: true
+    slack:
+      channel_id: "CBILLING"
+`
+	if err := os.WriteFile(configPath, []byte(content), 0600); err != nil {
+		t.Fatalf("Failed to create config file: %v", err)
+	}
+
+	cfg, err := Load(configPath)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	routes := cfg.RouteConfigs()
+	if len(routes) != 2 {
+		t.Fatalf("Expected 2 routes, got %d", len(routes))
+	}
+
+	support, billing := routes[0], routes[1]
+	if support.RouteName != "support" || support.Odoo.ProjectID != 1 {
+		t.Errorf("Unexpected support route %s / project %d", support.RouteName, support.Odoo.ProjectID)
+	}
+	if support.App.TicketPrefix != "SUP" || support.IMAP.Folder != "INBOX" || support.IMAP.Password != "shared-password" {
+		t.Errorf("Support route should inherit top-level settings, got prefix %s folder %s", support.App.TicketPrefix, support.IMAP.Folder)
+	}
+	if support.Slack.ChannelID != "CSUPPORT" || support.TemplatesDirOrDefault() != "./templates" {
+		t.Errorf("Support route should inherit Slack channel and templates, got %s / %s", support.Slack.ChannelID, support.TemplatesDirOrDefault())
+	}
+
+	if billing.Odoo.ProjectID != 2 || billing.App.TicketPrefix != "BIL" {
+		t.Errorf("Unexpected billing project %d / prefix %s", billing.Odoo.ProjectID, billing.App.TicketPrefix)
+	}
+	if billing.Odoo.Stages.New != 200 || billing.Odoo.Stages.Assigned != 101 {
+		t.Errorf("Expected billing stages new=200 assigned=101, got %+v", billing.Odoo.Stages)
+	}
+	if billing.IMAP.Username != "billing@example.com" || billing.IMAP.Folder != "Billing" || !billing.IMAP.Idle {
+		t.Errorf("Unexpected billing IMAP settings %+v", billing.IMAP)
+	}
+	if billing.Slack.ChannelID != "CBILLING" || billing.Slack.BotToken != "xoxb-shared" {
+		t.Errorf("Unexpected billing Slack settings %+v", billing.Slack)
+	}
+	if len(billing.App.Operators) != 1 || billing.App.Operators[0] != "bob@example.com" {
+		t.Errorf("Expected billing operators [bob@example.com], got %v", billing.App.Operators)
+	}
+	if billing.TemplatesDirOrDefault() != "./templates/billing" {
+		t.Errorf("Expected billing templates dir, got %s", billing.TemplatesDirOrDefault())
+	}
+
+	// The top-level config is left untouched
+	if cfg.App.TicketPrefix != "SUP" || cfg.Odoo.Stages.New != 100 {
+		t.Error("Resolving routes must not modify the top-level config")
+	}
+}
+
+func TestConfig_RoutesDefault(t *testing.T) {
+	cfg := &Config{Odoo: Odoo{ProjectID: 5}}
+
+	routes := cfg.RouteConfigs()
+	if len(routes) != 1 {
+		t.Fatalf("Expected a single default route, got %d", len(routes))
+	}
+	if routes[0].RouteName != "default" || routes[0].Odoo.ProjectID != 5 {
+		t.Errorf("Unexpected default route %s / project %d", routes[0].RouteName, routes[0].Odoo.ProjectID)
+	}
+}
+
+func TestConfig_RoutesValidation(t *testing.T) {
+	cfg := &Config{
+		Odoo: Odoo{URL: "https://odoo.example.com", DB: "db", Username: "u", Password: "p", Stages: OdooStages{New: 1}},
+		IMAP: IMAPCfg{Host: "imap.example.com", Password: "secret"},
+		SMTP: SMTPCfg{Host: "smtp.example.com", FromEmail: "support@example.com"},
+		Routes: []Route{
+			{Name: "support", ProjectID: 1, IMAP: IMAPCfg{Username: "support@example.com"}},
+			{Name: "support", IMAP: IMAPCfg{Username: "billing@example.com"}},
+		},
+	}
+
+	err := cfg.Validate()
+	if err == nil {
+		t.Fatal("Expected validation error")
+	}
+	for _, want := range []string{"routes[support]: duplicate route name", "routes[support]: odoo.project_id is required"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Expected %q in error, got %v", want, err)
+		}
+	}
+
+	cfg.Routes[1].Name = "billing"
+	cfg.Routes[1].ProjectID = 2
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Expected valid config, got %v", err)
+	}
+}
+
+func TestConfig_RouteOwnHost(t *testing.T) {
+	cfg := &Config{
+		Odoo: Odoo{URL: "https://odoo.example.com", DB: "db", Username: "u", Password: "p", Stages: OdooStages{New: 1}},
+		IMAP: IMAPCfg{Host: "imap.example.com", Username: "support@example.com", Password: "secret",
+			OAuth2: &OAuth2{TokenURL: "https://login.example.com/token", ClientID: "c", RefreshToken: "rt"}},
+		SMTP: SMTPCfg{Host: "smtp.example.com", FromEmail: "support@example.com"},
+		Routes: []Route{
+			{Name: "partner", ProjectID: 1, IMAP: IMAPCfg{Host: "imap.partner.example.net"}},
+			{Name: "same", ProjectID: 2, IMAP: IMAPCfg{Host: "IMAP.example.com", Folder: "Billing"}},
+		},
+	}
+
+	routes := cfg.RouteConfigs()
+	if p := routes[0].IMAP; p.Username != "" || p.Password != "" || p.OAuth2 != nil {
+		t.Errorf("Route on another host inherited the top-level login: %+v", p)
+	}
+	if s := routes[1].IMAP; s.Username != "support@example.com" || s.Password != "secret" || s.OAuth2 == nil {
+		t.Errorf("Route on the same host should keep the top-level login: %+v", s)
+	}
+
+	err := cfg.Validate()
+	if err == nil {
+		t.Fatal("Expected validation error")
+	}
+	for _, want := range []string{"routes[partner]: imap.username is required", "routes[partner]: imap.password is required"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Expected %q in %v", want, err)
+		}
+	}
+
+	cfg.Routes[0].IMAP.Username, cfg.Routes[0].IMAP.Password = "helpdesk@partner.example.net", "pw"
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Route with its own login rejected: %v", err)
+	}
+}
+
+func TestConfig_AutoMail(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "auto_mail.yaml")
+
+	base := `
+odoo:
+  url: "https://odoo.example.com"
+  db: "odoo_db"
+  username: "admin"
+  password: "password"
+  project_id: 1
+  stages:
+    new: 100
+imap:
+  host: "imap.example.com"
+  username: "user@example.com"
+  password: "password"
+smtp:
+  host: "smtp.example.com"
+  from_email: "support@example.com"
+`
+	if err := os.WriteFile(configPath, []byte(base), 0600); err != nil {
+		t.Fatalf("Failed to create config file: %v", err)
+	}
+	cfg, err := Load(configPath)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if cfg.App.AutoMail.AutoReply != AutoMailNote || cfg.App.AutoMail.Bounce != AutoMailBounce || cfg.App.AutoMail.Loop != AutoMailDrop {
+		t.Errorf("Unexpected auto_mail defaults %+v", cfg.App.AutoMail)
+	}
+
+	invalid := "app:\n  auto_mail:\n    bounce: \"ignore\"\n" + base
+	if err := os.WriteFile(configPath, []byte(invalid), 0600); err != nil {
+		t.Fatalf("Failed to create config file: %v", err)
+	}
+	_, err = Load(configPath)
+	if err == nil || !strings.Contains(err.Error(), "app.auto_mail.bounce must be one of drop, note, bounce") {
+		t.Errorf("Expected auto_mail validation error, got %v", err)
+	}
+
+	// An out-of-office reply is no delivery failure
+	invalid = "app:\n  auto_mail:\n    auto_reply: \"bounce\"\n" + base
+	if err := os.WriteFile(configPath, []byte(invalid), 0600); err != nil {
+		t.Fatalf("Failed to create config file: %v", err)
+	}
+	_, err = Load(configPath)
+	if err == nil || !strings.Contains(err.Error(), "app.auto_mail.auto_reply must be drop or note") {
+		t.Errorf("Expected auto_reply validation error, got %v", err)
+	}
+}
+
+func TestConfig_Strip(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "strip.yaml")
+
+	content := `
+app:
+  strip:
+    languages: ["cs", "xx"]
+    patterns: ["^-- internal --$", "([unclosed"]
+    keep_signatures: true
+odoo:
+  url: "https://odoo.example.com"
+  db: "odoo_db"
+  username: "admin"
+  password: "password"
+  project_id: 1
+  stages:
+    new: 100
+imap:
+  host: "imap.example.com"
+  username: "user@example.com"
+  password: "password"
+smtp:
+  host: "smtp.example.com"
+  from_email: "support@example.com"
+`
+	if err := os.WriteFile(configPath, []byte(content), 0600); err != nil {
+		t.Fatalf("Failed to create config file: %v", err)
+	}
+	_, err := Load(configPath)
+	if err == nil {
+		t.Fatal("Expected validation error for unknown language and invalid pattern")
+	}
+	if !strings.Contains(err.Error(), "app.strip.languages: unknown language xx") {
+		t.Errorf("Expected language error, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "app.strip.patterns[1]") {
+		t.Errorf("Expected pattern error, got %v", err)
+	}
+	if strings.Contains(err.Error(), "app.strip.patterns[0]") {
+		t.Errorf("Valid pattern reported as invalid: %v", err)
+	}
+}
+
+func TestConfig_OAuth2(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "oauth2.yaml")
+
+	content := `
+odoo:
+  url: "https://odoo.example.com"
+  db: "odoo_db"
+  username: "admin"
+  password: "password"
+  project_id: 1
+  stages:
+    new: 100
+imap:
+  host: "imap.example.com"
+  username: "user@example.com"
+  oauth2:
+    token_url: "https://login.example.com/token"
+    client_id: "client"
+    refresh_token: "rt"
+smtp:
+  host: "smtp.example.com"
+  from_email: "support@example.com"
+  oauth2:
+    client_id: "client"
+    mechanism: "cram-md5"
+`
+	if err := os.WriteFile(configPath, []byte(content), 0600); err != nil {
+		t.Fatalf("Failed to create config file: %v", err)
+	}
+	_, err := Load(configPath)
+	if err == nil {
+		t.Fatal("Expected validation error for incomplete smtp.oauth2")
+	}
+	if strings.Contains(err.Error(), "imap.password") {
+		t.Errorf("Password should not be required with oauth2: %v", err)
+	}
+	for _, want := range []string{"smtp.oauth2.token_url is required", "smtp.oauth2.mechanism must be xoauth2 or oauthbearer"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Expected %q in %v", want, err)
+		}
+	}
+}
+
+func TestConfig_RouteOAuth2(t *testing.T) {
+	top := &OAuth2{TokenURL: "https://login.example.com/token", ClientID: "top", RefreshToken: "rt"}
+	cfg := &Config{
+		Odoo: Odoo{URL: "https://odoo.example.com", DB: "db", Username: "admin", Password: "pw", Stages: OdooStages{New: 100}},
+		IMAP: IMAPCfg{Host: "imap.example.com", Username: "user@example.com", OAuth2: top},
+		SMTP: SMTPCfg{Host: "smtp.example.com", FromEmail: "support@example.com"},
+		Routes: []Route{
+			{Name: "billing", ProjectID: 1, IMAP: IMAPCfg{Username: "billing@example.com", OAuth2: &OAuth2{ClientID: "billing"}}},
+			{Name: "sales", ProjectID: 2, IMAP: IMAPCfg{Username: "sales@example.com", Password: "pw"}},
+			{Name: "support", ProjectID: 3},
+		},
+	}
+
+	routes := cfg.RouteConfigs()
+	if o := routes[0].IMAP.OAuth2; o == nil || o.ClientID != "billing" {
+		t.Errorf("billing oauth2 = %+v, want the route's own", o)
+	}
+	if routes[1].IMAP.OAuth2 != nil {
+		t.Errorf("sales logs in with its password, got oauth2 %+v", routes[1].IMAP.OAuth2)
+	}
+	if routes[2].IMAP.OAuth2 != top {
+		t.Errorf("support oauth2 = %+v, want the top-level one", routes[2].IMAP.OAuth2)
+	}
+
+	err := cfg.Validate()
+	if err == nil || !strings.Contains(err.Error(), "routes[billing]: imap.oauth2.token_url is required") {
+		t.Fatalf("Expected the route's oauth2 to be validated, got %v", err)
+	}
+	if strings.Contains(err.Error(), "imap.password") || strings.Contains(err.Error(), "routes[support]") {
+		t.Errorf("Unexpected errors: %v", err)
+	}
+
+	cfg.Routes[0].IMAP.OAuth2.TokenURL = "https://login.example.com/token"
+	cfg.Routes[0].IMAP.OAuth2.RefreshToken = "rt"
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Valid route oauth2 rejected: %v", err)
+	}
+}
+
+func TestConfig_InternalDomains(t *testing.T) {
+	cfg := &Config{SMTP: SMTPCfg{FromEmail: "Support@Example.com"}}
+	if got := cfg.InternalDomains(); len(got) != 1 || got[0] != "example.com" {
+		t.Errorf("InternalDomains() = %v, want domain of from_email", got)
+	}
+
+	cfg.App.Participants.InternalDomains = []string{"@Corp.example", " ", "example.org"}
+	got := cfg.InternalDomains()
+	if strings.Join(got, ",") != "corp.example,example.org" {
+		t.Errorf("InternalDomains() = %v", got)
+	}
+}
+
+func TestConfig_Rules(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "rules.yaml")
+
+	content := `
+app:
+  rules_dry_run: true
+  rules:
+    - name: invoices
+      match:
+        subject: "(?i)faktura"
+        attachment_types: ["application/pdf"]
+      set:
+        project_id: 1
+        tags: ["billing"]
+        priority: "1"
+    - name: elsewhere
+      match:
+        from: ["*@example.org"]
+      set:
+        project_id: 77
+    - name: empty
+      set:
+        priority: "urgent"
+    - match:
+        headers:
+          X-Mailer: "([broken"
+      set:
+        stage_id: 5
+odoo:
+  url: "https://odoo.example.com"
+  db: "odoo_db"
+  username: "admin"
+  password: "password"
+  project_id: 1
+  stages:
+    new: 100
+imap:
+  host: "imap.example.com"
+  username: "user@example.com"
+  password: "password"
+smtp:
+  host: "smtp.example.com"
+  from_email: "support@example.com"
+`
+	if err := os.WriteFile(configPath, []byte(content), 0600); err != nil {
+		t.Fatalf("Failed to create config file: %v", err)
+	}
+	_, err := Load(configPath)
+	if err == nil {
+		t.Fatal("Expected validation errors for invalid rules")
+	}
+	for _, want := range []string{
+		"app.rules[elsewhere].set.project_id 77 is not the project of any route",
+		"app.rules[empty].match needs at least one condition",
+		"app.rules[empty].set.priority must be 0 or 1",
+		"app.rules[3].match.headers.X-Mailer",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Expected %q in %v", want, err)
+		}
+	}
+	if strings.Contains(err.Error(), "app.rules[invoices]") {
+		t.Errorf("Valid rule reported as invalid: %v", err)
+	}
+}
+
+func TestConfig_Quarantine(t *testing.T) {
+	base := &Config{
+		Odoo: Odoo{URL: "https://odoo.example.com", DB: "db", Username: "admin", Password: "pw", ProjectID: 1, Stages: OdooStages{New: 100}},
+		IMAP: IMAPCfg{Host: "imap.example.com", Username: "user@example.com", Password: "pw"},
+		SMTP: SMTPCfg{Host: "smtp.example.com", FromEmail: "support@example.com"},
+	}
+
+	cfg := *base
+	cfg.App.Quarantine = Quarantine{Action: QuarantineFolder, AuthFail: []string{"DMARC", "spf"}, AuthServID: "mx.example.com"}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Valid quarantine config rejected: %v", err)
+	}
+
+	cfg.App.Quarantine = Quarantine{Action: QuarantineStage, AuthFail: []string{"arc"}}
+	err := cfg.Validate()
+	if err == nil {
+		t.Fatal("Expected validation errors")
+	}
+	for _, want := range []string{"app.quarantine.stage_id is required", "app.quarantine.auth_fail: unknown check arc", "app.quarantine.authserv_id is required for auth_fail"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Expected %q in %v", want, err)
+		}
+	}
+
+	cfg.App.Quarantine = Quarantine{Action: "delete"}
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "app.quarantine.action must be folder or stage") {
+		t.Errorf("Expected action error, got %v", err)
+	}
+}
+
+func TestConfig_Attachments(t *testing.T) {
+	cfg := &Config{
+		Odoo: Odoo{URL: "https://odoo.example.com", DB: "db", Username: "admin", Password: "pw", ProjectID: 1, Stages: OdooStages{New: 100}},
+		IMAP: IMAPCfg{Host: "imap.example.com", Username: "user@example.com", Password: "pw"},
+		SMTP: SMTPCfg{Host: "smtp.example.com", FromEmail: "support@example.com"},
+		App: App{Attachments: Attachments{
+			MaxSizeMB:  10,
+			MaxTotalMB: 25,
+			DenyTypes:  []string{".exe", "video/*"},
+			Offload:    &Offload{Endpoint: "http://minio:9000", Bucket: "helpdesk", AccessKey: "minio", SecretKey: "secret"},
+			Scan:       &Scan{Clamd: "tcp://clamav:3310"},
+			Original:   &Original{Compress: true, MaxSizeMB: 20},
+		}},
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Valid attachment config rejected: %v", err)
+	}
+
+	cfg.App.Attachments.MaxSizeMB = -1
+	cfg.App.Attachments.Offload = &Offload{Endpoint: "http://minio:9000", LinkExpiryHours: 200}
+	cfg.App.Attachments.Scan = &Scan{}
+	cfg.App.Attachments.Original = &Original{MaxSizeMB: -5}
+	err := cfg.Validate()
+	if err == nil {
+		t.Fatal("Expected validation errors")
+	}
+	for _, want := range []string{
+		"app.attachments: sizes must not be negative",
+		"app.attachments.offload: endpoint, bucket, access_key and secret_key are required",
+		"app.attachments.offload.link_expiry_hours must be between 1 and 168",
+		"app.attachments.scan.clamd is required",
+		"app.attachments.original.max_size_mb must not be negative",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Expected %q in %v", want, err)
+		}
+	}
+}
+
+func TestConfig_ReplyAuth(t *testing.T) {
+	cfg := &Config{
+		Odoo: Odoo{URL: "https://odoo.example.com", DB: "db", Username: "admin", Password: "pw", ProjectID: 1, Stages: OdooStages{New: 100}},
+		IMAP: IMAPCfg{Host: "imap.example.com", Username: "user@example.com", Password: "pw"},
+		SMTP: SMTPCfg{Host: "smtp.example.com", FromEmail: "support@example.com"},
+		App:  App{ReplyAuth: ReplyAuth{Policy: ReplyAuthNote, TokenSecret: "s3cret"}},
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Valid reply_auth config rejected: %v", err)
+	}
+	cfg.App.ReplyAuth.Policy = "drop"
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "app.reply_auth.policy must be new_ticket, note or quarantine") {
+		t.Errorf("Expected policy error, got %v", err)
+	}
+}
+
+func TestConfig_TemplatesNeedTag(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"new_ticket_subject.tmpl":    "[{{ .Tag }}] Potvrzení přijetí požadavku",
+		"agent_reply_subject.tmpl":   "Re: [{{ .TicketPrefix }}-#{{ .TaskID }}] {{ .Subject }}",
+		"ticket_closed_subject.tmpl": "[{{.Tag}}] Požadavek byl uzavřen",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cfg := &Config{
+		Odoo: Odoo{URL: "https://odoo.example.com", DB: "db", Username: "admin", Password: "pw", ProjectID: 1, Stages: OdooStages{New: 100}},
+		IMAP: IMAPCfg{Host: "imap.example.com", Username: "user@example.com", Password: "pw"},
+		SMTP: SMTPCfg{Host: "smtp.example.com", FromEmail: "support@example.com"},
+		App:  App{TemplatesDir: dir},
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Templates without a token secret rejected: %v", err)
+	}
+
+	cfg.App.ReplyAuth.TokenSecret = "s3cret"
+	err := cfg.Validate()
+	if err == nil || !strings.Contains(err.Error(), "templates: agent_reply_subject.tmpl must print {{ .Tag }}") {
+		t.Fatalf("Expected an error for the untagged subject, got %v", err)
+	}
+	if strings.Contains(err.Error(), "new_ticket_subject") || strings.Contains(err.Error(), "ticket_closed_subject") {
+		t.Errorf("Tagged subjects reported: %v", err)
+	}
+}
+
+func TestConfig_POP3(t *testing.T) {
+	cfg := &Config{
+		Odoo: Odoo{URL: "https://odoo.example.com", DB: "db", Username: "admin", Password: "pw", ProjectID: 1, Stages: OdooStages{New: 100}},
+		POP3: &POP3Cfg{Host: "pop.example.com", Username: "user@example.com", Password: "pw"},
+		SMTP: SMTPCfg{Host: "smtp.example.com", FromEmail: "support@example.com"},
+		Routes: []Route{
+			{Name: "small"},
+			{Name: "big", IMAP: IMAPCfg{Host: "imap.example.com", Username: "big@example.com", Password: "pw"}},
+		},
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Valid POP3 config rejected: %v", err)
+	}
+	routes := cfg.RouteConfigs()
+	if routes[0].POP3 == nil || routes[0].POP3.Host != "pop.example.com" {
+		t.Errorf("route small should inherit the POP3 mailbox, got %+v", routes[0].POP3)
+	}
+	if routes[1].POP3 != nil {
+		t.Errorf("route big has its own IMAP server, got POP3 %+v", routes[1].POP3)
+	}
+
+	cfg.App.Quarantine.Action = QuarantineFolder
+	cfg.POP3.Password = ""
+	err := cfg.Validate()
+	if err == nil {
+		t.Fatal("Expected POP3 errors")
+	}
+	for _, want := range []string{"routes[small]: pop3.password is required", "routes[small]: app.quarantine.action folder needs an IMAP mailbox"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Expected %q in %v", want, err)
+		}
+	}
+	if strings.Contains(err.Error(), "routes[big]: app.quarantine") {
+		t.Errorf("IMAP route must allow the folder action: %v", err)
+	}
+}
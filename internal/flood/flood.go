@@ -0,0 +1,158 @@
+// Package flood keeps a single sender from opening many tickets in a short time and
+// folds a mail sent twice into the ticket it repeats.
+package flood
+
+import (
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/anaryk/odoo-helpdesk-bridge/internal/config"
+	"github.com/anaryk/odoo-helpdesk-bridge/internal/state"
+)
+
+// replyPrefix matches the reply and forward markers mail clients put before a subject
+var replyPrefix = regexp.MustCompile(`(?i)^\s*((re|fw|fwd|aw|wg|sv|vs|odp|re\[\d+\])\s*:\s*)+`)
+
+// Guard applies app.flood to the tickets of one route
+type Guard struct {
+	cfg    config.Flood
+	route  string
+	window time.Duration
+	ignore map[string]bool
+	st     *state.Store
+}
+
+// Verdict says whether a sender may open another ticket
+type Verdict struct {
+	Throttled bool
+	Key       string // sender address or domain that reached its limit
+	Count     int    // tickets of the key within the window
+	TaskID    int64  // latest ticket of the key, where the throttled mail goes
+	Alert     bool   // first throttled mail of this flood
+}
+
+// New creates the guard of a route; state is shared, keys carry the route name
+func New(rc *config.Config, st *state.Store) *Guard {
+	g := &Guard{
+		cfg:    rc.App.Flood,
+		route:  rc.RouteName,
+		window: time.Duration(rc.App.Flood.WindowMinutes) * time.Minute,
+		ignore: make(map[string]bool),
+		st:     st,
+	}
+	for _, d := range rc.App.Flood.IgnoreDomains {
+		g.ignore[strings.ToLower(strings.TrimPrefix(strings.TrimSpace(d), "@"))] = true
+	}
+	return g
+}
+
+// Check decides whether the sender may open a new ticket at the given time. The
+// alert is handed out once per window, the mail after it is throttled silently.
+func (g *Guard) Check(from string, at time.Time) Verdict {
+	for _, k := range g.limits(from) {
+		act, err := g.st.GetSenderActivity(k.key)
+		if err != nil {
+			log.Error().Err(err).Str("key", k.key).Msg("load sender activity")
+			continue
+		}
+		n := len(recent(act.Tickets, at.Add(-g.window)))
+		if n < k.limit {
+			continue
+		}
+		v := Verdict{Throttled: true, Key: k.name, Count: n, TaskID: act.LastTaskID}
+		if !at.Before(act.AlertedUntil) {
+			v.Alert = true
+			act.AlertedUntil = at.Add(g.window)
+			if err := g.st.StoreSenderActivity(k.key, act); err != nil {
+				log.Error().Err(err).Str("key", k.key).Msg("store sender activity")
+			}
+		}
+		return v
+	}
+	return Verdict{}
+}
+
+// Duplicate returns the task opened for the same sender and subject within the
+// duplicate window. Mail without a subject is never a duplicate, it says nothing
+// about what it repeats.
+func (g *Guard) Duplicate(from, subject string, at time.Time) (int64, bool) {
+	if g.cfg.DuplicateWindowMinutes <= 0 || NormalizeSubject(subject) == "" {
+		return 0, false
+	}
+	id, opened, ok := g.st.GetRecentSubject(g.subjectKey(from, subject))
+	if !ok || at.Sub(opened) > g.duplicateWindow() {
+		return 0, false
+	}
+	return id, true
+}
+
+// Record notes a ticket opened for the sender
+func (g *Guard) Record(from, subject string, taskID int64, at time.Time) {
+	for _, k := range g.limits(from) {
+		act, err := g.st.GetSenderActivity(k.key)
+		if err != nil {
+			log.Error().Err(err).Str("key", k.key).Msg("load sender activity")
+			continue
+		}
+		act.Tickets = append(recent(act.Tickets, at.Add(-g.window)), at)
+		act.LastTaskID = taskID
+		if err := g.st.StoreSenderActivity(k.key, act); err != nil {
+			log.Error().Err(err).Str("key", k.key).Msg("store sender activity")
+		}
+	}
+	if g.cfg.DuplicateWindowMinutes > 0 && NormalizeSubject(subject) != "" {
+		if err := g.st.StoreRecentSubject(g.subjectKey(from, subject), taskID, at, at.Add(-g.duplicateWindow())); err != nil {
+			log.Error().Err(err).Int64("task_id", taskID).Msg("store recent subject")
+		}
+	}
+}
+
+// Window is how far back tickets count towards the limits
+func (g *Guard) Window() time.Duration { return g.window }
+
+type limit struct {
+	name, key string
+	limit     int
+}
+
+// limits lists the sender and domain limits that apply to the address
+func (g *Guard) limits(from string) []limit {
+	from = strings.ToLower(strings.TrimSpace(from))
+	var out []limit
+	if g.cfg.SenderLimit > 0 && from != "" {
+		out = append(out, limit{from, g.route + "/sender/" + from, g.cfg.SenderLimit})
+	}
+	if _, domain, ok := strings.Cut(from, "@"); ok && domain != "" && g.cfg.DomainLimit > 0 && !g.ignore[domain] {
+		out = append(out, limit{domain, g.route + "/domain/" + domain, g.cfg.DomainLimit})
+	}
+	return out
+}
+
+func (g *Guard) subjectKey(from, subject string) string {
+	return g.route + "/" + strings.ToLower(strings.TrimSpace(from)) + "/" + NormalizeSubject(subject)
+}
+
+func (g *Guard) duplicateWindow() time.Duration {
+	return time.Duration(g.cfg.DuplicateWindowMinutes) * time.Minute
+}
+
+// recent returns the times after since
+func recent(times []time.Time, since time.Time) []time.Time {
+	var out []time.Time
+	for _, t := range times {
+		if t.After(since) {
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+// NormalizeSubject lowercases a subject, drops reply and forward prefixes and
+// collapses whitespace, so resent mail matches its first copy
+func NormalizeSubject(s string) string {
+	s = replyPrefix.ReplaceAllString(s, "")
+	return strings.Join(strings.Fields(strings.ToLower(s)), " ")
+}
@@ -0,0 +1,117 @@
+package flood
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/anaryk/odoo-helpdesk-bridge/internal/config"
+	"github.com/anaryk/odoo-helpdesk-bridge/internal/state"
+)
+
+func newGuard(t *testing.T, f config.Flood) *Guard {
+	t.Helper()
+	st, err := state.New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("state.New() error = %v", err)
+	}
+	t.Cleanup(func() { _ = st.Close() })
+	rc := &config.Config{RouteName: "support"}
+	rc.App.Flood = f
+	return New(rc, st)
+}
+
+func TestGuard_SenderLimit(t *testing.T) {
+	g := newGuard(t, config.Flood{SenderLimit: 3, WindowMinutes: 10})
+	start := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	for i := range 3 {
+		at := start.Add(time.Duration(i) * time.Minute)
+		if v := g.Check("Monitor@Example.com", at); v.Throttled {
+			t.Fatalf("ticket %d throttled", i+1)
+		}
+		g.Record("monitor@example.com", "Disk full", int64(100+i), at)
+	}
+
+	v := g.Check("monitor@example.com", start.Add(4*time.Minute))
+	if !v.Throttled || !v.Alert || v.TaskID != 102 || v.Count != 3 || v.Key != "monitor@example.com" {
+		t.Errorf("4th mail = %+v, want throttled with alert", v)
+	}
+	if v := g.Check("monitor@example.com", start.Add(5*time.Minute)); !v.Throttled || v.Alert {
+		t.Errorf("5th mail = %+v, want throttled without alert", v)
+	}
+	if v := g.Check("other@example.com", start.Add(5*time.Minute)); v.Throttled {
+		t.Error("other sender must not be throttled")
+	}
+
+	// Once the first tickets leave the window the sender may open tickets again
+	if v := g.Check("monitor@example.com", start.Add(10*time.Minute+time.Second)); v.Throttled {
+		t.Errorf("after the window = %+v", v)
+	}
+}
+
+func TestGuard_DomainLimit(t *testing.T) {
+	g := newGuard(t, config.Flood{DomainLimit: 2, WindowMinutes: 10, IgnoreDomains: []string{"@gmail.com"}})
+	at := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	g.Record("a@acme.com", "one", 1, at)
+	g.Record("b@acme.com", "two", 2, at)
+	if v := g.Check("c@ACME.com", at); !v.Throttled || v.Key != "acme.com" || v.TaskID != 2 {
+		t.Errorf("acme.com = %+v, want throttled", v)
+	}
+
+	g.Record("a@gmail.com", "one", 3, at)
+	g.Record("b@gmail.com", "two", 4, at)
+	if v := g.Check("c@gmail.com", at); v.Throttled {
+		t.Error("ignored domain must not be throttled")
+	}
+}
+
+func TestGuard_Duplicate(t *testing.T) {
+	g := newGuard(t, config.Flood{DuplicateWindowMinutes: 30, WindowMinutes: 10})
+	at := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	g.Record("customer@example.com", "Printer   broken", 42, at)
+
+	if id, ok := g.Duplicate("Customer@example.com", "RE: Fwd: printer broken", at.Add(10*time.Minute)); !ok || id != 42 {
+		t.Errorf("Duplicate() = %d, %v, want 42", id, ok)
+	}
+	if _, ok := g.Duplicate("customer@example.com", "Printer broken", at.Add(31*time.Minute)); ok {
+		t.Error("mail after the window is not a duplicate")
+	}
+	if _, ok := g.Duplicate("other@example.com", "Printer broken", at); ok {
+		t.Error("mail from another sender is not a duplicate")
+	}
+	if _, ok := newGuard(t, config.Flood{}).Duplicate("customer@example.com", "Printer broken", at); ok {
+		t.Error("duplicate detection is off without a window")
+	}
+}
+
+func TestGuard_DuplicateWithoutSubject(t *testing.T) {
+	g := newGuard(t, config.Flood{DuplicateWindowMinutes: 30, WindowMinutes: 10})
+	at := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	g.Record("customer@example.com", "", 42, at)
+	g.Record("customer@example.com", "Fwd:", 43, at)
+
+	for _, subject := range []string{"", "Re:", "RE: Fwd: ", "  "} {
+		if id, ok := g.Duplicate("customer@example.com", subject, at.Add(time.Minute)); ok {
+			t.Errorf("Duplicate(%q) = %d, want no duplicate for an empty subject", subject, id)
+		}
+	}
+	if _, _, ok := g.st.GetRecentSubject(g.subjectKey("customer@example.com", "")); ok {
+		t.Error("an empty subject should not be recorded")
+	}
+}
+
+func TestNormalizeSubject(t *testing.T) {
+	tests := map[string]string{
+		"Re: RE: Printer":        "printer",
+		"Fwd:  Odp: Faktura 12 ": "faktura 12",
+		"AW: Re[2]: Server DOWN": "server down",
+		"Report: weekly":         "report: weekly",
+	}
+	for in, want := range tests {
+		if got := NormalizeSubject(in); got != want {
+			t.Errorf("NormalizeSubject(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package imap
+
+import (
+	"bytes"
+	"io"
+	"mime"
+	"strings"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-message"
+	gocharset "github.com/emersion/go-message/charset"
+	"github.com/rs/zerolog/log"
+)
+
+// The go-message charset package registers itself as message.CharsetReader, which
+// covers MIME parts. Envelope fields decoded by go-imap need the same reader.
+func init() {
+	imap.CharsetReader = charsetReader
+}
+
+// charsetReader converts from any IANA or WHATWG charset name to UTF-8
+func charsetReader(charset string, input io.Reader) (io.Reader, error) {
+	return gocharset.Reader(charset, input)
+}
+
+// decodeCharset converts text from the given charset to UTF-8. When the charset is
+// unknown the bytes are kept and invalid UTF-8 sequences become U+FFFD.
+func decodeCharset(data []byte, charset string) string {
+	charset = strings.ToLower(strings.TrimSpace(charset))
+	if charset == "" || charset == "utf-8" || charset == "us-ascii" {
+		return string(data)
+	}
+
+	r, err := charsetReader(charset, bytes.NewReader(data))
+	if err != nil {
+		log.Warn().Err(err).Str("charset", charset).Msg("unsupported charset, keeping raw text")
+		return strings.ToValidUTF8(string(data), "�")
+	}
+	decoded, err := io.ReadAll(r)
+	if err != nil {
+		log.Warn().Err(err).Str("charset", charset).Msg("charset conversion failed, keeping raw text")
+		return strings.ToValidUTF8(string(data), "�")
+	}
+	return string(decoded)
+}
+
+// partText returns the UTF-8 text of a part read through go-message. The transfer
+// encoding is already undone; the charset only when go-message did not report it unknown.
+func partText(body []byte, charset string, readErr error) string {
+	if message.IsUnknownCharset(readErr) {
+		return strings.TrimSpace(decodeCharset(body, charset))
+	}
+	return strings.TrimSpace(strings.ToValidUTF8(string(body), "�"))
+}
+
+// headerDecoder decodes RFC 2047 encoded words, keeping words in unknown charsets as raw text
+var headerDecoder = mime.WordDecoder{
+	CharsetReader: func(charset string, input io.Reader) (io.Reader, error) {
+		r, err := charsetReader(charset, input)
+		if err != nil {
+			log.Warn().Err(err).Str("charset", charset).Msg("unsupported header charset, keeping raw text")
+			return input, nil
+		}
+		return r, nil
+	},
+}
+
+// decodeHeader decodes an RFC 2047 header value such as a subject or sender name.
+// go-imap already decodes envelope fields it can read, this catches what it left encoded.
+func decodeHeader(s string) string {
+	if !strings.Contains(s, "=?") {
+		return s
+	}
+	decoded, err := headerDecoder.DecodeHeader(s)
+	if err != nil {
+		log.Debug().Err(err).Str("header", s).Msg("failed to decode header")
+		return s
+	}
+	return strings.ToValidUTF8(decoded, "�")
+}
@@ -0,0 +1,93 @@
+package imap
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDecodeCharset(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    []byte
+		charset string
+		want    string
+	}{
+		{"utf-8 untouched", []byte("Žluťoučký"), "UTF-8", "Žluťoučký"},
+		{"empty charset", []byte("plain"), "", "plain"},
+		{"iso-8859-2", []byte("\xe8ern\xfd k\xf9\xf2"), "iso-8859-2", "černý kůň"},
+		{"windows-1250", []byte("\x9eluou\xe8k\xfd"), "windows-1250", "žluoučký"},
+		{"iso-8859-15 euro", []byte("\xa4 5"), "ISO-8859-15", "€ 5"},
+		{"koi8-r", []byte("\xf0\xd2\xc9\xd7\xc5\xd4"), "koi8-r", "Привет"},
+		{"shift_jis", []byte("\x82\xb1\x82\xf1\x82\xc9\x82\xbf\x82\xcd"), "Shift_JIS", "こんにちは"},
+		{"gb2312", []byte("\xc4\xe3\xba\xc3"), "gb2312", "你好"},
+		{"unknown keeps ascii", []byte("hello \xff"), "x-unknown-charset", "hello �"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := decodeCharset(tt.data, tt.charset); got != tt.want {
+				t.Errorf("decodeCharset(%q) = %q, want %q", tt.charset, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeHeader(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"Plain subject", "Plain subject"},
+		{"=?utf-8?B?xIxlcnZlbsO9?=", "Červený"},
+		{"=?iso-8859-2?Q?=E8ern=FD_k=F9=F2?=", "černý kůň"},
+		{"=?koi8-r?B?8NLJ18XU?= world", "Привет world"},
+		{"=?x-unknown?Q?abc?=", "abc"},
+	}
+	for _, tt := range tests {
+		if got := decodeHeader(tt.in); got != tt.want {
+			t.Errorf("decodeHeader(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestParseEmailContent_Charsets(t *testing.T) {
+	tests := []struct {
+		name string
+		msg  string
+		want string
+	}{
+		{
+			name: "single part koi8-r",
+			msg:  "Content-Type: text/plain; charset=koi8-r\r\n\r\n\xf0\xd2\xc9\xd7\xc5\xd4\r\n",
+			want: "Привет",
+		},
+		{
+			name: "multipart iso-8859-2 quoted-printable",
+			msg: "Content-Type: multipart/mixed; boundary=b\r\n\r\n" +
+				"--b\r\nContent-Type: text/plain; charset=iso-8859-2\r\nContent-Transfer-Encoding: quoted-printable\r\n\r\n" +
+				"=E8ern=FD k=F9=F2 a=3Db\r\n--b--\r\n",
+			want: "černý kůň a=b",
+		},
+		{
+			name: "nested alternative windows-1250 base64",
+			msg: "Content-Type: multipart/mixed; boundary=b\r\n\r\n" +
+				"--b\r\nContent-Type: multipart/alternative; boundary=c\r\n\r\n" +
+				"--c\r\nContent-Type: text/plain; charset=windows-1250\r\nContent-Transfer-Encoding: base64\r\n\r\n" +
+				"nmx1b3Xoa/0=\r\n--c--\r\n--b--\r\n",
+			want: "žluoučký",
+		},
+		{
+			name: "unknown charset falls back to raw text",
+			msg: "Content-Type: multipart/mixed; boundary=b\r\n\r\n" +
+				"--b\r\nContent-Type: text/plain; charset=x-martian\r\n\r\nhello\r\n--b--\r\n",
+			want: "hello",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, _ := parseEmailContent(strings.NewReader(tt.msg))
+			if strings.TrimSpace(got) != tt.want {
+				t.Errorf("parseEmailContent() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,79 @@
+package imap
+
+import (
+	"bytes"
+	"mime"
+	"net/mail"
+	"regexp"
+	"strings"
+)
+
+// MessageClass tells ordinary mail apart from messages sent by machines.
+type MessageClass string
+
+const (
+	// ClassNormal is a message written by a person
+	ClassNormal MessageClass = ""
+	// ClassAutoReply covers out-of-office and other automatic responses
+	ClassAutoReply MessageClass = "auto_reply"
+	// ClassBounce is a delivery status notification about mail that could not be delivered
+	ClassBounce MessageClass = "bounce"
+	// ClassLoop is mail sent by the bridge itself that came back into the inbox
+	ClassLoop MessageClass = "loop"
+)
+
+var (
+	// Recipient the DSN reports as failed, RFC 3464
+	finalRecipientRe = regexp.MustCompile(`(?im)^(?:Final|Original)-Recipient:\s*rfc822;\s*<?([^\s<>]+@[^\s<>]+)>?`)
+	// Message-ID header of the returned message embedded in a DSN
+	embeddedMessageIDRe = regexp.MustCompile(`(?im)^Message-ID:\s*<([^>\s]+)>`)
+)
+
+// classify inspects the headers of a message to detect auto-replies, bounces and our own mail
+func classify(h mail.Header, fromAddr string, ownAddresses []string) MessageClass {
+	from := strings.ToLower(strings.TrimSpace(fromAddr))
+	for _, own := range ownAddresses {
+		if own = strings.ToLower(strings.TrimSpace(own)); own != "" && own == from {
+			return ClassLoop
+		}
+	}
+
+	if mt, params, err := mime.ParseMediaType(h.Get("Content-Type")); err == nil &&
+		mt == "multipart/report" && strings.EqualFold(params["report-type"], "delivery-status") {
+		return ClassBounce
+	}
+	if local, _, _ := strings.Cut(from, "@"); local == "mailer-daemon" || local == "postmaster" {
+		return ClassBounce
+	}
+
+	// RFC 3834: anything but "no" is machine generated
+	if v := strings.ToLower(strings.TrimSpace(h.Get("Auto-Submitted"))); v != "" && v != "no" {
+		return ClassAutoReply
+	}
+	if h.Get("X-Autoreply") != "" || h.Get("X-Autorespond") != "" {
+		return ClassAutoReply
+	}
+	switch strings.ToLower(strings.TrimSpace(h.Get("Precedence"))) {
+	case "auto_reply", "bulk", "junk":
+		return ClassAutoReply
+	}
+	return ClassNormal
+}
+
+// bounceDetails extracts the failed recipient and the Message-ID of the returned mail from a DSN
+func bounceDetails(raw []byte) (recipient, originalID string) {
+	if m := finalRecipientRe.FindSubmatch(raw); m != nil {
+		recipient = strings.ToLower(string(m[1]))
+	}
+	// Skip the DSN's own header block, the first Message-ID below it belongs to the returned mail
+	body := raw
+	if i := bytes.Index(raw, []byte("\r\n\r\n")); i >= 0 {
+		body = raw[i:]
+	} else if i := bytes.Index(raw, []byte("\n\n")); i >= 0 {
+		body = raw[i:]
+	}
+	if m := embeddedMessageIDRe.FindSubmatch(body); m != nil {
+		originalID = string(m[1])
+	}
+	return recipient, originalID
+}
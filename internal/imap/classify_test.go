@@ -0,0 +1,71 @@
+package imap
+
+import (
+	"net/mail"
+	"strings"
+	"testing"
+)
+
+func TestClassify(t *testing.T) {
+	own := []string{"Support@Example.com"}
+	tests := []struct {
+		name     string
+		headers  string
+		from     string
+		expected MessageClass
+	}{
+		{"Normal mail", "Subject: Help\r\n", "customer@example.org", ClassNormal},
+		{"Auto-Submitted no", "Auto-Submitted: no\r\n", "customer@example.org", ClassNormal},
+		{"Auto-Submitted auto-replied", "Auto-Submitted: auto-replied\r\n", "customer@example.org", ClassAutoReply},
+		{"X-Autoreply", "X-Autoreply: yes\r\n", "customer@example.org", ClassAutoReply},
+		{"Precedence bulk", "Precedence: bulk\r\n", "customer@example.org", ClassAutoReply},
+		{"Precedence list is a person", "Precedence: list\r\n", "customer@example.org", ClassNormal},
+		{"DSN report", "Content-Type: multipart/report; report-type=delivery-status; boundary=\"x\"\r\n", "mail@example.org", ClassBounce},
+		{"Mailer daemon", "Subject: Undelivered Mail\r\n", "MAILER-DAEMON@mx.example.org", ClassBounce},
+		{"Own address", "Subject: Re: [ML-#1] Test\r\n", "support@example.com", ClassLoop},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg, err := mail.ReadMessage(strings.NewReader(tt.headers + "\r\nbody"))
+			if err != nil {
+				t.Fatalf("ReadMessage: %v", err)
+			}
+			if got := classify(msg.Header, tt.from, own); got != tt.expected {
+				t.Errorf("classify() = %q, want %q", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestBounceDetails(t *testing.T) {
+	raw := "From: MAILER-DAEMON@mx.example.org\r\n" +
+		"Message-ID: <dsn-1@mx.example.org>\r\n" +
+		"Content-Type: multipart/report; report-type=delivery-status; boundary=\"b\"\r\n" +
+		"\r\n" +
+		"--b\r\n" +
+		"Content-Type: text/plain\r\n\r\nDelivery failed.\r\n" +
+		"--b\r\n" +
+		"Content-Type: message/delivery-status\r\n\r\n" +
+		"Reporting-MTA: dns; mx.example.org\r\n\r\n" +
+		"Final-Recipient: rfc822; Gone@Customer.example.com\r\n" +
+		"Action: failed\r\n" +
+		"--b\r\n" +
+		"Content-Type: text/rfc822-headers\r\n\r\n" +
+		"Message-ID: <ml-42.new.0@example.com>\r\n" +
+		"Subject: [ML-#42] Printer\r\n" +
+		"--b--\r\n"
+
+	recipient, originalID := bounceDetails([]byte(raw))
+	if recipient != "gone@customer.example.com" {
+		t.Errorf("Expected recipient gone@customer.example.com, got %q", recipient)
+	}
+	if originalID != "ml-42.new.0@example.com" {
+		t.Errorf("Expected original Message-ID ml-42.new.0@example.com, got %q", originalID)
+	}
+
+	em := Email{BouncedMessageID: originalID, InReplyTo: "other@example.com"}
+	if ids := em.ThreadIDs(); len(ids) != 2 || ids[0] != originalID {
+		t.Errorf("Bounced Message-ID should be looked up first, got %v", ids)
+	}
+}
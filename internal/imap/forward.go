@@ -0,0 +1,182 @@
+package imap
+
+import (
+	"bytes"
+	"io"
+	"net/mail"
+	"regexp"
+	"strings"
+
+	"github.com/emersion/go-message"
+)
+
+// forwardHeaderLookahead is how many lines below the forward marker the original headers are searched
+const forwardHeaderLookahead = 10
+
+// Forwarded is the original mail inside a message someone forwarded to the helpdesk.
+type Forwarded struct {
+	FromName  string
+	FromEmail string
+	Subject   string
+	Body      string
+	Note      string // what the forwarder wrote above the original
+	Attached  bool   // the original came as a message/rfc822 part, not quoted in the body
+}
+
+var (
+	// forwardMarker starts a forwarded block in the clients and languages we see
+	forwardMarker  = regexp.MustCompile(`(?i)^(-{2,}\s*(forwarded message|original message|přeposlaná zpráva|původní zpráva|preposlaná správa|pôvodná správa|weitergeleitete nachricht|ursprüngliche nachricht)\s*-{2,}|_{20,}|begin forwarded message:|začátek přeposlané zprávy:)$`)
+	forwardFrom    = regexp.MustCompile(`(?i)^(from|od|von):\s*(.+)$`)
+	forwardSubject = regexp.MustCompile(`(?i)^(subject|předmět|predmet|betreff):\s*(.*)$`)
+	// forwardHeader is any other header line of the block
+	forwardHeader = regexp.MustCompile(`(?i)^(date|sent|to|cc|datum|odesláno|odoslané|komu|kopie|kópia|gesendet|an|reply-to):`)
+	// mailtoAddress matches Outlook's `Name [mailto:addr]` form
+	mailtoAddress = regexp.MustCompile(`(?i)^(.*?)\s*\[mailto:([^\]\s]+)\]$`)
+	// forwardPrefix is the Fwd:/Fw: style prefix clients add to the subject
+	forwardPrefix = regexp.MustCompile(`(?i)^\s*((fwd?|wg|tr|přep)\s*:\s*)+`)
+)
+
+// ParseForwarded finds a forwarded message quoted in a plain text body and returns its
+// original sender, subject and text. It returns nil when the body has no forward block
+// with a usable From line.
+func ParseForwarded(body string) *Forwarded {
+	lines := strings.Split(strings.ReplaceAll(body, "\r\n", "\n"), "\n")
+	for i, ln := range lines {
+		if !forwardMarker.MatchString(strings.TrimSpace(ln)) {
+			continue
+		}
+		fw, end := parseForwardHeaders(lines, i+1)
+		if fw == nil {
+			continue
+		}
+		fw.Note = strings.TrimSpace(strings.Join(lines[:i], "\n"))
+		fw.Body = strings.TrimSpace(strings.Join(lines[end:], "\n"))
+		return fw
+	}
+	return nil
+}
+
+// parseForwardHeaders reads the From/Subject block starting at line i and returns
+// the index of the first body line
+func parseForwardHeaders(lines []string, i int) (*Forwarded, int) {
+	var fw *Forwarded
+	subject := ""
+	end := i
+	for k := i; k < len(lines) && k < i+forwardHeaderLookahead; k++ {
+		// Outlook HTML turned to text wraps the header names in asterisks
+		trim := strings.TrimSpace(strings.ReplaceAll(lines[k], "*", ""))
+		end = k + 1
+		switch {
+		case trim == "":
+			if fw != nil {
+				return withSubject(fw, subject), end
+			}
+			continue
+		case forwardFrom.MatchString(trim):
+			name, addr := parseForwardAddress(forwardFrom.FindStringSubmatch(trim)[2])
+			if addr == "" {
+				return nil, 0
+			}
+			fw = &Forwarded{FromName: name, FromEmail: addr}
+		case forwardSubject.MatchString(trim):
+			subject = strings.TrimSpace(forwardSubject.FindStringSubmatch(trim)[2])
+		case forwardHeader.MatchString(trim):
+		default:
+			// The headers ended without a blank line
+			if fw != nil {
+				return withSubject(fw, subject), k
+			}
+			return nil, 0
+		}
+	}
+	if fw == nil {
+		return nil, 0
+	}
+	return withSubject(fw, subject), end
+}
+
+func withSubject(fw *Forwarded, subject string) *Forwarded {
+	fw.Subject = subject
+	return fw
+}
+
+// parseForwardAddress splits "Name <addr>", "Name [mailto:addr]" or a bare address
+func parseForwardAddress(s string) (string, string) {
+	s = strings.TrimSpace(s)
+	if m := mailtoAddress.FindStringSubmatch(s); m != nil {
+		return strings.Trim(m[1], `" `), strings.ToLower(m[2])
+	}
+	if a, err := mail.ParseAddress(s); err == nil {
+		return a.Name, strings.ToLower(a.Address)
+	}
+	// Quoted text loses the quotes around names with commas or dots
+	if open := strings.LastIndex(s, "<"); open >= 0 && strings.HasSuffix(s, ">") {
+		addr := s[open+1 : len(s)-1]
+		if strings.Contains(addr, "@") {
+			return strings.Trim(s[:open], `" `), strings.ToLower(addr)
+		}
+	}
+	if strings.Contains(s, "@") && !strings.ContainsAny(s, " <>") {
+		return "", strings.ToLower(s)
+	}
+	return "", ""
+}
+
+// StripForwardPrefix removes Fwd:, Fw: and similar prefixes from a subject.
+func StripForwardPrefix(subject string) string {
+	return strings.TrimSpace(forwardPrefix.ReplaceAllString(subject, ""))
+}
+
+// extractAttachedForward returns the first message/rfc822 part of the mail, nil when there is none
+func extractAttachedForward(raw []byte) *Forwarded {
+	e, err := message.Read(bytes.NewReader(raw))
+	if err != nil && !message.IsUnknownCharset(err) {
+		return nil
+	}
+	return findForwardedPart(e, 0)
+}
+
+func findForwardedPart(e *message.Entity, depth int) *Forwarded {
+	if depth > maxMIMEDepth {
+		return nil
+	}
+	if mr := e.MultipartReader(); mr != nil {
+		for {
+			p, err := mr.NextPart()
+			if err == io.EOF || p == nil {
+				return nil
+			}
+			if err != nil && !message.IsUnknownCharset(err) {
+				return nil
+			}
+			if fw := findForwardedPart(p, depth+1); fw != nil {
+				return fw
+			}
+		}
+	}
+
+	if ct, _, _ := e.Header.ContentType(); ct != "message/rfc822" {
+		return nil
+	}
+	inner, err := io.ReadAll(e.Body)
+	if err != nil {
+		return nil
+	}
+	hdr, err := mail.ReadMessage(bytes.NewReader(inner))
+	if err != nil {
+		return nil
+	}
+	parser := mail.AddressParser{WordDecoder: &headerDecoder}
+	from, err := parser.Parse(hdr.Header.Get("From"))
+	if err != nil {
+		return nil
+	}
+	body, _ := parseEmailContent(bytes.NewReader(inner))
+	return &Forwarded{
+		FromName:  from.Name,
+		FromEmail: strings.ToLower(from.Address),
+		Subject:   decodeHeader(hdr.Header.Get("Subject")),
+		Body:      strings.TrimSpace(body),
+		Attached:  true,
+	}
+}
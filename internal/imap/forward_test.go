@@ -0,0 +1,151 @@
+package imap
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseForwarded(t *testing.T) {
+	tests := []struct {
+		name      string
+		body      string
+		wantName  string
+		wantEmail string
+		wantSubj  string
+		wantBody  string
+		wantNote  string
+	}{
+		{
+			name: "gmail",
+			body: "Can you take this one?\n\n" +
+				"---------- Forwarded message ---------\n" +
+				"From: Jan Novák <Jan.Novak@customer.example.com>\n" +
+				"Date: Mon, 1 Jul 2024 at 10:00\n" +
+				"Subject: Printer on 2nd floor\n" +
+				"To: Operator <operator@example.com>\n" +
+				"\n" +
+				"The printer is jammed again.\n",
+			wantName:  "Jan Novák",
+			wantEmail: "jan.novak@customer.example.com",
+			wantSubj:  "Printer on 2nd floor",
+			wantBody:  "The printer is jammed again.",
+			wantNote:  "Can you take this one?",
+		},
+		{
+			name: "outlook",
+			body: "FYI\n" +
+				"________________________________\n" +
+				"*From:* Novák, Jan [mailto:jan@customer.example.com]\n" +
+				"*Sent:* Monday, July 1, 2024 10:00 AM\n" +
+				"*To:* Operator\n" +
+				"*Subject:* VPN\n" +
+				"\n" +
+				"VPN does not connect.",
+			wantName:  "Novák, Jan",
+			wantEmail: "jan@customer.example.com",
+			wantSubj:  "VPN",
+			wantBody:  "VPN does not connect.",
+			wantNote:  "FYI",
+		},
+		{
+			name: "czech",
+			body: "-------- Přeposlaná zpráva --------\n" +
+				"Předmět: Faktura\n" +
+				"Datum: 1. 7. 2024\n" +
+				"Od: petr@customer.example.com\n" +
+				"Komu: operator@example.com\n" +
+				"\n" +
+				"Dobrý den, faktura nesedí.",
+			wantEmail: "petr@customer.example.com",
+			wantSubj:  "Faktura",
+			wantBody:  "Dobrý den, faktura nesedí.",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fw := ParseForwarded(tt.body)
+			if fw == nil {
+				t.Fatal("ParseForwarded() = nil")
+			}
+			if fw.FromName != tt.wantName || fw.FromEmail != tt.wantEmail {
+				t.Errorf("sender = %q <%s>, want %q <%s>", fw.FromName, fw.FromEmail, tt.wantName, tt.wantEmail)
+			}
+			if fw.Subject != tt.wantSubj {
+				t.Errorf("Subject = %q, want %q", fw.Subject, tt.wantSubj)
+			}
+			if fw.Body != tt.wantBody {
+				t.Errorf("Body = %q, want %q", fw.Body, tt.wantBody)
+			}
+			if fw.Note != tt.wantNote {
+				t.Errorf("Note = %q, want %q", fw.Note, tt.wantNote)
+			}
+			if fw.Attached {
+				t.Error("quoted forward must not be marked as attached")
+			}
+		})
+	}
+
+	for _, body := range []string{
+		"Hello, nothing forwarded here.",
+		"---------- Forwarded message ---------\nthe headers were removed\n\nbody",
+		"Meeting notes\nFrom: the team\n",
+	} {
+		if fw := ParseForwarded(body); fw != nil {
+			t.Errorf("ParseForwarded(%q) = %+v, want nil", body, fw)
+		}
+	}
+}
+
+func TestExtractAttachedForward(t *testing.T) {
+	raw := "From: Operator <operator@example.com>\r\n" +
+		"Subject: Fwd: Broken login\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: multipart/mixed; boundary=outer\r\n" +
+		"\r\n" +
+		"--outer\r\n" +
+		"Content-Type: text/plain\r\n" +
+		"\r\n" +
+		"Please handle.\r\n" +
+		"--outer\r\n" +
+		"Content-Type: message/rfc822\r\n" +
+		"Content-Disposition: attachment; filename=original.eml\r\n" +
+		"\r\n" +
+		"From: =?utf-8?q?Jan_Nov=C3=A1k?= <jan@customer.example.com>\r\n" +
+		"Subject: =?utf-8?q?P=C5=99ihl=C3=A1=C5=A1en=C3=AD?=\r\n" +
+		"Content-Type: text/plain; charset=utf-8\r\n" +
+		"\r\n" +
+		"I cannot log in.\r\n" +
+		"--outer--\r\n"
+
+	fw := extractAttachedForward([]byte(raw))
+	if fw == nil {
+		t.Fatal("extractAttachedForward() = nil")
+	}
+	if fw.FromName != "Jan Novák" || fw.FromEmail != "jan@customer.example.com" {
+		t.Errorf("sender = %q <%s>", fw.FromName, fw.FromEmail)
+	}
+	if fw.Subject != "Přihlášení" {
+		t.Errorf("Subject = %q", fw.Subject)
+	}
+	if !strings.Contains(fw.Body, "I cannot log in.") || !fw.Attached {
+		t.Errorf("unexpected forward %+v", fw)
+	}
+
+	if fw := extractAttachedForward([]byte(testMessage("plain"))); fw != nil {
+		t.Errorf("plain mail has no attached forward, got %+v", fw)
+	}
+}
+
+func TestStripForwardPrefix(t *testing.T) {
+	for in, want := range map[string]string{
+		"Fwd: Printer":      "Printer",
+		"FW: Fwd: Printer":  "Printer",
+		"WG: Drucker":       "Drucker",
+		"Re: Printer":       "Re: Printer",
+		"Forward planning ": "Forward planning",
+	} {
+		if got := StripForwardPrefix(in); got != want {
+			t.Errorf("StripForwardPrefix(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package imap
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"github.com/emersion/go-imap/client"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// idleRestartInterval re-issues IDLE before servers drop idle clients (RFC 2177 allows 29 minutes)
+	idleRestartInterval = 25 * time.Minute
+)
+
+// ErrIdleUnsupported is returned by Watcher.Run when the server does not advertise IDLE.
+var ErrIdleUnsupported = errors.New("imap: server does not support IDLE")
+
+// Watcher keeps a dedicated IMAP connection in IDLE state and signals when
+// the server announces new messages in the watched folder.
+type Watcher struct {
+	cfg    Config
+	notify chan struct{}
+	active atomic.Bool
+}
+
+// NewWatcher creates a watcher for the folder configured in cfg.
+func NewWatcher(cfg Config) *Watcher {
+	return &Watcher{cfg: cfg, notify: make(chan struct{}, 1)}
+}
+
+// C returns the channel signalled when new mail may be waiting.
+// Bursts of server notifications are coalesced into a single signal.
+func (w *Watcher) C() <-chan struct{} { return w.notify }
+
+// Active reports whether the IDLE connection is currently established.
+// Callers should poll the mailbox themselves while it is not.
+func (w *Watcher) Active() bool { return w.active.Load() }
+
+// Run idles until ctx is cancelled, reconnecting after connection failures.
+// It returns ErrIdleUnsupported right away when the server lacks IDLE.
+func (w *Watcher) Run(ctx context.Context) error {
+	for {
+		err := w.idle(ctx)
+		w.active.Store(false)
+		if ctx.Err() != nil {
+			return nil
+		}
+		if errors.Is(err, ErrIdleUnsupported) {
+			return err
+		}
+
+		log.Warn().Err(err).Dur("delay", retryDelay).Msg("IMAP IDLE connection lost, reconnecting")
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(retryDelay):
+		}
+	}
+}
+
+// idle runs a single IDLE session and returns when the connection fails or ctx is cancelled
+func (w *Watcher) idle(ctx context.Context) error {
+	c, err := dial(w.cfg)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = c.Logout() }()
+
+	ok, err := c.Support("IDLE")
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrIdleUnsupported
+	}
+
+	// Read-only select, the watcher never touches flags
+	if _, err := c.Select(w.cfg.Folder, true); err != nil {
+		return err
+	}
+
+	// The client blocks its reader until updates are consumed, so drain continuously
+	updates := make(chan client.Update, maxChannelBuffer)
+	c.Updates = updates
+
+	stop := make(chan struct{})
+	done := make(chan error, 1)
+	go func() {
+		done <- c.Idle(stop, &client.IdleOptions{LogoutTimeout: idleRestartInterval, PollInterval: -1})
+	}()
+
+	w.active.Store(true)
+	log.Info().Str("host", w.cfg.Host).Str("folder", w.cfg.Folder).Msg("IMAP IDLE started")
+
+	// Mail may have arrived while we were disconnected
+	w.signal()
+
+	for {
+		select {
+		case <-ctx.Done():
+			close(stop)
+			drainUntilDone(updates, done)
+			return ctx.Err()
+		case err := <-done:
+			if err == nil {
+				err = errors.New("IDLE ended unexpectedly")
+			}
+			return err
+		case u := <-updates:
+			if _, ok := u.(*client.MailboxUpdate); ok {
+				log.Debug().Str("folder", w.cfg.Folder).Msg("IMAP IDLE mailbox update received")
+				w.signal()
+			}
+		}
+	}
+}
+
+// signal wakes up the consumer unless a wake-up is already pending
+func (w *Watcher) signal() {
+	select {
+	case w.notify <- struct{}{}:
+	default:
+	}
+}
+
+// drainUntilDone discards updates until the IDLE command has terminated
+func drainUntilDone(updates <-chan client.Update, done <-chan error) {
+	for {
+		select {
+		case <-updates:
+		case <-done:
+			return
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package imap
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/backend"
+	"github.com/emersion/go-imap/backend/memory"
+	"github.com/emersion/go-imap/client"
+	"github.com/emersion/go-imap/server"
+)
+
+// updaterBackend adds unilateral update support to the memory backend so tests can announce new mail
+type updaterBackend struct {
+	*memory.Backend
+	updates chan backend.Update
+}
+
+func (b *updaterBackend) Updates() <-chan backend.Update { return b.updates }
+
+// usePlainDialer makes dial() talk plain IMAP to the in-process test servers
+func usePlainDialer(t *testing.T) {
+	t.Helper()
+	orig := dialTLS
+	dialTLS = func(addr string, _ *tls.Config) (*client.Client, error) { return client.Dial(addr) }
+	t.Cleanup(func() { dialTLS = orig })
+}
+
+// listenLocal returns a loopback listener and the matching client config
+func listenLocal(t *testing.T) (net.Listener, Config) {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	host, port, _ := net.SplitHostPort(l.Addr().String())
+	p, _ := strconv.Atoi(port)
+	return l, Config{Host: host, Port: p, Username: "username", Password: "password", Folder: "INBOX"}
+}
+
+// startTestServer serves the given backend on a loopback port
+func startTestServer(t *testing.T, be backend.Backend) Config {
+	t.Helper()
+	usePlainDialer(t)
+	l, cfg := listenLocal(t)
+	s := server.New(be)
+	s.AllowInsecureAuth = true
+	go func() { _ = s.Serve(l) }()
+	t.Cleanup(func() { _ = s.Close() })
+	return cfg
+}
+
+func waitSignal(t *testing.T, w *Watcher, what string) {
+	t.Helper()
+	select {
+	case <-w.C():
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting for %s", what)
+	}
+}
+
+func TestWatcher_SignalsOnNewMail(t *testing.T) {
+	be := &updaterBackend{Backend: memory.New(), updates: make(chan backend.Update, 1)}
+	cfg := startTestServer(t, be)
+
+	w := NewWatcher(cfg)
+	ctx, cancel := context.WithCancel(context.Background())
+	runErr := make(chan error, 1)
+	go func() { runErr <- w.Run(ctx) }()
+
+	// Initial wake-up once the IDLE connection is up
+	waitSignal(t, w, "initial signal")
+	if !w.Active() {
+		t.Error("Watcher should be active after IDLE started")
+	}
+
+	status := imap.NewMailboxStatus("INBOX", []imap.StatusItem{imap.StatusMessages})
+	status.Messages = 2
+	be.updates <- &backend.MailboxUpdate{Update: backend.NewUpdate("username", "INBOX"), MailboxStatus: status}
+
+	waitSignal(t, w, "EXISTS signal")
+
+	cancel()
+	select {
+	case err := <-runErr:
+		if err != nil {
+			t.Errorf("Run() should return nil after cancel, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run() did not return after cancel")
+	}
+	if w.Active() {
+		t.Error("Watcher should not be active after Run returned")
+	}
+}
+
+func TestWatcher_SignalsAreCoalesced(t *testing.T) {
+	w := NewWatcher(Config{})
+	w.signal()
+	w.signal()
+	w.signal()
+
+	<-w.C()
+	select {
+	case <-w.C():
+		t.Error("Expected pending signals to be coalesced into one")
+	default:
+	}
+}
+
+func TestWatcher_IdleUnsupported(t *testing.T) {
+	usePlainDialer(t)
+	l, cfg := listenLocal(t)
+	t.Cleanup(func() { _ = l.Close() })
+
+	// Minimal server that never advertises IDLE
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go serveWithoutIdle(conn)
+		}
+	}()
+
+	w := NewWatcher(cfg)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	err := w.Run(ctx)
+	if !errors.Is(err, ErrIdleUnsupported) {
+		t.Fatalf("Run() error = %v, want ErrIdleUnsupported", err)
+	}
+	if w.Active() {
+		t.Error("Watcher should not be active when IDLE is unsupported")
+	}
+}
+
+func serveWithoutIdle(conn net.Conn) {
+	defer func() { _ = conn.Close() }()
+	w := bufio.NewWriter(conn)
+	reply := func(lines ...string) {
+		for _, l := range lines {
+			_, _ = w.WriteString(l + "\r\n")
+		}
+		_ = w.Flush()
+	}
+
+	reply("* OK IMAP4rev1 test server ready")
+	sc := bufio.NewScanner(conn)
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		tag, cmd := fields[0], strings.ToUpper(fields[1])
+		switch cmd {
+		case "CAPABILITY":
+			reply("* CAPABILITY IMAP4rev1 AUTH=PLAIN", tag+" OK CAPABILITY completed")
+		case "LOGOUT":
+			reply("* BYE logging out", tag+" OK LOGOUT completed")
+			return
+		default:
+			reply(tag + " OK " + cmd + " completed")
+		}
+	}
+}
@@ -2,6 +2,7 @@
 package imap
 
 import (
+	"bytes"
 	"context"
 	"crypto/tls"
 	"encoding/base64"
@@ -10,8 +11,9 @@ import (
 	"mime"
 	"mime/quotedprintable"
 	"net"
+	"net/mail"
 	"net/textproto"
-	"regexp"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
@@ -20,15 +22,16 @@ import (
 	"github.com/emersion/go-imap/client"
 	"github.com/emersion/go-message"
 	"github.com/rs/zerolog/log"
+
+	"github.com/anaryk/odoo-helpdesk-bridge/internal/oauth"
+	"github.com/anaryk/odoo-helpdesk-bridge/internal/state"
+	"github.com/anaryk/odoo-helpdesk-bridge/internal/ticket"
 )
 
 const (
 	// maxChannelBuffer defines the buffer size for IMAP message channels
 	maxChannelBuffer = 50
 
-	// maxRegexGroups expected from ticket ID regex matching
-	maxRegexGroups = 3
-
 	// maxHeaderLines to log during email parsing debug
 	maxHeaderLines = 10
 
@@ -43,47 +46,104 @@ const (
 	maxRetryAttempts = 3
 	retryDelay       = 5 * time.Second
 
-	// Byte boundaries for charset decoding
-	asciiUpperBound     = 0x80 // Bytes below this are ASCII
-	latin1ExtendedStart = 0xA0 // Start of Latin-1 extended characters
+	// oauthTokenTimeout bounds fetching an access token before login
+	oauthTokenTimeout = 30 * time.Second
 )
 
 // Config holds IMAP client configuration parameters.
 type Config struct {
 	Host, Username, Password, Folder, SearchTo, ProcessedKeyword string
 	Port                                                         int
+	OwnAddresses                                                 []string // senders whose mail is classified as ClassLoop
+	Strip                                                        StripConfig
+
+	// AuthServID names the receiving server whose Authentication-Results are read;
+	// headers of anyone else are ignored, and without it Email.Auth stays empty
+	AuthServID string
+
+	// OAuth replaces the password login with XOAUTH2 or OAUTHBEARER when set
+	OAuth          *oauth.TokenSource
+	OAuthMechanism string
+
+	// SkipPartsLarger leaves message parts above this many bytes on the server,
+	// they end up in Email.Skipped; zero downloads everything
+	SkipPartsLarger int64
 }
 
 // Client represents an IMAP email client connection.
 type Client struct {
-	cfg     Config
-	c       *client.Client
-	mailbox string
+	cfg         Config
+	c           *client.Client
+	mailbox     string
+	uidValidity uint32
+	st          *state.Store
+	stripper    *Stripper
+
+	// UIDs handed out by FetchUnseen that have not been marked seen yet;
+	// the stored cursor never moves past the lowest of them
+	pending    map[uint32]bool
+	fetchedMax uint32
 }
 
+// dialTLS opens the TLS connection to the server; tests swap it for a plain dialer.
+var dialTLS = client.DialTLS
+
 // New creates a new IMAP client with the given configuration.
-func New(cfg Config) (*Client, error) {
-	cl := &Client{cfg: cfg}
-	err := cl.connect()
+// The store keeps the per-folder UID cursor; when it is nil every unseen message is fetched.
+func New(cfg Config, st *state.Store) (*Client, error) {
+	stripper, err := NewStripper(cfg.Strip)
+	if err != nil {
+		return nil, err
+	}
+	cl := &Client{cfg: cfg, st: st, stripper: stripper, pending: make(map[uint32]bool)}
+	err = cl.connect()
 	if err != nil {
 		return nil, err
 	}
 	return cl, nil
 }
 
-// connect establishes a connection to the IMAP server
-func (cl *Client) connect() error {
-	addr := net.JoinHostPort(cl.cfg.Host, itoa(cl.cfg.Port))
+// dial opens an authenticated connection to the IMAP server without selecting a folder
+func dial(cfg Config) (*client.Client, error) {
+	addr := net.JoinHostPort(cfg.Host, itoa(cfg.Port))
 	tlsConf := &tls.Config{
-		ServerName: cl.cfg.Host,
+		ServerName: cfg.Host,
 		MinVersion: tls.VersionTLS12,
 	}
-	c, err := client.DialTLS(addr, tlsConf)
+	c, err := dialTLS(addr, tlsConf)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	if err := c.Login(cl.cfg.Username, cl.cfg.Password); err != nil {
+	if err := login(c, cfg); err != nil {
 		_ = c.Logout()
+		return nil, err
+	}
+	return c, nil
+}
+
+// login authenticates with the OAuth2 token source when configured, with the password otherwise
+func login(c *client.Client, cfg Config) error {
+	if cfg.OAuth == nil {
+		return c.Login(cfg.Username, cfg.Password)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), oauthTokenTimeout)
+	defer cancel()
+	token, err := cfg.OAuth.Token(ctx)
+	if err != nil {
+		return err
+	}
+	if err := c.Authenticate(oauth.NewSASLClient(cfg.OAuthMechanism, cfg.Username, cfg.Host, cfg.Port, token)); err != nil {
+		// A revoked or rejected token is not reused on the next connect
+		cfg.OAuth.Invalidate()
+		return err
+	}
+	return nil
+}
+
+// connect establishes a connection to the IMAP server
+func (cl *Client) connect() error {
+	c, err := dial(cl.cfg)
+	if err != nil {
 		return err
 	}
 	cl.c = c
@@ -160,28 +220,159 @@ func (cl *Client) reconnect() error {
 }
 
 func (cl *Client) selectFolder(name string) error {
-	_, err := cl.c.Select(name, false)
+	status, err := cl.c.Select(name, false)
 	cl.mailbox = name
+	if err == nil {
+		cl.uidValidity = status.UidValidity
+	}
 	return err
 }
 
+// cursorKey identifies the selected folder in the state store. Routes sharing a
+// mailbox but filtering on different recipients keep separate cursors.
+func (cl *Client) cursorKey() string {
+	key := cl.cfg.Host + "/" + cl.cfg.Username + "/" + cl.mailbox
+	if to := strings.TrimSpace(cl.cfg.SearchTo); to != "" {
+		key += "/to=" + strings.ToLower(to)
+	}
+	return key
+}
+
+// loadCursor returns the highest UID already processed in the selected folder.
+// A UIDVALIDITY change means the server renumbered the mailbox, so the cursor starts over.
+func (cl *Client) loadCursor() uint32 {
+	if cl.st == nil {
+		return 0
+	}
+	cur, err := cl.st.GetIMAPCursor(cl.cursorKey())
+	if err != nil {
+		log.Error().Err(err).Str("folder", cl.mailbox).Msg("failed to load IMAP cursor")
+		return 0
+	}
+	if cur == nil {
+		return 0
+	}
+	if cur.UIDValidity != cl.uidValidity {
+		log.Warn().Str("folder", cl.mailbox).Uint32("stored_uidvalidity", cur.UIDValidity).Uint32("uidvalidity", cl.uidValidity).Uint32("last_uid", cur.LastUID).Msg("IMAP UIDVALIDITY changed, resetting cursor")
+		cl.pending = make(map[uint32]bool)
+		cl.fetchedMax = 0
+		if err := cl.st.StoreIMAPCursor(cl.cursorKey(), state.IMAPCursor{UIDValidity: cl.uidValidity}); err != nil {
+			log.Error().Err(err).Str("folder", cl.mailbox).Msg("failed to reset IMAP cursor")
+		}
+		return 0
+	}
+	return cur.LastUID
+}
+
+// advanceCursor moves the stored cursor up to the last UID below which every fetched message was handled
+func (cl *Client) advanceCursor(uid uint32) {
+	delete(cl.pending, uid)
+	cl.storeCursor()
+}
+
+// dropGone forgets pending UIDs the search no longer finds: another client expunged
+// them or marked them seen, they will not be handed out again and must not hold the
+// cursor back
+func (cl *Client) dropGone(found []uint32) {
+	var gone bool
+	for uid := range cl.pending {
+		if !slices.Contains(found, uid) {
+			log.Debug().Str("folder", cl.mailbox).Uint32("uid", uid).Msg("pending message gone from the mailbox")
+			delete(cl.pending, uid)
+			gone = true
+		}
+	}
+	if gone {
+		cl.storeCursor()
+	}
+}
+
+// storeCursor stores the last UID below which no fetched message is pending
+func (cl *Client) storeCursor() {
+	if cl.st == nil {
+		return
+	}
+	next := cl.fetchedMax
+	for p := range cl.pending {
+		if p-1 < next {
+			next = p - 1
+		}
+	}
+	cur, err := cl.st.GetIMAPCursor(cl.cursorKey())
+	if err != nil {
+		log.Error().Err(err).Str("folder", cl.mailbox).Msg("failed to load IMAP cursor")
+		return
+	}
+	if cur != nil && cur.UIDValidity == cl.uidValidity && cur.LastUID >= next {
+		return
+	}
+	if err := cl.st.StoreIMAPCursor(cl.cursorKey(), state.IMAPCursor{UIDValidity: cl.uidValidity, LastUID: next}); err != nil {
+		log.Error().Err(err).Str("folder", cl.mailbox).Uint32("last_uid", next).Msg("failed to store IMAP cursor")
+		return
+	}
+	log.Debug().Str("folder", cl.mailbox).Uint32("last_uid", next).Msg("IMAP cursor advanced")
+}
+
 // Attachment represents an email attachment with its metadata and content.
 type Attachment struct {
 	Filename    string
 	ContentType string
 	Size        int64
 	Data        []byte
+	ContentID   string // set for inline parts referenced from the HTML body as cid:
+	Source      string // winmail.dat or attached mail this file was unpacked from, empty otherwise
 }
 
 // Email represents a parsed email message with attachments.
 type Email struct {
-	ID          string // composed "mbox-uid"
+	ID          string // composed "host/user/mbox-uidvalidity-uid", unique across accounts
 	UID         uint32
 	Subject     string
 	FromName    string
 	FromEmail   string
-	Body        string // prefer text/plain; fallback to text/html stripped
+	To          []string  // lowercased addresses
+	Cc          []string  // lowercased addresses
+	ReplyTo     string    // set only when it differs from the sender
+	Date        time.Time // Date header, zero when missing
+	Received    time.Time // when the mail reached the helpdesk, zero means now
+	Body        string    // prefer text/plain; fallback to text/html stripped
+	Stripped    string    // Body without quoted history and signature
+	HTMLBody    string    // sanitized text/html part, empty for plain text mail
 	Attachments []Attachment
+	Skipped     []Attachment // parts left on the server for their size, without data
+	Raw         []byte       // message source as fetched, without the skipped parts
+	Forwarded   *Forwarded   // original mail when this one forwards it, nil otherwise
+	Headers     mail.Header  // top-level headers, nil when the message could not be read
+	Auth        AuthResults  // SPF/DKIM/DMARC as recorded by the receiving server
+	Spam        SpamVerdict
+
+	// Threading headers, message IDs without angle brackets
+	MessageID  string
+	InReplyTo  string
+	References []string
+
+	Class            MessageClass
+	BouncedRecipient string // failed recipient reported by a bounce
+	BouncedMessageID string // Message-ID of the mail that bounced
+}
+
+// ThreadIDs returns the message IDs this email replies to, closest ancestor first.
+// For a bounce the returned mail comes first.
+func (e Email) ThreadIDs() []string {
+	var ids []string
+	seen := make(map[string]bool)
+	add := func(id string) {
+		if id != "" && !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	add(e.BouncedMessageID)
+	add(e.InReplyTo)
+	for i := len(e.References) - 1; i >= 0; i-- {
+		add(e.References[i])
+	}
+	return ids
 }
 
 // FetchUnseen retrieves all unseen emails from the configured IMAP folder.
@@ -193,29 +384,49 @@ func (cl *Client) FetchUnseen(ctx context.Context) ([]Email, error) {
 func (cl *Client) fetchUnseenWithRetry(ctx context.Context, retryCount int) ([]Email, error) {
 	log.Debug().Str("folder", cl.cfg.Folder).Str("search_to", cl.cfg.SearchTo).Msg("searching for unseen emails")
 
-	// First, get mailbox status
-	status, err := cl.c.Status(cl.cfg.Folder, []imap.StatusItem{imap.StatusMessages, imap.StatusUnseen})
+	// First, get mailbox status; UIDVALIDITY may change while we stay connected
+	status, err := cl.c.Status(cl.cfg.Folder, []imap.StatusItem{imap.StatusMessages, imap.StatusUnseen, imap.StatusUidValidity})
 	if err != nil && isConnectionError(err) {
 		return cl.handleFetchError(ctx, err, retryCount)
 	}
 	if err == nil {
-		log.Debug().Uint32("total_messages", status.Messages).Uint32("unseen_count", status.Unseen).Msg("mailbox status")
+		log.Debug().Uint32("total_messages", status.Messages).Uint32("unseen_count", status.Unseen).Uint32("uidvalidity", status.UidValidity).Msg("mailbox status")
+		if status.UidValidity != 0 {
+			cl.uidValidity = status.UidValidity
+		}
 	}
 
+	lastUID := cl.loadCursor()
+
 	crit := imap.NewSearchCriteria()
 	crit.WithoutFlags = []string{imap.SeenFlag}
 	log.Debug().Strs("without_flags", crit.WithoutFlags).Msg("search criteria - without flags")
 
+	if lastUID > 0 {
+		crit.Uid = new(imap.SeqSet)
+		crit.Uid.AddRange(lastUID+1, 0)
+		log.Debug().Uint32("last_uid", lastUID).Msg("search criteria - UIDs above cursor")
+	}
+
 	if to := strings.TrimSpace(cl.cfg.SearchTo); to != "" {
 		crit.Header = make(textproto.MIMEHeader)
 		crit.Header.Set("To", to)
 		log.Debug().Str("search_to", to).Msg("search criteria - filtering by To header")
 	}
 
-	uids, err := cl.c.Search(crit)
+	found, err := cl.c.UidSearch(crit)
 	if err != nil {
 		return cl.handleFetchError(ctx, err, retryCount)
 	}
+	cl.dropGone(found)
+
+	// "n:*" always matches the highest UID, even when it is below n
+	var uids []uint32
+	for _, uid := range found {
+		if uid > lastUID {
+			uids = append(uids, uid)
+		}
+	}
 
 	log.Debug().Int("count", len(uids)).Interface("uids", uids).Msg("found unseen message UIDs")
 
@@ -223,42 +434,44 @@ func (cl *Client) fetchUnseenWithRetry(ctx context.Context, retryCount int) ([]E
 		return nil, nil
 	}
 
-	// Try a simple fetch by sequence number instead of UID
-	log.Debug().Msg("attempting sequence-based search as fallback")
-	seqCrit := imap.NewSearchCriteria()
-	seqCrit.WithoutFlags = []string{imap.SeenFlag}
-	seqNums, err := cl.c.Search(seqCrit)
-	if err == nil {
-		log.Debug().Interface("sequence_numbers", seqNums).Msg("found by sequence numbers")
+	// Messages with parts above the size limit are fetched part by part
+	var out []Email
+	if cl.cfg.SkipPartsLarger > 0 {
+		large, err := cl.largeMessages(uids)
+		if err != nil {
+			return cl.handleFetchError(ctx, err, retryCount)
+		}
+		if len(large) > 0 {
+			if out, err = cl.fetchPartial(large); err != nil {
+				return cl.handleFetchError(ctx, err, retryCount)
+			}
+			uids = slices.DeleteFunc(uids, func(uid uint32) bool { return large[uid] != nil })
+			if len(uids) == 0 {
+				return out, nil
+			}
+		}
 	}
 
-	// Try using sequence numbers instead of UIDs
-	log.Debug().Msg("using sequence numbers instead of UIDs for fetch")
 	seq := new(imap.SeqSet)
-	for _, seqNum := range seqNums {
-		seq.AddNum(seqNum)
-	}
-
-	log.Debug().Interface("sequence_numbers", seqNums).Msg("starting to fetch messages by sequence")
+	seq.AddNum(uids...)
 
-	// Fetch envelope, flags and body content
-	items := []imap.FetchItem{imap.FetchEnvelope, imap.FetchUid, imap.FetchFlags, imap.FetchRFC822}
+	// Peek so the message stays unseen until MarkSeen; a crash mid-processing must not lose it
+	section := &imap.BodySectionName{Peek: true}
+	items := []imap.FetchItem{imap.FetchEnvelope, imap.FetchUid, imap.FetchFlags, section.FetchItem()}
 
 	log.Debug().Msg("attempting to fetch envelope, flags and body content")
 	ch := make(chan *imap.Message, maxChannelBuffer)
 
 	fetchErr := make(chan error, 1)
 	go func() {
-		messageCount := 0
-		err := cl.c.Fetch(seq, items, ch) // Use Fetch instead of UidFetch
+		err := cl.c.UidFetch(seq, items, ch)
 		fetchErr <- err
 		if err != nil {
-			log.Debug().Err(err).Int("messages_received", messageCount).Msg("Fetch completed with error")
+			log.Debug().Err(err).Msg("UidFetch completed with error")
 		} else {
-			log.Debug().Int("messages_received", messageCount).Msg("Fetch completed successfully")
+			log.Debug().Msg("UidFetch completed successfully")
 		}
 	}()
-	var out []Email
 	fetchCompleted := false
 
 	for {
@@ -286,54 +499,111 @@ func (cl *Client) fetchUnseenWithRetry(ctx context.Context, retryCount int) ([]E
 				continue
 			}
 
-			log.Debug().Uint32("uid", msg.Uid).Str("subject", msg.Envelope.Subject).Strs("flags", msg.Flags).Msg("processing fetched message")
-
-			fromName, fromAddr := "", ""
-			if len(msg.Envelope.From) > 0 {
-				f := msg.Envelope.From[0]
-				fromAddr = fmt.Sprintf("%s@%s", f.MailboxName, f.HostName)
-				fromName = strings.TrimSpace(f.PersonalName)
-				if fromName == "" {
-					fromName = fromAddr
+			var raw []byte
+			if r := msg.GetBody(section); r != nil {
+				if raw, err = io.ReadAll(r); err != nil {
+					log.Warn().Err(err).Uint32("uid", msg.Uid).Msg("failed to read message body")
 				}
-				log.Debug().Str("from_addr", fromAddr).Str("from_name", fromName).Msg("extracted sender info")
-			} else {
-				log.Debug().Msg("no sender found in envelope")
 			}
-			body := ""
-			var attachments []Attachment
-
-			// Get body content from the message we already fetched
-			if r := msg.GetBody(&imap.BodySectionName{}); r != nil {
-				log.Debug().Uint32("uid", msg.Uid).Str("subject", msg.Envelope.Subject).Msg("parsing message body content")
-				body, attachments = parseEmailContent(r)
-				log.Debug().Uint32("uid", msg.Uid).Int("body_length", len(body)).Int("attachments_count", len(attachments)).Msg("body content parsed")
-
-				// Log attachment details
-				for i, att := range attachments {
-					log.Debug().Uint32("uid", msg.Uid).Int("attachment_index", i).Str("filename", att.Filename).Str("content_type", att.ContentType).Int64("size", att.Size).Msg("parsed attachment")
-				}
+			email := cl.toEmail(msg, raw)
+			cl.track(msg.Uid)
+			out = append(out, email)
+		}
+	}
+}
 
-				if len(body) == 0 {
-					log.Warn().Uint32("uid", msg.Uid).Str("subject", msg.Envelope.Subject).Msg("email body is empty after parsing")
-				}
-			} else {
-				log.Debug().Uint32("uid", msg.Uid).Msg("no body content found in message")
-			}
+// toEmail builds the Email of a fetched message; raw is the message content, nil when
+// the body was not returned
+func (cl *Client) toEmail(msg *imap.Message, raw []byte) Email {
+	log.Debug().Uint32("uid", msg.Uid).Str("subject", msg.Envelope.Subject).Strs("flags", msg.Flags).Msg("processing fetched message")
+
+	fromName, fromAddr := "", ""
+	if len(msg.Envelope.From) > 0 {
+		f := msg.Envelope.From[0]
+		fromAddr = fmt.Sprintf("%s@%s", f.MailboxName, f.HostName)
+		fromName = strings.TrimSpace(decodeHeader(f.PersonalName))
+		if fromName == "" {
+			fromName = fromAddr
+		}
+		log.Debug().Str("from_addr", fromAddr).Str("from_name", fromName).Msg("extracted sender info")
+	} else {
+		log.Debug().Msg("no sender found in envelope")
+	}
+	email := Email{
+		ID:        cl.cursorKey() + "-" + itoaU(cl.uidValidity) + "-" + itoaU(msg.Uid),
+		UID:       msg.Uid,
+		Subject:   decodeHeader(msg.Envelope.Subject),
+		FromName:  fromName,
+		FromEmail: fromAddr,
+		To:        envelopeAddresses(msg.Envelope.To),
+		Cc:        envelopeAddresses(msg.Envelope.Cc),
+		ReplyTo:   replyTo(msg.Envelope.ReplyTo, fromAddr),
+		Date:      msg.Envelope.Date,
+		MessageID: firstMessageID(msg.Envelope.MessageId),
+		InReplyTo: firstMessageID(msg.Envelope.InReplyTo),
+		Class:     ClassNormal,
+	}
+
+	if raw != nil {
+		log.Debug().Uint32("uid", msg.Uid).Str("subject", msg.Envelope.Subject).Msg("parsing message body content")
+		parseRaw(&email, raw, cl.stripper, cl.cfg.OwnAddresses, cl.cfg.AuthServID)
+	} else {
+		log.Debug().Uint32("uid", msg.Uid).Msg("no body content found in message")
+	}
+
+	log.Debug().Str("email_id", email.ID).Str("from", fromAddr).Str("subject", msg.Envelope.Subject).Str("message_id", email.MessageID).Str("in_reply_to", email.InReplyTo).Int("references", len(email.References)).Msg("email processed successfully")
+	return email
+}
 
-			email := Email{
-				ID:          cl.mailbox + "-" + itoaU(msg.Uid),
-				UID:         msg.Uid,
-				Subject:     msg.Envelope.Subject,
-				FromName:    fromName,
-				FromEmail:   fromAddr,
-				Body:        body,
-				Attachments: attachments,
-			}
+// track records a handed out UID so the cursor stops below it until MarkSeen
+func (cl *Client) track(uid uint32) {
+	cl.pending[uid] = true
+	if uid > cl.fetchedMax {
+		cl.fetchedMax = uid
+	}
+}
 
-			log.Debug().Str("email_id", email.ID).Str("from", fromAddr).Str("subject", msg.Envelope.Subject).Msg("email processed successfully")
-			out = append(out, email)
+// parseRaw fills in what the raw message carries beyond the envelope: headers, body,
+// HTML, attachments and a forwarded original. Message-ID and In-Reply-To headers
+// override the envelope values already set on em.
+func parseRaw(em *Email, raw []byte, stripper *Stripper, ownAddresses []string, authServID string) {
+	em.Raw = raw
+	if hdr, err := mail.ReadMessage(bytes.NewReader(raw)); err == nil {
+		em.Headers = hdr.Header
+		em.Auth = parseAuthResults(hdr.Header, authServID)
+		em.Spam = parseSpamVerdict(hdr.Header)
+		if id := firstMessageID(hdr.Header.Get("Message-Id")); id != "" {
+			em.MessageID = id
 		}
+		if id := firstMessageID(hdr.Header.Get("In-Reply-To")); id != "" {
+			em.InReplyTo = id
+		}
+		em.References = parseMessageIDs(hdr.Header.Get("References"))
+		em.Class = classify(hdr.Header, em.FromEmail, ownAddresses)
+		if em.Class == ClassBounce {
+			em.BouncedRecipient, em.BouncedMessageID = bounceDetails(raw)
+		}
+	}
+	em.Body, em.Attachments = unpackAttachments(parseEmailContent(bytes.NewReader(raw)))
+	em.Stripped = stripper.Strip(em.Body)
+	if h := extractHTML(raw); h != "" {
+		em.HTMLBody = SanitizeHTML(stripper.StripHTML(h))
+	}
+	if em.Forwarded = extractAttachedForward(raw); em.Forwarded != nil {
+		em.Forwarded.Note = em.Stripped
+	} else {
+		em.Forwarded = ParseForwarded(em.Body)
+	}
+	if em.Forwarded != nil {
+		em.Forwarded.Body = stripper.Strip(em.Forwarded.Body)
+	}
+	log.Debug().Uint32("uid", em.UID).Int("body_length", len(em.Body)).Int("attachments_count", len(em.Attachments)).Msg("body content parsed")
+
+	for i, att := range em.Attachments {
+		log.Debug().Uint32("uid", em.UID).Int("attachment_index", i).Str("filename", att.Filename).Str("content_type", att.ContentType).Int64("size", att.Size).Msg("parsed attachment")
+	}
+	if len(em.Body) == 0 {
+		log.Warn().Uint32("uid", em.UID).Str("subject", em.Subject).Msg("email body is empty after parsing")
 	}
 }
 
@@ -399,12 +669,131 @@ func (cl *Client) markSeenWithRetry(ctx context.Context, uid uint32, retryCount
 		// Retry the operation
 		return cl.markSeenWithRetry(ctx, uid, retryCount+1)
 	}
+	if err == nil {
+		cl.advanceCursor(uid)
+	}
+
+	return err
+}
+
+// Move moves a message into another folder of the mailbox, creating the folder when needed.
+// The message counts as handled for the UID cursor.
+func (cl *Client) Move(ctx context.Context, uid uint32, folder string) error {
+	return cl.moveWithRetry(ctx, uid, folder, 0)
+}
+
+// moveWithRetry implements Move with automatic reconnection
+func (cl *Client) moveWithRetry(ctx context.Context, uid uint32, folder string, retryCount int) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+	}
+
+	seq := new(imap.SeqSet)
+	seq.AddNum(uid)
+
+	err := cl.uidMove(seq, folder)
+	if err != nil && !isConnectionError(err) {
+		// Most likely the folder does not exist yet
+		if createErr := cl.c.Create(folder); createErr == nil {
+			log.Info().Str("folder", folder).Msg("created IMAP folder")
+			err = cl.uidMove(seq, folder)
+		}
+	}
+	if err != nil && isConnectionError(err) {
+		if retryCount >= maxRetryAttempts {
+			log.Error().Err(err).Uint32("uid", uid).Int("retry_count", retryCount).Msg("max retry attempts reached for IMAP Move")
+			return err
+		}
 
+		log.Warn().Err(err).Uint32("uid", uid).Int("retry_count", retryCount).Msg("IMAP connection error in Move, attempting reconnect")
+
+		if reconnectErr := cl.reconnect(); reconnectErr != nil {
+			log.Error().Err(reconnectErr).Msg("failed to reconnect to IMAP server in Move")
+			return reconnectErr
+		}
+		return cl.moveWithRetry(ctx, uid, folder, retryCount+1)
+	}
+	if err == nil {
+		cl.advanceCursor(uid)
+	}
 	return err
 }
 
+// uidMove uses MOVE and falls back to COPY, \Deleted and EXPUNGE when the server
+// advertises MOVE but refuses it for the mailbox
+func (cl *Client) uidMove(seq *imap.SeqSet, folder string) error {
+	err := cl.c.UidMove(seq, folder)
+	if err == nil || isConnectionError(err) {
+		return err
+	}
+	log.Debug().Err(err).Str("folder", folder).Msg("IMAP MOVE failed, copying instead")
+	if err := cl.c.UidCopy(seq, folder); err != nil {
+		return err
+	}
+	if err := cl.c.UidStore(seq, imap.FormatFlagsOp(imap.AddFlags, true), []interface{}{imap.DeletedFlag}, nil); err != nil {
+		return err
+	}
+	return cl.c.Expunge(nil)
+}
+
 // --- helpers ---
 
+// envelopeAddresses returns the lowercased addresses of an envelope field, skipping group syntax
+func envelopeAddresses(list []*imap.Address) []string {
+	var out []string
+	for _, a := range list {
+		if a == nil || a.MailboxName == "" || a.HostName == "" {
+			continue
+		}
+		out = append(out, strings.ToLower(a.Address()))
+	}
+	return out
+}
+
+// replyTo returns the first Reply-To address unless it is the sender, which servers fill in by default
+func replyTo(list []*imap.Address, from string) string {
+	addrs := envelopeAddresses(list)
+	if len(addrs) == 0 || strings.EqualFold(addrs[0], from) {
+		return ""
+	}
+	return addrs[0]
+}
+
+// parseMessageIDs extracts the <id> tokens of a Message-ID style header, without the angle brackets
+func parseMessageIDs(s string) []string {
+	var ids []string
+	for {
+		start := strings.IndexByte(s, '<')
+		if start < 0 {
+			break
+		}
+		end := strings.IndexByte(s[start:], '>')
+		if end < 0 {
+			break
+		}
+		if id := strings.TrimSpace(s[start+1 : start+end]); id != "" {
+			ids = append(ids, id)
+		}
+		s = s[start+end+1:]
+	}
+	// Some clients omit the brackets entirely
+	if len(ids) == 0 {
+		if id := strings.TrimSpace(s); id != "" && !strings.ContainsAny(id, " \t") {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+func firstMessageID(s string) string {
+	if ids := parseMessageIDs(s); len(ids) > 0 {
+		return ids[0]
+	}
+	return ""
+}
+
 func htmlToText(s string) string {
 	// Handle common HTML entities first
 	s = decodeHTMLEntities(s)
@@ -557,74 +946,16 @@ func decodeNumericEntities(s string) string {
 }
 
 // ExtractTicketID extracts a ticket ID from an email subject line using the expected prefix pattern.
+// A signed tag yields its ID too, the token is checked with the ticket package.
 func ExtractTicketID(subject, expectedPrefix string) (int, bool) {
-	// [PREFIX-#123]
-	re := regexp.MustCompile(`\[\s*([A-Za-z0-9_-]+)\s*-\s*#(\d+)\s*\]`)
-	m := re.FindStringSubmatch(subject)
-	if len(m) != maxRegexGroups {
-		return 0, false
-	}
-	if !strings.EqualFold(m[1], expectedPrefix) {
-		return 0, false
-	}
-	id, _ := strconv.Atoi(m[2])
-	return id, id > 0
+	ref, ok := ticket.Parse(subject, expectedPrefix)
+	return ref.ID, ok
 }
 
-// CleanBody removes quoted text and previous messages from email body text.
+// CleanBody removes quoted text and previous messages from email body text
+// using the rules of every supported language.
 func CleanBody(b string) string {
-	lines := strings.Split(b, "\n")
-	var out []string
-
-	// Patterns that indicate the start of quoted/forwarded content
-	breakPatterns := []string{
-		"original message",
-		"původní zpráva",
-		"---------- forwarded message",
-		"---------- přeposlaná zpráva",
-		"on wrote:",
-		"napsal:",
-		"from:",
-		"od:",
-		"sent:",
-		"odesláno:",
-		"-------- original message --------",
-		"-------- původní zpráva --------",
-	}
-
-	for _, ln := range lines {
-		trim := strings.TrimSpace(ln)
-		trimLower := strings.ToLower(trim)
-
-		// Skip quoted lines
-		if strings.HasPrefix(trim, ">") {
-			continue
-		}
-
-		// Check for break patterns
-		shouldBreak := false
-		for _, pattern := range breakPatterns {
-			if strings.Contains(trimLower, pattern) {
-				shouldBreak = true
-				break
-			}
-		}
-		if shouldBreak {
-			break
-		}
-
-		out = append(out, ln)
-	}
-
-	s := strings.TrimSpace(strings.Join(out, "\n"))
-
-	// If result is empty and original had content, return original content
-	if s == "" && strings.TrimSpace(b) != "" {
-		log.Debug().Msg("CleanBody resulted in empty string, returning original content")
-		return strings.TrimSpace(b)
-	}
-
-	return s
+	return defaultStripper.Strip(b)
 }
 
 func itoa(v int) string {
@@ -654,101 +985,6 @@ func decodeTextContent(data []byte, encoding string, charset string) string {
 	return strings.TrimSpace(text)
 }
 
-// decodeCharset converts text from various charsets to UTF-8
-func decodeCharset(data []byte, charset string) string {
-	if charset == "" {
-		return string(data)
-	}
-
-	charset = strings.ToLower(strings.TrimSpace(charset))
-
-	// Map of charset aliases
-	charsetMap := map[string][]byte{
-		"iso-8859-1":   nil, // Latin-1
-		"iso-8859-2":   nil, // Latin-2 (Central European)
-		"windows-1250": nil, // Windows Central European
-		"windows-1252": nil, // Windows Western European
-		"cp1250":       nil, // Same as windows-1250
-		"cp1252":       nil, // Same as windows-1252
-	}
-
-	// Check if we need charset conversion
-	_, needsConversion := charsetMap[charset]
-	if !needsConversion && charset != "utf-8" && charset != "us-ascii" {
-		// Unknown charset, try as-is
-		log.Debug().Str("charset", charset).Msg("unknown charset, using as-is")
-	}
-
-	// For ISO-8859-2 and Windows-1250 (Czech/Central European)
-	if charset == "iso-8859-2" || charset == "windows-1250" || charset == "cp1250" {
-		return decodeISO8859_2(data)
-	}
-
-	// For ISO-8859-1 and Windows-1252 (Western European)
-	if charset == "iso-8859-1" || charset == "windows-1252" || charset == "cp1252" {
-		return decodeWindows1252(data)
-	}
-
-	return string(data)
-}
-
-// decodeISO8859_2 decodes ISO-8859-2 (Latin-2, Central European) to UTF-8
-func decodeISO8859_2(data []byte) string {
-	// ISO-8859-2 to UTF-8 mapping for values 0x80-0xFF
-	iso8859_2 := map[byte]rune{
-		0xA1: 'Ą', 0xA2: '˘', 0xA3: 'Ł', 0xA4: '¤', 0xA5: 'Ľ', 0xA6: 'Ś', 0xA7: '§',
-		0xA8: '¨', 0xA9: 'Š', 0xAA: 'Ş', 0xAB: 'Ť', 0xAC: 'Ź', 0xAD: '\u00AD', 0xAE: 'Ž', 0xAF: 'Ż',
-		0xB0: '°', 0xB1: 'ą', 0xB2: '˛', 0xB3: 'ł', 0xB4: '´', 0xB5: 'ľ', 0xB6: 'ś', 0xB7: 'ˇ',
-		0xB8: '¸', 0xB9: 'š', 0xBA: 'ş', 0xBB: 'ť', 0xBC: 'ź', 0xBD: '˝', 0xBE: 'ž', 0xBF: 'ż',
-		0xC0: 'Ŕ', 0xC1: 'Á', 0xC2: 'Â', 0xC3: 'Ă', 0xC4: 'Ä', 0xC5: 'Ĺ', 0xC6: 'Ć', 0xC7: 'Ç',
-		0xC8: 'Č', 0xC9: 'É', 0xCA: 'Ę', 0xCB: 'Ë', 0xCC: 'Ě', 0xCD: 'Í', 0xCE: 'Î', 0xCF: 'Ď',
-		0xD0: 'Đ', 0xD1: 'Ń', 0xD2: 'Ň', 0xD3: 'Ó', 0xD4: 'Ô', 0xD5: 'Ő', 0xD6: 'Ö', 0xD7: '×',
-		0xD8: 'Ř', 0xD9: 'Ů', 0xDA: 'Ú', 0xDB: 'Ű', 0xDC: 'Ü', 0xDD: 'Ý', 0xDE: 'Ţ', 0xDF: 'ß',
-		0xE0: 'ŕ', 0xE1: 'á', 0xE2: 'â', 0xE3: 'ă', 0xE4: 'ä', 0xE5: 'ĺ', 0xE6: 'ć', 0xE7: 'ç',
-		0xE8: 'č', 0xE9: 'é', 0xEA: 'ę', 0xEB: 'ë', 0xEC: 'ě', 0xED: 'í', 0xEE: 'î', 0xEF: 'ď',
-		0xF0: 'đ', 0xF1: 'ń', 0xF2: 'ň', 0xF3: 'ó', 0xF4: 'ô', 0xF5: 'ő', 0xF6: 'ö', 0xF7: '÷',
-		0xF8: 'ř', 0xF9: 'ů', 0xFA: 'ú', 0xFB: 'ű', 0xFC: 'ü', 0xFD: 'ý', 0xFE: 'ţ', 0xFF: '˙',
-	}
-
-	var result strings.Builder
-	for _, b := range data {
-		if b < asciiUpperBound {
-			result.WriteByte(b)
-		} else if r, ok := iso8859_2[b]; ok {
-			result.WriteRune(r)
-		} else {
-			result.WriteByte(b)
-		}
-	}
-	return result.String()
-}
-
-// decodeWindows1252 decodes Windows-1252 (Western European) to UTF-8
-func decodeWindows1252(data []byte) string {
-	// Windows-1252 specific characters (0x80-0x9F range differs from ISO-8859-1)
-	windows1252 := map[byte]rune{
-		0x80: '\u20AC', 0x82: '\u201A', 0x83: '\u0192', 0x84: '\u201E', 0x85: '\u2026', 0x86: '\u2020', 0x87: '\u2021',
-		0x88: '\u02C6', 0x89: '\u2030', 0x8A: '\u0160', 0x8B: '\u2039', 0x8C: '\u0152', 0x8E: '\u017D',
-		0x91: '\u2018', 0x92: '\u2019', 0x93: '\u201C', 0x94: '\u201D', 0x95: '\u2022', 0x96: '\u2013', 0x97: '\u2014',
-		0x98: '\u02DC', 0x99: '\u2122', 0x9A: '\u0161', 0x9B: '\u203A', 0x9C: '\u0153', 0x9E: '\u017E', 0x9F: '\u0178',
-	}
-
-	var result strings.Builder
-	for _, b := range data {
-		if b < asciiUpperBound {
-			result.WriteByte(b)
-		} else if r, ok := windows1252[b]; ok {
-			result.WriteRune(r)
-		} else if b >= latin1ExtendedStart {
-			// ISO-8859-1 range (same as Unicode for 0xA0-0xFF)
-			result.WriteRune(rune(b))
-		} else {
-			result.WriteByte(b)
-		}
-	}
-	return result.String()
-}
-
 // extractBodyFromRawEmail extracts body content from raw email text by skipping headers
 func extractBodyFromRawEmail(rawEmail string) string {
 	lines := strings.Split(rawEmail, "\n")
@@ -866,25 +1102,26 @@ func parseEmailContent(r io.Reader) (string, []Attachment) {
 	}
 
 	mr, err := message.Read(strings.NewReader(string(data)))
-	if err != nil {
+	readErr := err
+	if err != nil && !message.IsUnknownCharset(err) {
 		// Simple email without MIME - try to extract body manually
 		log.Debug().Err(err).Msg("simple email without MIME structure, trying to extract body manually")
 		body := extractBodyFromRawEmail(string(data))
 		return body, nil
 	}
 
-	mt, _, _ := mr.Header.ContentType()
+	mt, mtParams, _ := mr.Header.ContentType()
 	log.Debug().Str("content_type", mt).Msg("email content type detected")
 
 	if !strings.HasPrefix(mt, "multipart/") {
 		// Simple content type
 		if strings.HasPrefix(mt, "text/plain") {
 			b, _ := io.ReadAll(mr.Body)
-			return string(b), nil
+			return partText(b, mtParams["charset"], readErr), nil
 		}
 		if strings.HasPrefix(mt, "text/html") {
 			b, _ := io.ReadAll(mr.Body)
-			return htmlToText(string(b)), nil
+			return htmlToText(partText(b, mtParams["charset"], readErr)), nil
 		}
 		return "", nil
 	}
@@ -895,8 +1132,9 @@ func parseEmailContent(r io.Reader) (string, []Attachment) {
 
 	// First pass: collect text parts and attachments
 	parts := make([]struct {
-		header message.Header
-		body   []byte
+		header  message.Header
+		body    []byte
+		readErr error
 	}, 0)
 
 	mpr := mr.MultipartReader()
@@ -905,17 +1143,20 @@ func parseEmailContent(r io.Reader) (string, []Attachment) {
 		if err == io.EOF {
 			break
 		}
-		if err != nil {
+		// A part in an unknown charset is still readable, its text is decoded with a fallback
+		if err != nil && !message.IsUnknownCharset(err) {
 			break
 		}
 
 		body, _ := io.ReadAll(part.Body)
 		parts = append(parts, struct {
-			header message.Header
-			body   []byte
+			header  message.Header
+			body    []byte
+			readErr error
 		}{
-			header: part.Header,
-			body:   body,
+			header:  part.Header,
+			body:    body,
+			readErr: err,
 		})
 	}
 
@@ -935,8 +1176,9 @@ func parseEmailContent(r io.Reader) (string, []Attachment) {
 
 		log.Debug().Int("part_index", i).Str("content_type", ct).Str("disposition", disposition).Int("body_size", len(part.body)).Msg("processing email part")
 
-		// Check if this is an attachment
-		if disposition == attachmentDisposition || disposition == inlineDisposition {
+		// Check if this is an attachment, attached mails and winmail.dat are often sent without disposition
+		if disposition == attachmentDisposition || disposition == inlineDisposition ||
+			ct == "message/rfc822" || ct == "application/ms-tnef" || ct == "application/vnd.ms-tnef" {
 			filename := dispParams["filename"]
 			if filename == "" {
 				filename = params["name"]
@@ -966,6 +1208,7 @@ func parseEmailContent(r io.Reader) (string, []Attachment) {
 				ContentType: ct,
 				Size:        int64(len(data)),
 				Data:        data,
+				ContentID:   contentID(part.header),
 			})
 			log.Debug().Str("filename", filename).Str("content_type", ct).Int("size", len(data)).Msg("added attachment")
 		} else if strings.HasPrefix(ct, "text/") {
@@ -973,10 +1216,10 @@ func parseEmailContent(r io.Reader) (string, []Attachment) {
 			log.Debug().Str("text_content_type", ct).Int("body_size", len(part.body)).Bool("body_empty", bodyText == "").Msg("found text content")
 			if bodyText == "" { // Prefer first text part
 				if strings.HasPrefix(ct, "text/plain") {
-					bodyText = string(part.body)
+					bodyText = partText(part.body, params["charset"], part.readErr)
 					log.Debug().Int("extracted_text_length", len(bodyText)).Msg("extracted plain text")
 				} else if strings.HasPrefix(ct, "text/html") {
-					bodyText = htmlToText(string(part.body))
+					bodyText = htmlToText(partText(part.body, params["charset"], part.readErr))
 					log.Debug().Int("extracted_text_length", len(bodyText)).Msg("extracted HTML text")
 				}
 			}
@@ -990,29 +1233,16 @@ func parseEmailContent(r io.Reader) (string, []Attachment) {
 				contentType = ct
 			}
 
-			// Handle charset issues in the multipart body
 			multipartBody := string(part.body)
-			multipartBody = strings.ReplaceAll(multipartBody, "charset=\"iso-8859-2\"", "charset=\"utf-8\"")
-			multipartBody = strings.ReplaceAll(multipartBody, "charset=iso-8859-2", "charset=utf-8")
-			multipartBody = strings.ReplaceAll(multipartBody, "charset=\"windows-1252\"", "charset=\"utf-8\"")
-			multipartBody = strings.ReplaceAll(multipartBody, "charset=windows-1252", "charset=utf-8")
-
 			mimeMessage := "Content-Type: " + contentType + "\r\n\r\n" + multipartBody
 
-			// Try our multipart parser first, then fallback to message.Read
-			if bodyText == "" {
-				extractedText := extractTextFromMultipart(multipartBody)
-				if extractedText != "" {
-					bodyText = extractedText
-					log.Debug().Int("direct_extracted_length", len(bodyText)).Msg("extracted text directly using multipart parser")
-					continue
-				}
-			}
-
 			// Parse as complete message
 			nestedMsg, err := message.Read(strings.NewReader(mimeMessage))
 			if err != nil {
-				log.Debug().Err(err).Msg("failed to parse nested multipart, skipping")
+				log.Debug().Err(err).Msg("failed to parse nested multipart, falling back to plain scan")
+				if bodyText == "" {
+					bodyText = extractTextFromMultipart(multipartBody)
+				}
 				continue
 			}
 
@@ -1023,10 +1253,11 @@ func parseEmailContent(r io.Reader) (string, []Attachment) {
 					if err == io.EOF {
 						break
 					}
-					if err != nil {
+					if err != nil && !message.IsUnknownCharset(err) {
 						log.Debug().Err(err).Msg("error reading nested part")
 						break
 					}
+					nestedReadErr := err
 
 					nestedBody, err := io.ReadAll(nestedPart.Body)
 					if err != nil {
@@ -1086,6 +1317,7 @@ func parseEmailContent(r io.Reader) (string, []Attachment) {
 							ContentType: nestedCt,
 							Size:        int64(len(nestedData)),
 							Data:        nestedData,
+							ContentID:   contentID(nestedPart.Header),
 						})
 						log.Debug().Str("filename", nestedFilename).Str("content_type", nestedCt).Int("size", len(nestedData)).Msg("added nested attachment")
 					} else if strings.HasPrefix(nestedCt, "text/") && bodyText == "" {
@@ -1094,16 +1326,19 @@ func parseEmailContent(r io.Reader) (string, []Attachment) {
 						nestedCharset := nestedParams["charset"]
 
 						if strings.HasPrefix(nestedCt, "text/plain") {
-							bodyText = decodeTextContent(nestedBody, nestedEncoding, nestedCharset)
+							bodyText = partText(nestedBody, nestedCharset, nestedReadErr)
 							log.Debug().Int("extracted_nested_text_length", len(bodyText)).Str("encoding", nestedEncoding).Str("charset", nestedCharset).Msg("extracted text from nested plain part")
 						} else if strings.HasPrefix(nestedCt, "text/html") {
-							decodedHTML := decodeTextContent(nestedBody, nestedEncoding, nestedCharset)
+							decodedHTML := partText(nestedBody, nestedCharset, nestedReadErr)
 							bodyText = htmlToText(decodedHTML)
 							log.Debug().Int("extracted_nested_text_length", len(bodyText)).Str("encoding", nestedEncoding).Str("charset", nestedCharset).Msg("extracted text from nested HTML part")
 						}
 					}
 				}
 			}
+			if bodyText == "" {
+				bodyText = extractTextFromMultipart(multipartBody)
+			}
 		} else {
 			// Check if this might be an attachment based on content-type or disposition
 			log.Debug().Str("content_type", ct).Str("disposition", disposition).Interface("disp_params", dispParams).Interface("ct_params", params).Int("body_size", len(part.body)).Msg("analyzing part for attachment detection")
@@ -1176,6 +1411,7 @@ func parseEmailContent(r io.Reader) (string, []Attachment) {
 					ContentType: ct,
 					Size:        int64(len(data)),
 					Data:        data,
+					ContentID:   contentID(part.header),
 				})
 				log.Debug().Str("filename", filename).Str("content_type", ct).Int("size", len(data)).Msg("added attachment")
 			} else if strings.HasPrefix(ct, "text/") && bodyText == "" {
@@ -1184,10 +1420,10 @@ func parseEmailContent(r io.Reader) (string, []Attachment) {
 				charset := params["charset"]
 
 				if strings.HasPrefix(ct, "text/plain") {
-					bodyText = decodeTextContent(part.body, encoding, charset)
+					bodyText = partText(part.body, charset, part.readErr)
 					log.Debug().Int("extracted_text_length", len(bodyText)).Str("encoding", encoding).Str("charset", charset).Msg("extracted text from plain part")
 				} else if strings.HasPrefix(ct, "text/html") {
-					decodedHTML := decodeTextContent(part.body, encoding, charset)
+					decodedHTML := partText(part.body, charset, part.readErr)
 					bodyText = htmlToText(decodedHTML)
 					log.Debug().Int("extracted_text_length", len(bodyText)).Str("encoding", encoding).Str("charset", charset).Msg("extracted text from HTML part")
 				}
@@ -1255,6 +1491,10 @@ func getExtensionForContentType(contentType string) string {
 		return ".bmp"
 	case "image/tiff":
 		return ".tiff"
+	case "message/rfc822":
+		return ".eml"
+	case "application/ms-tnef", "application/vnd.ms-tnef":
+		return ".dat"
 	}
 
 	// Fallback for partial matches
@@ -1,8 +1,26 @@
 package imap
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
 	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/backend"
+	"github.com/emersion/go-imap/backend/memory"
+	"github.com/emersion/go-imap/server"
+	"github.com/emersion/go-sasl"
+
+	"github.com/anaryk/odoo-helpdesk-bridge/internal/oauth"
+	"github.com/anaryk/odoo-helpdesk-bridge/internal/state"
 )
 
 func TestExtractTicketID(t *testing.T) {
@@ -370,3 +388,459 @@ type testError struct {
 func (e *testError) Error() string {
 	return e.msg
 }
+
+// seededBackend returns a memory backend whose INBOX holds the given unseen subjects (UIDs start at 7)
+func seededBackend(t *testing.T, subjects ...string) *memory.Backend {
+	t.Helper()
+	be := memory.New()
+	u, err := be.Login(nil, "username", "password")
+	if err != nil {
+		t.Fatalf("login: %v", err)
+	}
+	mbox, err := u.GetMailbox("INBOX")
+	if err != nil {
+		t.Fatalf("get mailbox: %v", err)
+	}
+	for _, subj := range subjects {
+		if err := mbox.CreateMessage(nil, time.Now(), bytes.NewBufferString(testMessage(subj))); err != nil {
+			t.Fatalf("create message: %v", err)
+		}
+	}
+	return be
+}
+
+func testMessage(subject string) string {
+	return "From: Customer <customer@example.com>\r\n" +
+		"To: helpdesk@example.com\r\n" +
+		"Subject: " + subject + "\r\n" +
+		"Content-Type: text/plain\r\n" +
+		"\r\n" +
+		"Body of " + subject
+}
+
+func newTestClient(t *testing.T, cfg Config, st *state.Store) *Client {
+	t.Helper()
+	cl, err := New(cfg, st)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	t.Cleanup(func() { _ = cl.Close() })
+	return cl
+}
+
+func newTestStore(t *testing.T) *state.Store {
+	t.Helper()
+	st, err := state.New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	t.Cleanup(func() { _ = st.Close() })
+	return st
+}
+
+func fetchUIDs(t *testing.T, cl *Client) []uint32 {
+	t.Helper()
+	msgs, err := cl.FetchUnseen(context.Background())
+	if err != nil {
+		t.Fatalf("FetchUnseen() error = %v", err)
+	}
+	var uids []uint32
+	for _, m := range msgs {
+		uids = append(uids, m.UID)
+	}
+	return uids
+}
+
+func equalUIDs(a, b []uint32) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestFetchUnseen_UIDCursor(t *testing.T) {
+	cfg := startTestServer(t, seededBackend(t, "first", "second"))
+	st := newTestStore(t)
+	cl := newTestClient(t, cfg, st)
+	ctx := context.Background()
+
+	msgs, err := cl.FetchUnseen(ctx)
+	if err != nil {
+		t.Fatalf("FetchUnseen() error = %v", err)
+	}
+	if len(msgs) != 2 {
+		t.Fatalf("Expected 2 messages, got %d", len(msgs))
+	}
+	if wantID := "127.0.0.1/username/INBOX-1-7"; msgs[0].ID != wantID || msgs[0].UID != 7 {
+		t.Errorf("Expected ID %s with UID 7, got %s with UID %d", wantID, msgs[0].ID, msgs[0].UID)
+	}
+	if msgs[0].Subject != "first" || !strings.Contains(msgs[0].Body, "Body of first") {
+		t.Errorf("Unexpected message content: subject %q, body %q", msgs[0].Subject, msgs[0].Body)
+	}
+
+	for _, m := range msgs {
+		if err := cl.MarkSeen(ctx, m.UID); err != nil {
+			t.Fatalf("MarkSeen() error = %v", err)
+		}
+	}
+	cursor, _ := st.GetIMAPCursor(cl.cursorKey())
+	if cursor == nil || cursor.LastUID != 8 || cursor.UIDValidity != 1 {
+		t.Fatalf("Expected cursor {1 8}, got %+v", cursor)
+	}
+
+	// Someone marks an old message unread again: it sits below the cursor and stays processed
+	seq := new(imap.SeqSet)
+	seq.AddNum(7)
+	if err := cl.c.UidStore(seq, imap.RemoveFlags, []interface{}{imap.SeenFlag}, nil); err != nil {
+		t.Fatalf("UidStore() error = %v", err)
+	}
+	if err := cl.c.Append("INBOX", nil, time.Now(), bytes.NewBufferString(testMessage("third"))); err != nil {
+		t.Fatalf("Append() error = %v", err)
+	}
+
+	if uids := fetchUIDs(t, cl); !equalUIDs(uids, []uint32{9}) {
+		t.Errorf("Expected only UID 9 after the cursor, got %v", uids)
+	}
+}
+
+func TestFetchUnseen_CursorWaitsForUnhandledMessages(t *testing.T) {
+	cfg := startTestServer(t, seededBackend(t, "first", "second", "third"))
+	st := newTestStore(t)
+	cl := newTestClient(t, cfg, st)
+	ctx := context.Background()
+
+	if uids := fetchUIDs(t, cl); !equalUIDs(uids, []uint32{7, 8, 9}) {
+		t.Fatalf("Expected UIDs [7 8 9], got %v", uids)
+	}
+
+	// Processing of UID 7 failed, the others went through
+	_ = cl.MarkSeen(ctx, 8)
+	_ = cl.MarkSeen(ctx, 9)
+
+	cursor, _ := st.GetIMAPCursor(cl.cursorKey())
+	if cursor == nil || cursor.LastUID != 6 {
+		t.Fatalf("Cursor must stay below the unhandled UID 7, got %+v", cursor)
+	}
+
+	// Fetching did not set \Seen, so the failed message is retried
+	if uids := fetchUIDs(t, cl); !equalUIDs(uids, []uint32{7}) {
+		t.Fatalf("Expected retry of UID 7, got %v", uids)
+	}
+	_ = cl.MarkSeen(ctx, 7)
+
+	cursor, _ = st.GetIMAPCursor(cl.cursorKey())
+	if cursor == nil || cursor.LastUID != 9 {
+		t.Errorf("Expected cursor to reach 9 once everything is handled, got %+v", cursor)
+	}
+}
+
+func TestFetchUnseen_PendingMessageExpunged(t *testing.T) {
+	cfg := startTestServer(t, seededBackend(t, "first", "second", "third"))
+	st := newTestStore(t)
+	cl := newTestClient(t, cfg, st)
+	ctx := context.Background()
+
+	if uids := fetchUIDs(t, cl); !equalUIDs(uids, []uint32{7, 8, 9}) {
+		t.Fatalf("Expected UIDs [7 8 9], got %v", uids)
+	}
+	_ = cl.MarkSeen(ctx, 8)
+	_ = cl.MarkSeen(ctx, 9)
+
+	// Another client deletes UID 7 before it was handled
+	seq := new(imap.SeqSet)
+	seq.AddNum(7)
+	if err := cl.c.UidStore(seq, imap.AddFlags, []interface{}{imap.DeletedFlag}, nil); err != nil {
+		t.Fatalf("UidStore() error = %v", err)
+	}
+	if err := cl.c.Expunge(nil); err != nil {
+		t.Fatalf("Expunge() error = %v", err)
+	}
+
+	if uids := fetchUIDs(t, cl); len(uids) != 0 {
+		t.Fatalf("Expected nothing to fetch, got %v", uids)
+	}
+	if len(cl.pending) != 0 {
+		t.Errorf("Expunged UID still pending: %v", cl.pending)
+	}
+	cursor, _ := st.GetIMAPCursor(cl.cursorKey())
+	if cursor == nil || cursor.LastUID != 9 {
+		t.Errorf("Expected cursor to reach 9 once the pending message is gone, got %+v", cursor)
+	}
+}
+
+func TestClient_Move(t *testing.T) {
+	be := seededBackend(t, "spam", "ham")
+	cfg := startTestServer(t, be)
+	st := newTestStore(t)
+	cl := newTestClient(t, cfg, st)
+	ctx := context.Background()
+
+	if uids := fetchUIDs(t, cl); !equalUIDs(uids, []uint32{7, 8}) {
+		t.Fatalf("Expected UIDs [7 8], got %v", uids)
+	}
+	if err := cl.Move(ctx, 7, "Quarantine"); err != nil {
+		t.Fatalf("Move() error = %v", err)
+	}
+	_ = cl.MarkSeen(ctx, 8)
+
+	u, _ := be.Login(nil, "username", "password")
+	q, err := u.GetMailbox("Quarantine")
+	if err != nil {
+		t.Fatalf("Quarantine folder should be created: %v", err)
+	}
+	if status, _ := q.Status([]imap.StatusItem{imap.StatusMessages}); status == nil || status.Messages != 1 {
+		t.Errorf("Expected one message in quarantine, got %+v", status)
+	}
+	cursor, _ := st.GetIMAPCursor(cl.cursorKey())
+	if cursor == nil || cursor.LastUID != 8 {
+		t.Errorf("Moved message counts as handled, cursor = %+v", cursor)
+	}
+	if uids := fetchUIDs(t, cl); len(uids) != 0 {
+		t.Errorf("Moved message must not be fetched again, got %v", uids)
+	}
+}
+
+func TestFetchUnseen_UIDValidityReset(t *testing.T) {
+	cfg := startTestServer(t, seededBackend(t, "first", "second"))
+	st := newTestStore(t)
+	cl := newTestClient(t, cfg, st)
+
+	// Cursor left over from before the mailbox was rebuilt
+	if err := st.StoreIMAPCursor(cl.cursorKey(), state.IMAPCursor{UIDValidity: 42, LastUID: 100}); err != nil {
+		t.Fatalf("StoreIMAPCursor() error = %v", err)
+	}
+
+	if uids := fetchUIDs(t, cl); !equalUIDs(uids, []uint32{7, 8}) {
+		t.Errorf("Expected UIDs [7 8] after UIDVALIDITY reset, got %v", uids)
+	}
+
+	cursor, _ := st.GetIMAPCursor(cl.cursorKey())
+	if cursor == nil || cursor.UIDValidity != 1 || cursor.LastUID != 0 {
+		t.Errorf("Expected cursor reset to {1 0}, got %+v", cursor)
+	}
+}
+
+func TestFetchUnseen_WithoutStore(t *testing.T) {
+	cfg := startTestServer(t, seededBackend(t, "first"))
+	cl := newTestClient(t, cfg, nil)
+
+	if uids := fetchUIDs(t, cl); !equalUIDs(uids, []uint32{7}) {
+		t.Fatalf("Expected UID 7, got %v", uids)
+	}
+	if err := cl.MarkSeen(context.Background(), 7); err != nil {
+		t.Fatalf("MarkSeen() error = %v", err)
+	}
+	if uids := fetchUIDs(t, cl); len(uids) != 0 {
+		t.Errorf("Expected no unseen messages, got %v", uids)
+	}
+}
+
+func TestParseMessageIDs(t *testing.T) {
+	tests := []struct {
+		name     string
+		header   string
+		expected []string
+	}{
+		{"Single", "<abc@example.com>", []string{"abc@example.com"}},
+		{"References list", "<a@x.com> <b@y.com>\r\n <c@z.com>", []string{"a@x.com", "b@y.com", "c@z.com"}},
+		{"Comment around ID", "<a@x.com> (Customer's message)", []string{"a@x.com"}},
+		{"Missing brackets", "bare@example.com", []string{"bare@example.com"}},
+		{"Empty", "", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parseMessageIDs(tt.header)
+			if strings.Join(got, ",") != strings.Join(tt.expected, ",") {
+				t.Errorf("parseMessageIDs(%q) = %v, want %v", tt.header, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestEmail_ThreadIDs(t *testing.T) {
+	em := Email{
+		InReplyTo:  "c@x.com",
+		References: []string{"a@x.com", "b@x.com", "c@x.com"},
+	}
+	got := strings.Join(em.ThreadIDs(), ",")
+	if got != "c@x.com,b@x.com,a@x.com" {
+		t.Errorf("ThreadIDs() = %s, want closest ancestor first without duplicates", got)
+	}
+}
+
+func TestFetchUnseen_ThreadingHeaders(t *testing.T) {
+	be := memory.New()
+	u, _ := be.Login(nil, "username", "password")
+	mbox, _ := u.GetMailbox("INBOX")
+	raw := "From: Customer <customer@example.com>\r\n" +
+		"To: helpdesk@example.com\r\n" +
+		"Subject: Re: completely different subject\r\n" +
+		"Message-ID: <reply-1@customer.example.com>\r\n" +
+		"In-Reply-To: <confirm-42@helpdesk.example.com>\r\n" +
+		"References: <orig@customer.example.com>\r\n <confirm-42@helpdesk.example.com>\r\n" +
+		"Content-Type: text/plain\r\n" +
+		"\r\n" +
+		"Any news?"
+	if err := mbox.CreateMessage(nil, time.Now(), bytes.NewBufferString(raw)); err != nil {
+		t.Fatalf("create message: %v", err)
+	}
+
+	cl := newTestClient(t, startTestServer(t, be), nil)
+	msgs, err := cl.FetchUnseen(context.Background())
+	if err != nil {
+		t.Fatalf("FetchUnseen() error = %v", err)
+	}
+	if len(msgs) != 1 {
+		t.Fatalf("Expected 1 message, got %d", len(msgs))
+	}
+	em := msgs[0]
+	if em.MessageID != "reply-1@customer.example.com" {
+		t.Errorf("Expected Message-ID reply-1@customer.example.com, got %q", em.MessageID)
+	}
+	if em.InReplyTo != "confirm-42@helpdesk.example.com" {
+		t.Errorf("Expected In-Reply-To confirm-42@helpdesk.example.com, got %q", em.InReplyTo)
+	}
+	if strings.Join(em.References, ",") != "orig@customer.example.com,confirm-42@helpdesk.example.com" {
+		t.Errorf("Unexpected References %v", em.References)
+	}
+	if !strings.Contains(em.Body, "Any news?") {
+		t.Errorf("Body should still be parsed, got %q", em.Body)
+	}
+}
+
+func TestFetchUnseen_Recipients(t *testing.T) {
+	be := memory.New()
+	u, _ := be.Login(nil, "username", "password")
+	mbox, _ := u.GetMailbox("INBOX")
+	raw := "From: Customer <customer@example.com>\r\n" +
+		"To: Helpdesk <Helpdesk@example.com>, boss@example.com\r\n" +
+		"Cc: Colleague <colleague@example.com>\r\n" +
+		"Reply-To: tickets@example.com\r\n" +
+		"Subject: Printer\r\n" +
+		"Content-Type: text/plain\r\n" +
+		"\r\n" +
+		"Broken again"
+	if err := mbox.CreateMessage(nil, time.Now(), bytes.NewBufferString(raw)); err != nil {
+		t.Fatalf("create message: %v", err)
+	}
+
+	cl := newTestClient(t, startTestServer(t, be), nil)
+	msgs, err := cl.FetchUnseen(context.Background())
+	if err != nil || len(msgs) != 1 {
+		t.Fatalf("FetchUnseen() = %d messages, %v", len(msgs), err)
+	}
+	em := msgs[0]
+	if strings.Join(em.To, ",") != "helpdesk@example.com,boss@example.com" {
+		t.Errorf("Unexpected To %v", em.To)
+	}
+	if strings.Join(em.Cc, ",") != "colleague@example.com" {
+		t.Errorf("Unexpected Cc %v", em.Cc)
+	}
+	if em.ReplyTo != "tickets@example.com" {
+		t.Errorf("Expected Reply-To tickets@example.com, got %q", em.ReplyTo)
+	}
+}
+
+func TestClient_CursorKey(t *testing.T) {
+	support := &Client{cfg: Config{Host: "imap.example.com", Username: "help@example.com", SearchTo: "Support@example.com"}, mailbox: "INBOX"}
+	billing := &Client{cfg: Config{Host: "imap.example.com", Username: "help@example.com", SearchTo: "billing@example.com"}, mailbox: "INBOX"}
+	plain := &Client{cfg: Config{Host: "imap.example.com", Username: "help@example.com"}, mailbox: "INBOX"}
+
+	if got := plain.cursorKey(); got != "imap.example.com/help@example.com/INBOX" {
+		t.Errorf("Unexpected cursor key %s", got)
+	}
+	if got := support.cursorKey(); got != "imap.example.com/help@example.com/INBOX/to=support@example.com" {
+		t.Errorf("Unexpected cursor key %s", got)
+	}
+	if support.cursorKey() == billing.cursorKey() {
+		t.Error("Routes sharing a mailbox must not share a cursor")
+	}
+}
+
+// xoauth2Server accepts XOAUTH2 for "username" with a fixed access token
+type xoauth2Server struct {
+	conn   server.Conn
+	be     backend.Backend
+	token  string
+	failed bool
+}
+
+func (s *xoauth2Server) Next(response []byte) ([]byte, bool, error) {
+	if s.failed {
+		return nil, true, errors.New("invalid token")
+	}
+	if response == nil {
+		return []byte{}, false, nil
+	}
+	if string(response) != "user=username\x01auth=Bearer "+s.token+"\x01\x01" {
+		s.failed = true
+		return []byte(`{"status":"401"}`), false, nil
+	}
+	user, err := s.be.Login(s.conn.Info(), "username", "password")
+	if err != nil {
+		return nil, true, err
+	}
+	ctx := s.conn.Context()
+	ctx.State = imap.AuthenticatedState
+	ctx.User = user
+	return nil, true, nil
+}
+
+// startOAuthServer serves the backend with XOAUTH2 and a token endpoint handing out issued
+func startOAuthServer(t *testing.T, be backend.Backend, valid, issued string) (Config, *atomic.Int32) {
+	t.Helper()
+	usePlainDialer(t)
+	l, cfg := listenLocal(t)
+	s := server.New(be)
+	s.AllowInsecureAuth = true
+	s.EnableAuth(oauth.MechXOAuth2, func(conn server.Conn) sasl.Server {
+		return &xoauth2Server{conn: conn, be: be, token: valid}
+	})
+	go func() { _ = s.Serve(l) }()
+	t.Cleanup(func() { _ = s.Close() })
+
+	var requests atomic.Int32
+	tokens := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		requests.Add(1)
+		_ = json.NewEncoder(w).Encode(map[string]any{"access_token": issued, "expires_in": 3600})
+	}))
+	t.Cleanup(tokens.Close)
+
+	cfg.Password = ""
+	cfg.OAuth = oauth.NewTokenSource(oauth.Config{TokenURL: tokens.URL, ClientID: "id"})
+	cfg.OAuthMechanism = oauth.MechXOAuth2
+	return cfg, &requests
+}
+
+func TestClient_OAuthLogin(t *testing.T) {
+	cfg, requests := startOAuthServer(t, seededBackend(t, "Hello"), "good-token", "good-token")
+
+	cl := newTestClient(t, cfg, nil)
+	if got := fetchUIDs(t, cl); len(got) != 1 {
+		t.Errorf("expected the seeded message after XOAUTH2 login, got %v", got)
+	}
+	if requests.Load() != 1 {
+		t.Errorf("expected one token request, got %d", requests.Load())
+	}
+}
+
+func TestClient_OAuthRejectedToken(t *testing.T) {
+	cfg, requests := startOAuthServer(t, seededBackend(t), "good-token", "stale-token")
+
+	if _, err := New(cfg, nil); err == nil {
+		t.Fatal("expected login to fail with a rejected token")
+	}
+	// The rejected token is dropped, the next connect asks for a new one
+	if _, err := New(cfg, nil); err == nil {
+		t.Fatal("expected login to fail with a rejected token")
+	}
+	if requests.Load() != 2 {
+		t.Errorf("expected a fresh token per attempt, got %d requests", requests.Load())
+	}
+}
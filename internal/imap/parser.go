@@ -0,0 +1,81 @@
+package imap
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/mail"
+	"strings"
+)
+
+// Parser turns raw messages from outside a mailbox, such as .eml files or an mbox
+// archive, into Emails the same way FetchUnseen does for mail on the server.
+type Parser struct {
+	stripper     *Stripper
+	ownAddresses []string
+	authServID   string
+}
+
+// NewParser uses the stripping rules, own addresses and authserv-id of the mailbox configuration
+func NewParser(cfg Config) (*Parser, error) {
+	stripper, err := NewStripper(cfg.Strip)
+	if err != nil {
+		return nil, err
+	}
+	return &Parser{stripper: stripper, ownAddresses: cfg.OwnAddresses, authServID: cfg.AuthServID}, nil
+}
+
+// Parse reads a raw RFC 5322 message. Sender, recipients, subject and date come from
+// its headers instead of an IMAP envelope.
+func (p *Parser) Parse(id string, raw []byte) (Email, error) {
+	msg, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		return Email{}, fmt.Errorf("read message: %w", err)
+	}
+	addrParser := mail.AddressParser{WordDecoder: &headerDecoder}
+	from, err := addrParser.Parse(msg.Header.Get("From"))
+	if err != nil {
+		return Email{}, fmt.Errorf("from: %w", err)
+	}
+	if from.Address == "" {
+		return Email{}, errors.New("from: empty address")
+	}
+
+	em := Email{
+		ID:        id,
+		Subject:   decodeHeader(msg.Header.Get("Subject")),
+		FromName:  strings.TrimSpace(from.Name),
+		FromEmail: strings.ToLower(from.Address),
+		To:        headerAddresses(&addrParser, msg.Header.Get("To")),
+		Cc:        headerAddresses(&addrParser, msg.Header.Get("Cc")),
+		Class:     ClassNormal,
+	}
+	if em.FromName == "" {
+		em.FromName = em.FromEmail
+	}
+	if rt := headerAddresses(&addrParser, msg.Header.Get("Reply-To")); len(rt) > 0 && rt[0] != em.FromEmail {
+		em.ReplyTo = rt[0]
+	}
+	if d, err := msg.Header.Date(); err == nil {
+		em.Date = d
+	}
+	parseRaw(&em, raw, p.stripper, p.ownAddresses, p.authServID)
+	return em, nil
+}
+
+// headerAddresses returns the lowercased addresses of an address list header,
+// an unparsable header gives none
+func headerAddresses(p *mail.AddressParser, v string) []string {
+	if strings.TrimSpace(v) == "" {
+		return nil
+	}
+	list, err := p.ParseList(v)
+	if err != nil {
+		return nil
+	}
+	out := make([]string, 0, len(list))
+	for _, a := range list {
+		out = append(out, strings.ToLower(a.Address))
+	}
+	return out
+}
@@ -0,0 +1,59 @@
+package imap
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParser_Parse(t *testing.T) {
+	p, err := NewParser(Config{OwnAddresses: []string{"helpdesk@example.com"}})
+	if err != nil {
+		t.Fatalf("NewParser() error = %v", err)
+	}
+	raw := "From: =?utf-8?q?Jan_Nov=C3=A1k?= <Jan@Customer.example.com>\r\n" +
+		"To: Helpdesk <helpdesk@example.com>\r\n" +
+		"Cc: petr@customer.example.com, Eva <eva@customer.example.com>\r\n" +
+		"Reply-To: support@customer.example.com\r\n" +
+		"Subject: =?utf-8?q?Tisk=C3=A1rna?=\r\n" +
+		"Date: Mon, 01 Jul 2024 10:00:00 +0200\r\n" +
+		"Message-ID: <abc@customer.example.com>\r\n" +
+		"In-Reply-To: <helpdesk-5.new.0@example.com>\r\n" +
+		"Content-Type: text/plain; charset=utf-8\r\n" +
+		"\r\n" +
+		"Printer is jammed.\r\n" +
+		"\r\n" +
+		"On Mon, Helpdesk wrote:\r\n" +
+		"> Ticket created\r\n"
+
+	em, err := p.Parse("ingest/abc", []byte(raw))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if em.ID != "ingest/abc" || em.FromName != "Jan Novák" || em.FromEmail != "jan@customer.example.com" {
+		t.Errorf("sender = %q %q <%s>", em.ID, em.FromName, em.FromEmail)
+	}
+	if em.Subject != "Tiskárna" {
+		t.Errorf("Subject = %q", em.Subject)
+	}
+	if !slices.Equal(em.To, []string{"helpdesk@example.com"}) || !slices.Equal(em.Cc, []string{"petr@customer.example.com", "eva@customer.example.com"}) {
+		t.Errorf("To = %v, Cc = %v", em.To, em.Cc)
+	}
+	if em.ReplyTo != "support@customer.example.com" {
+		t.Errorf("ReplyTo = %q", em.ReplyTo)
+	}
+	if want := time.Date(2024, 7, 1, 8, 0, 0, 0, time.UTC); !em.Date.Equal(want) {
+		t.Errorf("Date = %v, want %v", em.Date, want)
+	}
+	if em.MessageID != "abc@customer.example.com" || em.InReplyTo != "helpdesk-5.new.0@example.com" {
+		t.Errorf("threading = %q %q", em.MessageID, em.InReplyTo)
+	}
+	if em.Class != ClassNormal || em.Stripped != "Printer is jammed." || !strings.Contains(em.Body, "Ticket created") {
+		t.Errorf("class %v, body %q, stripped %q", em.Class, em.Body, em.Stripped)
+	}
+
+	if _, err := p.Parse("x", []byte("Subject: no sender\r\n\r\nbody")); err == nil {
+		t.Error("expected error for message without From")
+	}
+}
@@ -0,0 +1,192 @@
+package imap
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/emersion/go-imap"
+	"github.com/rs/zerolog/log"
+)
+
+// partialBoundary separates the parts of a message rebuilt without its large parts
+const partialBoundary = "=_helpdesk_bridge_partial"
+
+// largeMessages returns the structure of the messages having a part above
+// SkipPartsLarger, keyed by UID
+func (cl *Client) largeMessages(uids []uint32) (map[uint32]*imap.BodyStructure, error) {
+	seq := new(imap.SeqSet)
+	seq.AddNum(uids...)
+
+	ch := make(chan *imap.Message, maxChannelBuffer)
+	done := make(chan error, 1)
+	go func() {
+		done <- cl.c.UidFetch(seq, []imap.FetchItem{imap.FetchUid, imap.FetchBodyStructure}, ch)
+	}()
+
+	large := make(map[uint32]*imap.BodyStructure)
+	for msg := range ch {
+		if msg == nil || msg.BodyStructure == nil {
+			continue
+		}
+		if _, skipped := splitParts(msg.BodyStructure, cl.cfg.SkipPartsLarger); len(skipped) > 0 {
+			large[msg.Uid] = msg.BodyStructure
+		}
+	}
+	if err := <-done; err != nil {
+		return nil, err
+	}
+	return large, nil
+}
+
+// fetchPartial downloads the messages part by part, leaving the large parts on the
+// server. They are listed in Email.Skipped instead of Attachments.
+func (cl *Client) fetchPartial(large map[uint32]*imap.BodyStructure) ([]Email, error) {
+	uids := make([]uint32, 0, len(large))
+	for uid := range large {
+		uids = append(uids, uid)
+	}
+	slices.Sort(uids)
+
+	var out []Email
+	for _, uid := range uids {
+		keep, skipped := splitParts(large[uid], cl.cfg.SkipPartsLarger)
+
+		header := &imap.BodySectionName{BodyPartName: imap.BodyPartName{Specifier: imap.HeaderSpecifier}, Peek: true}
+		items := []imap.FetchItem{imap.FetchEnvelope, imap.FetchUid, imap.FetchFlags, header.FetchItem()}
+		sections := make([][2]*imap.BodySectionName, len(keep))
+		for i, path := range keep {
+			sections[i] = [2]*imap.BodySectionName{
+				{BodyPartName: imap.BodyPartName{Specifier: imap.MIMESpecifier, Path: path}, Peek: true},
+				{BodyPartName: imap.BodyPartName{Path: path}, Peek: true},
+			}
+			items = append(items, sections[i][0].FetchItem(), sections[i][1].FetchItem())
+		}
+
+		msg, err := cl.fetchOne(uid, items)
+		if err != nil {
+			return out, err
+		}
+		if msg.Envelope == nil {
+			log.Debug().Uint32("uid", uid).Msg("received message with nil envelope, skipping")
+			continue
+		}
+
+		parts := make([][2][]byte, len(sections))
+		for i, s := range sections {
+			parts[i] = [2][]byte{readSection(msg, s[0]), readSection(msg, s[1])}
+		}
+		email := cl.toEmail(msg, rebuildMessage(readSection(msg, header), parts))
+		email.Skipped = skipped
+		for _, att := range skipped {
+			log.Info().Uint32("uid", uid).Str("filename", att.Filename).Str("content_type", att.ContentType).Int64("size", att.Size).Msg("large part left on server")
+		}
+		cl.track(uid)
+		out = append(out, email)
+	}
+	return out, nil
+}
+
+// fetchOne fetches a single message by UID
+func (cl *Client) fetchOne(uid uint32, items []imap.FetchItem) (*imap.Message, error) {
+	seq := new(imap.SeqSet)
+	seq.AddNum(uid)
+
+	ch := make(chan *imap.Message, 1)
+	done := make(chan error, 1)
+	go func() {
+		done <- cl.c.UidFetch(seq, items, ch)
+	}()
+
+	var msg *imap.Message
+	for m := range ch {
+		if m != nil {
+			msg = m
+		}
+	}
+	if err := <-done; err != nil {
+		return nil, err
+	}
+	if msg == nil {
+		return nil, fmt.Errorf("message %d not returned by server", uid)
+	}
+	return msg, nil
+}
+
+func readSection(msg *imap.Message, section *imap.BodySectionName) []byte {
+	r := msg.GetBody(section)
+	if r == nil {
+		return nil
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		log.Warn().Err(err).Uint32("uid", msg.Uid).Str("section", string(section.FetchItem())).Msg("failed to read message section")
+	}
+	return data
+}
+
+// splitParts walks the leaf parts of a message: the paths of those up to limit bytes
+// are kept, the larger ones are returned as attachments without data. An attached
+// message counts as one part.
+func splitParts(bs *imap.BodyStructure, limit int64) (keep [][]int, skipped []Attachment) {
+	bs.Walk(func(path []int, part *imap.BodyStructure) bool {
+		if strings.EqualFold(part.MIMEType, "multipart") {
+			return true
+		}
+		if int64(part.Size) > limit {
+			skipped = append(skipped, skippedAttachment(part))
+		} else {
+			keep = append(keep, slices.Clone(path))
+		}
+		return false
+	})
+	return keep, skipped
+}
+
+func skippedAttachment(part *imap.BodyStructure) Attachment {
+	ct := strings.ToLower(part.MIMEType + "/" + part.MIMESubType)
+	name, _ := part.Filename()
+	if name == "" {
+		name = "attachment" + getExtensionForContentType(ct)
+	}
+	return Attachment{Filename: name, ContentType: ct, Size: int64(part.Size)}
+}
+
+// rebuildMessage puts the kept parts under the original header as a flat
+// multipart/mixed message. Each part is its MIME header and its content.
+func rebuildMessage(header []byte, parts [][2][]byte) []byte {
+	var b bytes.Buffer
+	skip := false
+	for _, line := range strings.SplitAfter(strings.TrimRight(string(header), "\r\n"), "\n") {
+		if line == "" {
+			continue
+		}
+		if line[0] != ' ' && line[0] != '\t' {
+			name, _, _ := strings.Cut(line, ":")
+			switch strings.ToLower(strings.TrimSpace(name)) {
+			case "content-type", "content-transfer-encoding", "mime-version":
+				skip = true
+			default:
+				skip = false
+			}
+		}
+		if !skip {
+			b.WriteString(strings.TrimRight(line, "\r\n") + "\r\n")
+		}
+	}
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: multipart/mixed; boundary=\"" + partialBoundary + "\"\r\n\r\n")
+	for _, p := range parts {
+		b.WriteString("--" + partialBoundary + "\r\n")
+		if h := strings.TrimRight(string(p[0]), "\r\n"); h != "" {
+			b.WriteString(h + "\r\n")
+		}
+		b.WriteString("\r\n")
+		b.Write(p[1])
+		b.WriteString("\r\n")
+	}
+	b.WriteString("--" + partialBoundary + "--\r\n")
+	return b.Bytes()
+}
@@ -0,0 +1,111 @@
+package imap
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func largeMessage() string {
+	return "From: Customer <customer@example.com>\r\n" +
+		"To: helpdesk@example.com\r\n" +
+		"Subject: Video of the fault\r\n" +
+		"Message-ID: <video@example.com>\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: multipart/mixed; boundary=\"b1\"\r\n" +
+		"\r\n" +
+		"--b1\r\n" +
+		"Content-Type: text/plain; charset=utf-8\r\n" +
+		"\r\n" +
+		"The printer jams, see the video.\r\n" +
+		"--b1\r\n" +
+		"Content-Type: application/pdf; name=\"manual.pdf\"\r\n" +
+		"Content-Disposition: attachment; filename=\"manual.pdf\"\r\n" +
+		"Content-Transfer-Encoding: base64\r\n" +
+		"\r\n" +
+		"JVBERi0xLjQK\r\n" +
+		"--b1\r\n" +
+		"Content-Type: video/mp4\r\n" +
+		"Content-Disposition: attachment; filename=\"jam.mp4\"\r\n" +
+		"Content-Transfer-Encoding: base64\r\n" +
+		"\r\n" +
+		strings.Repeat("AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA\r\n", 64) +
+		"--b1--\r\n"
+}
+
+func TestFetchUnseen_SkipsLargeParts(t *testing.T) {
+	be := seededBackend(t, "small")
+	u, _ := be.Login(nil, "username", "password")
+	mbox, _ := u.GetMailbox("INBOX")
+	if err := mbox.CreateMessage(nil, time.Now(), bytes.NewBufferString(largeMessage())); err != nil {
+		t.Fatalf("create message: %v", err)
+	}
+
+	cfg := startTestServer(t, be)
+	cfg.SkipPartsLarger = 1024
+	cl := newTestClient(t, cfg, newTestStore(t))
+
+	msgs, err := cl.FetchUnseen(context.Background())
+	if err != nil {
+		t.Fatalf("FetchUnseen() error = %v", err)
+	}
+	if len(msgs) != 2 {
+		t.Fatalf("got %d messages, want 2", len(msgs))
+	}
+
+	var small, large Email
+	for _, m := range msgs {
+		if m.Subject == "small" {
+			small = m
+		} else {
+			large = m
+		}
+	}
+	if small.Body != "Body of small" || len(small.Skipped) != 0 {
+		t.Errorf("small message = %q, skipped %v", small.Body, small.Skipped)
+	}
+
+	if large.UID != 8 || large.MessageID != "video@example.com" {
+		t.Errorf("large message UID = %d, Message-ID = %q", large.UID, large.MessageID)
+	}
+	if !strings.Contains(large.Body, "The printer jams") {
+		t.Errorf("Body = %q", large.Body)
+	}
+	if len(large.Attachments) != 1 || large.Attachments[0].Filename != "manual.pdf" || string(large.Attachments[0].Data) != "%PDF-1.4\n" {
+		t.Errorf("Attachments = %+v", large.Attachments)
+	}
+	if len(large.Skipped) != 1 {
+		t.Fatalf("Skipped = %+v", large.Skipped)
+	}
+	if s := large.Skipped[0]; s.Filename != "jam.mp4" || s.ContentType != "video/mp4" || s.Size < 4096 || s.Data != nil {
+		t.Errorf("Skipped[0] = %+v", s)
+	}
+
+	// Both count as handed out, the cursor moves once they are marked seen
+	for _, m := range msgs {
+		if err := cl.MarkSeen(context.Background(), m.UID); err != nil {
+			t.Fatalf("MarkSeen() error = %v", err)
+		}
+	}
+	if got := cl.loadCursor(); got != 8 {
+		t.Errorf("cursor = %d, want 8", got)
+	}
+}
+
+func TestRebuildMessage(t *testing.T) {
+	header := "Subject: Test\r\nContent-Type: multipart/mixed;\r\n boundary=\"x\"\r\nX-Keep: yes\r\n\r\n"
+	got := string(rebuildMessage([]byte(header), [][2][]byte{
+		{[]byte("Content-Type: text/plain\r\n\r\n"), []byte("hello")},
+		{nil, []byte("plain default")},
+	}))
+	want := "Subject: Test\r\nX-Keep: yes\r\nMIME-Version: 1.0\r\n" +
+		"Content-Type: multipart/mixed; boundary=\"" + partialBoundary + "\"\r\n\r\n" +
+		"--" + partialBoundary + "\r\nContent-Type: text/plain\r\n\r\nhello\r\n" +
+		"--" + partialBoundary + "\r\n\r\nplain default\r\n" +
+		"--" + partialBoundary + "--\r\n"
+	if got != want {
+		t.Errorf("rebuildMessage() =\n%q\nwant\n%q", got, want)
+	}
+}
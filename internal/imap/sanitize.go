@@ -0,0 +1,219 @@
+package imap
+
+import (
+	"bytes"
+	"html"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/emersion/go-message"
+)
+
+const (
+	// maxMIMEDepth limits recursion into nested multiparts
+	maxMIMEDepth = 10
+)
+
+// allowedTags are kept by SanitizeHTML, everything else is unwrapped to its text
+var allowedTags = map[string]bool{
+	"a": true, "abbr": true, "b": true, "blockquote": true, "br": true, "caption": true,
+	"code": true, "col": true, "colgroup": true, "dd": true, "del": true, "div": true,
+	"dl": true, "dt": true, "em": true, "font": true, "h1": true, "h2": true, "h3": true,
+	"h4": true, "h5": true, "h6": true, "hr": true, "i": true, "img": true, "ins": true,
+	"li": true, "ol": true, "p": true, "pre": true, "s": true, "small": true, "span": true,
+	"strike": true, "strong": true, "sub": true, "sup": true, "table": true, "tbody": true,
+	"td": true, "tfoot": true, "th": true, "thead": true, "tr": true, "u": true, "ul": true,
+}
+
+// droppedElements are removed together with their content
+var droppedElements = map[string]bool{
+	"script": true, "style": true, "head": true, "title": true, "iframe": true,
+	"object": true, "embed": true, "noscript": true, "template": true, "svg": true, "math": true,
+}
+
+// allowedAttrs lists the attributes kept on any allowed tag; URLs are checked separately
+var allowedAttrs = map[string]bool{
+	"alt": true, "title": true, "width": true, "height": true, "colspan": true,
+	"rowspan": true, "align": true, "valign": true, "border": true, "cellpadding": true,
+	"cellspacing": true, "color": true, "href": true, "src": true,
+}
+
+var (
+	tagNameRe = regexp.MustCompile(`^<\s*(/?)\s*([a-zA-Z][a-zA-Z0-9]*)`)
+	attrRe    = regexp.MustCompile(`([a-zA-Z_:][-a-zA-Z0-9_:.]*)(?:\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s"'=<>` + "`" + `]+)))?`)
+	cidSrcRe  = regexp.MustCompile(`(?i)(src\s*=\s*["'])cid:([^"']+)(["'])`)
+)
+
+// SanitizeHTML keeps the formatting of an email body (tables, lists, links, images)
+// and strips scripts, styles, event handlers and unsafe URLs.
+func SanitizeHTML(s string) string {
+	var out strings.Builder
+	skipUntil := "" // closing tag of a dropped element we are inside
+
+	for len(s) > 0 {
+		lt := strings.IndexByte(s, '<')
+		if lt < 0 {
+			if skipUntil == "" {
+				out.WriteString(s)
+			}
+			break
+		}
+		if skipUntil == "" {
+			out.WriteString(s[:lt])
+		}
+		s = s[lt:]
+
+		// Comments and conditional comments
+		if strings.HasPrefix(s, "<!--") {
+			end := strings.Index(s, "-->")
+			if end < 0 {
+				break
+			}
+			s = s[end+3:]
+			continue
+		}
+
+		gt := strings.IndexByte(s, '>')
+		if gt < 0 {
+			break
+		}
+		tag := s[:gt+1]
+		s = s[gt+1:]
+
+		m := tagNameRe.FindStringSubmatch(tag)
+		if m == nil {
+			// Doctype, processing instruction or a stray "<"
+			if skipUntil == "" && !strings.HasPrefix(tag, "<!") && !strings.HasPrefix(tag, "<?") {
+				out.WriteString(html.EscapeString(tag))
+			}
+			continue
+		}
+		closing, name := m[1] == "/", strings.ToLower(m[2])
+
+		if skipUntil != "" {
+			if closing && name == skipUntil {
+				skipUntil = ""
+			}
+			continue
+		}
+		if droppedElements[name] {
+			if !closing && !strings.HasSuffix(tag, "/>") {
+				skipUntil = name
+			}
+			continue
+		}
+		if !allowedTags[name] {
+			continue
+		}
+		if closing {
+			out.WriteString("</" + name + ">")
+			continue
+		}
+		out.WriteString(sanitizeTag(name, tag[len(m[0]):len(tag)-1]))
+	}
+	return out.String()
+}
+
+// sanitizeTag rebuilds an opening tag with only the allowed attributes
+func sanitizeTag(name, attrs string) string {
+	var b strings.Builder
+	b.WriteString("<" + name)
+	for _, am := range attrRe.FindAllStringSubmatch(attrs, -1) {
+		key := strings.ToLower(am[1])
+		if !allowedAttrs[key] {
+			continue
+		}
+		val := html.UnescapeString(am[2] + am[3] + am[4])
+		if (key == "href" || key == "src") && !safeURL(key, val) {
+			continue
+		}
+		b.WriteString(" " + key + `="` + html.EscapeString(val) + `"`)
+	}
+	if name == "a" {
+		b.WriteString(` rel="noopener noreferrer" target="_blank"`)
+	}
+	b.WriteString(">")
+	return b.String()
+}
+
+// safeURL accepts web and mail links, inline cid: references and embedded images
+func safeURL(attr, u string) bool {
+	l := strings.ToLower(strings.TrimSpace(u))
+	switch {
+	case strings.HasPrefix(l, "https://"), strings.HasPrefix(l, "http://"):
+		return true
+	case attr == "href" && strings.HasPrefix(l, "mailto:"):
+		return true
+	case attr == "src" && strings.HasPrefix(l, "cid:"):
+		return true
+	case attr == "src" && strings.HasPrefix(l, "data:image/") && !strings.HasPrefix(l, "data:image/svg"):
+		return true
+	}
+	return false
+}
+
+// ReplaceCIDs rewrites src="cid:..." references using the given Content-ID to URL map.
+// References without a URL are left untouched.
+func ReplaceCIDs(s string, urls map[string]string) string {
+	return cidSrcRe.ReplaceAllStringFunc(s, func(m string) string {
+		sm := cidSrcRe.FindStringSubmatch(m)
+		if u, ok := urls[strings.Trim(sm[2], "<>")]; ok {
+			return sm[1] + u + sm[3]
+		}
+		return m
+	})
+}
+
+// CIDs returns the Content-IDs referenced by the HTML body
+func CIDs(s string) []string {
+	var ids []string
+	for _, sm := range cidSrcRe.FindAllStringSubmatch(s, -1) {
+		ids = append(ids, strings.Trim(sm[2], "<>"))
+	}
+	return ids
+}
+
+// extractHTML returns the first text/html body part of a raw message, decoded to UTF-8
+func extractHTML(raw []byte) string {
+	e, err := message.Read(bytes.NewReader(raw))
+	if err != nil && !message.IsUnknownCharset(err) {
+		return ""
+	}
+	return findHTMLPart(e, err, 0)
+}
+
+func findHTMLPart(e *message.Entity, readErr error, depth int) string {
+	if depth > maxMIMEDepth {
+		return ""
+	}
+	if mr := e.MultipartReader(); mr != nil {
+		for {
+			p, err := mr.NextPart()
+			if err == io.EOF || p == nil {
+				return ""
+			}
+			if err != nil && !message.IsUnknownCharset(err) {
+				return ""
+			}
+			if h := findHTMLPart(p, err, depth+1); h != "" {
+				return h
+			}
+		}
+	}
+
+	ct, params, _ := e.Header.ContentType()
+	if disp, _ := getContentDisposition(e.Header); ct != "text/html" || disp == attachmentDisposition {
+		return ""
+	}
+	b, err := io.ReadAll(e.Body)
+	if err != nil {
+		return ""
+	}
+	return partText(b, params["charset"], readErr)
+}
+
+// contentID returns the Content-ID of a MIME part without angle brackets
+func contentID(h message.Header) string {
+	return strings.Trim(strings.TrimSpace(h.Get("Content-Id")), "<>")
+}
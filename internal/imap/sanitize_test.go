@@ -0,0 +1,150 @@
+package imap
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestSanitizeHTML(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{
+			name: "keeps formatting",
+			in:   `<p>Hello <b>world</b></p><ul><li>one</li></ul>`,
+			want: `<p>Hello <b>world</b></p><ul><li>one</li></ul>`,
+		},
+		{
+			name: "drops script with content",
+			in:   `<p>a</p><script>alert(1)</script><p>b</p>`,
+			want: `<p>a</p><p>b</p>`,
+		},
+		{
+			name: "drops head and style",
+			in:   `<html><head><title>x</title><style>p{color:red}</style></head><body><p>hi</p></body></html>`,
+			want: `<p>hi</p>`,
+		},
+		{
+			name: "drops event handlers and style attribute",
+			in:   `<div onclick="evil()" style="x" align="center">x</div>`,
+			want: `<div align="center">x</div>`,
+		},
+		{
+			name: "drops javascript links",
+			in:   `<a href="javascript:alert(1)">x</a>`,
+			want: `<a rel="noopener noreferrer" target="_blank">x</a>`,
+		},
+		{
+			name: "keeps web links",
+			in:   `<a href='https://example.com/?a=1&amp;b=2'>x</a>`,
+			want: `<a href="https://example.com/?a=1&amp;b=2" rel="noopener noreferrer" target="_blank">x</a>`,
+		},
+		{
+			name: "keeps cid images",
+			in:   `<img src="cid:logo@x" alt="Logo">`,
+			want: `<img src="cid:logo@x" alt="Logo">`,
+		},
+		{
+			name: "drops svg data images",
+			in:   `<img src="data:image/svg+xml;base64,AAAA">`,
+			want: `<img>`,
+		},
+		{
+			name: "drops comments",
+			in:   `a<!-- <script>x</script> -->b`,
+			want: `ab`,
+		},
+		{
+			name: "unwraps unknown tags",
+			in:   `<o:p>text</o:p><form action="x"><input></form>`,
+			want: `text`,
+		},
+		{
+			name: "escapes stray brackets",
+			in:   `1 < 2 <= 3>`,
+			want: `1 &lt; 2 &lt;= 3&gt;`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := SanitizeHTML(tt.in); got != tt.want {
+				t.Errorf("SanitizeHTML(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReplaceCIDs(t *testing.T) {
+	in := `<img src="cid:a@x"><img src='cid:<b@x>'><img src="cid:missing">`
+	got := ReplaceCIDs(in, map[string]string{"a@x": "/web/content/1", "b@x": "/web/content/2"})
+	want := `<img src="/web/content/1"><img src='/web/content/2'><img src="cid:missing">`
+	if got != want {
+		t.Errorf("ReplaceCIDs() = %q, want %q", got, want)
+	}
+
+	ids := CIDs(in)
+	if len(ids) != 3 || ids[0] != "a@x" || ids[1] != "b@x" || ids[2] != "missing" {
+		t.Errorf("CIDs() = %v", ids)
+	}
+}
+
+const relatedMessage = "From: a@example.com\r\n" +
+	"Subject: Logo\r\n" +
+	"MIME-Version: 1.0\r\n" +
+	"Content-Type: multipart/related; boundary=\"rel\"\r\n" +
+	"\r\n" +
+	"--rel\r\n" +
+	"Content-Type: multipart/alternative; boundary=\"alt\"\r\n" +
+	"\r\n" +
+	"--alt\r\n" +
+	"Content-Type: text/plain; charset=utf-8\r\n" +
+	"\r\n" +
+	"See the logo\r\n" +
+	"--alt\r\n" +
+	"Content-Type: text/html; charset=iso-8859-2\r\n" +
+	"Content-Transfer-Encoding: quoted-printable\r\n" +
+	"\r\n" +
+	"<p>Logo =E8ern=E9</p><img src=3D\"cid:logo@example.com\">\r\n" +
+	"--alt--\r\n" +
+	"--rel\r\n" +
+	"Content-Type: image/png; name=\"logo.png\"\r\n" +
+	"Content-Disposition: inline; filename=\"logo.png\"\r\n" +
+	"Content-Id: <logo@example.com>\r\n" +
+	"Content-Transfer-Encoding: base64\r\n" +
+	"\r\n" +
+	"iVBORw0KGgo=\r\n" +
+	"--rel--\r\n"
+
+func TestExtractHTML(t *testing.T) {
+	got := extractHTML([]byte(relatedMessage))
+	if !strings.Contains(got, "<p>Logo černé</p>") {
+		t.Errorf("expected decoded HTML part, got %q", got)
+	}
+	if !strings.Contains(got, `src="cid:logo@example.com"`) {
+		t.Errorf("expected cid reference, got %q", got)
+	}
+
+	plain := "From: a@example.com\r\nContent-Type: text/plain\r\n\r\nhello\r\n"
+	if got := extractHTML([]byte(plain)); got != "" {
+		t.Errorf("plain text mail should have no HTML part, got %q", got)
+	}
+}
+
+func TestParseEmailContent_InlineContentID(t *testing.T) {
+	_, atts := parseEmailContent(bytes.NewReader([]byte(relatedMessage)))
+	var found bool
+	for _, a := range atts {
+		if a.Filename == "logo.png" {
+			found = true
+			if a.ContentID != "logo@example.com" {
+				t.Errorf("expected Content-ID without brackets, got %q", a.ContentID)
+			}
+		}
+	}
+	if !found {
+		t.Fatalf("inline image not returned as attachment: %+v", atts)
+	}
+}
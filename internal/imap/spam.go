@@ -0,0 +1,130 @@
+package imap
+
+import (
+	"net/mail"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// AuthResults holds the SPF, DKIM and DMARC results the receiving server recorded in
+// Authentication-Results, lowercased ("pass", "fail", "softfail", "none", ...).
+// A method the header does not mention is empty.
+type AuthResults struct {
+	SPF   string
+	DKIM  string
+	DMARC string
+
+	// DKIMDomains are the signing domains of the passing signatures, header.d or the
+	// domain of header.i, lowercased
+	DKIMDomains []string
+}
+
+// SpamVerdict is what a spam filter such as SpamAssassin or rspamd wrote into X-Spam-* headers.
+type SpamVerdict struct {
+	Flagged bool    // X-Spam-Flag: YES or X-Spam-Status: Yes
+	Score   float64 // valid when Scored is set
+	Scored  bool
+}
+
+var (
+	// authComment matches RFC 5322 comments like "(sender IP is 192.0.2.1)"
+	authComment = regexp.MustCompile(`\([^()]*\)`)
+	// spamStatusScore picks "score=7.2" or "hits=7.2" out of X-Spam-Status
+	spamStatusScore = regexp.MustCompile(`(?i)\b(score|hits)=(-?[0-9]+(\.[0-9]+)?)`)
+)
+
+// parseAuthResults reads the topmost Authentication-Results header written by our
+// receiving server, the one whose authserv-id is authServID. Any other header could
+// have been written by the sender, a message without ours is unauthenticated.
+func parseAuthResults(h mail.Header, authServID string) AuthResults {
+	var res AuthResults
+	if authServID == "" {
+		return res
+	}
+	var v string
+	for _, value := range h["Authentication-Results"] {
+		value = authComment.ReplaceAllString(value, "")
+		// The first element is the authserv-id, optionally followed by a version
+		id, _, _ := strings.Cut(value, ";")
+		if fields := strings.Fields(id); len(fields) > 0 && strings.EqualFold(fields[0], authServID) {
+			v = value
+			break
+		}
+	}
+	if v == "" {
+		return res
+	}
+
+	for _, part := range strings.Split(v, ";")[1:] {
+		fields := strings.Fields(strings.TrimSpace(part))
+		if len(fields) == 0 {
+			continue
+		}
+		method, result, ok := strings.Cut(fields[0], "=")
+		if !ok {
+			continue
+		}
+		result = strings.ToLower(result)
+		switch strings.ToLower(method) {
+		case "spf":
+			res.SPF = result
+		case "dkim":
+			// With several signatures one valid signature is enough
+			if res.DKIM != "pass" {
+				res.DKIM = result
+			}
+			if result == "pass" {
+				if d := dkimDomain(fields[1:]); d != "" {
+					res.DKIMDomains = append(res.DKIMDomains, d)
+				}
+			}
+		case "dmarc":
+			res.DMARC = result
+		}
+	}
+	return res
+}
+
+// dkimDomain picks the signing domain out of the properties of a dkim result
+func dkimDomain(props []string) string {
+	var domain string
+	for _, p := range props {
+		name, value, _ := strings.Cut(p, "=")
+		switch strings.ToLower(name) {
+		case "header.d":
+			return strings.ToLower(value)
+		case "header.i":
+			// The identity is the domain or a subdomain of it, older servers only write this
+			domain = strings.ToLower(value[strings.LastIndex(value, "@")+1:])
+		}
+	}
+	return domain
+}
+
+// parseSpamVerdict reads X-Spam-Flag, X-Spam-Status and X-Spam-Score
+func parseSpamVerdict(h mail.Header) SpamVerdict {
+	var v SpamVerdict
+	if strings.EqualFold(strings.TrimSpace(h.Get("X-Spam-Flag")), "yes") {
+		v.Flagged = true
+	}
+	if status := strings.TrimSpace(h.Get("X-Spam-Status")); status != "" {
+		if strings.HasPrefix(strings.ToLower(status), "yes") {
+			v.Flagged = true
+		}
+		if m := spamStatusScore.FindStringSubmatch(status); m != nil {
+			if f, err := strconv.ParseFloat(m[2], 64); err == nil {
+				v.Score, v.Scored = f, true
+			}
+		}
+	}
+	// X-Spam-Score is either a number or a bar of "+" characters, one per point
+	if score := strings.TrimSpace(h.Get("X-Spam-Score")); score != "" {
+		if f, err := strconv.ParseFloat(score, 64); err == nil {
+			v.Score, v.Scored = f, true
+		} else if strings.Trim(score, "+") == "" {
+			v.Score, v.Scored = float64(len(score)), true
+		}
+	}
+	return v
+}
@@ -0,0 +1,72 @@
+package imap
+
+import (
+	"net/mail"
+	"reflect"
+	"testing"
+)
+
+func TestParseAuthResults(t *testing.T) {
+	h := mail.Header{"Authentication-Results": {
+		// Written by the sender above ours, our server did not strip it
+		"mx.google.com.evil.example.org; spf=pass; dkim=pass; dmarc=pass",
+		"mx.google.com;\r\n" +
+			"       dkim=fail header.i=@example.com header.s=s1 header.b=abc;\r\n" +
+			"       dkim=pass (2048-bit key) header.i=@esp.example.net;\r\n" +
+			"       spf=softfail (google.com: domain of transitioning x@example.com does not designate 192.0.2.1 as permitted sender) smtp.mailfrom=x@example.com;\r\n" +
+			"       dmarc=FAIL (p=REJECT sp=REJECT dis=NONE) header.from=example.com",
+		// Added before our server, possibly by the sender, and ignored
+		"mx.google.com; spf=pass; dkim=pass; dmarc=pass",
+	}}
+
+	got := parseAuthResults(h, "MX.google.com")
+	want := AuthResults{SPF: "softfail", DKIM: "pass", DMARC: "fail", DKIMDomains: []string{"esp.example.net"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseAuthResults() = %+v, want %+v", got, want)
+	}
+
+	// A forged header alone, or no authserv-id configured, leaves the mail unauthenticated
+	forged := mail.Header{"Authentication-Results": {"x; spf=pass; dkim=pass; dmarc=pass"}}
+	if got := parseAuthResults(forged, "mx.example.com"); !reflect.DeepEqual(got, AuthResults{}) {
+		t.Errorf("foreign authserv-id should give empty results, got %+v", got)
+	}
+	if got := parseAuthResults(h, ""); !reflect.DeepEqual(got, AuthResults{}) {
+		t.Errorf("without an authserv-id results should be empty, got %+v", got)
+	}
+
+	if got := parseAuthResults(mail.Header{}, "mx.example.com"); !reflect.DeepEqual(got, AuthResults{}) {
+		t.Errorf("missing header should give empty results, got %+v", got)
+	}
+	if got := parseAuthResults(mail.Header{"Authentication-Results": {"mx.example.com 1; none"}}, "mx.example.com"); !reflect.DeepEqual(got, AuthResults{}) {
+		t.Errorf("\"none\" should give empty results, got %+v", got)
+	}
+	if got := parseAuthResults(mail.Header{"Authentication-Results": {"mx.example.com 1; dmarc=pass"}}, "mx.example.com"); got.DMARC != "pass" {
+		t.Errorf("authserv-id with a version should match, got %+v", got)
+	}
+
+	signed := mail.Header{"Authentication-Results": {"mx.example.com; dkim=pass header.d=Example.com header.s=s1; dkim=pass header.i=@mail.example.org; dkim=fail header.d=other.example"}}
+	if got := parseAuthResults(signed, "mx.example.com").DKIMDomains; !reflect.DeepEqual(got, []string{"example.com", "mail.example.org"}) {
+		t.Errorf("DKIMDomains = %v, want the domains of the passing signatures", got)
+	}
+}
+
+func TestParseSpamVerdict(t *testing.T) {
+	tests := []struct {
+		name string
+		h    mail.Header
+		want SpamVerdict
+	}{
+		{"spamassassin yes", mail.Header{"X-Spam-Status": {"Yes, score=7.2 required=5.0 tests=BAYES_99,URIBL_BLACK autolearn=no"}}, SpamVerdict{Flagged: true, Score: 7.2, Scored: true}},
+		{"spamassassin no", mail.Header{"X-Spam-Status": {"No, score=-0.1 required=5.0"}}, SpamVerdict{Score: -0.1, Scored: true}},
+		{"flag and numeric score", mail.Header{"X-Spam-Flag": {"YES"}, "X-Spam-Score": {"12.5"}}, SpamVerdict{Flagged: true, Score: 12.5, Scored: true}},
+		{"bar score", mail.Header{"X-Spam-Score": {"+++++"}}, SpamVerdict{Score: 5, Scored: true}},
+		{"no headers", mail.Header{}, SpamVerdict{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseSpamVerdict(tt.h); got != tt.want {
+				t.Errorf("parseSpamVerdict() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
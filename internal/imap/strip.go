@@ -0,0 +1,251 @@
+package imap
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// wroteSpan is how many wrapped lines an "On <date> <name> wrote:" header may take
+	wroteSpan = 3
+	// headerBlockLookahead is how far below "From:" the rest of a forwarded header block is searched
+	headerBlockLookahead = 4
+)
+
+// StripConfig selects the rules used to cut quoted history and signatures from a body.
+type StripConfig struct {
+	Languages      []string // rule sets to use, all when empty
+	Patterns       []string // extra regexes, the body is cut at the first line matching one
+	KeepSignatures bool     // do not cut at "-- " and "Sent from my ..." lines
+	Debug          bool     // log which rule cut the body at info level
+}
+
+// stripRule cuts the body at the first line it matches
+type stripRule struct {
+	name string
+	re   *regexp.Regexp
+	// span > 1 also matches the line joined with the following ones, for wrapped headers
+	span int
+	// next, when set, must match one of the lines right below, e.g. "Sent:" under "From:"
+	next      *regexp.Regexp
+	signature bool
+}
+
+func rule(name, pattern string) stripRule {
+	return stripRule{name: name, re: regexp.MustCompile(`(?i)` + pattern), span: 1}
+}
+
+func wroteRule(name, pattern string) stripRule {
+	r := rule(name, pattern)
+	r.span = wroteSpan
+	return r
+}
+
+func headerRule(name, first, next string) stripRule {
+	r := rule(name, first)
+	r.next = regexp.MustCompile(`(?i)` + next)
+	return r
+}
+
+func signatureRule(name, pattern string) stripRule {
+	r := rule(name, pattern)
+	r.signature = true
+	return r
+}
+
+// languageRules are the quote headers mail clients write in each language
+var languageRules = map[string][]stripRule{
+	"en": {
+		rule("en.original_message", `^-{2,}\s*original message\s*-{2,}$`),
+		rule("en.forwarded_message", `^-{2,}\s*forwarded message\s*-{2,}$`),
+		wroteRule("en.on_wrote", `^on\s.+\swrote:$`),
+		headerRule("en.header_block", `^from:\s*\S`, `^(sent|date|to|subject|cc):`),
+	},
+	"cs": {
+		rule("cs.original_message", `^-{2,}\s*původní zpráva\s*-{2,}$`),
+		rule("cs.forwarded_message", `^-{2,}\s*přeposlaná zpráva\s*-{2,}$`),
+		wroteRule("cs.dne_napsal", `^dne\s.+\snapsal(a|\(a\))?:$`),
+		wroteRule("cs.address_napsal", `^.*<[^<>\s]+@[^<>\s]+>\s*napsal(a|\(a\))?:$`),
+		headerRule("cs.header_block", `^od:\s*\S`, `^(odesláno|datum|komu|předmět|kopie):`),
+	},
+	"sk": {
+		rule("sk.original_message", `^-{2,}\s*pôvodná správa\s*-{2,}$`),
+		rule("sk.forwarded_message", `^-{2,}\s*preposlaná správa\s*-{2,}$`),
+		wroteRule("sk.dna_napisal", `^dňa\s.+\snapísal(a|\(a\))?:$`),
+		wroteRule("sk.address_napisal", `^.*<[^<>\s]+@[^<>\s]+>\s*napísal(a|\(a\))?:$`),
+		headerRule("sk.header_block", `^od:\s*\S`, `^(odoslané|dátum|komu|predmet|kópia):`),
+	},
+	"de": {
+		rule("de.original_message", `^-{2,}\s*ursprüngliche nachricht\s*-{2,}$`),
+		rule("de.forwarded_message", `^-{2,}\s*weitergeleitete nachricht\s*-{2,}$`),
+		wroteRule("de.am_schrieb", `^am\s.+\sschrieb\s.+:$`),
+		headerRule("de.header_block", `^von:\s*\S`, `^(gesendet|datum|an|betreff|cc):`),
+	},
+}
+
+// commonRules apply regardless of language
+var commonRules = []stripRule{
+	rule("outlook_separator", `^_{20,}$`),
+	signatureRule("signature_delimiter", `^--$`), // "-- " once trimmed
+	signatureRule("mobile_signature", `^(sent from my\s|sent from outlook|get outlook for\s|odesláno z (mého )?(iphonu|iphone|androidu|telefonu)|odoslané z (môjho )?(iphonu|iphone|telefónu)|gesendet von meinem\s|von meinem \S+ gesendet)`),
+}
+
+// htmlQuoteMarkers mark where mail clients start the quoted history in HTML bodies
+var htmlQuoteMarkers = []struct {
+	name string
+	re   *regexp.Regexp
+}{
+	{"html.gmail_quote", regexp.MustCompile(`(?i)<div[^>]*class=["']?gmail_quote`)},
+	{"html.outlook_append", regexp.MustCompile(`(?i)<div[^>]*id=["']?appendonsend`)},
+	{"html.outlook_reply", regexp.MustCompile(`(?i)<div[^>]*id=["']?divRplyFwdMsg`)},
+	{"html.outlook_border", regexp.MustCompile(`(?i)<div[^>]*style=["'][^"']*border-top:\s*solid\s+#(e1e1e1|b5c4df)`)},
+	{"html.thunderbird_cite", regexp.MustCompile(`(?i)<div[^>]*class=["']?moz-cite-prefix`)},
+	{"html.blockquote_cite", regexp.MustCompile(`(?i)<blockquote[^>]*type=["']?cite`)},
+}
+
+// Stripper removes quoted history and signatures from email bodies.
+type Stripper struct {
+	rules []stripRule
+	debug bool
+}
+
+// defaultStripper uses every language and is behind CleanBody
+var defaultStripper, _ = NewStripper(StripConfig{})
+
+// NewStripper builds a stripper from the given rule selection.
+func NewStripper(cfg StripConfig) (*Stripper, error) {
+	langs := cfg.Languages
+	if len(langs) == 0 {
+		langs = []string{"en", "cs", "sk", "de"}
+	}
+
+	s := &Stripper{debug: cfg.Debug}
+	for _, lang := range langs {
+		rules, ok := languageRules[strings.ToLower(strings.TrimSpace(lang))]
+		if !ok {
+			return nil, fmt.Errorf("unknown strip language %q", lang)
+		}
+		s.rules = append(s.rules, rules...)
+	}
+	for i, p := range cfg.Patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("strip pattern %d: %w", i+1, err)
+		}
+		s.rules = append(s.rules, stripRule{name: fmt.Sprintf("pattern[%d]", i+1), re: re, span: 1})
+	}
+	for _, r := range commonRules {
+		if r.signature && cfg.KeepSignatures {
+			continue
+		}
+		s.rules = append(s.rules, r)
+	}
+	return s, nil
+}
+
+// Strip returns the body without quoted lines, quoted history and signature.
+// When nothing would be left the original body is returned.
+func (s *Stripper) Strip(b string) string {
+	lines := strings.Split(b, "\n")
+	var out []string
+
+	for i, ln := range lines {
+		trim := strings.TrimSpace(ln)
+
+		// Skip quoted lines
+		if strings.HasPrefix(trim, ">") {
+			continue
+		}
+
+		if r := s.match(lines, i); r != nil {
+			s.logCut(r.name, i)
+			break
+		}
+		out = append(out, ln)
+	}
+
+	res := strings.TrimSpace(strings.Join(out, "\n"))
+
+	// If result is empty and original had content, return original content
+	if res == "" && strings.TrimSpace(b) != "" {
+		log.Debug().Msg("CleanBody resulted in empty string, returning original content")
+		return strings.TrimSpace(b)
+	}
+	return res
+}
+
+// StripHTML cuts an HTML body at the quoted history markers of common mail clients.
+// It runs before sanitizing, which drops the ids and classes the markers rely on.
+func (s *Stripper) StripHTML(h string) string {
+	cut, name := -1, ""
+	for _, m := range htmlQuoteMarkers {
+		if loc := m.re.FindStringIndex(h); loc != nil && (cut < 0 || loc[0] < cut) {
+			cut, name = loc[0], m.name
+		}
+	}
+	if cut < 0 || strings.TrimSpace(htmlToText(h[:cut])) == "" {
+		return h
+	}
+	s.logCut(name, -1)
+	return h[:cut]
+}
+
+// match returns the rule that cuts the body at line i
+func (s *Stripper) match(lines []string, i int) *stripRule {
+	trim := strings.TrimSpace(lines[i])
+	if trim == "" {
+		return nil
+	}
+	for k := range s.rules {
+		r := &s.rules[k]
+		if !r.matchAt(lines, i) {
+			continue
+		}
+		if r.next != nil && !r.nextMatches(lines, i) {
+			continue
+		}
+		return r
+	}
+	return nil
+}
+
+func (r *stripRule) matchAt(lines []string, i int) bool {
+	joined := strings.TrimSpace(lines[i])
+	if r.re.MatchString(joined) {
+		return true
+	}
+	for k := 1; k < r.span && i+k < len(lines); k++ {
+		next := strings.TrimSpace(lines[i+k])
+		if next == "" {
+			break
+		}
+		joined += " " + next
+		if r.re.MatchString(joined) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *stripRule) nextMatches(lines []string, i int) bool {
+	for k := 1; k <= headerBlockLookahead && i+k < len(lines); k++ {
+		if r.next.MatchString(strings.TrimSpace(lines[i+k])) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Stripper) logCut(rule string, line int) {
+	ev := log.Debug()
+	if s.debug {
+		ev = log.Info()
+	}
+	if line >= 0 {
+		ev = ev.Int("line", line+1)
+	}
+	ev.Str("rule", rule).Msg("body cut by strip rule")
+}
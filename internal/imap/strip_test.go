@@ -0,0 +1,142 @@
+package imap
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestStripper_Strip(t *testing.T) {
+	s, err := NewStripper(StripConfig{})
+	if err != nil {
+		t.Fatalf("NewStripper() failed: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:     "from in the middle of a sentence is kept",
+			input:    "Please send the invoice from: our Prague office.\nThanks",
+			expected: "Please send the invoice from: our Prague office.\nThanks",
+		},
+		{
+			name:     "outlook header block",
+			input:    "Reply text\n\nFrom: Jan Novak <jan@example.com>\nSent: Monday, February 5, 2024 10:00\nTo: support@example.com\nSubject: Test\n\nOld text",
+			expected: "Reply text",
+		},
+		{
+			name:     "outlook separator",
+			input:    "Reply text\n________________________________\nFrom: someone\nOld text",
+			expected: "Reply text",
+		},
+		{
+			name:     "wrapped gmail header",
+			input:    "Thanks!\n\nOn Mon, 5 Feb 2024 at 10:00, Jan Novak <\njan@example.com> wrote:\n\nOld text",
+			expected: "Thanks!",
+		},
+		{
+			name:     "czech gmail header",
+			input:    "Díky\n\npo 5. 2. 2024 v 10:00 odesílatel Jan Novák <jan@example.com> napsal:\nstarý text",
+			expected: "Díky",
+		},
+		{
+			name:     "czech napsal in content is kept",
+			input:    "Kolega mi napsal:\nže to nefunguje",
+			expected: "Kolega mi napsal:\nže to nefunguje",
+		},
+		{
+			name:     "slovak header block",
+			input:    "Ďakujem\n\nOd: Ján <jan@example.sk>\nOdoslané: pondelok\nKomu: podpora",
+			expected: "Ďakujem",
+		},
+		{
+			name:     "german gmail header",
+			input:    "Danke\n\nAm Mo., 5. Feb. 2024 um 10:00 Uhr schrieb Hans <hans@example.de>:\nAlter Text",
+			expected: "Danke",
+		},
+		{
+			name:     "german outlook header",
+			input:    "Danke\n\nVon: Hans\nGesendet: Montag\nAn: support",
+			expected: "Danke",
+		},
+		{
+			name:     "signature delimiter",
+			input:    "Text\n-- \nJan Novak\nCEO",
+			expected: "Text",
+		},
+		{
+			name:     "mobile signature",
+			input:    "Text\n\nSent from my iPhone",
+			expected: "Text",
+		},
+		{
+			name:     "czech mobile signature",
+			input:    "Text\n\nOdesláno z iPhonu",
+			expected: "Text",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := s.Strip(tt.input); got != tt.expected {
+				t.Errorf("Strip() = %q, want %q", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestStripper_Config(t *testing.T) {
+	if _, err := NewStripper(StripConfig{Languages: []string{"xx"}}); err == nil {
+		t.Error("Expected error for unknown language")
+	}
+	if _, err := NewStripper(StripConfig{Patterns: []string{"("}}); err == nil {
+		t.Error("Expected error for invalid pattern")
+	}
+
+	// Only English rules, the German header stays
+	en, err := NewStripper(StripConfig{Languages: []string{"en"}})
+	if err != nil {
+		t.Fatalf("NewStripper() failed: %v", err)
+	}
+	input := "Danke\n\nVon: Hans\nGesendet: Montag"
+	if got := en.Strip(input); got != input {
+		t.Errorf("English rules should not cut German headers, got %q", got)
+	}
+
+	keep, err := NewStripper(StripConfig{KeepSignatures: true, Patterns: []string{`^={5,}$`}})
+	if err != nil {
+		t.Fatalf("NewStripper() failed: %v", err)
+	}
+	if got := keep.Strip("Text\n-- \nJan"); got != "Text\n-- \nJan" {
+		t.Errorf("Signature should be kept, got %q", got)
+	}
+	if got := keep.Strip("Text\n=====\nticket footer"); got != "Text" {
+		t.Errorf("Custom pattern should cut, got %q", got)
+	}
+}
+
+func TestStripper_StripHTML(t *testing.T) {
+	s, _ := NewStripper(StripConfig{})
+
+	gmail := `<div dir="ltr">Thanks</div><br><div class="gmail_quote"><div>On Mon wrote:</div><blockquote>old</blockquote></div>`
+	if got := s.StripHTML(gmail); got != `<div dir="ltr">Thanks</div><br>` {
+		t.Errorf("StripHTML(gmail) = %q", got)
+	}
+
+	outlook := `<p>Reply</p><div id="appendonsend"></div><hr><div id="divRplyFwdMsg">From: x</div>`
+	if got := s.StripHTML(outlook); got != `<p>Reply</p>` {
+		t.Errorf("StripHTML(outlook) = %q", got)
+	}
+
+	// Nothing before the marker, keep the whole body
+	onlyQuote := `<blockquote type="cite">old</blockquote>`
+	if got := s.StripHTML(onlyQuote); got != onlyQuote {
+		t.Errorf("StripHTML should keep a body that is only a quote, got %q", got)
+	}
+
+	plain := `<p>No quotes here</p>`
+	if got := s.StripHTML(plain); !strings.Contains(got, "No quotes here") {
+		t.Errorf("StripHTML(plain) = %q", got)
+	}
+}
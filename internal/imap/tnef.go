@@ -0,0 +1,402 @@
+package imap
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// TNEF (application/ms-tnef, usually named winmail.dat) is how Outlook wraps the body and
+// attachments of a rich text mail. The stream is a signature followed by attributes:
+// level (1 byte), id (4 bytes), length (4 bytes), data and a 2 byte checksum.
+const (
+	tnefSignature = 0x223E9F78
+
+	tnefLevelAttachment = 0x02
+
+	attSubject        = 0x00018004
+	attBody           = 0x0002800C
+	attAttachData     = 0x0006800F
+	attAttachTitle    = 0x00018010
+	attAttachRendData = 0x00069002
+	attMAPIProps      = 0x00069003
+	attAttachment     = 0x00069005
+	attOemCodepage    = 0x00069007
+)
+
+// MAPI property ids and types read from attMAPIProps and attAttachment
+const (
+	prBody                = 0x1000
+	prRTFCompressed       = 0x1009
+	prBodyHTML            = 0x1013
+	prAttachDataBin       = 0x3701
+	prAttachFilename      = 0x3704
+	prAttachLongFilename  = 0x3707
+	prAttachMIMETag       = 0x370E
+	prAttachContentID     = 0x3712
+	prAttachContentIDAlt  = 0x3713
+	ptMultiValue          = 0x1000
+	ptString8             = 0x001E
+	ptUnicode             = 0x001F
+	ptBinary              = 0x0102
+	ptObject              = 0x000D
+	ptCLSID               = 0x0048
+	mapiNamedPropertyBase = 0x8000
+)
+
+// tnefContent is what a winmail.dat carries
+type tnefContent struct {
+	Subject     string
+	Body        string
+	HTML        string
+	RTF         []byte // decompressed PR_RTF_COMPRESSED, kept when there is no other body
+	Attachments []Attachment
+}
+
+var errNotTNEF = errors.New("not a TNEF stream")
+
+// isTNEF reports whether the attachment is a winmail.dat
+func isTNEF(att Attachment) bool {
+	ct := strings.ToLower(att.ContentType)
+	return ct == "application/ms-tnef" || ct == "application/vnd.ms-tnef" ||
+		strings.EqualFold(att.Filename, "winmail.dat")
+}
+
+// decodeTNEF reads the body and attachments out of a TNEF stream
+//
+//nolint:gocyclo // One case per TNEF attribute
+func decodeTNEF(data []byte) (*tnefContent, error) {
+	if len(data) < 6 || binary.LittleEndian.Uint32(data) != tnefSignature {
+		return nil, errNotTNEF
+	}
+	var (
+		tn       tnefContent
+		charset  = "windows-1252"
+		att      *Attachment
+		pos      = 6 // signature and legacy key
+		finished = func() {
+			if att != nil && (len(att.Data) > 0 || att.Filename != "") {
+				if att.Filename == "" {
+					att.Filename = "attachment" + getExtensionForContentType(att.ContentType)
+				}
+				if att.ContentType == "" {
+					att.ContentType = "application/octet-stream"
+				}
+				att.Size = int64(len(att.Data))
+				tn.Attachments = append(tn.Attachments, *att)
+			}
+			att = nil
+		}
+	)
+
+	for pos < len(data) {
+		if len(data)-pos < 9 {
+			return nil, fmt.Errorf("truncated TNEF attribute at offset %d", pos)
+		}
+		level := data[pos]
+		id := binary.LittleEndian.Uint32(data[pos+1:])
+		n := int(binary.LittleEndian.Uint32(data[pos+5:]))
+		pos += 9
+		if n < 0 || n > len(data)-pos-2 {
+			return nil, fmt.Errorf("TNEF attribute %#08x overruns the stream", id)
+		}
+		value := data[pos : pos+n]
+		pos += n + 2 // checksum
+
+		if level == tnefLevelAttachment {
+			switch id {
+			case attAttachRendData:
+				finished()
+				att = &Attachment{}
+			case attAttachTitle:
+				if att != nil && att.Filename == "" {
+					att.Filename = decodeCharset(trimNUL(value), charset)
+				}
+			case attAttachData:
+				if att != nil {
+					att.Data = value
+				}
+			case attAttachment:
+				if att == nil {
+					continue
+				}
+				props, err := parseMAPIProps(value)
+				if err != nil {
+					return nil, fmt.Errorf("attachment properties: %w", err)
+				}
+				if name := props.text(prAttachLongFilename, charset); name != "" {
+					att.Filename = name
+				} else if name := props.text(prAttachFilename, charset); name != "" && att.Filename == "" {
+					att.Filename = name
+				}
+				if mt := props.text(prAttachMIMETag, charset); mt != "" {
+					att.ContentType = strings.ToLower(mt)
+				}
+				if cid := props.text(prAttachContentID, charset); cid != "" {
+					att.ContentID = cid
+				} else if cid := props.text(prAttachContentIDAlt, charset); cid != "" {
+					att.ContentID = cid
+				}
+				if v, ok := props[prAttachDataBin]; ok && len(att.Data) == 0 && v.typ == ptBinary {
+					att.Data = v.data
+				}
+			}
+			continue
+		}
+
+		switch id {
+		case attOemCodepage:
+			if len(value) >= 4 {
+				charset = codepageCharset(binary.LittleEndian.Uint32(value))
+			}
+		case attSubject:
+			tn.Subject = decodeCharset(trimNUL(value), charset)
+		case attBody:
+			tn.Body = decodeCharset(trimNUL(value), charset)
+		case attMAPIProps:
+			props, err := parseMAPIProps(value)
+			if err != nil {
+				return nil, fmt.Errorf("message properties: %w", err)
+			}
+			if body := props.text(prBody, charset); body != "" {
+				tn.Body = body
+			}
+			if html := props.text(prBodyHTML, charset); html != "" {
+				tn.HTML = html
+			}
+			if v, ok := props[prRTFCompressed]; ok {
+				// An oversized RTF is dropped, the body and HTML still come through
+				rtf, err := decompressRTF(v.data)
+				if err != nil && !errors.Is(err, errRTFTooLarge) {
+					return nil, fmt.Errorf("compressed RTF: %w", err)
+				}
+				tn.RTF = rtf
+			}
+		}
+	}
+	finished()
+	return &tn, nil
+}
+
+type mapiValue struct {
+	typ  uint16
+	data []byte
+}
+
+// mapiProps keeps the first value of each property, named properties are skipped
+type mapiProps map[uint16]mapiValue
+
+// text decodes a string property, PT_STRING8 is in the code page of the TNEF stream
+func (p mapiProps) text(id uint16, charset string) string {
+	v, ok := p[id]
+	if !ok {
+		return ""
+	}
+	switch v.typ {
+	case ptUnicode:
+		u := make([]uint16, 0, len(v.data)/2)
+		for i := 0; i+1 < len(v.data); i += 2 {
+			u = append(u, binary.LittleEndian.Uint16(v.data[i:]))
+		}
+		return strings.TrimRight(string(utf16.Decode(u)), "\x00")
+	case ptString8:
+		return decodeCharset(trimNUL(v.data), charset)
+	case ptBinary:
+		// PR_HTML is binary in the code page of the message
+		if utf8.Valid(v.data) {
+			return string(trimNUL(v.data))
+		}
+		return decodeCharset(trimNUL(v.data), charset)
+	}
+	return ""
+}
+
+// parseMAPIProps reads an encoded MAPI property list: a count, then per property
+// its type and id, the name for named properties, and the values padded to 4 bytes.
+func parseMAPIProps(data []byte) (mapiProps, error) {
+	r := &tnefReader{data: data}
+	props := make(mapiProps)
+	count := r.u32()
+	for i := uint32(0); i < count && r.err == nil; i++ {
+		tag := r.u32()
+		typ, id := uint16(tag), uint16(tag>>16)
+
+		if id >= mapiNamedPropertyBase {
+			r.skip(16) // GUID
+			if kind := r.u32(); kind == 0 {
+				r.skip(4)
+			} else {
+				r.skip(pad4(int(r.u32())))
+			}
+		}
+
+		base := typ &^ ptMultiValue
+		values := uint32(1)
+		if typ&ptMultiValue != 0 || isVariableMAPIType(base) {
+			values = r.u32()
+		}
+		for j := uint32(0); j < values && r.err == nil; j++ {
+			var v []byte
+			switch base {
+			case 0x0002, 0x0003, 0x0004, 0x000A, 0x000B, 0x0000, 0x0001:
+				v = r.bytes(4)
+			case 0x0005, 0x0006, 0x0007, 0x0014, 0x0040:
+				v = r.bytes(8)
+			case ptCLSID:
+				v = r.bytes(16)
+			case ptString8, ptUnicode, ptBinary, ptObject:
+				n := int(r.u32())
+				v = r.bytes(n)
+				r.skip(pad4(n) - n)
+			default:
+				return nil, fmt.Errorf("unknown MAPI property type %#04x", typ)
+			}
+			if _, seen := props[id]; !seen && j == 0 && id < mapiNamedPropertyBase {
+				props[id] = mapiValue{typ: base, data: v}
+			}
+		}
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	return props, nil
+}
+
+func isVariableMAPIType(t uint16) bool {
+	return t == ptString8 || t == ptUnicode || t == ptBinary || t == ptObject
+}
+
+// tnefReader is a bounds checked little endian reader, the first error sticks
+type tnefReader struct {
+	data []byte
+	pos  int
+	err  error
+}
+
+func (r *tnefReader) bytes(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n < 0 || n > len(r.data)-r.pos {
+		r.err = fmt.Errorf("truncated MAPI property at offset %d", r.pos)
+		return nil
+	}
+	b := r.data[r.pos : r.pos+n]
+	r.pos += n
+	return b
+}
+
+func (r *tnefReader) u32() uint32 {
+	if b := r.bytes(4); b != nil {
+		return binary.LittleEndian.Uint32(b)
+	}
+	return 0
+}
+
+func (r *tnefReader) skip(n int) { r.bytes(n) }
+
+func pad4(n int) int { return (n + 3) &^ 3 }
+
+func trimNUL(b []byte) []byte {
+	for len(b) > 0 && b[len(b)-1] == 0 {
+		b = b[:len(b)-1]
+	}
+	return b
+}
+
+// codepageCharset maps a Windows code page to a charset name decodeCharset knows
+func codepageCharset(cp uint32) string {
+	switch {
+	case cp == 65001:
+		return "utf-8"
+	case cp == 874 || (cp >= 1250 && cp <= 1258):
+		return fmt.Sprintf("windows-%d", cp)
+	case cp >= 28591 && cp <= 28605:
+		return fmt.Sprintf("iso-8859-%d", cp-28590)
+	case cp == 932:
+		return "shift_jis"
+	case cp == 936:
+		return "gbk"
+	case cp == 949:
+		return "euc-kr"
+	case cp == 950:
+		return "big5"
+	case cp == 20866:
+		return "koi8-r"
+	}
+	return "windows-1252"
+}
+
+// rtfPrebuf initializes the LZFu dictionary, see [MS-OXRTFCP] 2.1.2.1
+const rtfPrebuf = "{\\rtf1\\ansi\\mac\\deff0\\deftab720{\\fonttbl;}{\\f0\\fnil \\froman \\fswiss \\fmodern \\fscript \\fdecor MS Sans SerifSymbolArialTimes New RomanCourier{\\colortbl\\red0\\green0\\blue0\r\n\\par \\pard\\plain\\f0\\fs20\\b\\i\\u\\tab\\tx"
+
+const (
+	rtfCompressed   = 0x75465A4C // "LZFu"
+	rtfUncompressed = 0x414C454D // "MELA"
+
+	// maxRTFSize caps the uncompressed size a header may claim; the sender writes it
+	maxRTFSize = 16 << 20
+)
+
+var errRTFTooLarge = errors.New("RTF larger than the limit")
+
+// decompressRTF expands PR_RTF_COMPRESSED
+func decompressRTF(data []byte) ([]byte, error) {
+	if len(data) < 16 {
+		return nil, errors.New("header too short")
+	}
+	size := int(binary.LittleEndian.Uint32(data[4:]))
+	if size > maxRTFSize {
+		return nil, fmt.Errorf("%w: %d bytes", errRTFTooLarge, size)
+	}
+	magic := binary.LittleEndian.Uint32(data[8:])
+	in := data[16:]
+	switch magic {
+	case rtfUncompressed:
+		if size > len(in) {
+			size = len(in)
+		}
+		return in[:size], nil
+	case rtfCompressed:
+	default:
+		return nil, fmt.Errorf("unknown compression %#08x", magic)
+	}
+
+	var dict [4096]byte
+	copy(dict[:], rtfPrebuf)
+	w := len(rtfPrebuf)
+	// A reference of 2 bytes expands to at most 17, so the input bounds the output too
+	out := make([]byte, 0, min(size, 16*len(in)))
+	for i := 0; i < len(in); {
+		control := in[i]
+		i++
+		for bit := 0; bit < 8 && i < len(in); bit++ {
+			if control&(1<<bit) == 0 {
+				dict[w] = in[i]
+				w = (w + 1) % len(dict)
+				out = append(out, in[i])
+				i++
+				continue
+			}
+			if i+1 >= len(in) {
+				return nil, errors.New("truncated dictionary reference")
+			}
+			ref := int(in[i])<<8 | int(in[i+1])
+			i += 2
+			offset, length := ref>>4, ref&0xF+2
+			if offset == w {
+				return out, nil
+			}
+			for k := 0; k < length; k++ {
+				c := dict[(offset+k)%len(dict)]
+				dict[w] = c
+				w = (w + 1) % len(dict)
+				out = append(out, c)
+			}
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,236 @@
+package imap
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"strings"
+	"testing"
+	"unicode/utf16"
+)
+
+// tnefStream builds a TNEF stream out of (level, id, data) attributes
+type tnefStream struct{ bytes.Buffer }
+
+func newTNEFStream() *tnefStream {
+	s := &tnefStream{}
+	_ = binary.Write(s, binary.LittleEndian, uint32(tnefSignature))
+	_ = binary.Write(s, binary.LittleEndian, uint16(0x0001))
+	return s
+}
+
+func (s *tnefStream) attr(level byte, id uint32, data []byte) *tnefStream {
+	s.WriteByte(level)
+	_ = binary.Write(s, binary.LittleEndian, id)
+	_ = binary.Write(s, binary.LittleEndian, uint32(len(data)))
+	s.Write(data)
+	var sum uint16
+	for _, b := range data {
+		sum += uint16(b)
+	}
+	_ = binary.Write(s, binary.LittleEndian, sum)
+	return s
+}
+
+// mapiList encodes MAPI properties, each value is a PT_UNICODE, PT_STRING8 or PT_BINARY
+type mapiProp struct {
+	typ, id uint16
+	value   []byte
+}
+
+func mapiList(props ...mapiProp) []byte {
+	var b bytes.Buffer
+	_ = binary.Write(&b, binary.LittleEndian, uint32(len(props)))
+	for _, p := range props {
+		_ = binary.Write(&b, binary.LittleEndian, p.typ)
+		_ = binary.Write(&b, binary.LittleEndian, p.id)
+		_ = binary.Write(&b, binary.LittleEndian, uint32(1))
+		_ = binary.Write(&b, binary.LittleEndian, uint32(len(p.value)))
+		b.Write(p.value)
+		b.Write(make([]byte, pad4(len(p.value))-len(p.value)))
+	}
+	return b.Bytes()
+}
+
+func unicodeValue(s string) []byte {
+	var b bytes.Buffer
+	for _, u := range utf16.Encode([]rune(s + "\x00")) {
+		_ = binary.Write(&b, binary.LittleEndian, u)
+	}
+	return b.Bytes()
+}
+
+func testTNEF() []byte {
+	s := newTNEFStream()
+	cp := make([]byte, 8)
+	binary.LittleEndian.PutUint32(cp, 1250)
+	s.attr(1, attOemCodepage, cp)
+	s.attr(1, attSubject, []byte("Faktura\x00"))
+	s.attr(1, attMAPIProps, mapiList(
+		mapiProp{ptString8, prBody, []byte("Dobr\xfd den, p\xf8ikl\xe1d\xe1m fakturu.\x00")}, // windows-1250
+		mapiProp{ptBinary, prBodyHTML, []byte("<p>Dobrý den</p>")},
+	))
+
+	s.attr(2, attAttachRendData, make([]byte, 14))
+	s.attr(2, attAttachTitle, []byte("FAKTUR~1.PDF\x00"))
+	s.attr(2, attAttachData, []byte("%PDF-1.4 invoice"))
+	s.attr(2, attAttachment, mapiList(
+		mapiProp{ptUnicode, prAttachLongFilename, unicodeValue("faktura 2024-17.pdf")},
+		mapiProp{ptString8, prAttachMIMETag, []byte("application/pdf\x00")},
+	))
+
+	s.attr(2, attAttachRendData, make([]byte, 14))
+	s.attr(2, attAttachTitle, []byte("logo.png\x00"))
+	s.attr(2, attAttachData, []byte("\x89PNG"))
+	return s.Bytes()
+}
+
+func TestDecodeTNEF(t *testing.T) {
+	tn, err := decodeTNEF(testTNEF())
+	if err != nil {
+		t.Fatalf("decodeTNEF() error = %v", err)
+	}
+	if tn.Subject != "Faktura" {
+		t.Errorf("Subject = %q", tn.Subject)
+	}
+	if tn.Body != "Dobrý den, přikládám fakturu." {
+		t.Errorf("Body = %q", tn.Body)
+	}
+	if tn.HTML != "<p>Dobrý den</p>" {
+		t.Errorf("HTML = %q", tn.HTML)
+	}
+	if len(tn.Attachments) != 2 {
+		t.Fatalf("got %d attachments, want 2", len(tn.Attachments))
+	}
+	pdf := tn.Attachments[0]
+	if pdf.Filename != "faktura 2024-17.pdf" || pdf.ContentType != "application/pdf" || string(pdf.Data) != "%PDF-1.4 invoice" || pdf.Size != 16 {
+		t.Errorf("first attachment = %+v", pdf)
+	}
+	png := tn.Attachments[1]
+	if png.Filename != "logo.png" || png.ContentType != "application/octet-stream" || string(png.Data) != "\x89PNG" {
+		t.Errorf("second attachment = %+v", png)
+	}
+
+	if _, err := decodeTNEF([]byte("not tnef at all")); err == nil {
+		t.Error("expected error for data without TNEF signature")
+	}
+	truncated := testTNEF()
+	if _, err := decodeTNEF(truncated[:len(truncated)-3]); err == nil {
+		t.Error("expected error for truncated stream")
+	}
+}
+
+func TestDecompressRTF(t *testing.T) {
+	// Example from [MS-OXRTFCP] 3.1.1.1
+	compressed := []byte{
+		0x2d, 0x00, 0x00, 0x00, 0x2b, 0x00, 0x00, 0x00, 0x4c, 0x5a, 0x46, 0x75, 0xf1, 0xc5, 0xc7, 0xa7,
+		0x03, 0x00, 0x0a, 0x00, 0x72, 0x63, 0x70, 0x67, 0x31, 0x32, 0x35, 0x42, 0x32, 0x0a, 0xf3, 0x20,
+		0x68, 0x65, 0x6c, 0x09, 0x00, 0x20, 0x62, 0x77, 0x05, 0xb0, 0x6c, 0x64, 0x7d, 0x0a, 0x80, 0x0f,
+		0xa0,
+	}
+	got, err := decompressRTF(compressed)
+	if err != nil {
+		t.Fatalf("decompressRTF() error = %v", err)
+	}
+	if want := "{\\rtf1\\ansi\\ansicpg1252\\pard hello world}\r\n"; string(got) != want {
+		t.Errorf("decompressRTF() = %q, want %q", got, want)
+	}
+
+	raw := append([]byte{5, 0, 0, 0, 5, 0, 0, 0, 0x4d, 0x45, 0x4c, 0x41, 0, 0, 0, 0}, "{\\rtf}"...)
+	if got, err := decompressRTF(raw); err != nil || string(got) != "{\\rtf" {
+		t.Errorf("uncompressed RTF = %q, %v", got, err)
+	}
+
+	// A 20 byte blob claiming nearly 4 GiB is refused before anything is allocated
+	huge := []byte{4, 0, 0, 0, 0xf0, 0xff, 0xff, 0xef, 0x4c, 0x5a, 0x46, 0x75, 0, 0, 0, 0, 0, 'a', 'b', 'c'}
+	if got, err := decompressRTF(huge); !errors.Is(err, errRTFTooLarge) || got != nil {
+		t.Errorf("oversized RTF = %d bytes, %v", len(got), err)
+	}
+	// Inside winmail.dat only the RTF is dropped
+	s := newTNEFStream().attr(1, attMAPIProps, mapiList(
+		mapiProp{ptString8, prBody, []byte("Hello\x00")},
+		mapiProp{ptBinary, prRTFCompressed, huge},
+	))
+	if tn, err := decodeTNEF(s.Bytes()); err != nil || tn.Body != "Hello" || tn.RTF != nil {
+		t.Errorf("decodeTNEF() with an oversized RTF = %+v, %v", tn, err)
+	}
+	// Within the limit, the capacity follows the input rather than the header
+	claimed := []byte{4, 0, 0, 0, 0, 0, 0, 1, 0x4c, 0x5a, 0x46, 0x75, 0, 0, 0, 0, 0, 'a', 'b', 'c'}
+	if got, err := decompressRTF(claimed); err != nil || string(got) != "abc" || cap(got) > 16*4 {
+		t.Errorf("RTF with an inflated size = %q (cap %d), %v", got, cap(got), err)
+	}
+}
+
+func TestUnpackAttachments(t *testing.T) {
+	winmail := base64.StdEncoding.EncodeToString(testTNEF())
+	raw := "From: Jan <jan@customer.example.com>\r\n" +
+		"Subject: Faktura\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: multipart/mixed; boundary=outer\r\n" +
+		"\r\n" +
+		"--outer\r\n" +
+		"Content-Type: application/ms-tnef; name=winmail.dat\r\n" +
+		"Content-Transfer-Encoding: base64\r\n" +
+		"\r\n" +
+		winmail + "\r\n" +
+		"--outer\r\n" +
+		"Content-Type: message/rfc822\r\n" +
+		"\r\n" +
+		"From: Petr <petr@customer.example.com>\r\n" +
+		"Subject: =?utf-8?q?P=C5=AFvodn=C3=AD?=\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: multipart/mixed; boundary=inner\r\n" +
+		"\r\n" +
+		"--inner\r\n" +
+		"Content-Type: text/plain\r\n" +
+		"\r\n" +
+		"See the log.\r\n" +
+		"--inner\r\n" +
+		"Content-Type: text/plain\r\n" +
+		"Content-Disposition: attachment; filename=error.log\r\n" +
+		"\r\n" +
+		"panic: nil map\r\n" +
+		"--inner--\r\n" +
+		"--outer--\r\n"
+
+	body, atts := unpackAttachments(parseEmailContent(strings.NewReader(raw)))
+	if body != "Dobrý den, přikládám fakturu." {
+		t.Errorf("body = %q, want the TNEF body", body)
+	}
+
+	type file struct{ name, source string }
+	var got []file
+	for _, a := range atts {
+		got = append(got, file{a.Filename, a.Source})
+	}
+	want := []file{
+		{"winmail.dat", ""},
+		{"faktura 2024-17.pdf", "winmail.dat"},
+		{"logo.png", "winmail.dat"},
+		{"attachment.eml", ""},
+		{"attachment.txt", "attachment.eml"},
+		{"error.log", "attachment.eml"},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("attachments = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("attachment %d = %v, want %v", i, got[i], want[i])
+		}
+	}
+
+	text := string(atts[4].Data)
+	for _, s := range []string{"From: Petr <petr@customer.example.com>", "Subject: Původní", "See the log."} {
+		if !strings.Contains(text, s) {
+			t.Errorf("rendered message %q does not contain %q", text, s)
+		}
+	}
+
+	// A body already present is kept, a broken winmail.dat stays as it is
+	body, atts = unpackAttachments("Hello", []Attachment{{Filename: "winmail.dat", Data: []byte("garbage")}})
+	if body != "Hello" || len(atts) != 1 {
+		t.Errorf("unpackAttachments() = %q, %d attachments", body, len(atts))
+	}
+}
@@ -0,0 +1,94 @@
+package imap
+
+import (
+	"bytes"
+	"fmt"
+	"net/mail"
+	"path"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+// isAttachedMessage reports whether the attachment is a mail, message/rfc822 or an .eml file
+func isAttachedMessage(att Attachment) bool {
+	return strings.EqualFold(att.ContentType, "message/rfc822") ||
+		strings.EqualFold(path.Ext(att.Filename), ".eml")
+}
+
+// unpackAttachments expands winmail.dat and attached mails into the files they carry.
+// The containers stay in the list for audit, what was unpacked follows them with Source
+// set to the container's name. A TNEF body replaces an empty body.
+func unpackAttachments(body string, atts []Attachment) (string, []Attachment) {
+	return unpackLevel(body, atts, 0)
+}
+
+func unpackLevel(body string, atts []Attachment, depth int) (string, []Attachment) {
+	out := make([]Attachment, 0, len(atts))
+	for _, att := range atts {
+		out = append(out, att)
+		if depth >= maxMIMEDepth {
+			continue
+		}
+
+		var inner []Attachment
+		switch {
+		case isTNEF(att):
+			tn, err := decodeTNEF(att.Data)
+			if err != nil {
+				log.Warn().Err(err).Str("filename", att.Filename).Msg("failed to decode TNEF attachment, keeping it as it is")
+				continue
+			}
+			if strings.TrimSpace(body) == "" {
+				if strings.TrimSpace(tn.Body) != "" {
+					body = tn.Body
+				} else if tn.HTML != "" {
+					body = htmlToText(tn.HTML)
+				}
+			}
+			inner = tn.Attachments
+			// Outlook often sends only the RTF body, it is at least readable in a word processor
+			if len(tn.RTF) > 0 && tn.Body == "" && tn.HTML == "" {
+				inner = append(inner, Attachment{Filename: "message.rtf", ContentType: "application/rtf", Size: int64(len(tn.RTF)), Data: tn.RTF})
+			}
+		case isAttachedMessage(att):
+			text, atts := renderAttachedMessage(att.Data)
+			name := strings.TrimSuffix(att.Filename, path.Ext(att.Filename)) + ".txt"
+			inner = append([]Attachment{{Filename: name, ContentType: "text/plain", Size: int64(len(text)), Data: []byte(text)}}, atts...)
+		default:
+			continue
+		}
+
+		_, inner = unpackLevel("", inner, depth+1)
+		for i := range inner {
+			if inner[i].Source == "" {
+				inner[i].Source = att.Filename
+			}
+		}
+		log.Debug().Str("filename", att.Filename).Int("unpacked", len(inner)).Msg("unpacked container attachment")
+		out = append(out, inner...)
+	}
+	return body, out
+}
+
+// renderAttachedMessage turns an attached mail into plain text with its main headers
+// on top, and returns the attachments it carries.
+func renderAttachedMessage(raw []byte) (string, []Attachment) {
+	var b strings.Builder
+	if msg, err := mail.ReadMessage(bytes.NewReader(raw)); err == nil {
+		for _, name := range []string{"From", "Date", "To", "Cc", "Subject"} {
+			v := decodeHeader(msg.Header.Get(name))
+			if v == "" {
+				continue
+			}
+			fmt.Fprintf(&b, "%s: %s\n", name, v)
+		}
+		if b.Len() > 0 {
+			b.WriteString("\n")
+		}
+	}
+	body, atts := parseEmailContent(bytes.NewReader(raw))
+	b.WriteString(strings.TrimSpace(body))
+	b.WriteString("\n")
+	return b.String(), atts
+}
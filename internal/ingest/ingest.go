@@ -0,0 +1,211 @@
+// Package ingest reads mail stored in files: single .eml messages, mbox archives and Maildir folders.
+package ingest
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+)
+
+// Message is one raw RFC 5322 message and where it was read from
+type Message struct {
+	Source string // file path, "path#n" for the n-th message of an mbox
+	Raw    []byte
+}
+
+// Reader returns the messages of the given paths one by one, so an mbox of any size
+// is never held in memory as a whole.
+type Reader struct {
+	files []string
+
+	// mbox being read, nil between files
+	mbox     *bufio.Reader
+	mboxFile *os.File
+	mboxPath string
+	mboxN    int
+	// separator line of the next message, read while finishing the previous one
+	mboxNext []byte
+}
+
+// Open collects the files to read. A directory with cur/ or new/ is a Maildir, any
+// other directory is walked for files. A file starting with "From " is an mbox,
+// anything else a single message.
+func Open(paths ...string) (*Reader, error) {
+	r := &Reader{}
+	for _, p := range paths {
+		fi, err := os.Stat(p)
+		if err != nil {
+			return nil, err
+		}
+		if !fi.IsDir() {
+			r.files = append(r.files, p)
+			continue
+		}
+		files, err := dirFiles(p)
+		if err != nil {
+			return nil, err
+		}
+		r.files = append(r.files, files...)
+	}
+	return r, nil
+}
+
+// Files returns the number of files not read yet
+func (r *Reader) Files() int { return len(r.files) }
+
+// dirFiles lists the messages of a Maildir, new/ before cur/, or all files below a directory.
+// Maildir file names start with the delivery time, so sorting keeps them in order.
+func dirFiles(dir string) ([]string, error) {
+	if isDir(filepath.Join(dir, "new")) || isDir(filepath.Join(dir, "cur")) {
+		var files []string
+		for _, sub := range []string{"new", "cur"} {
+			entries, err := os.ReadDir(filepath.Join(dir, sub))
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			var names []string
+			for _, e := range entries {
+				if e.Type().IsRegular() {
+					names = append(names, filepath.Join(dir, sub, e.Name()))
+				}
+			}
+			sort.Strings(names)
+			files = append(files, names...)
+		}
+		return files, nil
+	}
+
+	var files []string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Type().IsRegular() {
+			files = append(files, path)
+		}
+		return nil
+	})
+	return files, err
+}
+
+func isDir(path string) bool {
+	fi, err := os.Stat(path)
+	return err == nil && fi.IsDir()
+}
+
+// Next returns the next message, io.EOF after the last one
+func (r *Reader) Next() (Message, error) {
+	for {
+		if r.mbox != nil {
+			raw, err := r.nextMbox()
+			if err == nil {
+				r.mboxN++
+				return Message{Source: r.mboxPath + "#" + strconv.Itoa(r.mboxN), Raw: raw}, nil
+			}
+			_ = r.closeMbox()
+			if !errors.Is(err, io.EOF) {
+				return Message{}, err
+			}
+			continue
+		}
+		if len(r.files) == 0 {
+			return Message{}, io.EOF
+		}
+		path := r.files[0]
+		r.files = r.files[1:]
+
+		f, err := os.Open(path)
+		if err != nil {
+			return Message{}, err
+		}
+		br := bufio.NewReader(f)
+		if head, _ := br.Peek(len(mboxSeparator)); string(head) == mboxSeparator {
+			r.mbox, r.mboxFile, r.mboxPath, r.mboxN = br, f, path, 0
+			continue
+		}
+		raw, err := io.ReadAll(br)
+		_ = f.Close()
+		if err != nil {
+			return Message{}, fmt.Errorf("%s: %w", path, err)
+		}
+		return Message{Source: path, Raw: raw}, nil
+	}
+}
+
+// Close releases the mbox being read
+func (r *Reader) Close() error {
+	r.files = nil
+	return r.closeMbox()
+}
+
+func (r *Reader) closeMbox() error {
+	if r.mboxFile == nil {
+		return nil
+	}
+	err := r.mboxFile.Close()
+	r.mbox, r.mboxFile, r.mboxNext = nil, nil, nil
+	return err
+}
+
+const mboxSeparator = "From "
+
+// nextMbox reads up to the next "From " line. Body lines escaped as ">From " (mboxrd)
+// lose one ">".
+func (r *Reader) nextMbox() ([]byte, error) {
+	var msg bytes.Buffer
+	started := r.mboxNext != nil
+	r.mboxNext = nil
+	for {
+		line, err := r.mbox.ReadBytes('\n')
+		if len(line) > 0 {
+			switch {
+			case bytes.HasPrefix(line, []byte(mboxSeparator)):
+				if started {
+					r.mboxNext = line
+					return trimMessage(msg.Bytes()), nil
+				}
+				started = true
+			case isEscapedFrom(line):
+				msg.Write(line[1:])
+			default:
+				msg.Write(line)
+			}
+		}
+		if err == io.EOF {
+			if !started || msg.Len() == 0 {
+				return nil, io.EOF
+			}
+			return trimMessage(msg.Bytes()), nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", r.mboxPath, err)
+		}
+	}
+}
+
+// isEscapedFrom matches ">From ", ">>From " and so on
+func isEscapedFrom(line []byte) bool {
+	rest := bytes.TrimLeft(line, ">")
+	return len(rest) < len(line) && bytes.HasPrefix(rest, []byte(mboxSeparator))
+}
+
+// trimMessage drops the blank line mbox puts before the next separator
+func trimMessage(b []byte) []byte {
+	switch {
+	case bytes.HasSuffix(b, []byte("\r\n\r\n")):
+		return b[:len(b)-2]
+	case bytes.HasSuffix(b, []byte("\n\n")):
+		return b[:len(b)-1]
+	}
+	return b
+}
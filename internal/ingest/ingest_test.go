@@ -0,0 +1,111 @@
+package ingest
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// readAll returns the sources and raw messages of the paths
+func readAll(t *testing.T, paths ...string) ([]string, []string) {
+	t.Helper()
+	r, err := Open(paths...)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer func() { _ = r.Close() }()
+	var sources, raws []string
+	for {
+		msg, err := r.Next()
+		if errors.Is(err, io.EOF) {
+			return sources, raws
+		}
+		if err != nil {
+			t.Fatalf("Next() error = %v", err)
+		}
+		sources = append(sources, msg.Source)
+		raws = append(raws, string(msg.Raw))
+	}
+}
+
+func TestReader_Eml(t *testing.T) {
+	dir := t.TempDir()
+	eml := filepath.Join(dir, "failed.eml")
+	writeFile(t, eml, "From: a@example.com\r\nSubject: one\r\n\r\nbody\r\n")
+
+	sources, raws := readAll(t, eml)
+	if len(raws) != 1 || sources[0] != eml || !strings.HasPrefix(raws[0], "From: a@example.com") {
+		t.Errorf("got %v %q", sources, raws)
+	}
+}
+
+func TestReader_Mbox(t *testing.T) {
+	mbox := filepath.Join(t.TempDir(), "archive.mbox")
+	writeFile(t, mbox, "From a@example.com Mon Jul  1 10:00:00 2024\n"+
+		"From: a@example.com\n"+
+		"Subject: one\n"+
+		"\n"+
+		">From the start, this was wrong.\n"+
+		">>From here too.\n"+
+		"\n"+
+		"From b@example.com Mon Jul  1 11:00:00 2024\n"+
+		"From: b@example.com\n"+
+		"Subject: two\n"+
+		"\n"+
+		"second\n")
+
+	sources, raws := readAll(t, mbox)
+	if len(raws) != 2 {
+		t.Fatalf("got %d messages, want 2: %q", len(raws), raws)
+	}
+	if sources[0] != mbox+"#1" || sources[1] != mbox+"#2" {
+		t.Errorf("sources = %v", sources)
+	}
+	want := "From: a@example.com\nSubject: one\n\nFrom the start, this was wrong.\n>From here too.\n"
+	if raws[0] != want {
+		t.Errorf("first message = %q, want %q", raws[0], want)
+	}
+	if raws[1] != "From: b@example.com\nSubject: two\n\nsecond\n" {
+		t.Errorf("second message = %q", raws[1])
+	}
+}
+
+func TestReader_Maildir(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "cur", "1700000002.M1.host:2,S"), "Subject: old\r\n\r\n")
+	writeFile(t, filepath.Join(dir, "new", "1700000003.M1.host"), "Subject: new\r\n\r\n")
+	writeFile(t, filepath.Join(dir, "tmp", "1700000004.M1.host"), "Subject: being delivered\r\n\r\n")
+
+	_, raws := readAll(t, dir)
+	if len(raws) != 2 || !strings.Contains(raws[0], "new") || !strings.Contains(raws[1], "old") {
+		t.Errorf("got %q, want new/ then cur/ and nothing from tmp/", raws)
+	}
+}
+
+func TestReader_Directory(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "a.eml"), "Subject: a\r\n\r\n")
+	writeFile(t, filepath.Join(dir, "sub", "b.eml"), "Subject: b\r\n\r\n")
+
+	_, raws := readAll(t, dir)
+	if len(raws) != 2 {
+		t.Errorf("got %d messages, want 2", len(raws))
+	}
+
+	if _, err := Open(filepath.Join(dir, "missing.eml")); err == nil {
+		t.Error("expected error for missing path")
+	}
+}
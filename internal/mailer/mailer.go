@@ -6,9 +6,13 @@ import (
 	"crypto/tls"
 	"fmt"
 	"net/smtp"
+	"strings"
 	"time"
 
 	"github.com/jordan-wright/email"
+	"github.com/rs/zerolog/log"
+
+	"github.com/anaryk/odoo-helpdesk-bridge/internal/oauth"
 )
 
 const (
@@ -25,6 +29,13 @@ type SMTPConfig struct {
 	FromName  string
 	FromEmail string
 	Timeout   time.Duration
+
+	// OAuth replaces the password with XOAUTH2 or OAUTHBEARER when set
+	OAuth          *oauth.TokenSource
+	OAuthMechanism string
+
+	// Suppress logs outgoing mail instead of sending it
+	Suppress bool
 }
 
 // SMTPClient provides email sending functionality via SMTP.
@@ -33,36 +44,39 @@ type SMTPClient struct{ cfg SMTPConfig }
 // NewSMTP creates a new SMTP client with the provided configuration.
 func NewSMTP(cfg SMTPConfig) *SMTPClient { return &SMTPClient{cfg: cfg} }
 
-// Send sends an email message to the specified recipient.
-func (m *SMTPClient) Send(to, subject, body string) error {
-	e := email.NewEmail()
-	if m.cfg.FromName != "" {
-		e.From = m.cfg.FromName + " <" + m.cfg.FromEmail + ">"
-	} else {
-		e.From = m.cfg.FromEmail
-	}
-	e.To = []string{to}
-	e.Subject = subject
-	e.Text = []byte(body)
-
-	addr := m.cfg.Host + ":" + itoa(m.cfg.Port)
+// Thread carries the threading headers of an outgoing message.
+// Message IDs are given without angle brackets.
+type Thread struct {
+	MessageID  string
+	InReplyTo  string
+	References []string
+	// Cc keeps the other participants of the conversation in copy
+	Cc []string
+}
 
-	var auth smtp.Auth
-	if m.cfg.Username != "" || m.cfg.Password != "" {
-		auth = smtp.PlainAuth("", m.cfg.Username, m.cfg.Password, m.cfg.Host)
+// MessageID returns a deterministic Message-ID for a message on a task, so a resend
+// of the same notification reuses the same ID. The domain is taken from FromEmail. A
+// non-empty token (the ticket's HMAC token) follows the task ID, replies can then prove
+// they answer a mail the bridge sent.
+func (m *SMTPClient) MessageID(scope string, taskID int64, kind string, ref int64, token string) string {
+	domain := "localhost"
+	if at := strings.LastIndex(m.cfg.FromEmail, "@"); at >= 0 && at < len(m.cfg.FromEmail)-1 {
+		domain = m.cfg.FromEmail[at+1:]
 	}
-
-	// Use STARTTLS for port 587 (Gmail standard), direct TLS for port 465
-	if m.cfg.Port == smtpSubmissionPort {
-		return e.SendWithStartTLS(addr, auth, &tls.Config{
-			ServerName: m.cfg.Host,
-			MinVersion: tls.VersionTLS12,
-		})
+	scope = strings.ToLower(strings.TrimSpace(scope))
+	if scope == "" {
+		scope = "helpdesk"
 	}
-	return e.SendWithTLS(addr, auth, &tls.Config{
-		ServerName: m.cfg.Host,
-		MinVersion: tls.VersionTLS12,
-	})
+	if token != "" {
+		return fmt.Sprintf("%s-%d-%s.%s.%d@%s", scope, taskID, token, kind, ref, domain)
+	}
+	return fmt.Sprintf("%s-%d.%s.%d@%s", scope, taskID, kind, ref, domain)
+}
+
+// Send sends an email message to the specified recipient.
+// A non-nil thread sets Message-ID, In-Reply-To and References.
+func (m *SMTPClient) Send(to, subject, body string, thread *Thread) error {
+	return m.deliver(m.newEmail(to, subject, body, thread))
 }
 
 // Attachment represents an email attachment
@@ -73,7 +87,22 @@ type Attachment struct {
 }
 
 // SendWithAttachments sends an email with attachments
-func (m *SMTPClient) SendWithAttachments(to, subject, body string, attachments []Attachment) error {
+func (m *SMTPClient) SendWithAttachments(to, subject, body string, attachments []Attachment, thread *Thread) error {
+	e := m.newEmail(to, subject, body, thread)
+
+	// Add attachments
+	for _, att := range attachments {
+		_, err := e.Attach(bytes.NewReader(att.Data), att.Filename, att.ContentType)
+		if err != nil {
+			return fmt.Errorf("attach %s: %w", att.Filename, err)
+		}
+	}
+
+	return m.deliver(e)
+}
+
+// newEmail builds the message with sender and threading headers
+func (m *SMTPClient) newEmail(to, subject, body string, thread *Thread) *email.Email {
 	e := email.NewEmail()
 	if m.cfg.FromName != "" {
 		e.From = m.cfg.FromName + " <" + m.cfg.FromEmail + ">"
@@ -84,18 +113,33 @@ func (m *SMTPClient) SendWithAttachments(to, subject, body string, attachments [
 	e.Subject = subject
 	e.Text = []byte(body)
 
-	// Add attachments
-	for _, att := range attachments {
-		_, err := e.Attach(bytes.NewReader(att.Data), att.Filename, att.ContentType)
-		if err != nil {
-			return fmt.Errorf("attach %s: %w", att.Filename, err)
+	if thread != nil {
+		if thread.MessageID != "" {
+			e.Headers.Set("Message-Id", "<"+thread.MessageID+">")
+		}
+		if thread.InReplyTo != "" {
+			e.Headers.Set("In-Reply-To", "<"+thread.InReplyTo+">")
 		}
+		if len(thread.References) > 0 {
+			e.Headers.Set("References", "<"+strings.Join(thread.References, "> <")+">")
+		}
+		e.Cc = thread.Cc
 	}
+	return e
+}
 
+// deliver sends the message over SMTP
+func (m *SMTPClient) deliver(e *email.Email) error {
+	if m.cfg.Suppress {
+		log.Info().Strs("to", e.To).Strs("cc", e.Cc).Str("subject", e.Subject).Msg("outgoing mail suppressed")
+		return nil
+	}
 	addr := m.cfg.Host + ":" + itoa(m.cfg.Port)
 
 	var auth smtp.Auth
-	if m.cfg.Username != "" || m.cfg.Password != "" {
+	if m.cfg.OAuth != nil {
+		auth = oauth.SMTPAuth(m.cfg.OAuthMechanism, m.cfg.Username, m.cfg.OAuth)
+	} else if m.cfg.Username != "" || m.cfg.Password != "" {
 		auth = smtp.PlainAuth("", m.cfg.Username, m.cfg.Password, m.cfg.Host)
 	}
 
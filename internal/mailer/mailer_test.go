@@ -2,6 +2,7 @@ package mailer
 
 import (
 	"errors"
+	"strings"
 	"testing"
 	"time"
 )
@@ -340,14 +341,14 @@ func TestSendWithAttachments_Success(t *testing.T) {
 	client := NewSMTP(cfg)
 
 	// This will fail but shouldn't panic - we're testing the method exists and handles attachments
-	err := client.SendWithAttachments("recipient@test.com", "Test Subject", "Test Body", attachments)
+	err := client.SendWithAttachments("recipient@test.com", "Test Subject", "Test Body", attachments, nil)
 	// We expect this to fail since we're using a nonexistent server
 	if err == nil {
 		t.Error("Expected error with nonexistent SMTP server")
 	}
 
 	// Test with empty attachments - should also fail with same server but not panic
-	err = client.SendWithAttachments("recipient@test.com", "Test Subject", "Test Body", nil)
+	err = client.SendWithAttachments("recipient@test.com", "Test Subject", "Test Body", nil, nil)
 	if err == nil {
 		t.Error("Expected error with nonexistent SMTP server")
 	}
@@ -370,3 +371,87 @@ func TestAttachment_Structure(t *testing.T) {
 		t.Errorf("Expected data 'test data', got %s", string(att.Data))
 	}
 }
+
+func TestSMTPClient_MessageID(t *testing.T) {
+	client := NewSMTP(SMTPConfig{FromEmail: "support@example.com"})
+
+	id := client.MessageID("ML", 42, "reply", 317, "")
+	if id != "ml-42.reply.317@example.com" {
+		t.Errorf("Expected ml-42.reply.317@example.com, got %s", id)
+	}
+	if again := client.MessageID("ML", 42, "reply", 317, ""); again != id {
+		t.Errorf("MessageID should be deterministic, got %s and %s", id, again)
+	}
+	if other := client.MessageID("ML", 42, "reply", 318, ""); other == id {
+		t.Error("Different messages should get different IDs")
+	}
+
+	if signed := client.MessageID("ML", 42, "reply", 317, "1a2b3c4d"); signed != "ml-42-1a2b3c4d.reply.317@example.com" {
+		t.Errorf("Expected ml-42-1a2b3c4d.reply.317@example.com, got %s", signed)
+	}
+
+	noDomain := NewSMTP(SMTPConfig{FromEmail: "invalid"})
+	if id := noDomain.MessageID("", 1, "new", 0, ""); id != "helpdesk-1.new.0@localhost" {
+		t.Errorf("Expected fallback helpdesk-1.new.0@localhost, got %s", id)
+	}
+}
+
+func TestSMTPClient_ThreadingHeaders(t *testing.T) {
+	client := NewSMTP(SMTPConfig{FromName: "Support", FromEmail: "support@example.com"})
+
+	e := client.newEmail("customer@example.com", "Re: [ML-#42] Printer", "Hello", &Thread{
+		MessageID:  "ml-42.reply.317@example.com",
+		InReplyTo:  "reply-1@customer.example.com",
+		References: []string{"orig@customer.example.com", "ml-42.new.0@example.com", "reply-1@customer.example.com"},
+	})
+	raw, err := e.Bytes()
+	if err != nil {
+		t.Fatalf("Bytes() error = %v", err)
+	}
+	msg := string(raw)
+
+	for _, want := range []string{
+		"Message-Id: <ml-42.reply.317@example.com>",
+		"In-Reply-To: <reply-1@customer.example.com>",
+		"References: <orig@customer.example.com> <ml-42.new.0@example.com> <reply-1@customer.example.com>",
+	} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("Expected header %q in message:\n%s", want, msg)
+		}
+	}
+
+	// Without thread metadata no threading headers are added
+	raw, err = client.newEmail("customer@example.com", "Hi", "Hello", nil).Bytes()
+	if err != nil {
+		t.Fatalf("Bytes() error = %v", err)
+	}
+	if strings.Contains(string(raw), "In-Reply-To") || strings.Contains(string(raw), "References") {
+		t.Errorf("Unexpected threading headers:\n%s", raw)
+	}
+}
+
+func TestSMTPClient_Cc(t *testing.T) {
+	client := NewSMTP(SMTPConfig{FromEmail: "support@example.com"})
+
+	e := client.newEmail("customer@example.com", "Re: [ML-#42] Printer", "Hello", &Thread{
+		Cc: []string{"colleague@example.com", "boss@example.com"},
+	})
+	raw, err := e.Bytes()
+	if err != nil {
+		t.Fatalf("Bytes() error = %v", err)
+	}
+	if !strings.Contains(string(raw), "Cc: <colleague@example.com>, <boss@example.com>") {
+		t.Errorf("Expected Cc header in message:\n%s", raw)
+	}
+	if strings.Contains(string(raw), "To: <colleague") {
+		t.Errorf("Cc recipients must not be added to To:\n%s", raw)
+	}
+}
+
+func TestSMTPClient_Suppress(t *testing.T) {
+	// Nothing listens on the port, a delivery attempt would fail
+	client := NewSMTP(SMTPConfig{Host: "127.0.0.1", Port: 1, FromEmail: "support@example.com", Suppress: true})
+	if err := client.Send("customer@example.com", "Subject", "Body", nil); err != nil {
+		t.Errorf("Send() with Suppress error = %v", err)
+	}
+}
@@ -0,0 +1,167 @@
+// Package oauth fetches OAuth2 access tokens and turns them into the XOAUTH2 and
+// OAUTHBEARER SASL exchanges used to log in to IMAP and SMTP without a password.
+package oauth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// MechXOAuth2 is the SASL mechanism used by Google and Microsoft
+	MechXOAuth2 = "XOAUTH2"
+	// MechOAuthBearer is the standard SASL mechanism from RFC 7628
+	MechOAuthBearer = "OAUTHBEARER"
+
+	// expirySkew renews a token this long before the provider says it expires
+	expirySkew = time.Minute
+	// defaultLifetime is assumed when the token response has no expires_in
+	defaultLifetime = time.Hour
+	// defaultTimeout bounds a single token request
+	defaultTimeout = 20 * time.Second
+	// maxErrorBody limits how much of a failed token response ends up in the error
+	maxErrorBody = 512
+)
+
+// Config describes where and how an access token is obtained.
+// With a RefreshToken the refresh_token grant is used, otherwise client_credentials.
+type Config struct {
+	TokenURL     string
+	ClientID     string
+	ClientSecret string
+	RefreshToken string
+	Scopes       []string
+	Timeout      time.Duration
+}
+
+// TokenSource hands out a cached access token and fetches a new one shortly before it expires.
+// It is safe for concurrent use.
+type TokenSource struct {
+	cfg  Config
+	http *http.Client
+	now  func() time.Time
+
+	mu           sync.Mutex
+	token        string
+	expiry       time.Time
+	refreshToken string
+}
+
+// NewTokenSource creates a token source; no request is made until the first Token call.
+func NewTokenSource(cfg Config) *TokenSource {
+	timeout := cfg.Timeout
+	if timeout == 0 {
+		timeout = defaultTimeout
+	}
+	return &TokenSource{
+		cfg:          cfg,
+		http:         &http.Client{Timeout: timeout},
+		now:          time.Now,
+		refreshToken: cfg.RefreshToken,
+	}
+}
+
+// Token returns a valid access token, requesting a new one when the cached one is about to expire.
+func (ts *TokenSource) Token(ctx context.Context) (string, error) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	if ts.token != "" && ts.now().Before(ts.expiry) {
+		return ts.token, nil
+	}
+	if err := ts.fetch(ctx); err != nil {
+		return "", err
+	}
+	return ts.token, nil
+}
+
+// Invalidate drops the cached token, e.g. after the server rejected it.
+func (ts *TokenSource) Invalidate() {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	ts.token = ""
+}
+
+type tokenResponse struct {
+	AccessToken      string `json:"access_token"`
+	ExpiresIn        int64  `json:"expires_in"`
+	RefreshToken     string `json:"refresh_token"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// fetch requests a new token, the caller holds the lock
+func (ts *TokenSource) fetch(ctx context.Context) error {
+	form := url.Values{}
+	form.Set("client_id", ts.cfg.ClientID)
+	if ts.cfg.ClientSecret != "" {
+		form.Set("client_secret", ts.cfg.ClientSecret)
+	}
+	if ts.refreshToken != "" {
+		form.Set("grant_type", "refresh_token")
+		form.Set("refresh_token", ts.refreshToken)
+	} else {
+		form.Set("grant_type", "client_credentials")
+	}
+	if len(ts.cfg.Scopes) > 0 {
+		form.Set("scope", strings.Join(ts.cfg.Scopes, " "))
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, ts.cfg.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := ts.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("oauth token request: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("oauth token response: %w", err)
+	}
+	var tr tokenResponse
+	_ = json.Unmarshal(body, &tr)
+	if resp.StatusCode != http.StatusOK || tr.Error != "" {
+		if tr.Error != "" {
+			return fmt.Errorf("oauth token endpoint: %s: %s", tr.Error, tr.ErrorDescription)
+		}
+		if len(body) > maxErrorBody {
+			body = body[:maxErrorBody]
+		}
+		return fmt.Errorf("oauth token endpoint: status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	if tr.AccessToken == "" {
+		return errors.New("oauth token endpoint: response has no access_token")
+	}
+
+	lifetime := time.Duration(tr.ExpiresIn) * time.Second
+	if lifetime <= 0 {
+		lifetime = defaultLifetime
+	}
+	if lifetime > 2*expirySkew {
+		lifetime -= expirySkew
+	}
+	ts.token = tr.AccessToken
+	ts.expiry = ts.now().Add(lifetime)
+	// Providers that rotate refresh tokens return the next one with every response
+	if tr.RefreshToken != "" {
+		ts.refreshToken = tr.RefreshToken
+	}
+	log.Debug().Str("token_url", ts.cfg.TokenURL).Time("expiry", ts.expiry).Msg("oauth access token refreshed")
+	return nil
+}
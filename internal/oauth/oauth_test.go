@@ -0,0 +1,140 @@
+package oauth
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// tokenEndpoint is a stand-in for the provider's token URL that records every request
+type tokenEndpoint struct {
+	mu       sync.Mutex
+	requests []url.Values
+	respond  func(n int, form url.Values) (int, map[string]any)
+}
+
+func (e *tokenEndpoint) start(t *testing.T) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Errorf("parse form: %v", err)
+		}
+		e.mu.Lock()
+		e.requests = append(e.requests, r.PostForm)
+		n := len(e.requests)
+		e.mu.Unlock()
+
+		status, body := e.respond(n, r.PostForm)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(body)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func (e *tokenEndpoint) count() int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return len(e.requests)
+}
+
+func TestTokenSource_ClientCredentialsCached(t *testing.T) {
+	ep := &tokenEndpoint{respond: func(n int, _ url.Values) (int, map[string]any) {
+		return http.StatusOK, map[string]any{"access_token": "tok-" + string(rune('0'+n)), "expires_in": 3600}
+	}}
+	srv := ep.start(t)
+
+	ts := NewTokenSource(Config{TokenURL: srv.URL, ClientID: "id", ClientSecret: "secret", Scopes: []string{"a", "b"}})
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	ts.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		tok, err := ts.Token(context.Background())
+		if err != nil {
+			t.Fatalf("Token() error = %v", err)
+		}
+		if tok != "tok-1" {
+			t.Errorf("Token() = %q, want cached tok-1", tok)
+		}
+	}
+	if ep.count() != 1 {
+		t.Fatalf("expected one token request, got %d", ep.count())
+	}
+	form := ep.requests[0]
+	if form.Get("grant_type") != "client_credentials" || form.Get("client_id") != "id" || form.Get("client_secret") != "secret" {
+		t.Errorf("unexpected token request %v", form)
+	}
+	if form.Get("scope") != "a b" {
+		t.Errorf("scope = %q", form.Get("scope"))
+	}
+
+	// Shortly before expiry a new token is fetched
+	now = now.Add(time.Hour - 30*time.Second)
+	tok, err := ts.Token(context.Background())
+	if err != nil {
+		t.Fatalf("Token() error = %v", err)
+	}
+	if tok != "tok-2" || ep.count() != 2 {
+		t.Errorf("expected refreshed token tok-2 after expiry, got %q (%d requests)", tok, ep.count())
+	}
+}
+
+func TestTokenSource_RefreshTokenRotation(t *testing.T) {
+	ep := &tokenEndpoint{respond: func(n int, form url.Values) (int, map[string]any) {
+		return http.StatusOK, map[string]any{
+			"access_token":  "access-" + form.Get("refresh_token"),
+			"refresh_token": "rt-" + string(rune('1'+n)),
+			"expires_in":    3600,
+		}
+	}}
+	srv := ep.start(t)
+
+	ts := NewTokenSource(Config{TokenURL: srv.URL, ClientID: "id", RefreshToken: "rt-1"})
+	tok, err := ts.Token(context.Background())
+	if err != nil {
+		t.Fatalf("Token() error = %v", err)
+	}
+	if tok != "access-rt-1" {
+		t.Errorf("Token() = %q", tok)
+	}
+	if ep.requests[0].Get("grant_type") != "refresh_token" {
+		t.Errorf("expected refresh_token grant, got %v", ep.requests[0])
+	}
+
+	// The rotated refresh token is used for the next request
+	ts.Invalidate()
+	tok, err = ts.Token(context.Background())
+	if err != nil {
+		t.Fatalf("Token() error = %v", err)
+	}
+	if tok != "access-rt-2" {
+		t.Errorf("Token() after invalidate = %q, want access-rt-2", tok)
+	}
+}
+
+func TestTokenSource_Errors(t *testing.T) {
+	ep := &tokenEndpoint{respond: func(n int, _ url.Values) (int, map[string]any) {
+		if n == 1 {
+			return http.StatusBadRequest, map[string]any{"error": "invalid_grant", "error_description": "token revoked"}
+		}
+		return http.StatusOK, map[string]any{"token_type": "Bearer"}
+	}}
+	srv := ep.start(t)
+	ts := NewTokenSource(Config{TokenURL: srv.URL, ClientID: "id"})
+
+	_, err := ts.Token(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "invalid_grant: token revoked") {
+		t.Errorf("expected provider error, got %v", err)
+	}
+	_, err = ts.Token(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "no access_token") {
+		t.Errorf("expected missing token error, got %v", err)
+	}
+}
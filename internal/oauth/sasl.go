@@ -0,0 +1,95 @@
+package oauth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/smtp"
+	"strconv"
+	"strings"
+)
+
+// SASLClient performs the XOAUTH2 or OAUTHBEARER exchange with an access token.
+// It satisfies the sasl.Client interface expected by go-imap.
+type SASLClient struct {
+	mech     string
+	username string
+	host     string
+	port     int
+	token    string
+}
+
+// NewSASLClient creates a client for the given mechanism, MechXOAuth2 when empty.
+// Host and port are only sent with OAUTHBEARER.
+func NewSASLClient(mech, username, host string, port int, token string) *SASLClient {
+	return &SASLClient{mech: normalizeMech(mech), username: username, host: host, port: port, token: token}
+}
+
+// Start returns the mechanism and the initial response carrying the token.
+func (c *SASLClient) Start() (string, []byte, error) {
+	if c.mech == MechOAuthBearer {
+		s := "n,a=" + c.username + ","
+		if c.host != "" {
+			s += "\x01host=" + c.host
+		}
+		if c.port != 0 {
+			s += "\x01port=" + strconv.Itoa(c.port)
+		}
+		s += "\x01auth=Bearer " + c.token + "\x01\x01"
+		return c.mech, []byte(s), nil
+	}
+	return c.mech, []byte("user=" + c.username + "\x01auth=Bearer " + c.token + "\x01\x01"), nil
+}
+
+// Next answers a server challenge. A challenge after the initial response carries the
+// JSON error of a rejected token; the reply lets the server finish with a failure.
+func (c *SASLClient) Next(_ []byte) ([]byte, error) {
+	if c.mech == MechOAuthBearer {
+		return []byte("\x01"), nil
+	}
+	return []byte{}, nil
+}
+
+func normalizeMech(name string) string {
+	if strings.EqualFold(strings.TrimSpace(name), MechOAuthBearer) {
+		return MechOAuthBearer
+	}
+	return MechXOAuth2
+}
+
+// smtpAuth implements smtp.Auth on top of a token source
+type smtpAuth struct {
+	mech     string
+	username string
+	ts       *TokenSource
+}
+
+// SMTPAuth returns an smtp.Auth logging in as username with tokens from ts.
+func SMTPAuth(mech, username string, ts *TokenSource) smtp.Auth {
+	return &smtpAuth{mech: normalizeMech(mech), username: username, ts: ts}
+}
+
+func (a *smtpAuth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	// Same rule as smtp.PlainAuth: never send a bearer token over plain text, except to localhost
+	if !server.TLS && !isLocalhost(server.Name) {
+		return "", nil, errors.New("unencrypted connection")
+	}
+	token, err := a.ts.Token(context.Background())
+	if err != nil {
+		return "", nil, err
+	}
+	return NewSASLClient(a.mech, a.username, server.Name, 0, token).Start()
+}
+
+func (a *smtpAuth) Next(fromServer []byte, more bool) ([]byte, error) {
+	if !more {
+		return nil, nil
+	}
+	// A challenge means the token was rejected, the next attempt fetches a new one
+	a.ts.Invalidate()
+	return nil, fmt.Errorf("%s rejected: %s", a.mech, fromServer)
+}
+
+func isLocalhost(name string) bool {
+	return name == "localhost" || name == "127.0.0.1" || name == "::1"
+}
@@ -0,0 +1,70 @@
+package oauth
+
+import (
+	"context"
+	"net/http"
+	"net/smtp"
+	"net/url"
+	"testing"
+)
+
+func TestSASLClient_Start(t *testing.T) {
+	mech, ir, err := NewSASLClient("", "user@example.com", "imap.example.com", 993, "tok").Start()
+	if err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	if mech != MechXOAuth2 {
+		t.Errorf("default mechanism = %q", mech)
+	}
+	if string(ir) != "user=user@example.com\x01auth=Bearer tok\x01\x01" {
+		t.Errorf("XOAUTH2 response = %q", ir)
+	}
+
+	mech, ir, err = NewSASLClient("oauthbearer", "user@example.com", "imap.example.com", 993, "tok").Start()
+	if err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	if mech != MechOAuthBearer {
+		t.Errorf("mechanism = %q", mech)
+	}
+	if string(ir) != "n,a=user@example.com,\x01host=imap.example.com\x01port=993\x01auth=Bearer tok\x01\x01" {
+		t.Errorf("OAUTHBEARER response = %q", ir)
+	}
+
+	// Error challenges are answered so the server can finish the exchange
+	if resp, err := NewSASLClient(MechOAuthBearer, "u", "", 0, "t").Next([]byte(`{"status":"401"}`)); err != nil || string(resp) != "\x01" {
+		t.Errorf("OAUTHBEARER Next() = %q, %v", resp, err)
+	}
+}
+
+func TestSMTPAuth(t *testing.T) {
+	ep := &tokenEndpoint{respond: func(int, url.Values) (int, map[string]any) {
+		return http.StatusOK, map[string]any{"access_token": "tok", "expires_in": 3600}
+	}}
+	srv := ep.start(t)
+	ts := NewTokenSource(Config{TokenURL: srv.URL, ClientID: "id"})
+	auth := SMTPAuth("", "user@example.com", ts)
+
+	if _, _, err := auth.Start(&smtp.ServerInfo{Name: "smtp.example.com", TLS: false}); err == nil {
+		t.Error("token must not be sent over an unencrypted connection")
+	}
+	if ep.count() != 0 {
+		t.Error("no token should be requested for a refused connection")
+	}
+
+	mech, ir, err := auth.Start(&smtp.ServerInfo{Name: "smtp.example.com", TLS: true})
+	if err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	if mech != MechXOAuth2 || string(ir) != "user=user@example.com\x01auth=Bearer tok\x01\x01" {
+		t.Errorf("Start() = %q, %q", mech, ir)
+	}
+
+	// A challenge means the server rejected the token
+	if _, err := auth.Next([]byte(`{"status":"400"}`), true); err == nil {
+		t.Error("expected error for rejected token")
+	}
+	if _, err := ts.Token(context.Background()); err != nil || ep.count() != 2 {
+		t.Errorf("rejected token should be fetched again, requests = %d", ep.count())
+	}
+}
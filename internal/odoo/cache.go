@@ -0,0 +1,88 @@
+package odoo
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Lookups of partners and users are kept for a short while; every poll asks about the
+// same customers and operators again
+var (
+	lookupTTL  = 5 * time.Minute
+	lookupSize = 5000 // entries kept per kind before expired ones are dropped
+)
+
+// lookupCache maps record IDs to a looked up value; the zero value is ready to use
+type lookupCache[V any] struct {
+	mu      sync.Mutex
+	entries map[int64]lookupEntry[V]
+}
+
+type lookupEntry[V any] struct {
+	value   V
+	expires time.Time
+}
+
+func (lc *lookupCache[V]) get(id int64) (V, bool) {
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+	e, ok := lc.entries[id]
+	if !ok || time.Now().After(e.expires) {
+		var zero V
+		return zero, false
+	}
+	return e.value, true
+}
+
+func (lc *lookupCache[V]) put(id int64, v V) {
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+	now := time.Now()
+	if lc.entries == nil {
+		lc.entries = make(map[int64]lookupEntry[V])
+	}
+	if len(lc.entries) >= lookupSize {
+		for k, e := range lc.entries {
+			if now.After(e.expires) {
+				delete(lc.entries, k)
+			}
+		}
+		if len(lc.entries) >= lookupSize {
+			clear(lc.entries)
+		}
+	}
+	lc.entries[id] = lookupEntry[V]{value: v, expires: now.Add(lookupTTL)}
+}
+
+// lookup returns the values of the IDs, reading those not cached with one call of
+// read. IDs read gets no value for are cached as the zero value, so they are not
+// asked about again either. When the read fails, the cached values come with the error.
+func lookup[V any](ctx context.Context, lc *lookupCache[V], ids []int64, read func(ctx context.Context, ids []int64) (map[int64]V, error)) (map[int64]V, error) {
+	out := make(map[int64]V, len(ids))
+	var missing []int64
+	for _, id := range ids {
+		if _, done := out[id]; done || id <= 0 {
+			continue
+		}
+		if v, ok := lc.get(id); ok {
+			out[id] = v
+			continue
+		}
+		var zero V
+		out[id] = zero
+		missing = append(missing, id)
+	}
+	if len(missing) == 0 {
+		return out, nil
+	}
+	found, err := read(ctx, missing)
+	if err != nil {
+		return out, err
+	}
+	for _, id := range missing {
+		out[id] = found[id]
+		lc.put(id, found[id])
+	}
+	return out, nil
+}
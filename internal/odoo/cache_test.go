@@ -0,0 +1,193 @@
+package odoo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// busyProject is a fake Odoo project with many changed tasks and messages, counting
+// the object calls it answers by model and method
+type busyProject struct {
+	tasks, partners, users int
+	calls                  map[string]int
+}
+
+func (p *busyProject) handler() odooHandler {
+	p.calls = make(map[string]int)
+	return authenticated(func(model, method string, args, kwargs any) (any, error) {
+		p.calls[model+"."+method]++
+		switch model + "." + method {
+		case "project.task.search":
+			ids := make([]any, p.tasks)
+			for i := range ids {
+				ids[i] = 1000 + i
+			}
+			return ids, nil
+		case "project.task.read":
+			var rows []any
+			for _, id := range args.([]any)[0].([]any) {
+				n := int(id.(float64)) - 1000
+				rows = append(rows, map[string]any{
+					"id": id, "name": fmt.Sprintf("Task %d", n), "stage_id": []any{1, "New"},
+					"partner_id": []any{100 + n%p.partners, "Customer"}, "user_ids": []any{500 + n%p.users},
+				})
+			}
+			return rows, nil
+		case "res.partner.read", "res.users.read":
+			var rows []any
+			for _, id := range args.([]any)[0].([]any) {
+				rows = append(rows, map[string]any{"id": id, "email": fmt.Sprintf("c%v@example.com", id), "name": fmt.Sprintf("User %v", id)})
+			}
+			return rows, nil
+		case "mail.message.search":
+			ids := make([]any, p.tasks)
+			for i := range ids {
+				ids[i] = 5000 + i
+			}
+			return ids, nil
+		case "mail.message.read":
+			var rows []any
+			for _, id := range args.([]any)[0].([]any) {
+				n := int(id.(float64)) - 5000
+				rows = append(rows, map[string]any{
+					"id": id, "res_id": 1000 + n, "body": "<p>Hi</p>", "date": "2025-03-01 12:00:00",
+					"message_type": "comment", "author_id": []any{100 + n%p.partners, "Author"},
+				})
+			}
+			return rows, nil
+		case "res.users.search_read":
+			// Every third partner is an operator
+			var rows []any
+			for _, id := range args.([]any)[0].([]any)[0].([]any)[2].([]any) {
+				if int(id.(float64))%3 == 0 {
+					rows = append(rows, map[string]any{"id": 500, "partner_id": []any{id, "Operator"}})
+				}
+			}
+			return rows, nil
+		}
+		return nil, errors.New("unexpected " + model + "." + method)
+	})
+}
+
+func (p *busyProject) total() int {
+	n := 0
+	for _, c := range p.calls {
+		n += c
+	}
+	return n
+}
+
+func TestListRecentlyChangedTasks_Batched(t *testing.T) {
+	p := &busyProject{tasks: 200, partners: 40, users: 5}
+	forEachProtocol(t, p.handler(), func(t *testing.T, c *Client) {
+		clear(p.calls)
+		tasks, err := c.ListRecentlyChangedTasks(context.Background(), 1, time.Now())
+		if err != nil || len(tasks) != 200 {
+			t.Fatalf("ListRecentlyChangedTasks() = %d tasks, %v", len(tasks), err)
+		}
+		if task := tasks[41]; task.CustomerEmail != "c101@example.com" || task.AssignedUserID != 501 || task.AssignedUserName != "User 501" {
+			t.Errorf("task 41 = %+v", task)
+		}
+		if p.total() != 4 || p.calls["res.partner.read"] != 1 || p.calls["res.users.read"] != 1 {
+			t.Errorf("calls = %v, want one search, task read, partner read and user read", p.calls)
+		}
+
+		// The next poll finds the partners and users in the cache
+		clear(p.calls)
+		if _, err := c.ListRecentlyChangedTasks(context.Background(), 1, time.Now()); err != nil || p.total() != 2 {
+			t.Errorf("second poll calls = %v, %v", p.calls, err)
+		}
+	})
+}
+
+func TestListTaskMessagesSince_Batched(t *testing.T) {
+	p := &busyProject{tasks: 200, partners: 40, users: 5}
+	forEachProtocol(t, p.handler(), func(t *testing.T, c *Client) {
+		clear(p.calls)
+		msgs, err := c.ListTaskMessagesSince(context.Background(), 1, time.Time{})
+		if err != nil || len(msgs) != 200 {
+			t.Fatalf("ListTaskMessagesSince() = %d messages, %v", len(msgs), err)
+		}
+		if !msgs[2].ByOperator || msgs[3].ByOperator {
+			t.Errorf("authors 102 and 103: operator = %v, %v", msgs[2].ByOperator, msgs[3].ByOperator)
+		}
+		if p.calls["res.users.search_read"] != 1 || p.total() != 4 {
+			t.Errorf("calls = %v, want a single operator check", p.calls)
+		}
+	})
+}
+
+func TestLookupCache(t *testing.T) {
+	var lc lookupCache[string]
+	var asked [][]int64
+	read := func(_ context.Context, ids []int64) (map[int64]string, error) {
+		asked = append(asked, ids)
+		return map[int64]string{1: "one", 2: "two"}, nil
+	}
+	ctx := context.Background()
+
+	got, _ := lookup(ctx, &lc, []int64{1, 2, 1, 3, 0}, read)
+	if len(asked) != 1 || fmt.Sprint(asked[0]) != "[1 2 3]" || got[1] != "one" || got[3] != "" {
+		t.Fatalf("first lookup = %v after reading %v", got, asked)
+	}
+	// Known and unknown IDs alike come from the cache now
+	if got, _ = lookup(ctx, &lc, []int64{3, 2}, read); len(asked) != 1 || got[2] != "two" {
+		t.Errorf("cached lookup = %v after reading %v", got, asked)
+	}
+
+	failing := func(context.Context, []int64) (map[int64]string, error) { return nil, errors.New("down") }
+	if got, err := lookup(ctx, &lc, []int64{1, 4}, failing); err == nil || got[1] != "one" {
+		t.Errorf("failed lookup = %v, %v", got, err)
+	}
+
+	defer func(ttl time.Duration) { lookupTTL = ttl }(lookupTTL)
+	lookupTTL = -time.Second
+	lc.put(1, "stale")
+	if _, ok := lc.get(1); ok {
+		t.Error("expired entry returned")
+	}
+}
+
+// The benchmarks report the Odoo calls a poll of a busy project costs, cold and with
+// the partner and user lookups cached from the previous poll. Read one by one, the
+// 200 tasks took 402 calls and the 200 messages 203.
+
+func BenchmarkListRecentlyChangedTasks(b *testing.B) {
+	benchmarkPoll(b, func(c *Client) error {
+		_, err := c.ListRecentlyChangedTasks(context.Background(), 1, time.Now())
+		return err
+	})
+}
+
+func BenchmarkListTaskMessagesSince(b *testing.B) {
+	benchmarkPoll(b, func(c *Client) error {
+		_, err := c.ListTaskMessagesSince(context.Background(), 1, time.Time{})
+		return err
+	})
+}
+
+func benchmarkPoll(b *testing.B, poll func(c *Client) error) {
+	p := &busyProject{tasks: 200, partners: 40, users: 5}
+	srv := fakeOdoo(b, p.handler())
+	c, err := NewClient(context.Background(), Config{URL: srv.URL, DB: "db", User: "admin", Pass: "pw", Timeout: 5 * time.Second})
+	if err != nil {
+		b.Fatal(err)
+	}
+	for _, cached := range []bool{false, true} {
+		b.Run(map[bool]string{false: "cold", true: "cached"}[cached], func(b *testing.B) {
+			clear(p.calls)
+			for b.Loop() {
+				if !cached {
+					c.partnerEmails, c.userNames, c.operators = lookupCache[string]{}, lookupCache[string]{}, lookupCache[bool]{}
+				}
+				if err := poll(c); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ReportMetric(float64(p.total())/float64(b.N), "calls/op")
+		})
+	}
+}
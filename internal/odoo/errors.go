@@ -0,0 +1,99 @@
+package odoo
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Kinds of failure, test for them with errors.Is
+var (
+	ErrAuth       = errors.New("odoo: login refused")                  // wrong database, user or password
+	ErrSession    = errors.New("odoo: session no longer valid")        // uid or password rejected on a call
+	ErrAccess     = errors.New("odoo: access denied")                  // the user may not touch the records
+	ErrMissing    = errors.New("odoo: record does not exist")          // deleted or never existed
+	ErrValidation = errors.New("odoo: rejected by validation")         // UserError and ValidationError
+	ErrConflict   = errors.New("odoo: concurrent update")              // transaction rolled back, safe to repeat
+	ErrTransient  = errors.New("odoo: server temporarily unavailable") // network failures and 429/502/503/504
+)
+
+// Exception names as Odoo reports them
+const (
+	accessDenied = "odoo.exceptions.AccessDenied"
+	accessError  = "odoo.exceptions.AccessError"
+	missingError = "odoo.exceptions.MissingError"
+	userError    = "odoo.exceptions.UserError"
+)
+
+// Error is a failed call: a fault raised by Odoo, an HTTP error status or a network
+// failure. Its kind is matched by errors.Is against the Err* values.
+type Error struct {
+	Code       int    // JSON-RPC error code or XML-RPC faultCode
+	Name       string // exception class, e.g. odoo.exceptions.AccessError
+	Message    string // exception message
+	Debug      string // server traceback, when Odoo sent one
+	HTTPStatus int    // status of a response that carried no RPC result
+	Err        error  // network error, the request may not have reached Odoo
+}
+
+func (e *Error) Error() string {
+	switch {
+	case e.Err != nil:
+		return "odoo: " + e.Err.Error()
+	case e.HTTPStatus != 0:
+		return fmt.Sprintf("odoo: HTTP %d %s", e.HTTPStatus, http.StatusText(e.HTTPStatus))
+	case e.Message != "":
+		return e.Message
+	case e.Name != "":
+		return e.Name
+	}
+	return fmt.Sprintf("odoo: error %d", e.Code)
+}
+
+func (e *Error) Unwrap() error { return e.Err }
+
+// Is reports whether the error is of the target kind
+func (e *Error) Is(target error) bool {
+	return target != nil && target == e.kind()
+}
+
+func (e *Error) kind() error {
+	if e.Err != nil {
+		return ErrTransient
+	}
+	switch e.HTTPStatus {
+	case 0:
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return ErrTransient
+	default:
+		return nil
+	}
+
+	// Odoo names its own exceptions in full, database errors come as psycopg2.errors.*
+	switch e.Name[strings.LastIndex(e.Name, ".")+1:] {
+	case "AccessDenied", "SessionExpiredException":
+		return ErrSession
+	case "AccessError":
+		return ErrAccess
+	case "MissingError":
+		return ErrMissing
+	case "UserError", "ValidationError", "RedirectWarning":
+		return ErrValidation
+	case "SerializationFailure", "TransactionRollbackError", "LockNotAvailable", "DeadlockDetected":
+		return ErrConflict
+	}
+	if e.Code == 100 { // the JSON-RPC code of an expired session
+		return ErrSession
+	}
+	if strings.Contains(e.Message, "could not serialize access") {
+		return ErrConflict
+	}
+	return nil
+}
+
+// lastLine is the exception line of a Python traceback
+func lastLine(s string) string {
+	s = strings.TrimSpace(s)
+	return strings.TrimSpace(s[strings.LastIndex(s, "\n")+1:])
+}
@@ -0,0 +1,150 @@
+package odoo
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestMain(m *testing.M) {
+	retryBase = time.Millisecond
+	os.Exit(m.Run())
+}
+
+func TestClient_Retry(t *testing.T) {
+	var calls int
+	var failures []error
+	h := authenticated(func(_, method string, _, _ any) (any, error) {
+		calls++
+		if calls <= len(failures) {
+			return nil, failures[calls-1]
+		}
+		if method == "create" {
+			return 7, nil
+		}
+		return []any{5}, nil
+	})
+	fail := func(errs ...error) {
+		calls, failures = 0, errs
+	}
+	badGateway := &Error{HTTPStatus: 502}
+	unavailable := &Error{HTTPStatus: 503}
+	conflict := &Error{Name: "psycopg2.errors.SerializationFailure", Message: "could not serialize access due to concurrent update"}
+
+	forEachProtocol(t, h, func(t *testing.T, c *Client) {
+		ctx := context.Background()
+
+		// A read is repeated through both failures
+		fail(badGateway, conflict)
+		var ids []int64
+		if err := c.execKW(ctx, projectTaskModel, "search", []any{[]any{}}, nil, &ids); err != nil || len(ids) != 1 || calls != 3 {
+			t.Errorf("search = %v, %v after %d calls, want [5] after 3", ids, err, calls)
+		}
+
+		// A write may have been committed behind a bad gateway, it is not sent again
+		fail(badGateway)
+		var id int64
+		err := c.execKW(ctx, projectTaskModel, "create", []any{map[string]any{}}, nil, &id)
+		var e *Error
+		if !errors.As(err, &e) || e.HTTPStatus != 502 || !errors.Is(err, ErrTransient) || calls != 1 {
+			t.Errorf("create error = %v after %d calls, want 502 after 1", err, calls)
+		}
+
+		// A rolled back conflict is repeated
+		fail(conflict)
+		if err := c.execKW(ctx, projectTaskModel, "create", []any{map[string]any{}}, nil, &id); err != nil || id != 7 || calls != 2 {
+			t.Errorf("create = %d, %v after %d calls, want 7 after 2", id, err, calls)
+		}
+
+		// Failures that keep coming are returned after the last retry
+		fail(unavailable, unavailable, unavailable, unavailable, unavailable)
+		if err := c.execKW(ctx, projectTaskModel, "write", []any{[]int64{1}, map[string]any{}}, nil, nil); !errors.Is(err, ErrTransient) || calls != maxRetries+1 {
+			t.Errorf("write error = %v after %d calls, want %d", err, calls, maxRetries+1)
+		}
+		fail()
+	})
+}
+
+func TestClient_Reauthenticate(t *testing.T) {
+	// The user was recreated under a new id, the old uid is refused
+	uid, logins := 2, 0
+	h := func(service, method string, args []any) (any, error) {
+		if service == "common" {
+			logins++
+			return uid, nil
+		}
+		if args[1] != float64(uid) {
+			return nil, &Error{Name: accessDenied, Message: "Access Denied"}
+		}
+		return []any{map[string]any{"id": 1, "name": "Task"}}, nil
+	}
+	forEachProtocol(t, h, func(t *testing.T, c *Client) {
+		uid, logins = 3, 0
+		task, err := c.GetTask(context.Background(), 1)
+		if err != nil || task.Name != "Task" {
+			t.Fatalf("GetTask() = %+v, %v", task, err)
+		}
+		if c.uid != 3 || logins != 1 {
+			t.Errorf("uid = %d after %d logins, want 3 after 1", c.uid, logins)
+		}
+		uid = 2
+	})
+
+	// A login that fails again ends the call
+	srv := fakeOdoo(t, func(service, _ string, _ []any) (any, error) {
+		if service == "common" {
+			return false, nil
+		}
+		return nil, &Error{Name: accessDenied, Message: "Access Denied"}
+	})
+	c := &Client{cfg: Config{URL: srv.URL, DB: "db", User: "admin"}, uid: 2, http: srv.Client()}
+	if _, err := c.GetTask(context.Background(), 1); !errors.Is(err, ErrAuth) {
+		t.Errorf("GetTask() error = %v, want login refused", err)
+	}
+}
+
+func TestRetryable(t *testing.T) {
+	dial := &Error{Err: &net.OpError{Op: "dial", Err: errors.New("connection refused")}}
+	reset := &Error{Err: &net.OpError{Op: "read", Err: errors.New("connection reset by peer")}}
+	tests := []struct {
+		name        string
+		err         error
+		read, write bool
+	}{
+		{"connection refused", dial, true, true},
+		{"connection reset", reset, true, false},
+		{"too many requests", &Error{HTTPStatus: 429}, true, true},
+		{"service unavailable", &Error{HTTPStatus: 503}, true, true},
+		{"bad gateway", &Error{HTTPStatus: 502}, true, false},
+		{"gateway timeout", &Error{HTTPStatus: 504}, true, false},
+		{"serialization failure", &Error{Code: 1, Message: "could not serialize access due to concurrent update"}, true, true},
+		{"not found", &Error{HTTPStatus: 404}, false, false},
+		{"access error", &Error{Name: accessError}, false, false},
+		{"validation", &Error{Name: userError}, false, false},
+		{"canceled", context.Canceled, false, false},
+	}
+	for _, tt := range tests {
+		if got := retryable(tt.err, true); got != tt.read {
+			t.Errorf("%s: retryable read = %v", tt.name, got)
+		}
+		if got := retryable(tt.err, false); got != tt.write {
+			t.Errorf("%s: retryable write = %v", tt.name, got)
+		}
+	}
+	if !errors.Is(reset, ErrTransient) || errors.Unwrap(reset) == nil {
+		t.Errorf("network error %v should be transient and wrap its cause", reset)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	defer func(base time.Duration) { retryBase = base }(retryBase)
+	retryBase = 500 * time.Millisecond
+	for attempt, want := range []time.Duration{500 * time.Millisecond, time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 8 * time.Second} {
+		if d := backoff(attempt); d < want/2 || d > want {
+			t.Errorf("backoff(%d) = %v, want between %v and %v", attempt, d, want/2, want)
+		}
+	}
+}
@@ -2,14 +2,16 @@
 package odoo
 
 import (
-	"bytes"
 	"context"
 	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"math/rand/v2"
+	"net"
 	"net/http"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/rs/zerolog/log"
@@ -34,18 +36,25 @@ const (
 
 // Config holds Odoo server connection configuration.
 type Config struct {
-	URL     string
-	DB      string
-	User    string
-	Pass    string
-	Timeout time.Duration
+	URL      string
+	DB       string
+	User     string
+	Pass     string
+	Timeout  time.Duration
+	Protocol string // ProtocolJSONRPC (default) or ProtocolXMLRPC
 }
 
 // Client represents an authenticated Odoo API client.
 type Client struct {
 	cfg  Config
+	mu   sync.Mutex // guards uid, renewed when Odoo rejects it
 	uid  int64
 	http *http.Client
+
+	// short-lived lookups by record ID
+	partnerEmails lookupCache[string]
+	userNames     lookupCache[string]
+	operators     lookupCache[bool] // partner ID -> has an active user
 }
 
 // NewClient creates a new authenticated Odoo client with the provided configuration.
@@ -66,62 +75,113 @@ func NewClient(ctx context.Context, cfg Config) (*Client, error) {
 
 func (c *Client) authenticate(ctx context.Context) (int64, error) {
 	var uid int64
-	err := c.rpc(ctx, "/jsonrpc", map[string]any{
-		"service": "common",
-		"method":  "authenticate",
-		"args":    []any{c.cfg.DB, c.cfg.User, c.cfg.Pass, map[string]any{}},
-	}, &uid)
-	return uid, err
+	err := c.call(ctx, "common", "authenticate", []any{c.cfg.DB, c.cfg.User, c.cfg.Pass, map[string]any{}}, &uid, true)
+	if err != nil {
+		return 0, err
+	}
+	// Odoo answers a wrong login with false, not a fault
+	if uid == 0 {
+		return 0, fmt.Errorf("%w: user %s on database %s", ErrAuth, c.cfg.User, c.cfg.DB)
+	}
+	return uid, nil
 }
 
+// execKW calls a model method. A rejected uid or password is answered by logging in
+// again once, in case the user was recreated or the database restored.
 func (c *Client) execKW(ctx context.Context, model, method string, args []any, kwargs map[string]any, result any) error {
-	payload := map[string]any{
-		"service": "object",
-		"method":  "execute_kw",
-		"args":    []any{c.cfg.DB, c.uid, c.cfg.Pass, model, method, args, kwargs},
+	send := func(uid int64) error {
+		return c.call(ctx, "object", "execute_kw", []any{c.cfg.DB, uid, c.cfg.Pass, model, method, args, kwargs}, result, readMethods[method])
+	}
+	uid := c.currentUID()
+	err := send(uid)
+	if !errors.Is(err, ErrSession) {
+		return err
+	}
+	log.Warn().Err(err).Str("model", model).Str("method", method).Msg("odoo rejected the session, logging in again")
+	if uid, err = c.reauthenticate(ctx, uid); err != nil {
+		return err
 	}
-	return c.rpc(ctx, "/jsonrpc", payload, result)
+	return send(uid)
 }
 
-func (c *Client) rpc(ctx context.Context, path string, call map[string]any, result any) error {
-	reqBody := map[string]any{
-		"jsonrpc": "2.0",
-		"method":  "call",
-		"params":  call,
-		"id":      time.Now().UnixNano(),
+func (c *Client) currentUID() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.uid
+}
+
+// reauthenticate logs in again unless another call already replaced the stale uid
+func (c *Client) reauthenticate(ctx context.Context, stale int64) (int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.uid != stale {
+		return c.uid, nil
 	}
-	b, _ := json.Marshal(reqBody)
-	req, _ := http.NewRequestWithContext(ctx, "POST", strings.TrimRight(c.cfg.URL, "/")+path, bytes.NewReader(b))
-	req.Header.Set("Content-Type", "application/json")
-	resp, err := c.http.Do(req)
+	uid, err := c.authenticate(ctx)
 	if err != nil {
-		return err
+		return 0, err
 	}
-	defer func() {
-		if err := resp.Body.Close(); err != nil {
-			log.Error().Err(err).Msg("failed to close response body")
+	c.uid = uid
+	return uid, nil
+}
+
+// Retries of a failed call; tests shorten the delays
+var (
+	maxRetries = 3
+	retryBase  = 500 * time.Millisecond
+	retryMax   = 8 * time.Second
+)
+
+// readMethods only read, repeating them cannot change anything
+var readMethods = map[string]bool{
+	"read": true, "search": true, "search_read": true, "search_count": true,
+	"fields_get": true, "name_search": true, "read_group": true,
+}
+
+// call sends the call and repeats it after a backoff while it fails in a way that may
+// pass. Calls that write are only repeated when they certainly changed nothing.
+func (c *Client) call(ctx context.Context, service, method string, args []any, result any, readOnly bool) error {
+	for attempt := 0; ; attempt++ {
+		err := c.transport().call(ctx, c.http, c.cfg.URL, service, method, args, result)
+		if err == nil || attempt == maxRetries || !retryable(err, readOnly) {
+			return err
+		}
+		wait := backoff(attempt)
+		log.Warn().Err(err).Str("method", method).Int("attempt", attempt+1).Dur("wait", wait).Msg("odoo call failed, retrying")
+		t := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		case <-t.C:
 		}
-	}()
-	var r struct {
-		Result any `json:"result"`
-		Error  *struct {
-			Code    int    `json:"code"`
-			Data    any    `json:"data"`
-			Message string `json:"message"`
-		} `json:"error"`
-	}
-	dec := json.NewDecoder(resp.Body)
-	if err := dec.Decode(&r); err != nil {
-		return err
 	}
-	if r.Error != nil {
-		return errors.New(r.Error.Message)
+}
+
+// retryable tells whether a failed call may be sent again. A write that timed out or
+// lost its connection may have been committed, so only reads are repeated then.
+func retryable(err error, readOnly bool) bool {
+	var e *Error
+	if !errors.As(err, &e) {
+		return false
 	}
-	if result != nil {
-		j, _ := json.Marshal(r.Result)
-		_ = json.Unmarshal(j, result)
+	switch {
+	case errors.Is(e, ErrConflict):
+		return true // Odoo rolled the transaction back
+	case e.HTTPStatus == http.StatusTooManyRequests, e.HTTPStatus == http.StatusServiceUnavailable:
+		return true // refused before it ran
+	case errors.Is(e, ErrTransient):
+		var op *net.OpError
+		return readOnly || (errors.As(e.Err, &op) && op.Op == "dial")
 	}
-	return nil
+	return false
+}
+
+// backoff doubles the delay with every attempt, with jitter so that routes failing
+// together do not retry in step
+func backoff(attempt int) time.Duration {
+	d := min(retryBase<<attempt, retryMax)
+	return d/2 + rand.N(d/2+1)
 }
 
 // --- domain types ---
@@ -133,6 +193,8 @@ type CreateTaskInput struct {
 	Description       string
 	CustomerPartnerID int64
 	StageID           int64
+	TagIDs            []int64
+	Priority          string // "0" normal, "1" high; Odoo's default when empty
 }
 
 // CreateTask creates a new task in Odoo with the provided input parameters.
@@ -160,6 +222,12 @@ func (c *Client) CreateTask(ctx context.Context, in CreateTaskInput) (int64, err
 	if in.StageID > 0 {
 		fields["stage_id"] = in.StageID
 	}
+	if len(in.TagIDs) > 0 {
+		fields["tag_ids"] = [][]any{{6, 0, in.TagIDs}}
+	}
+	if in.Priority != "" {
+		fields["priority"] = in.Priority
+	}
 	var id int64
 	err := c.execKW(ctx, projectTaskModel, "create", []any{fields}, nil, &id)
 	if err != nil {
@@ -186,6 +254,35 @@ func (c *Client) AddFollower(ctx context.Context, taskID, partnerID int64) error
 	return c.execKW(ctx, projectTaskModel, "message_subscribe", []any{taskID, []int64{partnerID}}, nil, &ok)
 }
 
+// TaskFollowerEmails returns the email addresses of the task's followers
+func (c *Client) TaskFollowerEmails(ctx context.Context, taskID int64) ([]string, error) {
+	var rows []map[string]any
+	domain := [][]any{{"res_model", "=", projectTaskModel}, {"res_id", "=", taskID}}
+	if err := c.execKW(ctx, "mail.followers", "search_read", []any{domain}, map[string]any{"fields": []string{"partner_id"}}, &rows); err != nil {
+		return nil, err
+	}
+	var partnerIDs []int64
+	for _, r := range rows {
+		if pair := anySlice(r["partner_id"]); len(pair) >= minFieldLength {
+			partnerIDs = append(partnerIDs, toInt64(pair[0]))
+		}
+	}
+	if len(partnerIDs) == 0 {
+		return nil, nil
+	}
+	found, err := c.readField(ctx, &c.partnerEmails, "res.partner", "email", partnerIDs)
+	if err != nil {
+		return nil, err
+	}
+	var emails []string
+	for _, id := range partnerIDs {
+		if email := strings.ToLower(strings.TrimSpace(found[id])); email != "" {
+			emails = append(emails, email)
+		}
+	}
+	return emails, nil
+}
+
 // FindOrCreatePartnerByEmail finds an existing partner by email or creates a new one.
 func (c *Client) FindOrCreatePartnerByEmail(ctx context.Context, email, name string) (int64, error) {
 	var ids []int64
@@ -205,6 +302,28 @@ func (c *Client) FindOrCreatePartnerByEmail(ctx context.Context, email, name str
 	return id, err
 }
 
+// FindOrCreateTags returns the IDs of the project tags with the given names, creating missing ones.
+func (c *Client) FindOrCreateTags(ctx context.Context, names []string) ([]int64, error) {
+	ids := make([]int64, 0, len(names))
+	for _, name := range names {
+		var found []int64
+		if err := c.execKW(ctx, "project.tags", "search", []any{[][]any{{"name", "=", name}}}, map[string]any{"limit": 1}, &found); err != nil {
+			return ids, err
+		}
+		if len(found) > 0 {
+			ids = append(ids, found[0])
+			continue
+		}
+		var id int64
+		if err := c.execKW(ctx, "project.tags", "create", []any{map[string]any{"name": name}}, nil, &id); err != nil {
+			return ids, err
+		}
+		log.Debug().Str("tag", name).Int64("tag_id", id).Msg("created project tag")
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
 func ifEmpty(v, fallback string) string {
 	if strings.TrimSpace(v) == "" {
 		return fallback
@@ -243,15 +362,47 @@ func itoa(v int) string {
 // --- Messages (chatter) ---
 
 // MessagePostCustomer posts a message to a task as a customer communication.
-func (c *Client) MessagePostCustomer(ctx context.Context, taskID, customerPartnerID int64, body string) error {
+// Attachments already uploaded to the task are linked to the message.
+func (c *Client) MessagePostCustomer(ctx context.Context, taskID, customerPartnerID int64, body string, attachmentIDs ...int64) error {
 	// public comment -> goes to followers
 	var ok any
-	return c.execKW(ctx, projectTaskModel, "message_post", []any{taskID}, map[string]any{
+	return c.execKW(ctx, projectTaskModel, "message_post", []any{taskID}, withAttachments(map[string]any{
 		"body":          body,
 		"message_type":  "comment",
 		"subtype_xmlid": "mail.mt_comment",
 		"author_id":     customerPartnerID, // partner
-	}, &ok)
+	}, attachmentIDs), &ok)
+}
+
+// MessagePostCustomerHTML posts an HTML formatted customer message. Without body_is_html
+// Odoo escapes string bodies coming over RPC.
+func (c *Client) MessagePostCustomerHTML(ctx context.Context, taskID, customerPartnerID int64, body string, attachmentIDs ...int64) error {
+	var ok any
+	return c.execKW(ctx, projectTaskModel, "message_post", []any{taskID}, withAttachments(map[string]any{
+		"body":          body,
+		"body_is_html":  true,
+		"message_type":  "comment",
+		"subtype_xmlid": "mail.mt_comment",
+		"author_id":     customerPartnerID,
+	}, attachmentIDs), &ok)
+}
+
+// MessagePostNote adds an internal note to a task, visible to employees only.
+func (c *Client) MessagePostNote(ctx context.Context, taskID int64, body string, attachmentIDs ...int64) error {
+	var ok any
+	return c.execKW(ctx, projectTaskModel, "message_post", []any{taskID}, withAttachments(map[string]any{
+		"body":          body,
+		"message_type":  "comment",
+		"subtype_xmlid": "mail.mt_note",
+	}, attachmentIDs), &ok)
+}
+
+// withAttachments adds attachment_ids to message_post arguments when there are any
+func withAttachments(kwargs map[string]any, ids []int64) map[string]any {
+	if len(ids) > 0 {
+		kwargs["attachment_ids"] = ids
+	}
+	return kwargs
 }
 
 // TaskMessage represents a message associated with a project task for operator message polling.
@@ -300,6 +451,18 @@ func (c *Client) ListTaskMessagesSince(ctx context.Context, projectID int64, sin
 	if err := c.execKW(ctx, "mail.message", "read", []any{ids, []string{"id", "res_id", "body", "date", "message_type", "subtype_id", "author_id"}}, nil, &rows); err != nil {
 		return nil, err
 	}
+	authorID := func(r map[string]any) int64 {
+		if authorPair := anySlice(r["author_id"]); len(authorPair) >= 1 {
+			return toInt64(authorPair[0])
+		}
+		return 0
+	}
+	authors := make([]int64, 0, len(rows))
+	for _, r := range rows {
+		authors = append(authors, authorID(r))
+	}
+	operators := c.partnersLookLikeOperators(ctx, authors)
+
 	out := make([]TaskMessage, 0, len(rows))
 	for _, r := range rows {
 		id := toInt64(r["id"])
@@ -308,12 +471,7 @@ func (c *Client) ListTaskMessagesSince(ctx context.Context, projectID int64, sin
 		date := parseOdooTime(str(r["date"]))
 		msgType := str(r["message_type"]) // "comment", "notification", ...
 		isComment := msgType == "comment"
-		authorPair := anySlice(r["author_id"])
-		var authorPartnerID int64
-		if len(authorPair) >= 1 {
-			authorPartnerID = toInt64(authorPair[0])
-		}
-		byOperator := c.partnerLooksLikeOperator(ctx, authorPartnerID)
+		byOperator := operators[authorID(r)]
 
 		trim := strings.TrimSpace(body)
 		isPublicPrefix := strings.HasPrefix(strings.ToLower(trim), "[public]")
@@ -326,11 +484,28 @@ func (c *Client) ListTaskMessagesSince(ctx context.Context, projectID int64, sin
 	return out, nil
 }
 
-func (c *Client) partnerLooksLikeOperator(ctx context.Context, partnerID int64) bool {
-	// if partner has a user (res.users) -> operator
-	var ids []int64
-	_ = c.execKW(ctx, "res.users", "search", []any{[][]any{{"partner_id", "=", partnerID}, {"active", "=", true}}}, map[string]any{"limit": 1}, &ids)
-	return len(ids) > 0
+// partnersLookLikeOperators tells for each partner whether it has an active user
+// (res.users), i.e. is an operator. All partners are checked with one search_read.
+func (c *Client) partnersLookLikeOperators(ctx context.Context, partnerIDs []int64) map[int64]bool {
+	operators, err := lookup(ctx, &c.operators, partnerIDs, func(ctx context.Context, ids []int64) (map[int64]bool, error) {
+		var rows []map[string]any
+		domain := [][]any{{"partner_id", "in", ids}, {"active", "=", true}}
+		if err := c.execKW(ctx, "res.users", "search_read", []any{domain}, map[string]any{"fields": []string{"partner_id"}}, &rows); err != nil {
+			return nil, err
+		}
+		out := make(map[int64]bool, len(rows))
+		for _, r := range rows {
+			if pair := anySlice(r["partner_id"]); len(pair) >= 1 {
+				out[toInt64(pair[0])] = true
+			}
+		}
+		return out, nil
+	})
+	if err != nil {
+		// Unknown authors count as customers, as when every author was checked alone
+		log.Warn().Err(err).Ints64("partner_ids", partnerIDs).Msg("odoo operator lookup")
+	}
+	return operators
 }
 
 func parseOdooTime(v string) time.Time {
@@ -423,82 +598,36 @@ func (c *Client) GetTask(ctx context.Context, id int64) (*Task, error) {
 		return nil, err
 	}
 	if len(rows) == 0 {
-		return nil, errors.New("task not found")
-	}
-	r := rows[0]
-	stagePair := anySlice(r["stage_id"])
-	var stageID int64
-	var stageName string
-	if len(stagePair) >= minFieldLength {
-		stageID = toInt64(stagePair[0])
-		stageName = str(stagePair[1])
-	}
-	// Get partner (customer) email and name
-	partnerPair := anySlice(r["partner_id"])
-	var email, pname string
-	if len(partnerPair) >= minFieldLength {
-		partnerID := toInt64(partnerPair[0])
-		pname = str(partnerPair[1])
-		if partnerID > 0 {
-			email = c.partnerEmailName(ctx, partnerID)
-		}
+		return nil, fmt.Errorf("task %d: %w", id, ErrMissing)
 	}
+	return c.tasksFromRows(ctx, rows)[0], nil
+}
 
-	// Get assigned user info (user_ids is Many2many, take first user if any)
-	userIDs := anySlice(r["user_ids"])
-	var assignedUserID int64
-	var assignedUserName string
-	if len(userIDs) > 0 {
-		assignedUserID = toInt64(userIDs[0])
-		// Get user name by ID
-		var userRows []map[string]any
-		if err := c.execKW(ctx, "res.users", "read", []any{[]int64{assignedUserID}, []string{"name"}}, nil, &userRows); err == nil && len(userRows) > 0 {
-			assignedUserName = str(userRows[0]["name"])
+// tasksFromRows builds tasks from project.task rows read with stage_id, partner_id
+// and user_ids. Customer emails and the names of the first assignees are read in one
+// call each for all rows.
+func (c *Client) tasksFromRows(ctx context.Context, rows []map[string]any) []*Task {
+	var partnerIDs, userIDs []int64
+	for _, r := range rows {
+		if pair := anySlice(r["partner_id"]); len(pair) >= minFieldLength {
+			partnerIDs = append(partnerIDs, toInt64(pair[0]))
+		}
+		// user_ids is Many2many, the first user is the assignee
+		if users := anySlice(r["user_ids"]); len(users) > 0 {
+			userIDs = append(userIDs, toInt64(users[0]))
 		}
 	}
-
-	t := &Task{
-		ID:               toInt64(r["id"]),
-		Name:             str(r["name"]),
-		StageID:          stageID,
-		StageName:        stageName,
-		CustomerEmail:    email,
-		CustomerName:     pname,
-		TaskURL:          c.TaskURL(c.cfg.URL, toInt64(r["id"])),
-		AssignedUserID:   assignedUserID,
-		AssignedUserName: assignedUserName,
+	// Without them the tasks are still usable, as before the lookups were batched
+	emails, err := c.readField(ctx, &c.partnerEmails, "res.partner", "email", partnerIDs)
+	if err != nil {
+		log.Warn().Err(err).Ints64("partner_ids", partnerIDs).Msg("odoo customer emails")
 	}
-	return t, nil
-}
-
-func (c *Client) partnerEmailName(ctx context.Context, id int64) string {
-	var rows []map[string]any
-	_ = c.execKW(ctx, "res.partner", "read", []any{[]int64{id}, []string{"email"}}, nil, &rows)
-	if len(rows) == 0 {
-		return ""
+	names, err := c.readField(ctx, &c.userNames, "res.users", "name", userIDs)
+	if err != nil {
+		log.Warn().Err(err).Ints64("user_ids", userIDs).Msg("odoo assignee names")
 	}
-	return str(rows[0]["email"])
-}
 
-// ListRecentlyChangedTasks retrieves tasks that have been modified since the specified time for a specific project.
-func (c *Client) ListRecentlyChangedTasks(ctx context.Context, projectID int64, since time.Time) ([]*Task, error) {
-	log.Debug().Int64("project_id", projectID).Time("since", since).Msg("fetching recently changed tasks for specific project")
-	var ids []int64
-	domain := [][]any{
-		{"write_date", ">", since.UTC().Format("2006-01-02 15:04:05")},
-		{"project_id", "=", projectID},
-	}
-	if err := c.execKW(ctx, projectTaskModel, "search", []any{domain}, map[string]any{"limit": defaultQueryLimit}, &ids); err != nil {
-		return nil, err
-	}
-	if len(ids) == 0 {
-		return nil, nil
-	}
-	var rows []map[string]any
-	if err := c.execKW(ctx, projectTaskModel, "read", []any{ids, []string{"id", "name", "stage_id", "partner_id", "user_ids"}}, nil, &rows); err != nil {
-		return nil, err
-	}
-	var out []*Task
+	out := make([]*Task, 0, len(rows))
 	for _, r := range rows {
 		stagePair := anySlice(r["stage_id"])
 		var stageID int64
@@ -512,24 +641,13 @@ func (c *Client) ListRecentlyChangedTasks(ctx context.Context, projectID int64,
 		partnerPair := anySlice(r["partner_id"])
 		var email, pname string
 		if len(partnerPair) >= minFieldLength {
-			partnerID := toInt64(partnerPair[0])
+			email = emails[toInt64(partnerPair[0])]
 			pname = str(partnerPair[1])
-			if partnerID > 0 {
-				email = c.partnerEmailName(ctx, partnerID)
-			}
 		}
 
-		// Get assigned user info (user_ids is Many2many, take first user if any)
-		userIDs := anySlice(r["user_ids"])
 		var assignedUserID int64
-		var assignedUserName string
-		if len(userIDs) > 0 {
-			assignedUserID = toInt64(userIDs[0])
-			// Get user name by ID
-			var userRows []map[string]any
-			if err := c.execKW(ctx, "res.users", "read", []any{[]int64{assignedUserID}, []string{"name"}}, nil, &userRows); err == nil && len(userRows) > 0 {
-				assignedUserName = str(userRows[0]["name"])
-			}
+		if users := anySlice(r["user_ids"]); len(users) > 0 {
+			assignedUserID = toInt64(users[0])
 		}
 
 		out = append(out, &Task{
@@ -539,10 +657,46 @@ func (c *Client) ListRecentlyChangedTasks(ctx context.Context, projectID int64,
 			CustomerEmail: email, CustomerName: pname,
 			TaskURL:          c.TaskURL(c.cfg.URL, toInt64(r["id"])),
 			AssignedUserID:   assignedUserID,
-			AssignedUserName: assignedUserName,
+			AssignedUserName: names[assignedUserID],
 		})
 	}
-	return out, nil
+	return out
+}
+
+// readField reads one field of the records with a single read, through the cache
+func (c *Client) readField(ctx context.Context, lc *lookupCache[string], model, field string, ids []int64) (map[int64]string, error) {
+	return lookup(ctx, lc, ids, func(ctx context.Context, ids []int64) (map[int64]string, error) {
+		var rows []map[string]any
+		if err := c.execKW(ctx, model, "read", []any{ids, []string{field}}, nil, &rows); err != nil {
+			return nil, err
+		}
+		out := make(map[int64]string, len(rows))
+		for _, r := range rows {
+			out[toInt64(r["id"])] = str(r[field])
+		}
+		return out, nil
+	})
+}
+
+// ListRecentlyChangedTasks retrieves tasks that have been modified since the specified time for a specific project.
+func (c *Client) ListRecentlyChangedTasks(ctx context.Context, projectID int64, since time.Time) ([]*Task, error) {
+	log.Debug().Int64("project_id", projectID).Time("since", since).Msg("fetching recently changed tasks for specific project")
+	var ids []int64
+	domain := [][]any{
+		{"write_date", ">", since.UTC().Format("2006-01-02 15:04:05")},
+		{"project_id", "=", projectID},
+	}
+	if err := c.execKW(ctx, projectTaskModel, "search", []any{domain}, map[string]any{"limit": defaultQueryLimit}, &ids); err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	var rows []map[string]any
+	if err := c.execKW(ctx, projectTaskModel, "read", []any{ids, []string{"id", "name", "stage_id", "partner_id", "user_ids"}}, nil, &rows); err != nil {
+		return nil, err
+	}
+	return c.tasksFromRows(ctx, rows), nil
 }
 
 // ListRecentlyChangedTasksForSLA returns tasks changed since given time, optimized for SLA checking (no customer emails)
@@ -605,6 +759,12 @@ func (c *Client) SetTaskStage(ctx context.Context, taskID, stageID int64) error
 	return c.execKW(ctx, projectTaskModel, "write", []any{[]int64{taskID}, map[string]any{"stage_id": stageID}}, nil, &ok)
 }
 
+// SetTaskDescription replaces the HTML description of a task
+func (c *Client) SetTaskDescription(ctx context.Context, taskID int64, description string) error {
+	var ok bool
+	return c.execKW(ctx, projectTaskModel, "write", []any{[]int64{taskID}, map[string]any{"description": description}}, nil, &ok)
+}
+
 // AssignTask assigns a task to a user
 func (c *Client) AssignTask(ctx context.Context, taskID int64, userEmail string) error {
 	log.Debug().Str("user_email", userEmail).Int64("task_id", taskID).Msg("searching for user to assign task")
@@ -765,7 +925,7 @@ func (c *Client) DownloadAttachment(ctx context.Context, attachmentID int64) ([]
 	}
 
 	if len(attachments) == 0 {
-		return nil, fmt.Errorf("attachment not found")
+		return nil, fmt.Errorf("attachment %d: %w", attachmentID, ErrMissing)
 	}
 
 	encodedData, ok := attachments[0]["datas"].(string)
@@ -942,14 +942,13 @@ func TestListTaskMessagesSince_ProjectFiltering(t *testing.T) {
 			}
 			response := map[string]any{"jsonrpc": "2.0", "id": req["id"], "result": messages}
 			_ = json.NewEncoder(w).Encode(response)
-		case 5, 6: // Partner operator checks
-			// Return empty for first (customer), user for second (operator)
-			var response map[string]any
-			if callCount == 5 {
-				response = map[string]any{"jsonrpc": "2.0", "id": req["id"], "result": []int64{}}
-			} else {
-				response = map[string]any{"jsonrpc": "2.0", "id": req["id"], "result": []int64{401}}
+		case 5: // One operator check for all authors
+			// Only the second author (operator) has a user
+			if model, method := args[3], args[4]; model != "res.users" || method != "search_read" {
+				t.Errorf("Expected res.users search_read, got %v.%v", model, method)
 			}
+			users := []map[string]any{{"id": 401, "partner_id": []any{int64(302), "Operator Two"}}}
+			response := map[string]any{"jsonrpc": "2.0", "id": req["id"], "result": users}
 			_ = json.NewEncoder(w).Encode(response)
 		}
 	}))
@@ -982,8 +981,8 @@ func TestListTaskMessagesSince_ProjectFiltering(t *testing.T) {
 			messages[1].TaskID, messages[1].IsPublicPrefix, messages[1].ByOperator)
 	}
 
-	if callCount != 6 {
-		t.Errorf("Expected 6 API calls, got %d", callCount)
+	if callCount != 5 {
+		t.Errorf("Expected 5 API calls, got %d", callCount)
 	}
 }
 
@@ -1082,19 +1081,16 @@ func TestListRecentlyChangedTasks_ProjectFiltering(t *testing.T) {
 			}
 			response := map[string]any{"jsonrpc": "2.0", "id": req["id"], "result": tasks}
 			_ = json.NewEncoder(w).Encode(response)
-		case 4: // Get customer email for task 1
-			partners := []map[string]any{{"email": "customer@example.com"}}
+		case 4: // Get customer emails of all tasks
+			partners := []map[string]any{{"id": 301, "email": "customer@example.com"}}
 			response := map[string]any{"jsonrpc": "2.0", "id": req["id"], "result": partners}
 			_ = json.NewEncoder(w).Encode(response)
-		case 5, 6: // Get user names for task 1 (first user) and no user for task 2
-			var response map[string]any
-			if callCount == 5 {
-				users := []map[string]any{{"name": "Operator One"}}
-				response = map[string]any{"jsonrpc": "2.0", "id": req["id"], "result": users}
-			} else {
-				users := []map[string]any{}
-				response = map[string]any{"jsonrpc": "2.0", "id": req["id"], "result": users}
+		case 5: // Get names of the first assignees of all tasks
+			if ids := args[5].([]any)[0]; fmt.Sprint(ids) != "[401]" {
+				t.Errorf("Expected user names read for [401], got %v", ids)
 			}
+			users := []map[string]any{{"id": 401, "name": "Operator One"}}
+			response := map[string]any{"jsonrpc": "2.0", "id": req["id"], "result": users}
 			_ = json.NewEncoder(w).Encode(response)
 		}
 	}))
@@ -1176,11 +1172,11 @@ func TestGetTask_UserAssignmentDetection(t *testing.T) {
 			response := map[string]any{"jsonrpc": "2.0", "id": req["id"], "result": task}
 			_ = json.NewEncoder(w).Encode(response)
 		case 3: // Get customer email
-			partners := []map[string]any{{"email": "customer@example.com"}}
+			partners := []map[string]any{{"id": 301, "email": "customer@example.com"}}
 			response := map[string]any{"jsonrpc": "2.0", "id": req["id"], "result": partners}
 			_ = json.NewEncoder(w).Encode(response)
 		case 4: // Get user name for first assigned user
-			users := []map[string]any{{"name": "Primary Operator"}}
+			users := []map[string]any{{"id": 401, "name": "Primary Operator"}}
 			response := map[string]any{"jsonrpc": "2.0", "id": req["id"], "result": users}
 			_ = json.NewEncoder(w).Encode(response)
 		}
@@ -1433,7 +1429,7 @@ func TestListRecentlyChangedTasksForSLA_ProjectFiltering(t *testing.T) {
 	}
 }
 
-func TestPartnerLooksLikeOperator_Scenarios(t *testing.T) {
+func TestPartnersLookLikeOperators_Scenarios(t *testing.T) {
 	tests := []struct {
 		name       string
 		partnerID  int64
@@ -1459,11 +1455,9 @@ func TestPartnerLooksLikeOperator_Scenarios(t *testing.T) {
 					response := map[string]any{"jsonrpc": "2.0", "id": req["id"], "result": int64(42)}
 					_ = json.NewEncoder(w).Encode(response)
 				case 2: // User search
-					var result []int64
+					result := []map[string]any{} // No user
 					if tt.hasUser {
-						result = []int64{501} // User exists
-					} else {
-						result = []int64{} // No user
+						result = []map[string]any{{"id": 501, "partner_id": []any{tt.partnerID, "Operator"}}} // User exists
 					}
 					response := map[string]any{"jsonrpc": "2.0", "id": req["id"], "result": result}
 					_ = json.NewEncoder(w).Encode(response)
@@ -1477,10 +1471,243 @@ func TestPartnerLooksLikeOperator_Scenarios(t *testing.T) {
 				t.Fatalf("NewClient() failed: %v", err)
 			}
 
-			isOp := client.partnerLooksLikeOperator(context.Background(), tt.partnerID)
+			isOp := client.partnersLookLikeOperators(context.Background(), []int64{tt.partnerID})[tt.partnerID]
 			if isOp != tt.expectedOp {
-				t.Errorf("Expected partnerLooksLikeOperator()=%v for %s, got %v", tt.expectedOp, tt.name, isOp)
+				t.Errorf("Expected partnersLookLikeOperators()=%v for %s, got %v", tt.expectedOp, tt.name, isOp)
 			}
 		})
 	}
 }
+
+func TestMessagePostNote(t *testing.T) {
+	var kwargs map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Params struct {
+				Args []any `json:"args"`
+			} `json:"params"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		if len(req.Params.Args) == 7 {
+			kwargs, _ = req.Params.Args[6].(map[string]any)
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"jsonrpc": "2.0", "id": 1, "result": 99})
+	}))
+	defer server.Close()
+
+	client := &Client{
+		cfg:  Config{URL: server.URL, DB: "testdb"},
+		uid:  42,
+		http: &http.Client{},
+	}
+
+	if err := client.MessagePostNote(context.Background(), 123, "Out of office"); err != nil {
+		t.Fatalf("MessagePostNote() should not fail: %v", err)
+	}
+	if kwargs["subtype_xmlid"] != "mail.mt_note" {
+		t.Errorf("Expected internal note subtype, got %v", kwargs["subtype_xmlid"])
+	}
+	if _, ok := kwargs["author_id"]; ok {
+		t.Error("Internal note should not be posted as the customer")
+	}
+	if kwargs["body"] != "Out of office" {
+		t.Errorf("Unexpected body %v", kwargs["body"])
+	}
+	if _, ok := kwargs["attachment_ids"]; ok {
+		t.Error("Note without attachments should not send attachment_ids")
+	}
+
+	if err := client.MessagePostNote(context.Background(), 123, "Original mail", 5, 6); err != nil {
+		t.Fatalf("MessagePostNote() with attachments should not fail: %v", err)
+	}
+	if ids, _ := kwargs["attachment_ids"].([]any); len(ids) != 2 || ids[0] != float64(5) || ids[1] != float64(6) {
+		t.Errorf("Expected attachment_ids [5 6], got %v", kwargs["attachment_ids"])
+	}
+}
+
+func TestMessagePostCustomerHTML(t *testing.T) {
+	var kwargs map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Params struct {
+				Args []any `json:"args"`
+			} `json:"params"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		if len(req.Params.Args) == 7 {
+			kwargs, _ = req.Params.Args[6].(map[string]any)
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"jsonrpc": "2.0", "id": 1, "result": 99})
+	}))
+	defer server.Close()
+
+	client := &Client{
+		cfg:  Config{URL: server.URL, DB: "testdb"},
+		uid:  42,
+		http: &http.Client{},
+	}
+
+	if err := client.MessagePostCustomerHTML(context.Background(), 123, 7, "<p>Hello</p>"); err != nil {
+		t.Fatalf("MessagePostCustomerHTML() should not fail: %v", err)
+	}
+	if kwargs["body_is_html"] != true {
+		t.Errorf("Expected body_is_html, got %v", kwargs["body_is_html"])
+	}
+	if kwargs["author_id"] != float64(7) {
+		t.Errorf("Expected customer as author, got %v", kwargs["author_id"])
+	}
+	if kwargs["body"] != "<p>Hello</p>" {
+		t.Errorf("Unexpected body %v", kwargs["body"])
+	}
+}
+
+func TestSetTaskDescription(t *testing.T) {
+	var args []any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Params struct {
+				Args []any `json:"args"`
+			} `json:"params"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		args = req.Params.Args
+		_ = json.NewEncoder(w).Encode(map[string]any{"jsonrpc": "2.0", "id": 1, "result": true})
+	}))
+	defer server.Close()
+
+	client := &Client{
+		cfg:  Config{URL: server.URL, DB: "testdb"},
+		uid:  42,
+		http: &http.Client{},
+	}
+
+	if err := client.SetTaskDescription(context.Background(), 123, `<p><img src="/web/content/5"></p>`); err != nil {
+		t.Fatalf("SetTaskDescription() should not fail: %v", err)
+	}
+	if len(args) < 6 || args[4] != "write" {
+		t.Fatalf("Expected write call, got %v", args)
+	}
+	params, _ := args[5].([]any)
+	if len(params) != 2 {
+		t.Fatalf("Unexpected write params %v", args[5])
+	}
+	vals, _ := params[1].(map[string]any)
+	if vals["description"] != `<p><img src="/web/content/5"></p>` {
+		t.Errorf("Unexpected description %v", vals["description"])
+	}
+}
+
+func TestFindOrCreateTags(t *testing.T) {
+	var calls []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Params struct {
+				Args []any `json:"args"`
+			} `json:"params"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		method, _ := req.Params.Args[4].(string)
+		calls = append(calls, method)
+
+		var result any
+		switch method {
+		case "search":
+			domain, _ := req.Params.Args[5].([]any)
+			cond := domain[0].([]any)[0].([]any)
+			if cond[2] == "billing" {
+				result = []int64{7}
+			} else {
+				result = []int64{}
+			}
+		case "create":
+			result = 8
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"jsonrpc": "2.0", "id": 1, "result": result})
+	}))
+	defer server.Close()
+
+	client := &Client{
+		cfg:  Config{URL: server.URL, DB: "testdb"},
+		uid:  42,
+		http: &http.Client{},
+	}
+
+	ids, err := client.FindOrCreateTags(context.Background(), []string{"billing", "vip"})
+	if err != nil {
+		t.Fatalf("FindOrCreateTags() error = %v", err)
+	}
+	if len(ids) != 2 || ids[0] != 7 || ids[1] != 8 {
+		t.Errorf("FindOrCreateTags() = %v, want [7 8]", ids)
+	}
+	if strings.Join(calls, ",") != "search,search,create" {
+		t.Errorf("Unexpected calls %v", calls)
+	}
+}
+
+func TestCreateTask_TagsAndPriority(t *testing.T) {
+	var vals map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Params struct {
+				Args []any `json:"args"`
+			} `json:"params"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		if req.Params.Args[4] == "create" {
+			params, _ := req.Params.Args[5].([]any)
+			vals, _ = params[0].(map[string]any)
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"jsonrpc": "2.0", "id": 1, "result": 99})
+	}))
+	defer server.Close()
+
+	client := &Client{
+		cfg:  Config{URL: server.URL, DB: "testdb"},
+		uid:  42,
+		http: &http.Client{},
+	}
+
+	_, err := client.CreateTask(context.Background(), CreateTaskInput{ProjectID: 1, Name: "Invoice", TagIDs: []int64{7, 8}, Priority: "1"})
+	if err != nil {
+		t.Fatalf("CreateTask() error = %v", err)
+	}
+	if vals["priority"] != "1" {
+		t.Errorf("priority = %v", vals["priority"])
+	}
+	if got := fmt.Sprint(vals["tag_ids"]); got != "[[6 0 [7 8]]]" {
+		t.Errorf("tag_ids = %s", got)
+	}
+}
+
+func TestTaskFollowerEmails(t *testing.T) {
+	var models []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req map[string]any
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		args := req["params"].(map[string]any)["args"].([]any)
+		var result any
+		if len(args) > 3 {
+			models = append(models, fmt.Sprintf("%v.%v", args[3], args[4]))
+			switch args[3] {
+			case "mail.followers":
+				result = []map[string]any{{"partner_id": []any{int64(7), "Anna"}}, {"partner_id": []any{int64(8), "Petr"}}}
+			case "res.partner":
+				result = []map[string]any{{"id": 7, "email": "Anna@Example.com"}, {"id": 8, "email": ""}}
+			}
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"jsonrpc": "2.0", "id": req["id"], "result": result})
+	}))
+	defer server.Close()
+
+	client := &Client{cfg: Config{URL: server.URL, DB: "testdb"}, uid: 42, http: &http.Client{}}
+	emails, err := client.TaskFollowerEmails(context.Background(), 101)
+	if err != nil {
+		t.Fatalf("TaskFollowerEmails() error = %v", err)
+	}
+	if len(emails) != 1 || emails[0] != "anna@example.com" {
+		t.Errorf("TaskFollowerEmails() = %v", emails)
+	}
+	if strings.Join(models, ",") != "mail.followers.search_read,res.partner.read" {
+		t.Errorf("calls = %v", models)
+	}
+}
@@ -0,0 +1,113 @@
+package odoo
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Protocols of the external API
+const (
+	ProtocolJSONRPC = "jsonrpc" // POST /jsonrpc, the default
+	ProtocolXMLRPC  = "xmlrpc"  // POST /xmlrpc/2/common and /xmlrpc/2/object
+)
+
+// transport carries one call of the external API to a service ("common" or "object").
+// The result is decoded the way encoding/json decodes the JSON-RPC result, so callers
+// see the same types whichever protocol is used.
+type transport interface {
+	call(ctx context.Context, hc *http.Client, baseURL, service, method string, args []any, result any) error
+}
+
+// transport returns the implementation of the configured protocol
+func (c *Client) transport() transport {
+	if c.cfg.Protocol == ProtocolXMLRPC {
+		return xmlRPC{}
+	}
+	return jsonRPC{}
+}
+
+// jsonRPC speaks JSON-RPC 2.0 on /jsonrpc
+type jsonRPC struct{}
+
+func (jsonRPC) call(ctx context.Context, hc *http.Client, baseURL, service, method string, args []any, result any) error {
+	reqBody := map[string]any{
+		"jsonrpc": "2.0",
+		"method":  "call",
+		"params": map[string]any{
+			"service": service,
+			"method":  method,
+			"args":    args,
+		},
+		"id": time.Now().UnixNano(),
+	}
+	b, _ := json.Marshal(reqBody)
+	req, _ := http.NewRequestWithContext(ctx, "POST", strings.TrimRight(baseURL, "/")+"/jsonrpc", bytes.NewReader(b))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := send(hc, req)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := resp.Body.Close(); err != nil {
+			log.Error().Err(err).Msg("failed to close response body")
+		}
+	}()
+	var r struct {
+		Result any `json:"result"`
+		Error  *struct {
+			Code    int    `json:"code"`
+			Message string `json:"message"`
+			Data    struct {
+				Name    string `json:"name"`
+				Message string `json:"message"`
+				Debug   string `json:"debug"`
+			} `json:"data"`
+		} `json:"error"`
+	}
+	dec := json.NewDecoder(resp.Body)
+	if err := dec.Decode(&r); err != nil {
+		return err
+	}
+	if r.Error != nil {
+		// The generic "Odoo Server Error" carries the exception in its data
+		e := &Error{Code: r.Error.Code, Name: r.Error.Data.Name, Message: r.Error.Data.Message, Debug: r.Error.Data.Debug}
+		if e.Message == "" {
+			e.Message = r.Error.Message
+		}
+		return e
+	}
+	assign(r.Result, result)
+	return nil
+}
+
+// send posts the request; a network failure or a response other than 200 becomes an
+// *Error. Odoo answers faults with 200, other statuses come from it or a proxy in front.
+func send(hc *http.Client, req *http.Request) (*http.Response, error) {
+	resp, err := hc.Do(req)
+	if err != nil {
+		if req.Context().Err() != nil {
+			return nil, req.Context().Err()
+		}
+		return nil, &Error{Err: err}
+	}
+	if resp.StatusCode != http.StatusOK {
+		_ = resp.Body.Close()
+		return nil, &Error{HTTPStatus: resp.StatusCode}
+	}
+	return resp, nil
+}
+
+// assign copies a decoded result into the caller's value through JSON, the way the
+// client has always filled results; a result that does not fit is left unset
+func assign(v, result any) {
+	if result != nil {
+		j, _ := json.Marshal(v)
+		_ = json.Unmarshal(j, result)
+	}
+}
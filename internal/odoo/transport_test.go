@@ -0,0 +1,357 @@
+package odoo
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// odooHandler answers one call of the external API; args arrive as encoding/json
+// decodes them, whichever protocol carried them
+type odooHandler func(service, method string, args []any) (any, error)
+
+// fakeOdoo serves the handler over both JSON-RPC and XML-RPC, the way Odoo does
+func fakeOdoo(t testing.TB, h odooHandler) *httptest.Server {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/jsonrpc", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Params struct {
+				Service string `json:"service"`
+				Method  string `json:"method"`
+				Args    []any  `json:"args"`
+			} `json:"params"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		res, err := h(req.Params.Service, req.Params.Method, req.Params.Args)
+		if httpError(w, err) {
+			return
+		}
+		resp := map[string]any{"jsonrpc": "2.0", "id": 1, "result": res}
+		if err != nil {
+			name, msg := exception(err)
+			resp = map[string]any{"jsonrpc": "2.0", "id": 1, "error": map[string]any{
+				"code": 200, "message": "Odoo Server Error",
+				"data": map[string]any{"name": name, "message": msg, "debug": traceback(name, msg)},
+			}}
+		}
+		_ = json.NewEncoder(w).Encode(resp)
+	})
+	mux.HandleFunc("/xmlrpc/2/", func(w http.ResponseWriter, r *http.Request) {
+		var call struct {
+			Method string     `xml:"methodName"`
+			Params []xmlValue `xml:"params>param>value"`
+		}
+		if err := xml.NewDecoder(r.Body).Decode(&call); err != nil {
+			t.Errorf("fake odoo: bad XML-RPC request: %v", err)
+		}
+		args := make([]any, len(call.Params))
+		for i, p := range call.Params {
+			args[i] = p.decode()
+		}
+		var norm []any
+		assign(args, &norm)
+
+		res, err := h(strings.TrimPrefix(r.URL.Path, "/xmlrpc/2/"), call.Method, norm)
+		if httpError(w, err) {
+			return
+		}
+		var b bytes.Buffer
+		b.WriteString(xml.Header + "<methodResponse>")
+		if err != nil {
+			// The fault codes of odoo.http.xmlrpc_handle_exception_int
+			name, msg := exception(err)
+			fault := map[string]any{"faultCode": 1, "faultString": traceback(name, msg)}
+			switch name {
+			case userError, missingError, "odoo.exceptions.ValidationError":
+				fault = map[string]any{"faultCode": 2, "faultString": msg}
+			case accessDenied:
+				fault = map[string]any{"faultCode": 3, "faultString": msg}
+			case accessError:
+				fault = map[string]any{"faultCode": 4, "faultString": msg}
+			}
+			b.WriteString("<fault>")
+			_ = writeValue(&b, reflect.ValueOf(fault))
+			b.WriteString("</fault>")
+		} else {
+			b.WriteString("<params><param>")
+			_ = writeValue(&b, reflect.ValueOf(res))
+			b.WriteString("</param></params>")
+		}
+		b.WriteString("</methodResponse>")
+		w.Header().Set("Content-Type", "text/xml")
+		_, _ = w.Write(b.Bytes())
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// exception is the exception Odoo raises for a handler error: an *Error names it,
+// anything else is a ValueError
+func exception(err error) (name, msg string) {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Name, e.Message
+	}
+	return "builtins.ValueError", err.Error()
+}
+
+func traceback(name, msg string) string {
+	return "Traceback (most recent call last):\n  File \"odoo/http.py\", line 1\n" + name + ": " + msg + "\n"
+}
+
+// httpError answers an *Error with an HTTP status the way a proxy in front of Odoo would
+func httpError(w http.ResponseWriter, err error) bool {
+	var e *Error
+	if !errors.As(err, &e) || e.HTTPStatus == 0 {
+		return false
+	}
+	http.Error(w, http.StatusText(e.HTTPStatus), e.HTTPStatus)
+	return true
+}
+
+// forEachProtocol runs the test against a client of each protocol, both talking to
+// the same fake Odoo
+func forEachProtocol(t *testing.T, h odooHandler, test func(t *testing.T, c *Client)) {
+	for _, protocol := range []string{ProtocolJSONRPC, ProtocolXMLRPC} {
+		t.Run(protocol, func(t *testing.T) {
+			srv := fakeOdoo(t, h)
+			c, err := NewClient(context.Background(), Config{URL: srv.URL, DB: "db", User: "admin", Pass: "pw", Timeout: 5 * time.Second, Protocol: protocol})
+			if err != nil {
+				t.Fatalf("NewClient() error = %v", err)
+			}
+			if c.uid != 2 {
+				t.Fatalf("uid = %d, want 2", c.uid)
+			}
+			test(t, c)
+		})
+	}
+}
+
+// authenticated answers common.authenticate and hands object calls to h
+func authenticated(h func(model, method string, args, kwargs any) (any, error)) odooHandler {
+	return func(service, method string, args []any) (any, error) {
+		if service == "common" && method == "authenticate" {
+			if args[0] != "db" || args[1] != "admin" || args[2] != "pw" {
+				return false, nil
+			}
+			return 2, nil
+		}
+		if service != "object" || method != "execute_kw" || len(args) != 7 {
+			return nil, errors.New("unexpected call " + service + "." + method)
+		}
+		if args[1] != float64(2) {
+			return nil, errors.New("wrong uid")
+		}
+		return h(args[3].(string), args[4].(string), args[5], args[6])
+	}
+}
+
+func TestTransport_Attachments(t *testing.T) {
+	h := authenticated(func(model, method string, args, _ any) (any, error) {
+		switch model + "." + method {
+		case "ir.attachment.search":
+			domain := args.([]any)[0].([]any)
+			if !reflect.DeepEqual(domain[1], []any{"res_id", "=", float64(123)}) {
+				return nil, errors.New("unexpected domain")
+			}
+			return []any{7, 8}, nil
+		case "ir.attachment.read":
+			fields := args.([]any)[1].([]any)
+			if len(fields) == 1 {
+				return []any{map[string]any{"id": 7, "datas": "aGVsbG8="}}, nil
+			}
+			return []any{
+				map[string]any{"id": 7, "name": "invoice.pdf", "mimetype": "application/pdf", "file_size": 1024},
+				map[string]any{"id": 8, "name": "photo <1>.jpg", "mimetype": "image/jpeg", "file_size": 2.5e6},
+			}, nil
+		}
+		return nil, errors.New("unexpected " + model + "." + method)
+	})
+	forEachProtocol(t, h, func(t *testing.T, c *Client) {
+		atts, err := c.GetTaskAttachments(context.Background(), 123)
+		if err != nil {
+			t.Fatalf("GetTaskAttachments() error = %v", err)
+		}
+		want := []Attachment{
+			{ID: 7, Name: "invoice.pdf", MimeType: "application/pdf", Size: 1024},
+			{ID: 8, Name: "photo <1>.jpg", MimeType: "image/jpeg", Size: 2500000},
+		}
+		if !reflect.DeepEqual(atts, want) {
+			t.Errorf("GetTaskAttachments() = %+v", atts)
+		}
+		data, err := c.DownloadAttachment(context.Background(), 7)
+		if err != nil || string(data) != "hello" {
+			t.Errorf("DownloadAttachment() = %q, %v", data, err)
+		}
+	})
+}
+
+func TestTransport_CreateTask(t *testing.T) {
+	var got map[string]any
+	h := authenticated(func(model, method string, args, kwargs any) (any, error) {
+		if model != projectTaskModel || method != "create" {
+			return nil, errors.New("unexpected " + model + "." + method)
+		}
+		got = args.([]any)[0].(map[string]any)
+		return 501, nil
+	})
+	forEachProtocol(t, h, func(t *testing.T, c *Client) {
+		id, err := c.CreateTask(context.Background(), CreateTaskInput{ProjectID: 3, Name: "Tiskárna & síť", Description: "<p>x</p>", CustomerPartnerID: 9, TagIDs: []int64{1, 2}})
+		if err != nil || id != 501 {
+			t.Fatalf("CreateTask() = %d, %v", id, err)
+		}
+		if got["name"] != "Tiskárna & síť" || got["project_id"] != float64(3) || got["partner_id"] != float64(9) {
+			t.Errorf("create values = %v", got)
+		}
+	})
+}
+
+func TestTransport_Errors(t *testing.T) {
+	tests := []struct {
+		err  error
+		kind error
+		msg  string
+	}{
+		{&Error{Name: accessError, Message: "You are not allowed to modify 'Task' (project.task) records."}, ErrAccess, "You are not allowed to modify 'Task' (project.task) records."},
+		{&Error{Name: missingError, Message: "Record does not exist or has been deleted.\n(Record: project.task(1,), User: 2)"}, ErrMissing, "Record does not exist or has been deleted.\n(Record: project.task(1,), User: 2)"},
+		{&Error{Name: "odoo.exceptions.ValidationError", Message: "Stage is required"}, ErrValidation, "Stage is required"},
+		{errors.New("Invalid field 'foo' on model 'project.task'"), nil, "Invalid field 'foo' on model 'project.task'"},
+	}
+	for _, tt := range tests {
+		h := authenticated(func(_, _ string, _, _ any) (any, error) { return nil, tt.err })
+		forEachProtocol(t, h, func(t *testing.T, c *Client) {
+			err := c.SetTaskStage(context.Background(), 1, 2)
+			var e *Error
+			if !errors.As(err, &e) || e.Message != tt.msg {
+				t.Fatalf("SetTaskStage() error = %#v", err)
+			}
+			if tt.kind != nil && !errors.Is(err, tt.kind) {
+				t.Errorf("error %q is not %v", err, tt.kind)
+			}
+			for _, other := range []error{ErrAccess, ErrMissing, ErrValidation, ErrSession, ErrConflict, ErrTransient} {
+				if other != tt.kind && errors.Is(err, other) {
+					t.Errorf("error %q is %v", err, other)
+				}
+			}
+		})
+	}
+
+	// A failed login answers false, not a fault
+	for _, protocol := range []string{ProtocolJSONRPC, ProtocolXMLRPC} {
+		srv := fakeOdoo(t, authenticated(nil))
+		_, err := NewClient(context.Background(), Config{URL: srv.URL, DB: "db", User: "admin", Pass: "wrong", Protocol: protocol})
+		if !errors.Is(err, ErrAuth) {
+			t.Errorf("%s: NewClient() with a wrong password error = %v", protocol, err)
+		}
+	}
+}
+
+func TestXMLRPC_EncodeCall(t *testing.T) {
+	var none map[string]any
+	b, err := encodeCall("execute_kw", []any{"db", int64(2), "a<b", []any{[]any{"id", "in", []int64{1, 2}}}, map[string]any{"limit": 5, "active": false, "x": nil, "ctx": none}, 1.5, []byte("hi")})
+	if err != nil {
+		t.Fatalf("encodeCall() error = %v", err)
+	}
+	want := xml.Header + "<methodCall><methodName>execute_kw</methodName><params>" +
+		"<param><value><string>db</string></value></param>" +
+		"<param><value><int>2</int></value></param>" +
+		"<param><value><string>a&lt;b</string></value></param>" +
+		"<param><value><array><data><value><array><data><value><string>id</string></value><value><string>in</string></value>" +
+		"<value><array><data><value><int>1</int></value><value><int>2</int></value></data></array></value></data></array></value></data></array></value></param>" +
+		"<param><value><struct><member><name>active</name><value><boolean>0</boolean></value></member>" +
+		"<member><name>ctx</name><value><nil/></value></member>" +
+		"<member><name>limit</name><value><int>5</int></value></member>" +
+		"<member><name>x</name><value><nil/></value></member></struct></value></param>" +
+		"<param><value><double>1.5</double></value></param>" +
+		"<param><value><base64>aGk=</base64></value></param>" +
+		"</params></methodCall>"
+	if string(b) != want {
+		t.Errorf("encodeCall() =\n%s\nwant\n%s", b, want)
+	}
+	if _, err := encodeCall("x", []any{struct{}{}}); err == nil {
+		t.Error("encoding a struct should fail")
+	}
+}
+
+func TestXMLRPC_DecodeResponse(t *testing.T) {
+	// As written by Python's xmlrpc.client for Odoo
+	body := `<?xml version='1.0'?>
+<methodResponse>
+<params>
+<param>
+<value><array><data>
+<value><struct>
+<member>
+<name>id</name>
+<value><int>42</int></value>
+</member>
+<member>
+<name>name</name>
+<value><string>Printer &amp; network</string></value>
+</member>
+<member>
+<name>stage_id</name>
+<value><array><data>
+<value><int>5</int></value>
+<value><string>New</string></value>
+</data></array></value>
+</member>
+<member>
+<name>user_ids</name>
+<value><array><data>
+</data></array></value>
+</member>
+<member>
+<name>description</name>
+<value><boolean>0</boolean></value>
+</member>
+<member>
+<name>write_date</name>
+<value><string>2025-03-01 12:00:00</string></value>
+</member>
+<member>
+<name>plain</name>
+<value>untyped</value>
+</member>
+<member>
+<name>ratio</name>
+<value><double>0.25</double></value>
+</member>
+</struct></value>
+</data></array></value>
+</param>
+</params>
+</methodResponse>`
+	var r struct {
+		Params []xmlValue `xml:"params>param>value"`
+	}
+	if err := xml.Unmarshal([]byte(body), &r); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	var got []map[string]any
+	assign(r.Params[0].decode(), &got)
+	want := []map[string]any{{
+		"id": float64(42), "name": "Printer & network", "stage_id": []any{float64(5), "New"},
+		"user_ids": []any{}, "description": false, "write_date": "2025-03-01 12:00:00",
+		"plain": "untyped", "ratio": 0.25,
+	}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("decoded = %#v", got)
+	}
+
+	var fault *Error
+	if !errors.As(faultError(map[string]any{"faultCode": int64(1), "faultString": "Traceback...\nValueError: Invalid field 'foo'\n"}), &fault) ||
+		fault.Name != "ValueError" || fault.Message != "Invalid field 'foo'" || !strings.HasPrefix(fault.Debug, "Traceback") {
+		t.Errorf("faultError() = %#v", fault)
+	}
+}
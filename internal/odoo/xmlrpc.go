@@ -0,0 +1,249 @@
+package odoo
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+// xmlRPC speaks XML-RPC on /xmlrpc/2/<service>, for instances and proxies that do
+// not expose /jsonrpc
+type xmlRPC struct{}
+
+func (xmlRPC) call(ctx context.Context, hc *http.Client, baseURL, service, method string, args []any, result any) error {
+	body, err := encodeCall(method, args)
+	if err != nil {
+		return err
+	}
+	req, _ := http.NewRequestWithContext(ctx, "POST", strings.TrimRight(baseURL, "/")+"/xmlrpc/2/"+service, bytes.NewReader(body))
+	req.Header.Set("Content-Type", "text/xml")
+	resp, err := send(hc, req)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := resp.Body.Close(); err != nil {
+			log.Error().Err(err).Msg("failed to close response body")
+		}
+	}()
+
+	var r struct {
+		Params []xmlValue `xml:"params>param>value"`
+		Fault  *xmlValue  `xml:"fault>value"`
+	}
+	if err := xml.NewDecoder(resp.Body).Decode(&r); err != nil {
+		return fmt.Errorf("xmlrpc: %w", err)
+	}
+	if r.Fault != nil {
+		return faultError(r.Fault.decode())
+	}
+	if len(r.Params) == 0 {
+		return errors.New("xmlrpc: response without a value")
+	}
+	assign(r.Params[0].decode(), result)
+	return nil
+}
+
+// faultError turns an XML-RPC fault into an *Error. /xmlrpc/2 reports Odoo's own
+// exceptions by code with just the message; anything else is code 1 with the whole
+// traceback, whose last line names the exception.
+func faultError(v any) error {
+	fault, _ := v.(map[string]any)
+	msg, _ := fault["faultString"].(string)
+	e := &Error{Message: strings.TrimSpace(msg)}
+	if code, ok := fault["faultCode"].(int64); ok {
+		e.Code = int(code)
+	}
+	switch e.Code {
+	case 2:
+		// MissingError and ValidationError are sent as their base class, UserError
+		e.Name = userError
+		if strings.Contains(e.Message, "does not exist or has been deleted") {
+			e.Name = missingError
+		}
+	case 3:
+		e.Name = accessDenied
+	case 4:
+		e.Name = accessError
+	default:
+		e.Debug = msg
+		e.Message = lastLine(msg)
+		if name, text, ok := strings.Cut(e.Message, ": "); ok && !strings.Contains(name, " ") {
+			e.Name, e.Message = name, text
+		}
+	}
+	if e.Message == "" && e.Name == "" {
+		e.Message = fmt.Sprintf("xmlrpc: fault %v", fault["faultCode"])
+	}
+	return e
+}
+
+// encodeCall writes the methodCall document for the parameters
+func encodeCall(method string, params []any) ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteString(xml.Header)
+	b.WriteString("<methodCall><methodName>")
+	_ = xml.EscapeText(&b, []byte(method))
+	b.WriteString("</methodName><params>")
+	for _, p := range params {
+		b.WriteString("<param>")
+		if err := writeValue(&b, reflect.ValueOf(p)); err != nil {
+			return nil, err
+		}
+		b.WriteString("</param>")
+	}
+	b.WriteString("</params></methodCall>")
+	return b.Bytes(), nil
+}
+
+// writeValue encodes a Go value; Odoo accepts <nil/> for None
+func writeValue(b *bytes.Buffer, v reflect.Value) error {
+	b.WriteString("<value>")
+	defer b.WriteString("</value>")
+	for v.Kind() == reflect.Interface || v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			b.WriteString("<nil/>")
+			return nil
+		}
+		v = v.Elem()
+	}
+	// nil maps and slices are sent as None, like encoding/json sends null
+	if !v.IsValid() || ((v.Kind() == reflect.Map || v.Kind() == reflect.Slice) && v.IsNil()) {
+		b.WriteString("<nil/>")
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		b.WriteString("<string>")
+		_ = xml.EscapeText(b, []byte(v.String()))
+		b.WriteString("</string>")
+	case reflect.Bool:
+		if v.Bool() {
+			b.WriteString("<boolean>1</boolean>")
+		} else {
+			b.WriteString("<boolean>0</boolean>")
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		b.WriteString("<int>" + strconv.FormatInt(v.Int(), 10) + "</int>")
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		b.WriteString("<int>" + strconv.FormatUint(v.Uint(), 10) + "</int>")
+	case reflect.Float32, reflect.Float64:
+		b.WriteString("<double>" + strconv.FormatFloat(v.Float(), 'f', -1, 64) + "</double>")
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8 {
+			b.WriteString("<base64>" + base64.StdEncoding.EncodeToString(v.Bytes()) + "</base64>")
+			return nil
+		}
+		b.WriteString("<array><data>")
+		for i := range v.Len() {
+			if err := writeValue(b, v.Index(i)); err != nil {
+				return err
+			}
+		}
+		b.WriteString("</data></array>")
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return fmt.Errorf("xmlrpc: cannot encode %s", v.Type())
+		}
+		keys := make([]string, 0, v.Len())
+		for _, k := range v.MapKeys() {
+			keys = append(keys, k.String())
+		}
+		sort.Strings(keys)
+		b.WriteString("<struct>")
+		for _, k := range keys {
+			b.WriteString("<member><name>")
+			_ = xml.EscapeText(b, []byte(k))
+			b.WriteString("</name>")
+			if err := writeValue(b, v.MapIndex(reflect.ValueOf(k).Convert(v.Type().Key()))); err != nil {
+				return err
+			}
+			b.WriteString("</member>")
+		}
+		b.WriteString("</struct>")
+	default:
+		return fmt.Errorf("xmlrpc: cannot encode %s", v.Type())
+	}
+	return nil
+}
+
+// xmlValue is a <value> element of any type
+type xmlValue struct {
+	Text     string    `xml:",chardata"`
+	String   *string   `xml:"string"`
+	Int      *string   `xml:"int"`
+	I4       *string   `xml:"i4"`
+	I8       *string   `xml:"i8"`
+	Double   *string   `xml:"double"`
+	Boolean  *string   `xml:"boolean"`
+	DateTime *string   `xml:"dateTime.iso8601"`
+	Base64   *string   `xml:"base64"`
+	Nil      *struct{} `xml:"nil"`
+	Array    *struct {
+		Values []xmlValue `xml:"data>value"`
+	} `xml:"array"`
+	Struct *struct {
+		Members []struct {
+			Name  string   `xml:"name"`
+			Value xmlValue `xml:"value"`
+		} `xml:"member"`
+	} `xml:"struct"`
+}
+
+// decode returns the value as a generic Go value: arrays as []any, structs as
+// map[string]any. Date and base64 values stay strings, like Odoo's JSON-RPC returns them.
+func (x xmlValue) decode() any {
+	switch {
+	case x.String != nil:
+		return *x.String
+	case x.Int != nil, x.I4 != nil, x.I8 != nil:
+		s := firstSet(x.Int, x.I4, x.I8)
+		n, _ := strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+		return n
+	case x.Double != nil:
+		f, _ := strconv.ParseFloat(strings.TrimSpace(*x.Double), 64)
+		return f
+	case x.Boolean != nil:
+		return strings.TrimSpace(*x.Boolean) == "1"
+	case x.DateTime != nil:
+		return strings.TrimSpace(*x.DateTime)
+	case x.Base64 != nil:
+		return strings.Join(strings.Fields(*x.Base64), "")
+	case x.Nil != nil:
+		return nil
+	case x.Array != nil:
+		out := make([]any, len(x.Array.Values))
+		for i, v := range x.Array.Values {
+			out[i] = v.decode()
+		}
+		return out
+	case x.Struct != nil:
+		out := make(map[string]any, len(x.Struct.Members))
+		for _, m := range x.Struct.Members {
+			out[m.Name] = m.Value.decode()
+		}
+		return out
+	}
+	// A value without a type element is a string
+	return x.Text
+}
+
+func firstSet(vals ...*string) string {
+	for _, v := range vals {
+		if v != nil {
+			return *v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,326 @@
+// Package pop3 reads mailboxes that are only reachable over POP3. The protocol has no
+// flags, so the UIDL of every processed message is kept in the state store; with
+// Delete set, processed messages are removed from the server in the next session.
+package pop3
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/anaryk/odoo-helpdesk-bridge/internal/imap"
+	"github.com/anaryk/odoo-helpdesk-bridge/internal/state"
+)
+
+const (
+	defaultTimeout = 30 * time.Second
+
+	// fetchBatch caps the messages downloaded in one session, the rest follow on the next poll
+	fetchBatch = 50
+)
+
+// Config holds the POP3 server settings of a route
+type Config struct {
+	Host     string
+	Port     int // default 995, 110 with StartTLS
+	Username string
+	Password string
+	StartTLS bool // upgrade a plain connection with STLS instead of connecting over TLS
+	Delete   bool // remove processed messages from the server
+	Timeout  time.Duration
+}
+
+// Client fetches new messages from a POP3 mailbox. Each fetch is a session of its
+// own, nothing stays connected between polls.
+type Client struct {
+	cfg    Config
+	parser *imap.Parser
+	st     *state.Store
+
+	// UIDs handed out by the last FetchUnseen, mapped to the UIDL MarkSeen records
+	fetched map[uint32]string
+	nextUID uint32
+	// unreadable UIDLs are logged once and left on the server
+	unreadable map[string]bool
+}
+
+// dial opens the connection to the server; tests swap it for a plain dialer
+var dial = func(addr string, cfg Config) (net.Conn, error) {
+	d := &net.Dialer{Timeout: cfg.Timeout}
+	if cfg.StartTLS {
+		return d.Dial("tcp", addr)
+	}
+	return tls.DialWithDialer(d, "tcp", addr, tlsConfig(cfg))
+}
+
+func tlsConfig(cfg Config) *tls.Config {
+	return &tls.Config{ServerName: cfg.Host, MinVersion: tls.VersionTLS12}
+}
+
+// New checks the login and returns the client. Messages are parsed by the parser,
+// the store remembers which of them were processed.
+func New(cfg Config, parser *imap.Parser, st *state.Store) (*Client, error) {
+	if st == nil {
+		return nil, errors.New("pop3: state store is required")
+	}
+	if cfg.Port == 0 {
+		cfg.Port = 995
+		if cfg.StartTLS {
+			cfg.Port = 110
+		}
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = defaultTimeout
+	}
+	c := &Client{cfg: cfg, parser: parser, st: st, fetched: make(map[uint32]string), unreadable: make(map[string]bool)}
+
+	s, err := c.open(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	if err := s.quit(); err != nil {
+		return nil, err
+	}
+	log.Debug().Str("host", cfg.Host).Str("username", cfg.Username).Msg("POP3 login verified")
+	return c, nil
+}
+
+// Close has nothing to release, sessions end with each fetch
+func (c *Client) Close() error { return nil }
+
+// mailboxKey identifies the mailbox in the state store
+func (c *Client) mailboxKey() string {
+	return c.cfg.Host + "/" + c.cfg.Username
+}
+
+// FetchUnseen downloads the messages whose UIDL has not been processed yet. Processed
+// messages still on the server are deleted first when Delete is set.
+func (c *Client) FetchUnseen(ctx context.Context) ([]imap.Email, error) {
+	seen, err := c.st.GetPOP3Seen(c.mailboxKey())
+	if err != nil {
+		return nil, fmt.Errorf("pop3: load seen UIDLs: %w", err)
+	}
+
+	s, err := c.open(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// Without QUIT the server drops the DELE commands of a failed session
+	defer s.close()
+
+	list, err := s.uidl()
+	if err != nil {
+		return nil, err
+	}
+
+	// A message handed out before and not acknowledged keeps its UID
+	uids := make(map[string]uint32, len(c.fetched))
+	for uid, uidl := range c.fetched {
+		uids[uidl] = uid
+	}
+	fetched := make(map[uint32]string)
+
+	var out []imap.Email
+	onServer := make(map[string]bool, len(list))
+	for _, m := range list {
+		onServer[m.uidl] = true
+		if seen[m.uidl] {
+			if c.cfg.Delete {
+				if _, err := s.cmd("DELE %d", m.num); err != nil {
+					return nil, err
+				}
+			}
+			continue
+		}
+		if c.unreadable[m.uidl] || len(out) >= fetchBatch {
+			continue
+		}
+		raw, err := s.retr(m.num)
+		if err != nil {
+			return nil, err
+		}
+		em, err := c.parser.Parse(c.mailboxKey()+"/pop3-"+m.uidl, raw)
+		if err != nil {
+			c.unreadable[m.uidl] = true
+			log.Error().Err(err).Str("host", c.cfg.Host).Str("uidl", m.uidl).Msg("unreadable POP3 message left on the server")
+			continue
+		}
+		uid, ok := uids[m.uidl]
+		if !ok {
+			c.nextUID++
+			uid = c.nextUID
+		}
+		em.UID = uid
+		fetched[uid] = m.uidl
+		out = append(out, em)
+	}
+
+	if err := s.quit(); err != nil {
+		return nil, err
+	}
+	c.fetched = fetched
+	if err := c.st.PrunePOP3Seen(c.mailboxKey(), onServer); err != nil {
+		log.Error().Err(err).Str("host", c.cfg.Host).Msg("failed to prune POP3 UIDLs")
+	}
+	log.Debug().Str("host", c.cfg.Host).Int("on_server", len(list)).Int("new", len(out)).Msg("POP3 mailbox fetched")
+	return out, nil
+}
+
+// MarkSeen records the message as processed so it is not fetched again
+func (c *Client) MarkSeen(_ context.Context, uid uint32) error {
+	uidl, ok := c.fetched[uid]
+	if !ok {
+		return fmt.Errorf("pop3: unknown message %d", uid)
+	}
+	if err := c.st.MarkPOP3Seen(c.mailboxKey(), uidl); err != nil {
+		return err
+	}
+	delete(c.fetched, uid)
+	return nil
+}
+
+// session is one authenticated POP3 connection
+type session struct {
+	nc      net.Conn
+	tp      *textproto.Conn
+	timeout time.Duration
+}
+
+type listing struct {
+	num  int
+	uidl string
+}
+
+// open connects, upgrades to TLS when configured and logs in
+func (c *Client) open(ctx context.Context) (*session, error) {
+	addr := net.JoinHostPort(c.cfg.Host, strconv.Itoa(c.cfg.Port))
+	nc, err := dial(addr, c.cfg)
+	if err != nil {
+		return nil, fmt.Errorf("pop3: connect %s: %w", addr, err)
+	}
+	s := &session{nc: nc, tp: textproto.NewConn(nc), timeout: c.cfg.Timeout}
+	s.extend()
+	if _, err := s.status(); err != nil {
+		s.close()
+		return nil, err
+	}
+	if c.cfg.StartTLS {
+		if _, err := s.cmd("STLS"); err != nil {
+			s.close()
+			return nil, err
+		}
+		tc := tls.Client(nc, tlsConfig(c.cfg))
+		if err := tc.HandshakeContext(ctx); err != nil {
+			s.close()
+			return nil, fmt.Errorf("pop3: starttls: %w", err)
+		}
+		s.nc, s.tp = tc, textproto.NewConn(tc)
+	}
+	if _, err := s.cmd("USER %s", c.cfg.Username); err != nil {
+		s.close()
+		return nil, err
+	}
+	if _, err := s.cmd("PASS %s", c.cfg.Password); err != nil {
+		s.close()
+		return nil, fmt.Errorf("pop3: login: %w", err)
+	}
+	return s, nil
+}
+
+// extend gives the next command its own timeout, a long download is not cut short
+func (s *session) extend() {
+	_ = s.nc.SetDeadline(time.Now().Add(s.timeout))
+}
+
+// cmd sends a command and returns the text after +OK
+func (s *session) cmd(format string, args ...any) (string, error) {
+	s.extend()
+	if err := s.tp.PrintfLine(format, args...); err != nil {
+		return "", fmt.Errorf("pop3: %w", err)
+	}
+	return s.status()
+}
+
+// status reads a +OK or -ERR response line
+func (s *session) status() (string, error) {
+	line, err := s.tp.ReadLine()
+	if err != nil {
+		return "", fmt.Errorf("pop3: %w", err)
+	}
+	if rest, ok := strings.CutPrefix(line, "+OK"); ok {
+		return strings.TrimSpace(rest), nil
+	}
+	return "", fmt.Errorf("pop3: server error: %s", strings.TrimSpace(strings.TrimPrefix(line, "-ERR")))
+}
+
+// lines reads a multi-line response up to the terminating dot, byte-stuffing removed
+func (s *session) lines() ([]string, error) {
+	var out []string
+	for {
+		line, err := s.tp.ReadLine()
+		if err != nil {
+			return nil, fmt.Errorf("pop3: %w", err)
+		}
+		if line == "." {
+			return out, nil
+		}
+		out = append(out, strings.TrimPrefix(line, "."))
+	}
+}
+
+// uidl lists the messages with their unique IDs
+func (s *session) uidl() ([]listing, error) {
+	if _, err := s.cmd("UIDL"); err != nil {
+		return nil, err
+	}
+	lines, err := s.lines()
+	if err != nil {
+		return nil, err
+	}
+	out := make([]listing, 0, len(lines))
+	for _, l := range lines {
+		num, uidl, ok := strings.Cut(strings.TrimSpace(l), " ")
+		n, err := strconv.Atoi(num)
+		if !ok || err != nil || uidl == "" {
+			return nil, fmt.Errorf("pop3: bad UIDL line %q", l)
+		}
+		out = append(out, listing{num: n, uidl: strings.TrimSpace(uidl)})
+	}
+	return out, nil
+}
+
+// retr downloads a message with CRLF line endings
+func (s *session) retr(num int) ([]byte, error) {
+	if _, err := s.cmd("RETR %d", num); err != nil {
+		return nil, err
+	}
+	lines, err := s.lines()
+	if err != nil {
+		return nil, err
+	}
+	var raw strings.Builder
+	for _, l := range lines {
+		raw.WriteString(l)
+		raw.WriteString("\r\n")
+	}
+	return []byte(raw.String()), nil
+}
+
+// quit ends the session, the server applies DELE commands only now
+func (s *session) quit() error {
+	_, err := s.cmd("QUIT")
+	s.close()
+	return err
+}
+
+func (s *session) close() {
+	_ = s.nc.Close()
+}
@@ -0,0 +1,268 @@
+package pop3
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/anaryk/odoo-helpdesk-bridge/internal/imap"
+	"github.com/anaryk/odoo-helpdesk-bridge/internal/state"
+)
+
+type fakeMessage struct {
+	uidl, raw string
+}
+
+// fakeServer is a POP3 mailbox that applies DELE only when a session ends with QUIT
+type fakeServer struct {
+	mu       sync.Mutex
+	password string
+	messages []fakeMessage
+	retrs    int
+}
+
+func (f *fakeServer) listen(t *testing.T) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { _ = l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go f.serve(conn)
+		}
+	}()
+	return l.Addr().String()
+}
+
+func (f *fakeServer) serve(conn net.Conn) {
+	defer func() { _ = conn.Close() }()
+	r := bufio.NewReader(conn)
+	reply := func(s string) { _, _ = fmt.Fprint(conn, s+"\r\n") }
+	reply("+OK fake POP3 ready")
+
+	f.mu.Lock()
+	msgs := append([]fakeMessage(nil), f.messages...)
+	f.mu.Unlock()
+	deleted := make(map[int]bool)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		cmd, arg, _ := strings.Cut(strings.TrimSpace(line), " ")
+		var n int
+		_, _ = fmt.Sscan(arg, &n)
+		switch cmd {
+		case "USER":
+			reply("+OK")
+		case "PASS":
+			if arg != f.password {
+				reply("-ERR invalid login")
+				continue
+			}
+			reply("+OK logged in")
+		case "UIDL":
+			reply("+OK")
+			for i, m := range msgs {
+				if !deleted[i+1] {
+					reply(fmt.Sprintf("%d %s", i+1, m.uidl))
+				}
+			}
+			reply(".")
+		case "RETR":
+			f.mu.Lock()
+			f.retrs++
+			f.mu.Unlock()
+			reply("+OK")
+			for _, l := range strings.Split(msgs[n-1].raw, "\r\n") {
+				if strings.HasPrefix(l, ".") {
+					l = "." + l
+				}
+				reply(l)
+			}
+			reply(".")
+		case "DELE":
+			deleted[n] = true
+			reply("+OK deleted")
+		case "QUIT":
+			f.mu.Lock()
+			var keep []fakeMessage
+			for i, m := range msgs {
+				if !deleted[i+1] {
+					keep = append(keep, m)
+				}
+			}
+			f.messages = keep
+			f.mu.Unlock()
+			reply("+OK bye")
+			return
+		default:
+			reply("-ERR unknown command")
+		}
+	}
+}
+
+// connect points a client at the fake server over plain TCP
+func connect(t *testing.T, f *fakeServer, cfg Config) (*Client, *state.Store, error) {
+	t.Helper()
+	host, port, _ := net.SplitHostPort(f.listen(t))
+	orig := dial
+	dial = func(addr string, _ Config) (net.Conn, error) { return net.Dial("tcp", addr) }
+	t.Cleanup(func() { dial = orig })
+
+	st, err := state.New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("state.New() error = %v", err)
+	}
+	t.Cleanup(func() { _ = st.Close() })
+	parser, err := imap.NewParser(imap.Config{})
+	if err != nil {
+		t.Fatalf("NewParser() error = %v", err)
+	}
+	cfg.Host, cfg.Username = host, "support"
+	cfg.Port, _ = strconv.Atoi(port)
+	c, err := New(cfg, parser, st)
+	return c, st, err
+}
+
+func newClient(t *testing.T, f *fakeServer, del bool) (*Client, *state.Store) {
+	t.Helper()
+	c, st, err := connect(t, f, Config{Password: "secret", Delete: del})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	return c, st
+}
+
+func message(subject, body string) string {
+	return "From: Jan Novak <jan@example.com>\r\nTo: support@example.com\r\nSubject: " + subject +
+		"\r\nMessage-ID: <" + strings.ReplaceAll(subject, " ", "") + "@example.com>\r\n\r\n" + body
+}
+
+func TestClient_FetchAndMarkSeen(t *testing.T) {
+	f := &fakeServer{password: "secret", messages: []fakeMessage{
+		{"uid-1", message("First", "Hello\r\n.dotted line\r\n")},
+		{"uid-2", message("Second", "World\r\n")},
+	}}
+	c, _ := newClient(t, f, false)
+	ctx := context.Background()
+
+	got, err := c.FetchUnseen(ctx)
+	if err != nil {
+		t.Fatalf("FetchUnseen() error = %v", err)
+	}
+	if len(got) != 2 || got[0].Subject != "First" || got[1].Subject != "Second" {
+		t.Fatalf("FetchUnseen() = %+v", got)
+	}
+	if !strings.Contains(got[0].Body, "\n.dotted line") || got[0].FromEmail != "jan@example.com" {
+		t.Errorf("first message body = %q from %q", got[0].Body, got[0].FromEmail)
+	}
+	if got[0].ID == got[1].ID || !strings.HasSuffix(got[0].ID, "/pop3-uid-1") {
+		t.Errorf("IDs = %q, %q", got[0].ID, got[1].ID)
+	}
+
+	if err := c.MarkSeen(ctx, got[0].UID); err != nil {
+		t.Fatalf("MarkSeen() error = %v", err)
+	}
+	if err := c.MarkSeen(ctx, got[0].UID); err == nil {
+		t.Error("MarkSeen() of an acknowledged message should fail")
+	}
+	again, err := c.FetchUnseen(ctx)
+	if err != nil || len(again) != 1 || again[0].Subject != "Second" {
+		t.Fatalf("second FetchUnseen() = %+v, %v", again, err)
+	}
+	if len(f.messages) != 2 || f.retrs != 3 {
+		t.Errorf("%d messages left after %d downloads, want 2 after 3", len(f.messages), f.retrs)
+	}
+	if again[0].UID != got[1].UID || len(c.fetched) != 1 {
+		t.Errorf("second message UID %d, want %d kept; %d messages tracked", again[0].UID, got[1].UID, len(c.fetched))
+	}
+}
+
+func TestClient_FetchWithoutMarkSeen(t *testing.T) {
+	f := &fakeServer{password: "secret", messages: []fakeMessage{
+		{"uid-1", message("First", "Hello\r\n")},
+		{"uid-2", message("Second", "World\r\n")},
+	}}
+	c, _ := newClient(t, f, false)
+	ctx := context.Background()
+
+	// While Odoo is down nothing is acknowledged, every poll fetches the same mail
+	first, err := c.FetchUnseen(ctx)
+	if err != nil || len(first) != 2 {
+		t.Fatalf("FetchUnseen() = %+v, %v", first, err)
+	}
+	for range 5 {
+		got, err := c.FetchUnseen(ctx)
+		if err != nil || len(got) != 2 || got[0].UID != first[0].UID || got[1].UID != first[1].UID {
+			t.Fatalf("repeated FetchUnseen() = %+v, %v, want the same UIDs", got, err)
+		}
+	}
+	if len(c.fetched) != 2 {
+		t.Errorf("%d messages tracked, want 2", len(c.fetched))
+	}
+
+	// A message deleted by another client is forgotten
+	f.mu.Lock()
+	f.messages = f.messages[1:]
+	f.mu.Unlock()
+	if _, err := c.FetchUnseen(ctx); err != nil || len(c.fetched) != 1 {
+		t.Errorf("after a deletion %d messages tracked, %v", len(c.fetched), err)
+	}
+	if err := c.MarkSeen(ctx, first[1].UID); err != nil {
+		t.Errorf("MarkSeen() error = %v", err)
+	}
+}
+
+func TestClient_Delete(t *testing.T) {
+	f := &fakeServer{password: "secret", messages: []fakeMessage{
+		{"uid-1", message("First", "Hello\r\n")},
+		{"uid-2", message("Second", "World\r\n")},
+	}}
+	c, st := newClient(t, f, true)
+	ctx := context.Background()
+
+	got, err := c.FetchUnseen(ctx)
+	if err != nil || len(got) != 2 {
+		t.Fatalf("FetchUnseen() = %+v, %v", got, err)
+	}
+	if err := c.MarkSeen(ctx, got[1].UID); err != nil {
+		t.Fatalf("MarkSeen() error = %v", err)
+	}
+
+	// The processed message is removed in the next session, the other is fetched again
+	again, err := c.FetchUnseen(ctx)
+	if err != nil || len(again) != 1 || again[0].Subject != "First" {
+		t.Fatalf("second FetchUnseen() = %+v, %v", again, err)
+	}
+	if len(f.messages) != 1 || f.messages[0].uidl != "uid-1" {
+		t.Errorf("server messages = %+v", f.messages)
+	}
+
+	// Once gone from the server its UIDL is forgotten
+	if _, err := c.FetchUnseen(ctx); err != nil {
+		t.Fatalf("third FetchUnseen() error = %v", err)
+	}
+	if seen, _ := st.GetPOP3Seen(c.mailboxKey()); len(seen) != 0 {
+		t.Errorf("seen UIDLs = %v, want none", seen)
+	}
+}
+
+func TestClient_LoginFailure(t *testing.T) {
+	f := &fakeServer{password: "other"}
+	if _, _, err := connect(t, f, Config{Password: "secret"}); err == nil || !strings.Contains(err.Error(), "invalid login") {
+		t.Errorf("New() error = %v, want login failure", err)
+	}
+}
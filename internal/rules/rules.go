@@ -0,0 +1,167 @@
+// Package rules routes new tickets to projects, stages and people by declarative match rules.
+package rules
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/anaryk/odoo-helpdesk-bridge/internal/attach"
+	"github.com/anaryk/odoo-helpdesk-bridge/internal/config"
+	"github.com/anaryk/odoo-helpdesk-bridge/internal/imap"
+)
+
+// Decision is what the matching rule asks for. The zero value keeps the route's defaults.
+type Decision struct {
+	Rule string // name of the rule that fired, empty when none did
+	config.RuleActions
+}
+
+// Engine evaluates the configured rules in order, the first matching rule wins.
+type Engine struct {
+	rules  []rule
+	dryRun bool
+}
+
+type rule struct {
+	name    string
+	from    []string
+	subject *regexp.Regexp
+	body    *regexp.Regexp
+	types   []string
+	headers map[string]*regexp.Regexp
+	set     config.RuleActions
+}
+
+// New compiles the rules. In dry run the engine only logs which rule would fire.
+func New(cfgs []config.Rule, dryRun bool) (*Engine, error) {
+	e := &Engine{dryRun: dryRun}
+	for i, rc := range cfgs {
+		r := rule{name: rc.Name, set: rc.Set}
+		if r.name == "" {
+			r.name = fmt.Sprintf("rule%d", i+1)
+		}
+		var err error
+		if r.subject, err = compile(rc.Match.Subject); err != nil {
+			return nil, fmt.Errorf("rule %s subject: %w", r.name, err)
+		}
+		if r.body, err = compile(rc.Match.Body); err != nil {
+			return nil, fmt.Errorf("rule %s body: %w", r.name, err)
+		}
+		for name, p := range rc.Match.Headers {
+			re, err := compile(p)
+			if err != nil {
+				return nil, fmt.Errorf("rule %s header %s: %w", r.name, name, err)
+			}
+			if r.headers == nil {
+				r.headers = make(map[string]*regexp.Regexp)
+			}
+			r.headers[name] = re
+		}
+		for _, f := range rc.Match.From {
+			r.from = append(r.from, strings.ToLower(strings.TrimSpace(f)))
+		}
+		for _, t := range rc.Match.AttachmentTypes {
+			r.types = append(r.types, strings.ToLower(strings.TrimSpace(t)))
+		}
+		e.rules = append(e.rules, r)
+	}
+	return e, nil
+}
+
+func compile(p string) (*regexp.Regexp, error) {
+	if p == "" {
+		return nil, nil
+	}
+	return regexp.Compile(p)
+}
+
+// Decide returns the actions of the first rule the mail matches and logs which rule fired.
+func (e *Engine) Decide(em imap.Email) Decision {
+	if e == nil {
+		return Decision{}
+	}
+	for _, r := range e.rules {
+		if !r.matches(em) {
+			continue
+		}
+		log.Info().Str("rule", r.name).Str("from", em.FromEmail).Str("subject", em.Subject).Bool("dry_run", e.dryRun).
+			Int64("project_id", r.set.ProjectID).Int64("stage_id", r.set.StageID).Strs("tags", r.set.Tags).
+			Str("assignee", r.set.Assignee).Strs("team", r.set.Team).Str("slack_channel", r.set.SlackChannel).
+			Bool("no_confirmation", r.set.NoConfirmation).Msg("routing rule matched")
+		if e.dryRun {
+			return Decision{}
+		}
+		return Decision{Rule: r.name, RuleActions: r.set}
+	}
+	log.Debug().Str("from", em.FromEmail).Str("subject", em.Subject).Msg("no routing rule matched")
+	return Decision{}
+}
+
+// matches reports whether every condition of the rule holds
+func (r *rule) matches(em imap.Email) bool {
+	if len(r.from) > 0 && !matchSender(em.FromEmail, r.from) {
+		return false
+	}
+	if r.subject != nil && !r.subject.MatchString(em.Subject) {
+		return false
+	}
+	if r.body != nil && !r.body.MatchString(em.Stripped) {
+		return false
+	}
+	if len(r.types) > 0 && !r.matchAttachments(em.Attachments) {
+		return false
+	}
+	for name, re := range r.headers {
+		if !matchHeader(em, name, re) {
+			return false
+		}
+	}
+	return true
+}
+
+func (r *rule) matchAttachments(atts []imap.Attachment) bool {
+	for _, att := range atts {
+		if attach.MatchType(att, r.types) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchHeader matches any value of the header, a missing header never matches
+func matchHeader(em imap.Email, name string, re *regexp.Regexp) bool {
+	for k, values := range em.Headers {
+		if !strings.EqualFold(k, name) {
+			continue
+		}
+		for _, v := range values {
+			if re.MatchString(v) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// matchSender uses the wildcard forms of excluded_emails: exact, "*@domain" and "prefix@*"
+func matchSender(addr string, patterns []string) bool {
+	addr = strings.ToLower(addr)
+	for _, p := range patterns {
+		switch {
+		case strings.HasPrefix(p, "*"):
+			if strings.HasSuffix(addr, strings.TrimPrefix(p, "*")) {
+				return true
+			}
+		case strings.HasSuffix(p, "*"):
+			if strings.HasPrefix(addr, strings.TrimSuffix(p, "*")) {
+				return true
+			}
+		case p == addr:
+			return true
+		}
+	}
+	return false
+}
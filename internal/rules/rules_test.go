@@ -0,0 +1,112 @@
+package rules
+
+import (
+	"net/mail"
+	"testing"
+
+	"github.com/anaryk/odoo-helpdesk-bridge/internal/config"
+	"github.com/anaryk/odoo-helpdesk-bridge/internal/imap"
+)
+
+func testRules() []config.Rule {
+	return []config.Rule{
+		{
+			Name:  "vip",
+			Match: config.RuleMatch{From: []string{"*@BigCorp.example.com"}},
+			Set:   config.RuleActions{Priority: "1", Tags: []string{"vip"}, Assignee: "boss@example.com"},
+		},
+		{
+			Name: "invoices",
+			Match: config.RuleMatch{
+				Subject:         `(?i)faktur|invoice`,
+				AttachmentTypes: []string{"application/pdf", ".isdoc"},
+			},
+			Set: config.RuleActions{ProjectID: 20, StageID: 5, SlackChannel: "C0BILLING", NoConfirmation: true},
+		},
+		{
+			Name:  "monitoring",
+			Match: config.RuleMatch{Headers: map[string]string{"x-mailer": `^Zabbix`}, Body: `(?i)problem`},
+			Set:   config.RuleActions{Team: []string{"ops1@example.com", "ops2@example.com"}},
+		},
+	}
+}
+
+func TestEngine_Decide(t *testing.T) {
+	e, err := New(testRules(), false)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	tests := []struct {
+		name string
+		em   imap.Email
+		want string
+	}{
+		{
+			name: "sender domain",
+			em:   imap.Email{FromEmail: "ceo@bigcorp.example.com", Subject: "Invoice", Attachments: []imap.Attachment{{Filename: "a.pdf", ContentType: "application/pdf"}}},
+			want: "vip", // the first matching rule wins
+		},
+		{
+			name: "subject and attachment type",
+			em:   imap.Email{FromEmail: "a@customer.example.org", Subject: "Faktura 2024/17", Attachments: []imap.Attachment{{Filename: "f.pdf", ContentType: "application/pdf"}}},
+			want: "invoices",
+		},
+		{
+			name: "attachment extension",
+			em:   imap.Email{FromEmail: "a@customer.example.org", Subject: "Invoice", Attachments: []imap.Attachment{{Filename: "F.ISDOC", ContentType: "application/octet-stream"}}},
+			want: "invoices",
+		},
+		{
+			name: "subject without attachment",
+			em:   imap.Email{FromEmail: "a@customer.example.org", Subject: "Invoice"},
+			want: "",
+		},
+		{
+			name: "header and body",
+			em:   imap.Email{FromEmail: "zabbix@example.com", Stripped: "Problem: disk full", Headers: mail.Header{"X-Mailer": {"Zabbix 6.0"}}},
+			want: "monitoring",
+		},
+		{
+			name: "missing header",
+			em:   imap.Email{FromEmail: "zabbix@example.com", Stripped: "Problem: disk full"},
+			want: "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := e.Decide(tt.em).Rule; got != tt.want {
+				t.Errorf("Decide() rule = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	d := e.Decide(imap.Email{FromEmail: "a@customer.example.org", Subject: "invoice", Attachments: []imap.Attachment{{ContentType: "application/pdf"}}})
+	if d.ProjectID != 20 || d.StageID != 5 || d.SlackChannel != "C0BILLING" || !d.NoConfirmation {
+		t.Errorf("Decide() actions = %+v", d.RuleActions)
+	}
+}
+
+func TestEngine_DryRun(t *testing.T) {
+	e, err := New(testRules(), true)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	d := e.Decide(imap.Email{FromEmail: "ceo@bigcorp.example.com"})
+	if d.Rule != "" || d.Priority != "" || d.Assignee != "" {
+		t.Errorf("dry run must not apply the rule, got %+v", d)
+	}
+
+	// Without rules the defaults are kept
+	var none *Engine
+	if d := none.Decide(imap.Email{FromEmail: "ceo@bigcorp.example.com"}); d.Rule != "" {
+		t.Errorf("nil engine decided %+v", d)
+	}
+}
+
+func TestNew_InvalidRegex(t *testing.T) {
+	_, err := New([]config.Rule{{Name: "broken", Match: config.RuleMatch{Subject: "([a"}}}, false)
+	if err == nil {
+		t.Error("expected error for invalid subject regex")
+	}
+}
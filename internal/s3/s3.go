@@ -0,0 +1,253 @@
+// Package s3 stores files in an S3 compatible object store such as MinIO or AWS S3.
+// Requests are signed with AWS Signature Version 4 and use path-style URLs.
+package s3
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	algorithm   = "AWS4-HMAC-SHA256"
+	service     = "s3"
+	amzDate     = "20060102T150405Z"
+	scopeDate   = "20060102"
+	unsignedSHA = "UNSIGNED-PAYLOAD"
+
+	// maxLinkExpiry is the longest validity SigV4 allows for a presigned URL
+	maxLinkExpiry = 7 * 24 * time.Hour
+)
+
+// Config holds the object store connection
+type Config struct {
+	Endpoint  string // e.g. https://s3.eu-central-1.amazonaws.com or http://minio:9000
+	Region    string
+	Bucket    string
+	AccessKey string
+	SecretKey string
+
+	// PublicURL is the base of links to stored objects when the bucket is readable
+	// without credentials; otherwise links are presigned for LinkExpiry
+	PublicURL  string
+	LinkExpiry time.Duration
+	Timeout    time.Duration
+}
+
+// Client uploads objects and links to them
+type Client struct {
+	cfg      Config
+	endpoint *url.URL
+	http     *http.Client
+	now      func() time.Time
+}
+
+// New checks the configuration, no request is made yet
+func New(cfg Config) (*Client, error) {
+	u, err := url.Parse(strings.TrimRight(cfg.Endpoint, "/"))
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("invalid endpoint %q", cfg.Endpoint)
+	}
+	if cfg.Bucket == "" || cfg.AccessKey == "" || cfg.SecretKey == "" {
+		return nil, errors.New("bucket, access key and secret key are required")
+	}
+	if cfg.Region == "" {
+		cfg.Region = "us-east-1"
+	}
+	if cfg.LinkExpiry <= 0 || cfg.LinkExpiry > maxLinkExpiry {
+		cfg.LinkExpiry = maxLinkExpiry
+	}
+	timeout := cfg.Timeout
+	if timeout == 0 {
+		timeout = 5 * time.Minute
+	}
+	return &Client{cfg: cfg, endpoint: u, http: &http.Client{Timeout: timeout}, now: time.Now}, nil
+}
+
+// Put uploads an object
+func (c *Client) Put(ctx context.Context, key, contentType string, data []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, c.objectURL(key).String(), bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	sum := sha256.Sum256(data)
+	c.sign(req, hex.EncodeToString(sum[:]), c.now())
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("put %s: %w", key, err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("put %s: %s: %s", key, resp.Status, strings.TrimSpace(string(body)))
+	}
+	log.Debug().Str("bucket", c.cfg.Bucket).Str("key", key).Int("size", len(data)).Msg("object stored")
+	return nil
+}
+
+// URL returns a link to the object, presigned unless a public URL is configured
+func (c *Client) URL(key string) string {
+	if c.cfg.PublicURL != "" {
+		return strings.TrimRight(c.cfg.PublicURL, "/") + "/" + encodePath(key)
+	}
+	return c.presign(c.objectURL(key), c.cfg.LinkExpiry, c.now())
+}
+
+// LinkExpiry is how long links returned by URL stay valid, zero for public links
+func (c *Client) LinkExpiry() time.Duration {
+	if c.cfg.PublicURL != "" {
+		return 0
+	}
+	return c.cfg.LinkExpiry
+}
+
+func (c *Client) objectURL(key string) *url.URL {
+	u := *c.endpoint
+	u.Path = u.Path + "/" + c.cfg.Bucket + "/" + key
+	u.RawPath = c.endpoint.EscapedPath() + "/" + encodePath(c.cfg.Bucket) + "/" + encodePath(key)
+	return &u
+}
+
+// sign adds the SigV4 Authorization header. Host and every header already set are signed.
+func (c *Client) sign(req *http.Request, payloadHash string, t time.Time) {
+	t = t.UTC()
+	req.Header.Set("X-Amz-Date", t.Format(amzDate))
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	names := []string{"host"}
+	values := map[string]string{"host": req.URL.Host}
+	for k, v := range req.Header {
+		name := strings.ToLower(k)
+		names = append(names, name)
+		values[name] = strings.Join(v, ",")
+	}
+	sort.Strings(names)
+	var canonHeaders strings.Builder
+	for _, name := range names {
+		canonHeaders.WriteString(name + ":" + strings.TrimSpace(values[name]) + "\n")
+	}
+	signed := strings.Join(names, ";")
+
+	canonical := strings.Join([]string{
+		req.Method,
+		canonicalURI(req.URL),
+		canonicalQuery(req.URL.Query()),
+		canonHeaders.String(),
+		signed,
+		payloadHash,
+	}, "\n")
+	scope := c.scope(t)
+	sig := c.signature(t, scope, canonical)
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s,SignedHeaders=%s,Signature=%s", algorithm, c.cfg.AccessKey, scope, signed, sig))
+}
+
+// presign returns a GET URL carrying its signature in the query
+func (c *Client) presign(u *url.URL, expiry time.Duration, t time.Time) string {
+	t = t.UTC()
+	scope := c.scope(t)
+	q := u.Query()
+	q.Set("X-Amz-Algorithm", algorithm)
+	q.Set("X-Amz-Credential", c.cfg.AccessKey+"/"+scope)
+	q.Set("X-Amz-Date", t.Format(amzDate))
+	q.Set("X-Amz-Expires", strconv.Itoa(int(expiry.Seconds())))
+	q.Set("X-Amz-SignedHeaders", "host")
+
+	canonical := strings.Join([]string{
+		http.MethodGet,
+		canonicalURI(u),
+		canonicalQuery(q),
+		"host:" + u.Host + "\n",
+		"host",
+		unsignedSHA,
+	}, "\n")
+	q.Set("X-Amz-Signature", c.signature(t, scope, canonical))
+
+	signed := *u
+	signed.RawQuery = canonicalQuery(q)
+	return signed.String()
+}
+
+func (c *Client) scope(t time.Time) string {
+	return t.Format(scopeDate) + "/" + c.cfg.Region + "/" + service + "/aws4_request"
+}
+
+func (c *Client) signature(t time.Time, scope, canonical string) string {
+	hash := sha256.Sum256([]byte(canonical))
+	toSign := algorithm + "\n" + t.Format(amzDate) + "\n" + scope + "\n" + hex.EncodeToString(hash[:])
+
+	key := hmacSHA256([]byte("AWS4"+c.cfg.SecretKey), t.Format(scopeDate))
+	key = hmacSHA256(key, c.cfg.Region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	return hex.EncodeToString(hmacSHA256(key, toSign))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+func canonicalURI(u *url.URL) string {
+	if p := u.EscapedPath(); p != "" {
+		return p
+	}
+	return "/"
+}
+
+func canonicalQuery(q url.Values) string {
+	keys := make([]string, 0, len(q))
+	for k := range q {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var parts []string
+	for _, k := range keys {
+		vs := append([]string(nil), q[k]...)
+		sort.Strings(vs)
+		for _, v := range vs {
+			parts = append(parts, uriEncode(k, true)+"="+uriEncode(v, true))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// encodePath escapes an object key, keeping the slashes
+func encodePath(key string) string {
+	return uriEncode(key, false)
+}
+
+// uriEncode is the SigV4 URI encoding: everything but A-Z, a-z, 0-9 and -._~ is escaped
+func uriEncode(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+		switch {
+		case ch >= 'A' && ch <= 'Z', ch >= 'a' && ch <= 'z', ch >= '0' && ch <= '9',
+			ch == '-', ch == '.', ch == '_', ch == '~':
+			b.WriteByte(ch)
+		case ch == '/' && !encodeSlash:
+			b.WriteByte(ch)
+		default:
+			fmt.Fprintf(&b, "%%%02X", ch)
+		}
+	}
+	return b.String()
+}
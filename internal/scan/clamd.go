@@ -0,0 +1,128 @@
+package scan
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// chunkSize is the size of the INSTREAM chunks, clamd reads at most StreamMaxLength in total
+	chunkSize = 64 << 10
+	// defaultTimeout bounds a single scan
+	defaultTimeout = time.Minute
+)
+
+// Clamd scans files with a clamd daemon using the INSTREAM command
+type Clamd struct {
+	network string
+	address string
+	timeout time.Duration
+}
+
+// NewClamd creates a scanner for the daemon at addr: tcp://host:3310, unix:///path/clamd.ctl,
+// host:port or a socket path. No connection is made until the first Scan.
+func NewClamd(addr string, timeout time.Duration) (*Clamd, error) {
+	c := &Clamd{timeout: timeout}
+	if c.timeout <= 0 {
+		c.timeout = defaultTimeout
+	}
+	switch {
+	case strings.HasPrefix(addr, "unix://"):
+		c.network, c.address = "unix", strings.TrimPrefix(addr, "unix://")
+	case strings.HasPrefix(addr, "tcp://"):
+		c.network, c.address = "tcp", strings.TrimPrefix(addr, "tcp://")
+	case strings.HasPrefix(addr, "/"):
+		c.network, c.address = "unix", addr
+	default:
+		c.network, c.address = "tcp", addr
+	}
+	if c.address == "" {
+		return nil, fmt.Errorf("invalid clamd address %q", addr)
+	}
+	if c.network == "tcp" {
+		if _, _, err := net.SplitHostPort(c.address); err != nil {
+			return nil, fmt.Errorf("invalid clamd address %q: %w", addr, err)
+		}
+	}
+	return c, nil
+}
+
+// Scan streams the file to clamd
+func (c *Clamd) Scan(ctx context.Context, name string, r io.Reader) (Result, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, c.network, c.address)
+	if err != nil {
+		return Result{}, fmt.Errorf("clamd: %w", err)
+	}
+	defer func() { _ = conn.Close() }()
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	// clamd may stop reading and answer early, e.g. when the stream is over its limit
+	writeErr := stream(conn, r)
+	reply, err := bufio.NewReader(conn).ReadString(0)
+	if err != nil && reply == "" {
+		if writeErr != nil {
+			return Result{}, fmt.Errorf("clamd: %w", writeErr)
+		}
+		return Result{}, fmt.Errorf("clamd: read reply: %w", err)
+	}
+
+	res, err := parseReply(reply)
+	if err != nil {
+		return Result{}, err
+	}
+	log.Debug().Str("file", name).Bool("infected", res.Infected).Str("signature", res.Signature).Msg("clamd scan")
+	return res, nil
+}
+
+// stream sends the INSTREAM command: length-prefixed chunks ended by a zero length
+func stream(w io.Writer, r io.Reader) error {
+	if _, err := io.WriteString(w, "zINSTREAM\x00"); err != nil {
+		return err
+	}
+	buf := make([]byte, 4+chunkSize)
+	for {
+		n, err := io.ReadFull(r, buf[4:])
+		if n > 0 {
+			binary.BigEndian.PutUint32(buf[:4], uint32(n))
+			if _, werr := w.Write(buf[:4+n]); werr != nil {
+				return werr
+			}
+		}
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+	_, err := w.Write([]byte{0, 0, 0, 0})
+	return err
+}
+
+// parseReply reads "stream: OK", "stream: <signature> FOUND" or "<message> ERROR"
+func parseReply(reply string) (Result, error) {
+	reply = strings.TrimSpace(strings.TrimRight(reply, "\x00"))
+	verdict := strings.TrimSpace(strings.TrimPrefix(reply, "stream:"))
+	switch {
+	case verdict == "OK":
+		return Result{}, nil
+	case strings.HasSuffix(verdict, " FOUND"):
+		return Result{Infected: true, Signature: strings.TrimSuffix(verdict, " FOUND")}, nil
+	}
+	return Result{}, fmt.Errorf("clamd: %s", strings.TrimSuffix(verdict, " ERROR"))
+}
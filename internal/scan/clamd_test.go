@@ -0,0 +1,119 @@
+package scan
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"testing"
+)
+
+// eicar is the standard antivirus test file
+const eicar = `X5O!P%@AP[4\PZX54(P^)7CC)7}$EICAR-STANDARD-ANTIVIRUS-TEST-FILE!$H+H*`
+
+// fakeClamd answers INSTREAM like clamd: EICAR is found, streams over maxLen are refused
+func fakeClamd(t *testing.T, maxLen int) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { _ = l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go serveClamd(conn, maxLen)
+		}
+	}()
+	return "tcp://" + l.Addr().String()
+}
+
+func serveClamd(conn net.Conn, maxLen int) {
+	defer func() { _ = conn.Close() }()
+	r := bufio.NewReader(conn)
+	if cmd, err := r.ReadString(0); err != nil || cmd != "zINSTREAM\x00" {
+		_, _ = io.WriteString(conn, "UNKNOWN COMMAND\x00")
+		return
+	}
+	var data bytes.Buffer
+	for {
+		var size uint32
+		if err := binary.Read(r, binary.BigEndian, &size); err != nil {
+			return
+		}
+		if size == 0 {
+			break
+		}
+		if data.Len()+int(size) > maxLen {
+			_, _ = io.WriteString(conn, "INSTREAM size limit exceeded. ERROR\x00")
+			return
+		}
+		if _, err := io.CopyN(&data, r, int64(size)); err != nil {
+			return
+		}
+	}
+	if bytes.Contains(data.Bytes(), []byte(eicar)) {
+		_, _ = io.WriteString(conn, "stream: Win.Test.EICAR_HDB-1 FOUND\x00")
+		return
+	}
+	_, _ = io.WriteString(conn, "stream: OK\x00")
+}
+
+func TestClamd_Scan(t *testing.T) {
+	c, err := NewClamd(fakeClamd(t, 1<<20), 0)
+	if err != nil {
+		t.Fatalf("NewClamd() error = %v", err)
+	}
+	ctx := context.Background()
+
+	res, err := c.Scan(ctx, "clean.txt", strings.NewReader(strings.Repeat("hello ", 50000)))
+	if err != nil || res.Infected {
+		t.Errorf("clean file: %+v, %v", res, err)
+	}
+
+	res, err = c.Scan(ctx, "eicar.com", strings.NewReader(eicar))
+	if err != nil || !res.Infected || res.Signature != "Win.Test.EICAR_HDB-1" {
+		t.Errorf("eicar: %+v, %v", res, err)
+	}
+
+	_, err = c.Scan(ctx, "huge.bin", bytes.NewReader(make([]byte, 2<<20)))
+	if err == nil || !strings.Contains(err.Error(), "size limit exceeded") {
+		t.Errorf("huge file error = %v", err)
+	}
+}
+
+func TestNewClamd(t *testing.T) {
+	tests := []struct {
+		addr, network, address string
+	}{
+		{"tcp://clamav:3310", "tcp", "clamav:3310"},
+		{"clamav:3310", "tcp", "clamav:3310"},
+		{"unix:///run/clamav/clamd.ctl", "unix", "/run/clamav/clamd.ctl"},
+		{"/run/clamav/clamd.ctl", "unix", "/run/clamav/clamd.ctl"},
+	}
+	for _, tt := range tests {
+		c, err := NewClamd(tt.addr, 0)
+		if err != nil || c.network != tt.network || c.address != tt.address {
+			t.Errorf("NewClamd(%q) = %+v, %v", tt.addr, c, err)
+		}
+	}
+	for _, bad := range []string{"", "clamav", "tcp://"} {
+		if _, err := NewClamd(bad, 0); err == nil {
+			t.Errorf("NewClamd(%q) expected error", bad)
+		}
+	}
+
+	c, err := NewClamd("127.0.0.1:1", 0)
+	if err != nil {
+		t.Fatalf("NewClamd() error = %v", err)
+	}
+	if _, err := c.Scan(context.Background(), "x", strings.NewReader("x")); err == nil {
+		t.Error("expected error when clamd is down")
+	}
+}
@@ -0,0 +1,18 @@
+// Package scan checks mail attachments for malware before they are stored.
+package scan
+
+import (
+	"context"
+	"io"
+)
+
+// Result is the verdict on one file
+type Result struct {
+	Infected  bool
+	Signature string // name of the detected malware, empty when clean
+}
+
+// Scanner checks a file; an error means the file could not be checked, not that it is infected
+type Scanner interface {
+	Scan(ctx context.Context, name string, r io.Reader) (Result, error)
+}
@@ -39,9 +39,15 @@ func New(cfg *config.Config, odooClient *odoo.Client, slackClient *slack.Client,
 
 // InitializeTask creates initial SLA state when a new task is created
 func (h *Handler) InitializeTask(taskID int64) error {
+	return h.InitializeTaskAt(taskID, time.Now())
+}
+
+// InitializeTaskAt starts the SLA clocks of a new task at the given time, used when
+// older mail is ingested with its original date
+func (h *Handler) InitializeTaskAt(taskID int64, createdAt time.Time) error {
 	slaState := state.SLAState{
 		TaskID:    taskID,
-		CreatedAt: time.Now(),
+		CreatedAt: createdAt,
 	}
 	return h.state.StoreSLAState(slaState)
 }
@@ -167,5 +173,9 @@ func (h *Handler) notifySlackSLAViolation(task *odoo.Task, violationType string)
 		Channel:   slackMsg.Channel,
 	}
 
-	return h.slackClient.NotifySLAViolation(parentMsg, int(task.ID), task.Name, violationType)
+	sl := h.slackClient
+	if slackMsg.RuleChannel != "" {
+		sl = sl.WithChannel(slackMsg.RuleChannel)
+	}
+	return sl.NotifySLAViolation(parentMsg, int(task.ID), task.Name, violationType)
 }
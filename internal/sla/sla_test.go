@@ -106,6 +106,27 @@ func TestHandler_InitializeTask(t *testing.T) {
 	}
 }
 
+func TestHandler_InitializeTaskAt(t *testing.T) {
+	store, err := state.New(t.TempDir() + "/test.db")
+	if err != nil {
+		t.Fatalf("Failed to create state store: %v", err)
+	}
+	defer func() { _ = store.Close() }()
+
+	handler := New(&config.Config{}, nil, nil, store)
+	received := time.Date(2024, 7, 1, 8, 0, 0, 0, time.UTC)
+	if err := handler.InitializeTaskAt(7, received); err != nil {
+		t.Fatalf("InitializeTaskAt failed: %v", err)
+	}
+	slaState, err := store.GetSLAState(7)
+	if err != nil || slaState == nil {
+		t.Fatalf("GetSLAState = %v, %v", slaState, err)
+	}
+	if !slaState.CreatedAt.Equal(received) {
+		t.Errorf("CreatedAt = %v, want %v", slaState.CreatedAt, received)
+	}
+}
+
 func TestHandler_IsNewStage(t *testing.T) {
 	const newStageID int64 = 100
 
@@ -7,6 +7,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/rs/zerolog/log"
@@ -53,6 +54,13 @@ func NewWithConfig(cfg Config) *Client {
 	}
 }
 
+// WithChannel returns a copy of the client posting to another channel, e.g. one picked by a routing rule.
+func (c *Client) WithChannel(channelID string) *Client {
+	cp := *c
+	cp.channelID = channelID
+	return &cp
+}
+
 // Message represents a Slack message with timestamp for threading
 type Message struct {
 	Timestamp string `json:"ts"`
@@ -126,6 +134,57 @@ func (c *Client) postNewTaskWebhook(taskID int, title, url, body, assignedOperat
 			section("<" + url + "|:point_right: Otevřít v Odoo>"),
 		},
 	}
+	return c.postWebhook(payload)
+}
+
+// NotifyQuarantinedTask posts a quiet notice, without @channel, about a task created in quarantine
+func (c *Client) NotifyQuarantinedTask(taskID int, title, url, reason string) (*Message, error) {
+	text := ":no_entry_sign: *Task v karanténě*"
+	payload := map[string]any{
+		"text": text,
+		"blocks": []any{
+			section(text),
+			section("*Task:* " + title),
+			section("*ID:* " + itoa(taskID)),
+			section("*Důvod:* " + reason),
+			section("<" + url + "|:point_right: Otevřít v Odoo>"),
+		},
+	}
+	if c.botToken != "" && c.channelID != "" {
+		payload["channel"] = c.channelID
+		return c.callSlackAPI("chat.postMessage", payload)
+	}
+	if c.webhook == "" {
+		return nil, nil
+	}
+	return nil, c.postWebhook(payload)
+}
+
+// NotifyFlood announces that a sender or domain reached its ticket limit. It does not
+// ping @channel, the whole point is to stop the noise.
+func (c *Client) NotifyFlood(key string, count int, window time.Duration, taskID int, url string) (*Message, error) {
+	text := ":rotating_light: *Příliš mnoho nových požadavků*"
+	payload := map[string]any{
+		"text": text,
+		"blocks": []any{
+			section(text),
+			section(fmt.Sprintf("*Odesílatel:* %s (%d za %d min)", key, count, int(window.Minutes()))),
+			section(fmt.Sprintf("Další zprávy se přidávají jako poznámky k tasku #%d", taskID)),
+			section("<" + url + "|:point_right: Otevřít v Odoo>"),
+		},
+	}
+	if c.botToken != "" && c.channelID != "" {
+		payload["channel"] = c.channelID
+		return c.callSlackAPI("chat.postMessage", payload)
+	}
+	if c.webhook == "" {
+		return nil, nil
+	}
+	return nil, c.postWebhook(payload)
+}
+
+// postWebhook sends a payload to the incoming webhook
+func (c *Client) postWebhook(payload map[string]any) error {
 	b, _ := json.Marshal(payload)
 	req, _ := http.NewRequestWithContext(context.Background(), "POST", c.webhook, bytes.NewReader(b))
 	req.Header.Set("Content-Type", "application/json")
@@ -260,6 +319,22 @@ func (c *Client) NotifySLAViolation(parentMsg *Message, taskID int, title string
 	return err
 }
 
+// NotifyInfectedAttachments warns in the task's thread about attachments held back by the virus scanner
+func (c *Client) NotifyInfectedAttachments(parentMsg *Message, taskID int, files []string) error {
+	if c.botToken == "" || c.channelID == "" || parentMsg == nil || len(files) == 0 {
+		return nil
+	}
+
+	payload := map[string]any{
+		"channel":   c.channelID,
+		"thread_ts": parentMsg.Timestamp,
+		"text":      fmt.Sprintf(":biohazard_sign: *Zadržené přílohy* - Task #%d: antivirus našel malware v %s", taskID, strings.Join(files, ", ")),
+	}
+
+	_, err := c.callSlackAPI("chat.postMessage", payload)
+	return err
+}
+
 func (c *Client) callSlackAPI(method string, payload map[string]any) (*Message, error) {
 	b, _ := json.Marshal(payload)
 	req, _ := http.NewRequestWithContext(context.Background(), "POST", "https://slack.com/api/"+method, bytes.NewReader(b))
@@ -2,9 +2,12 @@ package slack
 
 import (
 	"encoding/json"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestClient_NotifyNewTask_Webhook(t *testing.T) {
@@ -100,3 +103,57 @@ func TestClient_NoWebhookURL(t *testing.T) {
 		t.Errorf("Expected no error for empty webhook URL, got: %v", err)
 	}
 }
+
+func TestClient_WithChannel(t *testing.T) {
+	client := NewWithConfig(Config{BotToken: "test-token", ChannelID: "C1234567890"})
+	routed := client.WithChannel("C0000000BIL")
+
+	if routed.channelID != "C0000000BIL" || routed.botToken != "test-token" {
+		t.Errorf("WithChannel() = channel %q, token %q", routed.channelID, routed.botToken)
+	}
+	if client.channelID != "C1234567890" {
+		t.Errorf("WithChannel() must not change the original client, got %q", client.channelID)
+	}
+}
+
+func TestClient_NotifyQuarantinedTask_Webhook(t *testing.T) {
+	var body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		body = string(b)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	client := New(server.URL)
+	if _, err := client.NotifyQuarantinedTask(123, "Cheap pills", "http://example.com/task/123", "dmarc=fail"); err != nil {
+		t.Fatalf("NotifyQuarantinedTask failed: %v", err)
+	}
+	if strings.Contains(body, "<!channel>") {
+		t.Errorf("Quarantine notice must not ping the channel: %s", body)
+	}
+	if !strings.Contains(body, "dmarc=fail") {
+		t.Errorf("Quarantine notice should carry the reason: %s", body)
+	}
+}
+
+func TestClient_NotifyFlood_Webhook(t *testing.T) {
+	var body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		body = string(b)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	client := New(server.URL)
+	if _, err := client.NotifyFlood("monitor@example.com", 5, 10*time.Minute, 123, "http://example.com/task/123"); err != nil {
+		t.Fatalf("NotifyFlood failed: %v", err)
+	}
+	if strings.Contains(body, "<!channel>") {
+		t.Errorf("Flood alert must not ping the channel: %s", body)
+	}
+	if !strings.Contains(body, "monitor@example.com (5 za 10 min)") || !strings.Contains(body, "#123") {
+		t.Errorf("Flood alert should name the sender and the task: %s", body)
+	}
+}
@@ -3,6 +3,8 @@ package state
 
 import (
 	"encoding/json"
+	"slices"
+	"strings"
 	"time"
 
 	"go.etcd.io/bbolt"
@@ -27,6 +29,14 @@ var (
 	bReopenedNotified = []byte("reopened_notified")
 	bSlackMessages    = []byte("slack_messages")
 	bSLAStates        = []byte("sla_states")
+	bIMAPCursors      = []byte("imap_cursors")
+	bMessageIDs       = []byte("message_ids")
+	bTaskMessageIDs   = []byte("task_message_ids")
+	bBouncingEmails   = []byte("bouncing_emails")
+	bParticipants     = []byte("task_participants")
+	bSenderActivity   = []byte("sender_activity")
+	bRecentSubjects   = []byte("recent_subjects")
+	bPOP3UIDLs        = []byte("pop3_uidls")
 )
 
 // Store provides persistent key-value storage using BBolt database.
@@ -39,7 +49,7 @@ func New(path string) (*Store, error) {
 		return nil, err
 	}
 	if err := db.Update(func(tx *bbolt.Tx) error {
-		for _, b := range [][]byte{bProcessedEmails, bOdooMsgSent, bLastOdooMsgTime, bClosedNotified, bReopenedNotified, bSlackMessages, bSLAStates} {
+		for _, b := range [][]byte{bProcessedEmails, bOdooMsgSent, bLastOdooMsgTime, bClosedNotified, bReopenedNotified, bSlackMessages, bSLAStates, bIMAPCursors, bMessageIDs, bTaskMessageIDs, bBouncingEmails, bParticipants, bSenderActivity, bRecentSubjects, bPOP3UIDLs} {
 			if _, e := tx.CreateBucketIfNotExists(b); e != nil {
 				return e
 			}
@@ -109,6 +119,32 @@ func (s *Store) SetLastOdooMessageTime(t time.Time) error {
 	})
 }
 
+// GetLastOdooMessageTimeForProject retrieves the timestamp of the last processed Odoo message
+// of one project. Projects without their own timestamp start from the global one.
+func (s *Store) GetLastOdooMessageTimeForProject(projectID int64) time.Time {
+	var t time.Time
+	_ = s.db.View(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(bLastOdooMsgTime)
+		v := b.Get(append([]byte("ts:"), itob(projectID)...))
+		if v == nil {
+			v = b.Get([]byte("ts"))
+		}
+		if v != nil {
+			_ = t.UnmarshalText(v)
+		}
+		return nil
+	})
+	return t
+}
+
+// SetLastOdooMessageTimeForProject updates the timestamp of the last processed Odoo message of one project.
+func (s *Store) SetLastOdooMessageTimeForProject(projectID int64, t time.Time) error {
+	txt, _ := t.UTC().MarshalText()
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket(bLastOdooMsgTime).Put(append([]byte("ts:"), itob(projectID)...), txt)
+	})
+}
+
 // IsTaskClosedNotified checks if a task closure notification has been sent.
 func (s *Store) IsTaskClosedNotified(id int64) bool {
 	var ok bool
@@ -163,6 +199,8 @@ func (s *Store) ClearTaskReopenedNotified(id int64) error {
 type SlackMessageInfo struct {
 	Timestamp string `json:"timestamp"`
 	Channel   string `json:"channel"`
+	// RuleChannel is the channel a routing rule posted the task to, empty for the route's own
+	RuleChannel string `json:"rule_channel,omitempty"`
 }
 
 // StoreSlackMessage saves Slack message info for a task
@@ -229,6 +267,279 @@ func (s *Store) GetSLAState(taskID int64) (*SLAState, error) {
 	return &state, nil
 }
 
+// IMAPCursor records how far an IMAP folder has been processed
+type IMAPCursor struct {
+	UIDValidity uint32 `json:"uid_validity"`
+	LastUID     uint32 `json:"last_uid"`
+}
+
+// StoreIMAPCursor saves the processing cursor for an IMAP folder
+func (s *Store) StoreIMAPCursor(folder string, cursor IMAPCursor) error {
+	data, _ := json.Marshal(cursor)
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket(bIMAPCursors).Put([]byte(folder), data)
+	})
+}
+
+// GetIMAPCursor retrieves the processing cursor for an IMAP folder
+func (s *Store) GetIMAPCursor(folder string) (*IMAPCursor, error) {
+	var cursor *IMAPCursor
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		data := tx.Bucket(bIMAPCursors).Get([]byte(folder))
+		if data == nil {
+			return nil
+		}
+		cursor = &IMAPCursor{}
+		return json.Unmarshal(data, cursor)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return cursor, nil
+}
+
+// StoreMessageID links an email Message-ID (sent or received) to a task
+func (s *Store) StoreMessageID(taskID int64, messageID string) error {
+	if messageID == "" {
+		return nil
+	}
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		if err := tx.Bucket(bMessageIDs).Put([]byte(messageID), itob(taskID)); err != nil {
+			return err
+		}
+
+		tb := tx.Bucket(bTaskMessageIDs)
+		var ids []string
+		if data := tb.Get(itob(taskID)); data != nil {
+			if err := json.Unmarshal(data, &ids); err != nil {
+				return err
+			}
+		}
+		for _, id := range ids {
+			if id == messageID {
+				return nil
+			}
+		}
+		data, _ := json.Marshal(append(ids, messageID))
+		return tb.Put(itob(taskID), data)
+	})
+}
+
+// GetTaskByMessageID returns the task a Message-ID belongs to
+func (s *Store) GetTaskByMessageID(messageID string) (int64, bool, error) {
+	var taskID int64
+	var found bool
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		data := tx.Bucket(bMessageIDs).Get([]byte(messageID))
+		if len(data) == int64ByteLength {
+			taskID = btoi(data)
+			found = true
+		}
+		return nil
+	})
+	return taskID, found, err
+}
+
+// GetTaskMessageIDs returns all Message-IDs recorded for a task, oldest first
+func (s *Store) GetTaskMessageIDs(taskID int64) ([]string, error) {
+	var ids []string
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		data := tx.Bucket(bTaskMessageIDs).Get(itob(taskID))
+		if data == nil {
+			return nil
+		}
+		return json.Unmarshal(data, &ids)
+	})
+	return ids, err
+}
+
+// MarkEmailBouncing records that mail to an address bounces
+func (s *Store) MarkEmailBouncing(email string) error {
+	txt, _ := time.Now().UTC().MarshalText()
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket(bBouncingEmails).Put([]byte(strings.ToLower(email)), txt)
+	})
+}
+
+// IsEmailBouncing checks if mail to an address is known to bounce
+func (s *Store) IsEmailBouncing(email string) bool {
+	var ok bool
+	_ = s.db.View(func(tx *bbolt.Tx) error {
+		ok = tx.Bucket(bBouncingEmails).Get([]byte(strings.ToLower(email))) != nil
+		return nil
+	})
+	return ok
+}
+
+// ClearEmailBouncing removes the bouncing mark, e.g. once the address writes to us again
+func (s *Store) ClearEmailBouncing(email string) error {
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket(bBouncingEmails).Delete([]byte(strings.ToLower(email)))
+	})
+}
+
+// AddTaskParticipants remembers addresses that take part in a task's conversation besides the customer
+func (s *Store) AddTaskParticipants(taskID int64, emails ...string) error {
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(bParticipants)
+		var list []string
+		if data := b.Get(itob(taskID)); data != nil {
+			if err := json.Unmarshal(data, &list); err != nil {
+				return err
+			}
+		}
+		changed := false
+		for _, e := range emails {
+			e = strings.ToLower(strings.TrimSpace(e))
+			if e != "" && !slices.Contains(list, e) {
+				list = append(list, e)
+				changed = true
+			}
+		}
+		if !changed {
+			return nil
+		}
+		data, _ := json.Marshal(list)
+		return b.Put(itob(taskID), data)
+	})
+}
+
+// GetTaskParticipants returns the tracked participants of a task in the order they joined
+func (s *Store) GetTaskParticipants(taskID int64) ([]string, error) {
+	var list []string
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		data := tx.Bucket(bParticipants).Get(itob(taskID))
+		if data == nil {
+			return nil
+		}
+		return json.Unmarshal(data, &list)
+	})
+	return list, err
+}
+
+// SenderActivity is the recent ticket history of a sender or a domain, kept for flood protection
+type SenderActivity struct {
+	Tickets      []time.Time `json:"tickets"` // when the recent tickets were opened
+	LastTaskID   int64       `json:"last_task_id"`
+	AlertedUntil time.Time   `json:"alerted_until,omitempty"` // no further flood alert before this
+}
+
+// StoreSenderActivity saves the ticket history of a sender or domain key
+func (s *Store) StoreSenderActivity(key string, a SenderActivity) error {
+	data, _ := json.Marshal(a)
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket(bSenderActivity).Put([]byte(key), data)
+	})
+}
+
+// GetSenderActivity retrieves the ticket history of a key, empty when there is none
+func (s *Store) GetSenderActivity(key string) (SenderActivity, error) {
+	var a SenderActivity
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		data := tx.Bucket(bSenderActivity).Get([]byte(key))
+		if data == nil {
+			return nil
+		}
+		return json.Unmarshal(data, &a)
+	})
+	return a, err
+}
+
+type recentSubject struct {
+	TaskID int64     `json:"task_id"`
+	At     time.Time `json:"at"`
+}
+
+// StoreRecentSubject remembers the task opened for a sender and subject key. Entries
+// recorded before expire are dropped on the way.
+func (s *Store) StoreRecentSubject(key string, taskID int64, at, expire time.Time) error {
+	data, _ := json.Marshal(recentSubject{TaskID: taskID, At: at})
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(bRecentSubjects)
+		var stale [][]byte
+		if err := b.ForEach(func(k, v []byte) error {
+			var r recentSubject
+			if json.Unmarshal(v, &r) != nil || r.At.Before(expire) {
+				stale = append(stale, k)
+			}
+			return nil
+		}); err != nil {
+			return err
+		}
+		for _, k := range stale {
+			if err := b.Delete(k); err != nil {
+				return err
+			}
+		}
+		return b.Put([]byte(key), data)
+	})
+}
+
+// GetRecentSubject returns the task last opened for a sender and subject key and when
+func (s *Store) GetRecentSubject(key string) (int64, time.Time, bool) {
+	var r recentSubject
+	_ = s.db.View(func(tx *bbolt.Tx) error {
+		if data := tx.Bucket(bRecentSubjects).Get([]byte(key)); data != nil {
+			return json.Unmarshal(data, &r)
+		}
+		return nil
+	})
+	return r.TaskID, r.At, r.TaskID != 0
+}
+
+// GetPOP3Seen returns the UIDLs of a POP3 mailbox whose messages were processed
+func (s *Store) GetPOP3Seen(mailbox string) (map[string]bool, error) {
+	seen := make(map[string]bool)
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(bPOP3UIDLs).Bucket([]byte(mailbox))
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(k, _ []byte) error {
+			seen[string(k)] = true
+			return nil
+		})
+	})
+	return seen, err
+}
+
+// MarkPOP3Seen records a processed message of a POP3 mailbox by its UIDL
+func (s *Store) MarkPOP3Seen(mailbox, uidl string) error {
+	txt, _ := time.Now().MarshalText()
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		b, err := tx.Bucket(bPOP3UIDLs).CreateBucketIfNotExists([]byte(mailbox))
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(uidl), txt)
+	})
+}
+
+// PrunePOP3Seen forgets the UIDLs of messages no longer on the server
+func (s *Store) PrunePOP3Seen(mailbox string, onServer map[string]bool) error {
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(bPOP3UIDLs).Bucket([]byte(mailbox))
+		if b == nil {
+			return nil
+		}
+		var gone [][]byte
+		if err := b.ForEach(func(k, _ []byte) error {
+			if !onServer[string(k)] {
+				gone = append(gone, k)
+			}
+			return nil
+		}); err != nil {
+			return err
+		}
+		for _, k := range gone {
+			if err := b.Delete(k); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
 func itob(v int64) []byte {
 	b := make([]byte, int64ByteLength)
 	for i := uint(0); i < int64ByteLength; i++ {
@@ -236,3 +547,11 @@ func itob(v int64) []byte {
 	}
 	return b
 }
+
+func btoi(b []byte) int64 {
+	var v int64
+	for i := uint(0); i < int64ByteLength; i++ {
+		v |= int64(b[i]) << (bitShiftOffset - i*int64ByteLength)
+	}
+	return v
+}
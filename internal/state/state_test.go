@@ -374,3 +374,241 @@ func TestStore_TaskClosedNotification(t *testing.T) {
 		t.Error("Task should not have closed notification after clearing")
 	}
 }
+
+func TestStore_IMAPCursor(t *testing.T) {
+	store, err := New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	defer func() { _ = store.Close() }()
+
+	folder := "imap.example.com/helpdesk/INBOX"
+
+	cursor, err := store.GetIMAPCursor(folder)
+	if err != nil {
+		t.Fatalf("GetIMAPCursor failed: %v", err)
+	}
+	if cursor != nil {
+		t.Error("No cursor should exist initially")
+	}
+
+	if err := store.StoreIMAPCursor(folder, IMAPCursor{UIDValidity: 1700000000, LastUID: 42}); err != nil {
+		t.Fatalf("StoreIMAPCursor failed: %v", err)
+	}
+
+	cursor, err = store.GetIMAPCursor(folder)
+	if err != nil {
+		t.Fatalf("GetIMAPCursor failed: %v", err)
+	}
+	if cursor == nil {
+		t.Fatal("Cursor should exist after storing")
+	}
+	if cursor.UIDValidity != 1700000000 {
+		t.Errorf("Expected UIDVALIDITY 1700000000, got %d", cursor.UIDValidity)
+	}
+	if cursor.LastUID != 42 {
+		t.Errorf("Expected last UID 42, got %d", cursor.LastUID)
+	}
+
+	// Other folders are tracked independently
+	other, err := store.GetIMAPCursor("imap.example.com/helpdesk/Support")
+	if err != nil {
+		t.Fatalf("GetIMAPCursor failed: %v", err)
+	}
+	if other != nil {
+		t.Error("Cursor should be scoped to its folder")
+	}
+}
+
+func TestStore_MessageIDs(t *testing.T) {
+	store, err := New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	defer func() { _ = store.Close() }()
+
+	if _, found, err := store.GetTaskByMessageID("unknown@example.com"); err != nil || found {
+		t.Errorf("Unknown Message-ID should not be found, got found=%v err=%v", found, err)
+	}
+
+	for _, id := range []string{"orig@mail.example.com", "reply@bridge.example.com", "orig@mail.example.com"} {
+		if err := store.StoreMessageID(1234, id); err != nil {
+			t.Fatalf("StoreMessageID failed: %v", err)
+		}
+	}
+	if err := store.StoreMessageID(1234, ""); err != nil {
+		t.Fatalf("StoreMessageID with empty ID failed: %v", err)
+	}
+
+	taskID, found, err := store.GetTaskByMessageID("reply@bridge.example.com")
+	if err != nil || !found {
+		t.Fatalf("Message-ID should be found, got found=%v err=%v", found, err)
+	}
+	if taskID != 1234 {
+		t.Errorf("Expected task 1234, got %d", taskID)
+	}
+
+	ids, err := store.GetTaskMessageIDs(1234)
+	if err != nil {
+		t.Fatalf("GetTaskMessageIDs failed: %v", err)
+	}
+	if len(ids) != 2 || ids[0] != "orig@mail.example.com" || ids[1] != "reply@bridge.example.com" {
+		t.Errorf("Expected two distinct IDs in order, got %v", ids)
+	}
+}
+
+func TestStore_LastOdooMessageTimeForProject(t *testing.T) {
+	store, err := New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	defer func() { _ = store.Close() }()
+
+	global := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+	if err := store.SetLastOdooMessageTime(global); err != nil {
+		t.Fatalf("SetLastOdooMessageTime failed: %v", err)
+	}
+
+	// Without its own timestamp a project continues from the global one
+	if got := store.GetLastOdooMessageTimeForProject(1); !got.Equal(global) {
+		t.Errorf("Expected fallback to global time %v, got %v", global, got)
+	}
+
+	later := global.Add(2 * time.Hour)
+	if err := store.SetLastOdooMessageTimeForProject(1, later); err != nil {
+		t.Fatalf("SetLastOdooMessageTimeForProject failed: %v", err)
+	}
+	if got := store.GetLastOdooMessageTimeForProject(1); !got.Equal(later) {
+		t.Errorf("Expected project time %v, got %v", later, got)
+	}
+	if got := store.GetLastOdooMessageTimeForProject(2); !got.Equal(global) {
+		t.Errorf("Other projects should be unaffected, got %v", got)
+	}
+}
+
+func TestStore_BouncingEmails(t *testing.T) {
+	store, err := New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	defer func() { _ = store.Close() }()
+
+	if store.IsEmailBouncing("gone@example.com") {
+		t.Error("Address should not be bouncing initially")
+	}
+	if err := store.MarkEmailBouncing("Gone@Example.com"); err != nil {
+		t.Fatalf("MarkEmailBouncing failed: %v", err)
+	}
+	if !store.IsEmailBouncing("gone@example.com") {
+		t.Error("Address should be bouncing regardless of case")
+	}
+	if err := store.ClearEmailBouncing("gone@example.com"); err != nil {
+		t.Fatalf("ClearEmailBouncing failed: %v", err)
+	}
+	if store.IsEmailBouncing("gone@example.com") {
+		t.Error("Address should not be bouncing after clear")
+	}
+}
+
+func TestStore_TaskParticipants(t *testing.T) {
+	store, err := New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	defer func() { _ = store.Close() }()
+
+	if list, err := store.GetTaskParticipants(7); err != nil || len(list) != 0 {
+		t.Fatalf("Expected no participants, got %v, %v", list, err)
+	}
+	if err := store.AddTaskParticipants(7, "Anna@Example.com", "petr@example.com"); err != nil {
+		t.Fatalf("AddTaskParticipants failed: %v", err)
+	}
+	if err := store.AddTaskParticipants(7, "anna@example.com", " ", "eva@example.com"); err != nil {
+		t.Fatalf("AddTaskParticipants failed: %v", err)
+	}
+	list, err := store.GetTaskParticipants(7)
+	if err != nil {
+		t.Fatalf("GetTaskParticipants failed: %v", err)
+	}
+	want := []string{"anna@example.com", "petr@example.com", "eva@example.com"}
+	if len(list) != len(want) {
+		t.Fatalf("GetTaskParticipants() = %v, want %v", list, want)
+	}
+	for i := range want {
+		if list[i] != want[i] {
+			t.Errorf("participant %d = %q, want %q", i, list[i], want[i])
+		}
+	}
+	if other, _ := store.GetTaskParticipants(8); len(other) != 0 {
+		t.Errorf("Participants leaked to another task: %v", other)
+	}
+}
+
+func TestStore_RecentSubjects(t *testing.T) {
+	store, err := New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	defer func() { _ = store.Close() }()
+
+	now := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	if err := store.StoreRecentSubject("a", 7, now.Add(-time.Hour), now.Add(-2*time.Hour)); err != nil {
+		t.Fatalf("StoreRecentSubject failed: %v", err)
+	}
+	if id, at, ok := store.GetRecentSubject("a"); !ok || id != 7 || !at.Equal(now.Add(-time.Hour)) {
+		t.Errorf("GetRecentSubject() = %d, %v, %v", id, at, ok)
+	}
+
+	// Storing another key drops entries older than the expiry
+	if err := store.StoreRecentSubject("b", 8, now, now.Add(-30*time.Minute)); err != nil {
+		t.Fatalf("StoreRecentSubject failed: %v", err)
+	}
+	if _, _, ok := store.GetRecentSubject("a"); ok {
+		t.Error("Expired subject should be gone")
+	}
+	if id, _, ok := store.GetRecentSubject("b"); !ok || id != 8 {
+		t.Errorf("GetRecentSubject(b) = %d, %v", id, ok)
+	}
+
+	act := SenderActivity{Tickets: []time.Time{now}, LastTaskID: 8}
+	if err := store.StoreSenderActivity("sender:a@example.com", act); err != nil {
+		t.Fatalf("StoreSenderActivity failed: %v", err)
+	}
+	if got, err := store.GetSenderActivity("sender:a@example.com"); err != nil || got.LastTaskID != 8 || len(got.Tickets) != 1 {
+		t.Errorf("GetSenderActivity() = %+v, %v", got, err)
+	}
+	if got, _ := store.GetSenderActivity("sender:b@example.com"); got.LastTaskID != 0 {
+		t.Errorf("Unknown sender has activity: %+v", got)
+	}
+}
+
+func TestStore_POP3Seen(t *testing.T) {
+	store, err := New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	defer func() { _ = store.Close() }()
+
+	if seen, err := store.GetPOP3Seen("pop.example.com/support"); err != nil || len(seen) != 0 {
+		t.Fatalf("GetPOP3Seen() of a new mailbox = %v, %v", seen, err)
+	}
+	for _, uidl := range []string{"a1", "b2", "c3"} {
+		if err := store.MarkPOP3Seen("pop.example.com/support", uidl); err != nil {
+			t.Fatalf("MarkPOP3Seen failed: %v", err)
+		}
+	}
+	if err := store.MarkPOP3Seen("pop.example.com/other", "a1"); err != nil {
+		t.Fatalf("MarkPOP3Seen failed: %v", err)
+	}
+
+	if err := store.PrunePOP3Seen("pop.example.com/support", map[string]bool{"b2": true, "d4": true}); err != nil {
+		t.Fatalf("PrunePOP3Seen failed: %v", err)
+	}
+	seen, err := store.GetPOP3Seen("pop.example.com/support")
+	if err != nil || len(seen) != 1 || !seen["b2"] {
+		t.Errorf("GetPOP3Seen() after prune = %v, %v", seen, err)
+	}
+	if other, _ := store.GetPOP3Seen("pop.example.com/other"); !other["a1"] {
+		t.Error("Pruning one mailbox must not touch another")
+	}
+}
@@ -7,10 +7,15 @@ import (
 	"path/filepath"
 	"strings"
 	"text/template"
+
+	"github.com/anaryk/odoo-helpdesk-bridge/internal/ticket"
 )
 
 // Engine provides template rendering capabilities for email messages.
-type Engine struct{ dir string }
+type Engine struct {
+	dir    string
+	secret string // signs the ticket tag, see SignTags
+}
 
 // New creates a new template engine with the specified templates directory.
 func New(dir string) (*Engine, error) {
@@ -20,6 +25,11 @@ func New(dir string) (*Engine, error) {
 	return &Engine{dir: dir}, nil
 }
 
+// SignTags adds an HMAC token made with the secret to the .Tag of every template
+func (e *Engine) SignTags(secret string) {
+	e.secret = secret
+}
+
 func (e *Engine) render(file string, data any) (string, error) {
 	// Validate filename to prevent directory traversal
 	if strings.Contains(file, "..") || strings.Contains(file, "/") {
@@ -45,13 +55,13 @@ func (e *Engine) render(file string, data any) (string, error) {
 // RenderNewTicket renders email templates for new ticket notifications.
 func (e *Engine) RenderNewTicket(prefix string, taskID int, customerName, originalBody string, slaStartHours, slaResolutionHours int) (string, string, error) {
 	subj, err := e.render("new_ticket_subject.tmpl", map[string]any{
-		"TicketPrefix": prefix, "TaskID": taskID,
+		"TicketPrefix": prefix, "TaskID": taskID, "Tag": ticket.Tag(e.secret, prefix, taskID),
 	})
 	if err != nil {
 		return "", "", err
 	}
 	body, err := e.render("new_ticket_body.tmpl", map[string]any{
-		"TicketPrefix": prefix, "TaskID": taskID, "CustomerName": customerName, "OriginalBody": originalBody,
+		"TicketPrefix": prefix, "TaskID": taskID, "Tag": ticket.Tag(e.secret, prefix, taskID), "CustomerName": customerName, "OriginalBody": originalBody,
 		"SLAStartHours": slaStartHours, "SLAResolutionHours": slaResolutionHours,
 	})
 	return strings.TrimSpace(subj), body, err
@@ -60,13 +70,13 @@ func (e *Engine) RenderNewTicket(prefix string, taskID int, customerName, origin
 // RenderAgentReply renders email templates for agent reply notifications.
 func (e *Engine) RenderAgentReply(prefix string, taskID int, subject, customerName, agentMsg string) (string, string, error) {
 	subj, err := e.render("agent_reply_subject.tmpl", map[string]any{
-		"TicketPrefix": prefix, "TaskID": taskID, "Subject": subject,
+		"TicketPrefix": prefix, "TaskID": taskID, "Tag": ticket.Tag(e.secret, prefix, taskID), "Subject": subject,
 	})
 	if err != nil {
 		return "", "", err
 	}
 	body, err := e.render("agent_reply_body.tmpl", map[string]any{
-		"TicketPrefix": prefix, "TaskID": taskID, "CustomerName": customerName, "AgentMessage": agentMsg,
+		"TicketPrefix": prefix, "TaskID": taskID, "Tag": ticket.Tag(e.secret, prefix, taskID), "CustomerName": customerName, "AgentMessage": agentMsg,
 	})
 	return strings.TrimSpace(subj), body, err
 }
@@ -74,13 +84,13 @@ func (e *Engine) RenderAgentReply(prefix string, taskID int, subject, customerNa
 // RenderTicketClosed renders email templates for ticket closure notifications.
 func (e *Engine) RenderTicketClosed(prefix string, taskID int, taskURL, customerName string) (string, string, error) {
 	subj, err := e.render("ticket_closed_subject.tmpl", map[string]any{
-		"TicketPrefix": prefix, "TaskID": taskID,
+		"TicketPrefix": prefix, "TaskID": taskID, "Tag": ticket.Tag(e.secret, prefix, taskID),
 	})
 	if err != nil {
 		return "", "", err
 	}
 	body, err := e.render("ticket_closed_body.tmpl", map[string]any{
-		"TicketPrefix": prefix, "TaskID": taskID, "TaskURL": taskURL, "CustomerName": customerName,
+		"TicketPrefix": prefix, "TaskID": taskID, "Tag": ticket.Tag(e.secret, prefix, taskID), "TaskURL": taskURL, "CustomerName": customerName,
 	})
 	return strings.TrimSpace(subj), body, err
 }
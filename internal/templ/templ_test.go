@@ -5,6 +5,8 @@ import (
 	"path/filepath"
 	"strings"
 	"testing"
+
+	"github.com/anaryk/odoo-helpdesk-bridge/internal/ticket"
 )
 
 func TestNew(t *testing.T) {
@@ -356,3 +358,30 @@ func TestEngine_SubjectTrimming(t *testing.T) {
 		t.Errorf("Subject should be trimmed: expected '%s', got '%s'", expected, subject)
 	}
 }
+
+func TestEngine_SignTags(t *testing.T) {
+	tmpDir := t.TempDir()
+	for name, content := range map[string]string{
+		"ticket_closed_subject.tmpl": "[{{.Tag}}] Ticket resolved",
+		"ticket_closed_body.tmpl":    "Ticket {{.TaskID}} resolved",
+	} {
+		if err := os.WriteFile(filepath.Join(tmpDir, name), []byte(content), 0600); err != nil {
+			t.Fatalf("Failed to create template: %v", err)
+		}
+	}
+	engine, err := New(tmpDir)
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+
+	subject, _, err := engine.RenderTicketClosed("ML", 7, "https://odoo/7", "Jane")
+	if err != nil || subject != "[ML-#7] Ticket resolved" {
+		t.Errorf("unsigned subject = %q, %v", subject, err)
+	}
+
+	engine.SignTags("s3cret")
+	subject, _, _ = engine.RenderTicketClosed("ML", 7, "https://odoo/7", "Jane")
+	if want := "[" + ticket.Tag("s3cret", "ML", 7) + "] Ticket resolved"; subject != want || subject == "[ML-#7] Ticket resolved" {
+		t.Errorf("signed subject = %q, want %q", subject, want)
+	}
+}
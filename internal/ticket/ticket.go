@@ -0,0 +1,86 @@
+// Package ticket formats and parses the ticket tag in mail subjects. The plain tag is
+// [PREFIX-#123]; with a secret it carries an HMAC token, [PREFIX-#123-1a2b3c4d], so
+// ticket numbers taken from one mail cannot be used to write into other tickets. The
+// Message-IDs of the mail sent for a ticket carry the same token.
+package ticket
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// tokenLength is the number of hex digits of the token kept in the tag
+const tokenLength = 8
+
+// tagPattern matches [PREFIX-#123] and [PREFIX-#123-token]
+var tagPattern = regexp.MustCompile(`\[\s*([A-Za-z0-9_-]+)\s*-\s*#(\d+)(?:-([0-9A-Fa-f]+))?\s*\]`)
+
+// messageIDPattern matches what follows the prefix in a generated Message-ID:
+// -123.kind.ref@domain, or -123-token.kind.ref@domain when signed
+var messageIDPattern = regexp.MustCompile(`^-(\d+)(?:-([0-9a-f]+))?\.[a-z]+\.\d+@`)
+
+// Ref is a ticket tag found in a subject
+type Ref struct {
+	Prefix string
+	ID     int
+	Token  string // empty for an unsigned tag
+}
+
+// Tag formats the tag without brackets; the token is added when secret is set
+func Tag(secret, prefix string, id int) string {
+	tag := prefix + "-#" + strconv.Itoa(id)
+	if secret != "" {
+		tag += "-" + Token(secret, prefix, id)
+	}
+	return tag
+}
+
+// Token is the signature of a ticket number under the secret
+func Token(secret, prefix string, id int) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strings.ToUpper(prefix) + "-" + strconv.Itoa(id)))
+	return hex.EncodeToString(mac.Sum(nil))[:tokenLength]
+}
+
+// Parse finds the first tag with the prefix in a subject
+func Parse(subject, prefix string) (Ref, bool) {
+	for _, m := range tagPattern.FindAllStringSubmatch(subject, -1) {
+		if !strings.EqualFold(m[1], prefix) {
+			continue
+		}
+		id, _ := strconv.Atoi(m[2])
+		if id <= 0 {
+			continue
+		}
+		return Ref{Prefix: m[1], ID: id, Token: strings.ToLower(m[3])}, true
+	}
+	return Ref{}, false
+}
+
+// Valid reports whether the tag carries the right token; without a secret every tag is valid
+func (r Ref) Valid(secret string) bool {
+	if secret == "" {
+		return true
+	}
+	return hmac.Equal([]byte(r.Token), []byte(Token(secret, r.Prefix, r.ID)))
+}
+
+// ParseMessageID recognizes a Message-ID generated for a ticket with the prefix. Such
+// IDs are predictable, so with a secret only those with a valid token may be trusted.
+func ParseMessageID(id, prefix string) (Ref, bool) {
+	lower := strings.ToLower(strings.Trim(strings.TrimSpace(id), "<>"))
+	rest, ok := strings.CutPrefix(lower, strings.ToLower(prefix))
+	if !ok || prefix == "" {
+		return Ref{}, false
+	}
+	m := messageIDPattern.FindStringSubmatch(rest)
+	if m == nil {
+		return Ref{}, false
+	}
+	n, _ := strconv.Atoi(m[1])
+	return Ref{Prefix: prefix, ID: n, Token: m[2]}, n > 0
+}
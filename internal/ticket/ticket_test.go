@@ -0,0 +1,83 @@
+package ticket
+
+import "testing"
+
+func TestTag(t *testing.T) {
+	if got := Tag("", "TICKET", 123); got != "TICKET-#123" {
+		t.Errorf("unsigned Tag() = %q", got)
+	}
+	got := Tag("s3cret", "TICKET", 123)
+	if got != "TICKET-#123-"+Token("s3cret", "TICKET", 123) || len(got) != len("TICKET-#123-")+tokenLength {
+		t.Errorf("signed Tag() = %q", got)
+	}
+	if Token("s3cret", "TICKET", 123) == Token("s3cret", "TICKET", 124) || Token("s3cret", "TICKET", 123) == Token("other", "TICKET", 123) {
+		t.Error("tokens must differ between tickets and secrets")
+	}
+}
+
+func TestParse(t *testing.T) {
+	signed := "Re: [" + Tag("s3cret", "HELP-DESK", 42) + "] Printer"
+	tests := []struct {
+		subject string
+		want    Ref
+		ok      bool
+	}{
+		{"Re: [TICKET-#123] Printer", Ref{Prefix: "TICKET", ID: 123}, true},
+		{"[ ticket - #7 ]", Ref{Prefix: "ticket", ID: 7}, true},
+		{"[OTHER-#1] Fwd: [TICKET-#2]", Ref{Prefix: "TICKET", ID: 2}, true},
+		{"[TICKET-#0]", Ref{}, false},
+		{"TICKET-#12 without brackets", Ref{}, false},
+		{"[HELP-DESK-#42-ABCDEF12]", Ref{Prefix: "HELP-DESK", ID: 42, Token: "abcdef12"}, true},
+	}
+	for _, tt := range tests {
+		prefix := "TICKET"
+		if tt.want.Prefix == "HELP-DESK" {
+			prefix = "help-desk"
+		}
+		got, ok := Parse(tt.subject, prefix)
+		if ok != tt.ok || got != tt.want {
+			t.Errorf("Parse(%q) = %+v, %v, want %+v, %v", tt.subject, got, ok, tt.want, tt.ok)
+		}
+	}
+
+	ref, ok := Parse(signed, "HELP-DESK")
+	if !ok || !ref.Valid("s3cret") {
+		t.Errorf("signed tag %q not valid: %+v", signed, ref)
+	}
+	if ref.Valid("other") {
+		t.Error("token must not be valid under another secret")
+	}
+	if unsigned, _ := Parse("[HELP-DESK-#42]", "HELP-DESK"); unsigned.Valid("s3cret") || !unsigned.Valid("") {
+		t.Error("unsigned tag is only valid without a secret")
+	}
+	if forged, _ := Parse("[HELP-DESK-#43-"+ref.Token+"]", "HELP-DESK"); forged.Valid("s3cret") {
+		t.Error("token of another ticket must not be valid")
+	}
+}
+
+func TestParseMessageID(t *testing.T) {
+	token := Token("s3cret", "HELP-DESK", 42)
+	tests := []struct {
+		id   string
+		want Ref
+		ok   bool
+	}{
+		{"help-desk-42.new.0@example.com", Ref{Prefix: "HELP-DESK", ID: 42}, true},
+		{"<help-desk-42-" + token + ".reply.317@example.com>", Ref{Prefix: "HELP-DESK", ID: 42, Token: token}, true},
+		{"help-desk-42.new.0", Ref{}, false},
+		{"other-42.new.0@example.com", Ref{}, false},
+		{"CAF=abc123@mail.gmail.com", Ref{}, false},
+	}
+	for _, tt := range tests {
+		got, ok := ParseMessageID(tt.id, "HELP-DESK")
+		if ok != tt.ok || got != tt.want {
+			t.Errorf("ParseMessageID(%q) = %+v, %v, want %+v, %v", tt.id, got, ok, tt.want, tt.ok)
+		}
+	}
+	if signed, _ := ParseMessageID("help-desk-42-"+token+".new.0@example.com", "HELP-DESK"); !signed.Valid("s3cret") {
+		t.Error("signed Message-ID should be valid")
+	}
+	if unsigned, _ := ParseMessageID("help-desk-42.new.0@example.com", "HELP-DESK"); unsigned.Valid("s3cret") {
+		t.Error("unsigned Message-ID must not be valid with a secret")
+	}
+}